@@ -1,14 +1,14 @@
 package apis
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 
 	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/llm"
 	"github.com/jimyeongjung/owlverload_api/models"
 )
 
@@ -18,39 +18,7 @@ type BarcodeAnalyzeRequest struct {
 	ProductName string `json:"product_name"` // Product name
 }
 
-// OpenAIChatRequest defines the request structure for OpenAI API
-type OpenAIChatRequest struct {
-	Model    string              `json:"model"`
-	Messages []OpenAIChatMessage `json:"messages"`
-}
-
-type OpenAIChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-// OpenAIChatResponse defines the response structure from OpenAI API
-type OpenAIChatResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Usage   struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
-	Choices []struct {
-		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
-		} `json:"message"`
-		FinishReason string `json:"finish_reason"`
-		Index        int    `json:"index"`
-	} `json:"choices"`
-}
-
-// ProductAnalysisResult defines the structured analysis result from OpenAI
+// ProductAnalysisResult defines the structured analysis result from the LLM
 type ProductAnalysisResult struct {
 	Name struct {
 		English  string `json:"english"`
@@ -58,14 +26,17 @@ type ProductAnalysisResult struct {
 		Japanese string `json:"japanese"`
 		Chinese  string `json:"chinese"`
 	} `json:"name"`
-	ExpiryDate            string `json:"expiry_date"`
-	IngredientsTranslated string `json:"ingredients_translated"`
-	ContainsAlcohol       string `json:"contains_alcohol"`
-	HalalStatus           string `json:"halal_status"`
-	ContainsPork          string `json:"contains_pork"`
-	ContainsBeef          string `json:"contains_beef"`
-	IsPlantBased          string `json:"is_plant_based"`
-	Reasoning             string `json:"reasoning"`
+	ExpiryDate            string   `json:"expiry_date"`
+	Ingredients           string   `json:"ingredients,omitempty"`
+	IngredientsTranslated string   `json:"ingredients_translated"`
+	Allergens             []string `json:"allergens,omitempty"`
+	ContainsAlcohol       string   `json:"contains_alcohol"`
+	HalalStatus           string   `json:"halal_status"`
+	ContainsPork          string   `json:"contains_pork"`
+	ContainsBeef          string   `json:"contains_beef"`
+	IsPlantBased          string   `json:"is_plant_based"`
+	Reasoning             string   `json:"reasoning"`
+	Model                 string   `json:"-"` // the model that answered, as reported by the provider
 }
 
 // HandleBarcodeAnalyze handles the request to analyze a barcode
@@ -86,7 +57,7 @@ func HandleBarcodeAnalyze(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("---Reading request body---")
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		fmt.Println("---Failed to read request body: %v---", err)
+		fmt.Printf("---Failed to read request body: %v---\n", err)
 		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
 		return
 	}
@@ -95,7 +66,7 @@ func HandleBarcodeAnalyze(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("---Unmarshaling request JSON---")
 	err = json.Unmarshal(body, &request)
 	if err != nil {
-		fmt.Println("---Invalid request format: %v---", err)
+		fmt.Printf("---Invalid request format: %v---\n", err)
 		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
 		return
 	}
@@ -109,11 +80,18 @@ func HandleBarcodeAnalyze(w http.ResponseWriter, r *http.Request) {
 	}
 	fmt.Println("request.ProductName", request.ProductName)
 
-	// Prepare OpenAI request
-	fmt.Println("---Preparing OpenAI request---")
-	openAIRequest := OpenAIChatRequest{
-		Model: "gpt-4o",
-		Messages: []OpenAIChatMessage{
+	provider, err := meteredProviderFromEnv(tokenClaims, llmFeatureBarcodeAnalyze)
+	if err != nil {
+		fmt.Println("---LLM provider not configured on server---", err)
+		models.WriteServiceError(w, "Server configuration error", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	// Ask the model about the barcode
+	fmt.Println("---Making request to LLM provider---")
+	chatResponse, err := provider.Chat(r.Context(), llm.ChatRequest{
+		Model: llm.DefaultModel(),
+		Messages: []llm.Message{
 			{
 				Role:    "system",
 				Content: "You are a product analysis assistant. For the given barcode, provide information about the product in JSON format. If you don't know about a specific barcode, provide a response indicating that the product information is not available.",
@@ -141,86 +119,18 @@ func HandleBarcodeAnalyze(w http.ResponseWriter, r *http.Request) {
 				Do not include any other text in your response.`, request.ProductName, request.Barcode),
 			},
 		},
-	}
-
-	// Convert request to JSON
-	openAIRequestJSON, err := json.Marshal(openAIRequest)
+	})
 	if err != nil {
-		fmt.Println("---Failed to marshal OpenAI request: %v---", err)
-		models.WriteServiceError(w, "Failed to prepare API request", false, true, http.StatusInternalServerError)
+		fmt.Println("---Barcode analysis request failed---", err)
+		writeAnalysisError(w, err)
 		return
 	}
 
-	// Get OpenAI API key from environment variable
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		fmt.Println("---OpenAI API key not configured on server---")
-		models.WriteServiceError(w, "Server configuration error", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Make request to OpenAI API
-	fmt.Println("---Making request to OpenAI API---")
-	client := &http.Client{}
-	openAIReq, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(openAIRequestJSON))
-	if err != nil {
-		fmt.Println("---Failed to create OpenAI request: %v---", err)
-		models.WriteServiceError(w, "Failed to create API request", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	openAIReq.Header.Set("Content-Type", "application/json")
-	openAIReq.Header.Set("Authorization", "Bearer "+apiKey)
-
-	response, err := client.Do(openAIReq)
-	if err != nil {
-		fmt.Println("---Failed to send request to OpenAI: %v---", err)
-		models.WriteServiceError(w, "Failed to connect to OpenAI API", false, true, http.StatusServiceUnavailable)
-		return
-	}
-	defer response.Body.Close()
-
-	// Read OpenAI response
-	fmt.Println("---Reading OpenAI API response---")
-	responseBody, err := io.ReadAll(response.Body)
-	if err != nil {
-		fmt.Println("---Failed to read OpenAI response: %v---", err)
-		models.WriteServiceError(w, "Failed to read API response", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Check for non-200 response
-	if response.StatusCode != http.StatusOK {
-		fmt.Println("---OpenAI API returned non-200 status code: %d, response: %s---", response.StatusCode, string(responseBody))
-		models.WriteServiceError(w, fmt.Sprintf("OpenAI API error: %s", string(responseBody)), false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Parse OpenAI response
-	fmt.Println("---Parsing OpenAI API response---")
-	var openAIResponse OpenAIChatResponse
-	err = json.Unmarshal(responseBody, &openAIResponse)
-	if err != nil {
-		fmt.Println("---Failed to parse OpenAI response: %v---", err)
-		models.WriteServiceError(w, "Failed to parse API response", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Extract the analysis content
-	if len(openAIResponse.Choices) == 0 {
-		fmt.Println("---No content in OpenAI response---")
-		models.WriteServiceError(w, "No content returned from analysis", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	analysisContent := openAIResponse.Choices[0].Message.Content
-
 	// Parse the JSON response from GPT
 	fmt.Println("---Parsing analysis content into structured format---")
-	var analysisResult ProductAnalysisResult
-	err = json.Unmarshal([]byte(analysisContent), &analysisResult)
+	analysisResult, err := parseProductAnalysis(chatResponse.Content)
 	if err != nil {
-		fmt.Println("---Failed to parse analysis content as JSON: %v---", err)
+		fmt.Println("---Failed to parse analysis content as JSON---", err)
 		models.WriteServiceError(w, "Failed to parse analysis content", false, true, http.StatusInternalServerError)
 		return
 	}
@@ -278,3 +188,49 @@ func HandleBarcodeAnalyze(w http.ResponseWriter, r *http.Request) {
 }
 
 // "The product information for barcode 8801043060554 is not available in the current database. Without specific details about the product, uncertainty exists regarding its ingredients and dietary status."
+
+const productTextPrompt = `Analyze the product named %s with barcode: %s. Return the information in this exact JSON format:
+
+{
+"name": {
+	"english": "",
+	"korean": "",
+	"japanese": "",
+	"chinese": ""
+},
+"ingredients_translated": "",
+"allergens": [],
+"contains_alcohol": "Yes" or "No" or "Unclear",
+"contains_pork": "Yes" or "No" or "Unclear",
+"contains_beef": "Yes" or "No" or "Unclear",
+"is_plant_based": "Yes" or "No" or "Unclear",
+"halal_status": "Halal" or "Not Halal" or "Unclear",
+"reasoning": ""
+}
+If you don't know this product, provide best guesses and indicate uncertainty in the reasoning field.
+Do not include any other text in your response.`
+
+// analyzeProductText asks the text model about a product from its name and barcode
+func analyzeProductText(ctx context.Context, provider llm.Provider, productName string, barcode string) (ProductAnalysisResult, llm.Usage, error) {
+	resp, err := provider.Chat(ctx, llm.ChatRequest{
+		Model:    llm.DefaultModel(),
+		JSONMode: true,
+		Messages: []llm.Message{
+			{
+				Role:    "system",
+				Content: "You are a product analysis assistant. For the given product, provide information about the product in JSON format. If you don't know about a specific product, provide a response indicating that the product information is not available.",
+			},
+			{
+				Role:    "user",
+				Content: fmt.Sprintf(productTextPrompt, productName, barcode),
+			},
+		},
+	})
+	if err != nil {
+		return ProductAnalysisResult{}, resp.Usage, err
+	}
+
+	result, err := parseProductAnalysis(resp.Content)
+	result.Model = resp.Model
+	return result, resp.Usage, err
+}
@@ -0,0 +1,118 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// CreateAPIKeyRequest defines the request body for issuing a device or script API key
+type CreateAPIKeyRequest struct {
+	Name          string `json:"name"`
+	StoreID       string `json:"store_id"`
+	Role          string `json:"role"`            // staff, supervisor or manager
+	ExpiresInDays int    `json:"expires_in_days"` // 0 for a key that does not expire
+}
+
+// HandleCreateAPIKey handles POST requests that issue an API key. The key is only returned here.
+func HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleCreateAPIKey---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.APIKeyID != 0 {
+		models.WriteServiceError(w, "API keys cannot issue other API keys", false, true, http.StatusForbidden)
+		return
+	}
+
+	var request CreateAPIKeyRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	request.Role = strings.ToLower(strings.TrimSpace(request.Role))
+	if request.Name == "" || request.StoreID == "" {
+		models.WriteServiceError(w, "name and store_id are required", false, true, http.StatusBadRequest)
+		return
+	}
+	if !models.IsRole(request.Role) || models.RoleLevel(request.Role) > models.RoleLevel(models.MaxAPIKeyRole) {
+		models.WriteServiceError(w, "role must be staff, supervisor or manager", false, true, http.StatusBadRequest)
+		return
+	}
+	if request.ExpiresInDays < 0 {
+		models.WriteServiceError(w, "expires_in_days cannot be negative", false, true, http.StatusBadRequest)
+		return
+	}
+	if store, err := models.GetStore(request.StoreID); err != nil || !store.Active {
+		models.WriteServiceError(w, "Unknown or inactive store: "+request.StoreID, false, true, http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt *time.Time
+	if request.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		expiresAt = &expiry
+	}
+
+	key, plaintext, err := models.CreateAPIKey(request.Name, request.StoreID, request.Role, expiresAt, tokenClaims.Email)
+	if err != nil {
+		log.Printf("Error creating API key %s: %v", request.Name, err)
+		models.WriteServiceError(w, "Failed to create API key", false, true, http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"api_key": key,
+		"key":     plaintext,
+		"header":  middleware.APIKeyHeader,
+	}
+	models.WriteServiceResponse(w, "API key created. Store the key now, it cannot be shown again", response, true, true, http.StatusCreated)
+}
+
+// HandleGetAPIKeys handles GET requests listing API keys with their last use
+func HandleGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := models.GetAPIKeys()
+	if err != nil {
+		log.Printf("Error listing API keys: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve API keys", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "API keys retrieved successfully", keys, true, true, http.StatusOK)
+}
+
+// HandleRevokeAPIKey handles DELETE requests that revoke an API key
+func HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleRevokeAPIKey---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	keyID, err := strconv.ParseInt(mux.Vars(r)["keyId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid API key ID", false, true, http.StatusBadRequest)
+		return
+	}
+
+	err = models.RevokeAPIKey(keyID, tokenClaims.Email)
+	if errors.Is(err, models.ErrAPIKeyNotFound) {
+		models.WriteServiceError(w, "API key not found or already revoked", false, true, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error revoking API key %d: %v", keyID, err)
+		models.WriteServiceError(w, "Failed to revoke API key", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "API key revoked successfully", nil, true, true, http.StatusOK)
+}
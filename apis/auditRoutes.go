@@ -0,0 +1,84 @@
+package apis
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// HandleGetAuditLog handles GET requests listing audit entries, newest first.
+// Query: entity_type, entity_id, user (email or uid), from and to (RFC 3339 or YYYY-MM-DD),
+// before_id for paging, limit (default 100)
+func HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		EntityType: query.Get("entity_type"),
+		EntityID:   query.Get("entity_id"),
+		Actor:      query.Get("user"),
+		Limit:      100,
+	}
+	var ok bool
+	if filter.From, ok = parseAuditTime(w, "from", query.Get("from")); !ok {
+		return
+	}
+	if filter.To, ok = parseAuditTime(w, "to", query.Get("to")); !ok {
+		return
+	}
+	if v, err := strconv.ParseInt(query.Get("before_id"), 10, 64); err == nil && v > 0 {
+		filter.BeforeID = v
+	}
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 && v <= 1000 {
+		filter.Limit = v
+	}
+
+	entries, err := models.GetAuditEntries(filter)
+	if err != nil {
+		log.Printf("Error listing audit log: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve audit log", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Audit log retrieved successfully", entries, true, true, http.StatusOK)
+}
+
+// HandleVerifyAuditLog handles GET requests that check the audit hash chain.
+// Query: from_id (default 1), limit (default 10000)
+func HandleVerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	fromID := int64(1)
+	if v, err := strconv.ParseInt(r.URL.Query().Get("from_id"), 10, 64); err == nil && v > 0 {
+		fromID = v
+	}
+	limit := 10000
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 100000 {
+		limit = v
+	}
+
+	result, err := models.VerifyAuditChain(fromID, limit)
+	if err != nil {
+		log.Printf("Error verifying audit log: %v", err)
+		models.WriteServiceError(w, "Failed to verify audit log", false, true, http.StatusInternalServerError)
+		return
+	}
+	message := "Audit log is intact"
+	if !result.Valid {
+		message = "Audit log has been tampered with"
+	}
+	models.WriteServiceResponse(w, message, result, true, true, http.StatusOK)
+}
+
+// parseAuditTime accepts RFC 3339 timestamps and plain dates; it answers 400 for anything else
+func parseAuditTime(w http.ResponseWriter, name string, value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	models.WriteServiceError(w, name+" must be an RFC 3339 time or a YYYY-MM-DD date", false, true, http.StatusBadRequest)
+	return time.Time{}, false
+}
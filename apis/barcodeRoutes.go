@@ -34,7 +34,7 @@ func HandleSaveBarcode(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("---Reading request body---")
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		fmt.Println("---Failed to read request body: %v---", err)
+		fmt.Printf("---Failed to read request body: %v---\n", err)
 		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
 		return
 	}
@@ -43,7 +43,7 @@ func HandleSaveBarcode(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("---Unmarshaling request JSON---")
 	err = json.Unmarshal(body, &request)
 	if err != nil {
-		fmt.Println("---Invalid request format: %v---", err)
+		fmt.Printf("---Invalid request format: %v---\n", err)
 		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
 		return
 	}
@@ -61,7 +61,7 @@ func HandleSaveBarcode(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("---Saving barcode---")
 	barcode, err := models.SaveBarcode(request.Barcode, userEmail)
 	if err != nil {
-		fmt.Println("---Error saving barcode: %v---", err)
+		fmt.Printf("---Error saving barcode: %v---\n", err)
 		models.WriteServiceError(w, err.Error(), false, true, http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,315 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/llm"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+const (
+	defaultEnrichmentLimit       = 100
+	maxEnrichmentLimit           = 1000
+	defaultEnrichmentConcurrency = 2
+	maxEnrichmentConcurrency     = 8
+	defaultEnrichmentBudget      = 200_000 // tokens
+	enrichmentItemTimeout        = 2 * time.Minute
+)
+
+// StartEnrichmentJobRequest defines the options for a batch enrichment run
+type StartEnrichmentJobRequest struct {
+	Limit        int `json:"limit"`         // max items to analyze
+	Concurrency  int `json:"concurrency"`   // parallel analyzer calls
+	BudgetTokens int `json:"budget_tokens"` // stop dispatching once this many tokens are spent
+}
+
+// HandleStartEnrichmentJob handles POST requests to start a background enrichment job.
+// Results go to the AI suggestion queue, never straight onto items.
+func HandleStartEnrichmentJob(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleStartEnrichmentJob---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	var request StartEnrichmentJobRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if request.Limit <= 0 {
+		request.Limit = defaultEnrichmentLimit
+	}
+	if request.Limit > maxEnrichmentLimit {
+		request.Limit = maxEnrichmentLimit
+	}
+	if request.Concurrency <= 0 {
+		request.Concurrency = defaultEnrichmentConcurrency
+	}
+	if request.Concurrency > maxEnrichmentConcurrency {
+		request.Concurrency = maxEnrichmentConcurrency
+	}
+	if request.BudgetTokens <= 0 {
+		request.BudgetTokens = defaultEnrichmentBudget
+	}
+
+	provider, err := llm.NewProviderFromEnv()
+	if err != nil {
+		log.Printf("LLM provider unavailable: %v", err)
+		models.WriteServiceError(w, "Server configuration error", false, true, http.StatusInternalServerError)
+		return
+	}
+	// The job spends tokens on behalf of the admin who started it
+	meter := newUsageMeter(tokenClaims, llmFeatureEnrichment)
+	if err := meter.Allow(r.Context()); err != nil {
+		writeAnalysisError(w, err)
+		return
+	}
+	provider = llm.WithMeter(provider, meter)
+
+	candidates, err := models.GetItemsMissingEnrichment(request.Limit)
+	if err != nil {
+		log.Printf("Error loading enrichment candidates: %v", err)
+		models.WriteServiceError(w, "Failed to load items with missing information", false, true, http.StatusInternalServerError)
+		return
+	}
+	if len(candidates) == 0 {
+		models.WriteServiceResponse(w, "No items need enrichment", map[string]interface{}{"total_items": 0}, true, true, http.StatusOK)
+		return
+	}
+
+	job, err := models.CreateEnrichmentJob(models.EnrichmentJob{
+		Concurrency:  request.Concurrency,
+		BudgetTokens: request.BudgetTokens,
+		TotalItems:   len(candidates),
+		StartedBy:    userEmail,
+	})
+	if err != nil {
+		log.Printf("Error creating enrichment job: %v", err)
+		models.WriteServiceError(w, "Failed to create enrichment job", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	go runEnrichmentJob(job, candidates, provider)
+
+	models.WriteServiceResponse(w, "Enrichment job started", job, true, true, http.StatusAccepted)
+}
+
+// HandleGetEnrichmentJobs handles GET requests to list recent enrichment jobs
+func HandleGetEnrichmentJobs(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	jobs, err := models.GetEnrichmentJobs(limit)
+	if err != nil {
+		log.Printf("Error listing enrichment jobs: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve enrichment jobs", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Enrichment jobs retrieved successfully", jobs, true, true, http.StatusOK)
+}
+
+// HandleGetEnrichmentJob handles GET requests for one job's progress, failures and token spend
+func HandleGetEnrichmentJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := strconv.ParseInt(mux.Vars(r)["jobId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid job ID", false, true, http.StatusBadRequest)
+		return
+	}
+
+	job, err := models.GetEnrichmentJob(jobID)
+	if err != nil {
+		models.WriteServiceError(w, "Enrichment job not found", false, true, http.StatusNotFound)
+		return
+	}
+	failures, err := models.GetEnrichmentJobFailures(jobID)
+	if err != nil {
+		log.Printf("Error loading failures for job %d: %v", jobID, err)
+		failures = []models.EnrichmentJobFailure{}
+	}
+
+	response := map[string]interface{}{
+		"job":          job,
+		"failures":     failures,
+		"total_tokens": job.PromptTokens + job.CompletionTokens,
+	}
+	models.WriteServiceResponse(w, "Enrichment job retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// runEnrichmentJob analyzes the candidates with at most job.Concurrency calls in flight
+// and stops dispatching new items once the token budget is spent.
+func runEnrichmentJob(job models.EnrichmentJob, candidates []models.EnrichmentCandidate, provider llm.Provider) {
+	log.Printf("Enrichment job %d started: %d items, concurrency %d, budget %d tokens",
+		job.ID, len(candidates), job.Concurrency, job.BudgetTokens)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, job.Concurrency)
+	budgetExceeded := false
+	quotaExceeded := false
+
+	for _, candidate := range candidates {
+		slots <- struct{}{}
+
+		// Check after taking a slot so tokens spent by the calls we waited on are counted
+		mu.Lock()
+		spent := job.PromptTokens + job.CompletionTokens
+		stop := quotaExceeded
+		mu.Unlock()
+		if stop {
+			<-slots
+			break
+		}
+		if spent >= job.BudgetTokens {
+			<-slots
+			budgetExceeded = true
+			break
+		}
+
+		wg.Add(1)
+		go func(candidate models.EnrichmentCandidate) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			usage, created, err := enrichItem(job, candidate, provider)
+
+			mu.Lock()
+			defer mu.Unlock()
+			job.Processed++
+			job.PromptTokens += usage.PromptTokens
+			job.CompletionTokens += usage.CompletionTokens
+			switch {
+			case err != nil:
+				job.Failed++
+				if errors.Is(err, llm.ErrQuotaExceeded) {
+					quotaExceeded = true
+				}
+				if recErr := models.RecordEnrichmentFailure(job.ID, candidate.Item.ID, err.Error()); recErr != nil {
+					log.Printf("Enrichment job %d: failed to record failure for item %s: %v", job.ID, candidate.Item.ID, recErr)
+				}
+			case created:
+				job.Succeeded++
+			default:
+				job.Skipped++
+			}
+			if saveErr := models.SaveEnrichmentJobProgress(job); saveErr != nil {
+				log.Printf("Enrichment job %d: failed to save progress: %v", job.ID, saveErr)
+			}
+		}(candidate)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	job.Status = models.EnrichmentJobCompleted
+	switch {
+	case quotaExceeded:
+		job.Status = models.EnrichmentJobQuotaExceeded
+		job.Skipped += job.TotalItems - job.Processed
+		job.Error = fmt.Sprintf("LLM usage quota reached after %d items", job.Processed)
+	case budgetExceeded:
+		job.Status = models.EnrichmentJobBudgetExceeded
+		job.Skipped += job.TotalItems - job.Processed
+		job.Error = fmt.Sprintf("token budget of %d reached after %d items", job.BudgetTokens, job.Processed)
+	}
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	if err := models.SaveEnrichmentJobProgress(job); err != nil {
+		log.Printf("Enrichment job %d: failed to save final state: %v", job.ID, err)
+	}
+	log.Printf("Enrichment job %d finished with status %s: %d succeeded, %d failed, %d skipped, %d tokens",
+		job.ID, job.Status, job.Succeeded, job.Failed, job.Skipped, job.PromptTokens+job.CompletionTokens)
+}
+
+// enrichItem runs one item through the analyzer and queues the useful answers for review.
+// It reports created=false when the model had nothing to add for the missing fields.
+func enrichItem(job models.EnrichmentJob, candidate models.EnrichmentCandidate, provider llm.Provider) (llm.Usage, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), enrichmentItemTimeout)
+	defer cancel()
+
+	item := candidate.Item
+	analysis, usage, err := analyzeProductText(ctx, provider, item.Name, item.BarCode)
+	if err != nil {
+		return usage, false, err
+	}
+
+	changes := enrichmentChanges(candidate.MissingFields, analysis)
+	if len(changes) == 0 {
+		return usage, false, nil
+	}
+
+	model := analysis.Model
+	if model == "" {
+		model = llm.DefaultModel()
+	}
+	_, err = models.CreateAISuggestion(models.AISuggestion{
+		ItemID:    item.ID,
+		JobID:     job.ID,
+		Source:    "enrichment",
+		Model:     model,
+		Changes:   changes,
+		Reasoning: analysis.Reasoning,
+		CreatedBy: job.StartedBy,
+	})
+	return usage, err == nil, err
+}
+
+// enrichmentChanges picks the analyzer answers for the fields the item is missing.
+// "Unclear" dietary answers are dropped rather than guessed.
+func enrichmentChanges(missingFields []string, analysis ProductAnalysisResult) map[string]string {
+	yesNo := func(answer string) string {
+		switch answer {
+		case "Yes":
+			return "true"
+		case "No":
+			return "false"
+		}
+		return ""
+	}
+	halal := ""
+	switch analysis.HalalStatus {
+	case "Halal":
+		halal = "true"
+	case "Not Halal":
+		halal = "false"
+	}
+
+	proposed := map[string]string{
+		"name_eng":          analysis.Name.English,
+		"name_kor":          analysis.Name.Korean,
+		"name_jpn":          analysis.Name.Japanese,
+		"name_chn":          analysis.Name.Chinese,
+		"ingredients":       analysis.IngredientsTranslated,
+		"is_halal":          halal,
+		"is_pork_contained": yesNo(analysis.ContainsPork),
+		"is_beef_contained": yesNo(analysis.ContainsBeef),
+		"is_plant_based":    yesNo(analysis.IsPlantBased),
+	}
+
+	changes := map[string]string{}
+	for _, field := range missingFields {
+		if value := proposed[field]; value != "" {
+			changes[field] = value
+		}
+	}
+	return changes
+}
@@ -0,0 +1,299 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/storage"
+)
+
+const (
+	defaultImageGCGraceHours = 72
+	minImageGCGraceHours     = 1
+)
+
+// StartImageGCRequest defines the options for an image GC scan
+type StartImageGCRequest struct {
+	GraceHours int `json:"grace_hours"` // objects younger than this are never candidates
+}
+
+// HandleStartImageGC handles POST requests that start a dry-run scan of the image bucket.
+// The scan only records candidates; nothing is deleted until the run's delete pass is started.
+func HandleStartImageGC(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleStartImageGC---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	var request StartImageGCRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+			return
+		}
+	}
+	if request.GraceHours == 0 {
+		request.GraceHours = defaultImageGCGraceHours
+	}
+	if request.GraceHours < minImageGCGraceHours {
+		models.WriteServiceError(w, "grace_hours must be at least 1", false, true, http.StatusBadRequest)
+		return
+	}
+
+	blob, err := storage.Default()
+	if err != nil {
+		log.Printf("Storage unavailable for image GC: %v", err)
+		models.WriteServiceError(w, "Storage is not configured", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	run, err := models.CreateImageGCRun(models.ImageGCRun{GraceHours: request.GraceHours, StartedBy: userEmail})
+	if err != nil {
+		log.Printf("Error creating image GC run: %v", err)
+		models.WriteServiceError(w, "Failed to start image GC", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	go runImageGCScan(run, blob)
+
+	models.WriteServiceResponse(w, "Image GC scan started", run, true, true, http.StatusAccepted)
+}
+
+// HandleGetImageGCRuns handles GET requests to list recent image GC runs
+func HandleGetImageGCRuns(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	runs, err := models.GetImageGCRuns(limit)
+	if err != nil {
+		log.Printf("Error listing image GC runs: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve image GC runs", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Image GC runs retrieved successfully", runs, true, true, http.StatusOK)
+}
+
+// HandleGetImageGCRun handles GET requests for a run's report: counters plus the candidate
+// objects, optionally filtered with ?status=pending|deleted|skipped
+func HandleGetImageGCRun(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.ParseInt(mux.Vars(r)["runId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid run ID", false, true, http.StatusBadRequest)
+		return
+	}
+
+	run, err := models.GetImageGCRun(runID)
+	if err != nil {
+		models.WriteServiceError(w, "Image GC run not found", false, true, http.StatusNotFound)
+		return
+	}
+	candidates, err := models.GetImageGCCandidates(runID, r.URL.Query().Get("status"))
+	if err != nil {
+		log.Printf("Error loading candidates of image GC run %d: %v", runID, err)
+		models.WriteServiceError(w, "Failed to retrieve image GC candidates", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"run":        run,
+		"candidates": candidates,
+	}
+	models.WriteServiceResponse(w, "Image GC run retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// HandleDeleteImageGCRun handles POST requests that start the delete pass of a scanned run.
+// Every candidate is re-checked against the reference registry before it is deleted.
+func HandleDeleteImageGCRun(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleDeleteImageGCRun---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	runID, err := strconv.ParseInt(mux.Vars(r)["runId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid run ID", false, true, http.StatusBadRequest)
+		return
+	}
+	if _, err := models.GetImageGCRun(runID); err != nil {
+		models.WriteServiceError(w, "Image GC run not found", false, true, http.StatusNotFound)
+		return
+	}
+
+	blob, err := storage.Default()
+	if err != nil {
+		log.Printf("Storage unavailable for image GC: %v", err)
+		models.WriteServiceError(w, "Storage is not configured", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	run, err := models.StartImageGCDeletion(runID, userEmail)
+	if err != nil {
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusConflict)
+		return
+	}
+
+	go runImageGCDelete(run, blob)
+
+	models.WriteServiceResponse(w, "Image GC delete pass started", run, true, true, http.StatusAccepted)
+}
+
+// runImageGCScan lists the image objects and records every image id that no registered
+// source references and whose objects are all older than the grace period
+func runImageGCScan(run models.ImageGCRun, blob storage.Blob) {
+	ctx := context.Background()
+	fail := func(err error) {
+		log.Printf("Image GC run %d failed: %v", run.ID, err)
+		now := time.Now()
+		run.Status = models.ImageGCRunFailed
+		run.Error = err.Error()
+		run.ScannedAt = &now
+		if err := models.SaveImageGCRunProgress(run); err != nil {
+			log.Printf("Error saving image GC run %d: %v", run.ID, err)
+		}
+	}
+
+	// List before loading references so an image attached mid-scan is seen as referenced
+	objects, err := blob.List(ctx, imageKey(""))
+	if err != nil {
+		fail(err)
+		return
+	}
+	references, err := models.GetReferencedImageIDs()
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	cutoff := time.Now().Add(-time.Duration(run.GraceHours) * time.Hour)
+	groups := map[string][]storage.Object{}
+	recent := map[string]bool{}
+	for _, obj := range objects {
+		imageID := models.ImageIDFromPath(obj.Key)
+		if imageID == "" {
+			continue // not produced by the upload pipeline
+		}
+		groups[imageID] = append(groups[imageID], obj)
+		if obj.LastModified.After(cutoff) {
+			recent[imageID] = true
+		}
+	}
+
+	candidates := []models.ImageGCCandidate{}
+	for imageID, group := range groups {
+		if len(references[imageID]) > 0 || recent[imageID] {
+			continue
+		}
+		for _, obj := range group {
+			candidates = append(candidates, models.ImageGCCandidate{
+				ImageID:      imageID,
+				StorageKey:   obj.Key,
+				Size:         obj.Size,
+				LastModified: obj.LastModified,
+			})
+			run.CandidateBytes += obj.Size
+		}
+	}
+	if err := models.SaveImageGCCandidates(run.ID, candidates); err != nil {
+		fail(err)
+		return
+	}
+
+	now := time.Now()
+	run.Status = models.ImageGCRunScanned
+	run.ScannedObjects = len(objects)
+	run.Candidates = len(candidates)
+	run.ScannedAt = &now
+	if err := models.SaveImageGCRunProgress(run); err != nil {
+		log.Printf("Error saving image GC run %d: %v", run.ID, err)
+	}
+	log.Printf("Image GC run %d scanned %d objects, %d candidates (%d bytes)", run.ID, run.ScannedObjects, run.Candidates, run.CandidateBytes)
+}
+
+// runImageGCDelete deletes the pending candidates of a run, skipping any image that
+// gained a reference since the scan
+func runImageGCDelete(run models.ImageGCRun, blob storage.Blob) {
+	ctx := context.Background()
+	candidates, err := models.GetImageGCCandidates(run.ID, models.ImageGCCandidatePending)
+	if err != nil {
+		log.Printf("Image GC run %d failed: %v", run.ID, err)
+		run.Status = models.ImageGCRunFailed
+		run.Error = err.Error()
+		if err := models.SaveImageGCRunProgress(run); err != nil {
+			log.Printf("Error saving image GC run %d: %v", run.ID, err)
+		}
+		return
+	}
+
+	referencedBy := map[string][]string{}
+	checked := map[string]bool{}
+	deletedAll := map[string]bool{}
+	for _, candidate := range candidates {
+		if !checked[candidate.ImageID] {
+			checked[candidate.ImageID] = true
+			deletedAll[candidate.ImageID] = true
+			sources, err := models.GetImageReferences(candidate.ImageID)
+			if err != nil {
+				// Unknown is treated as referenced
+				sources = []string{"unknown: " + err.Error()}
+			}
+			referencedBy[candidate.ImageID] = sources
+		}
+
+		status, reason := models.ImageGCCandidateDeleted, ""
+		if sources := referencedBy[candidate.ImageID]; len(sources) > 0 {
+			status, reason = models.ImageGCCandidateSkipped, "referenced by "+strings.Join(sources, ", ")
+		} else if err := blob.Delete(ctx, candidate.StorageKey); err != nil {
+			status, reason = models.ImageGCCandidateSkipped, err.Error()
+		}
+
+		if status == models.ImageGCCandidateDeleted {
+			run.Deleted++
+			run.DeletedBytes += candidate.Size
+		} else {
+			run.Skipped++
+			deletedAll[candidate.ImageID] = false
+		}
+		if err := models.MarkImageGCCandidate(candidate.ID, status, reason); err != nil {
+			log.Printf("Error updating image GC candidate %d: %v", candidate.ID, err)
+		}
+	}
+
+	for imageID, ok := range deletedAll {
+		if !ok {
+			continue
+		}
+		if err := models.DeleteImageVariants(imageID); err != nil {
+			log.Printf("Error removing variant records of image %s: %v", imageID, err)
+		}
+		if err := models.DeleteImageFingerprint(imageID); err != nil {
+			log.Printf("Error removing fingerprint of image %s: %v", imageID, err)
+		}
+	}
+
+	now := time.Now()
+	run.Status = models.ImageGCRunDeleted
+	run.DeletedAt = &now
+	if err := models.SaveImageGCRunProgress(run); err != nil {
+		log.Printf("Error saving image GC run %d: %v", run.ID, err)
+	}
+	log.Printf("Image GC run %d deleted %d objects (%d bytes), skipped %d", run.ID, run.Deleted, run.DeletedBytes, run.Skipped)
+}
@@ -13,16 +13,17 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/disintegration/imaging"
+	"github.com/gen2brain/webp"
 	"github.com/google/uuid"
 	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/imagehash"
 	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/storage"
 	"golang.org/x/exp/slices"
 )
 
@@ -34,6 +35,11 @@ type ImageUploadResponse struct {
 	Success   bool   `json:"success"`
 	Timestamp string `json:"timestamp"`
 	FileName  string `json:"file_name"`
+	// Variants are the responsive sizes stored under the image ID. They are generated in the
+	// background, so a URL can 404 for a moment after the upload.
+	Variants []ImageVariantResponse `json:"variants"`
+	// Duplicates warns about near-identical photos already attached to other items
+	Duplicates []models.ImageDuplicate `json:"duplicate_warnings,omitempty"`
 }
 
 type ImageDeleteRequest struct {
@@ -68,40 +74,79 @@ func HandleImageUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	fileData, _, uploadErr := readUploadedImage(r)
+	if uploadErr != nil {
+		models.WriteServiceError(w, uploadErr.Message, false, true, uploadErr.Status)
+		return
+	}
+
+	// item_id (optional) is the item the photo is meant for; its own images are not reported as duplicates
+	response, err := storeUploadedImage(fileData, r.FormValue("item_id"), firebase.GetTokenClaimsFromContext(r.Context()).StoreID)
+	if err != nil {
+		log.Printf("Error storing uploaded image: %v", err)
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusInternalServerError)
+		return
+	}
+
+	models.WriteServiceResponse(w, "Image uploaded successfully", response, true, true, http.StatusOK)
+}
+
+// imageUploadError carries the client-facing message and status for a rejected upload
+type imageUploadError struct {
+	Status  int
+	Message string
+}
+
+func (e *imageUploadError) Error() string {
+	return e.Message
+}
+
+// readUploadedImage parses the multipart form and returns the bytes and content type of the "image" field
+func readUploadedImage(r *http.Request) ([]byte, string, *imageUploadError) {
 	// Parse multipart form
 	err := r.ParseMultipartForm(32 << 20) // 32MB max memory
 	if err != nil {
 		log.Printf("Error parsing multipart form: %v", err)
-		models.WriteServiceError(w, "Failed to parse form data", false, true, http.StatusBadRequest)
-		return
+		return nil, "", &imageUploadError{Status: http.StatusBadRequest, Message: "Failed to parse form data"}
 	}
 
 	// Get the uploaded file
 	file, header, err := r.FormFile("image")
 	if err != nil {
 		log.Printf("Error retrieving file from form: %v", err)
-		models.WriteServiceError(w, "No image file provided", false, true, http.StatusBadRequest)
-		return
+		return nil, "", &imageUploadError{Status: http.StatusBadRequest, Message: "No image file provided"}
 	}
 	defer file.Close()
 
 	// Validate file type
 	contentType := header.Header.Get("Content-Type")
 	if !isValidImageType(contentType) {
-		models.WriteServiceError(w, "Invalid image type. Only JPEG, PNG, and WebP are supported", false, true, http.StatusBadRequest)
-		return
+		return nil, "", &imageUploadError{Status: http.StatusBadRequest, Message: "Invalid image type. Only JPEG, PNG, and WebP are supported"}
 	}
 
 	// Read file data
 	fileData, err := io.ReadAll(file)
 	if err != nil {
 		log.Printf("Error reading file data: %v", err)
-		models.WriteServiceError(w, "Failed to read image file", false, true, http.StatusInternalServerError)
-		return
+		return nil, "", &imageUploadError{Status: http.StatusInternalServerError, Message: "Failed to read image file"}
+	}
+
+	return fileData, strings.ToLower(contentType), nil
+}
+
+// storeUploadedImage processes a raw upload and stores it, returning the upload response.
+// The returned error message is safe to show to the client. Near-duplicates of the photo
+// on items other than excludeItemID that are visible in storeID are reported as warnings; they
+// never block the upload.
+func storeUploadedImage(fileData []byte, excludeItemID string, storeID string) (ImageUploadResponse, error) {
+	img, format, err := decodeUploadedImage(fileData)
+	if err != nil {
+		log.Printf("Error processing image: %v", err)
+		return ImageUploadResponse{}, fmt.Errorf("Failed to process image")
 	}
 
 	// Process the image
-	processedData, err := processImage(fileData, ImageProcessingConfig{
+	processedData, err := processDecodedImage(img, format, ImageProcessingConfig{
 		MaxWidth:  600,
 		Quality:   70,
 		Format:    "jpeg",
@@ -109,8 +154,7 @@ func HandleImageUpload(w http.ResponseWriter, r *http.Request) {
 	})
 	if err != nil {
 		log.Printf("Error processing image: %v", err)
-		models.WriteServiceError(w, "Failed to process image", false, true, http.StatusInternalServerError)
-		return
+		return ImageUploadResponse{}, fmt.Errorf("Failed to process image")
 	}
 
 	// Generate UUID for the image
@@ -118,117 +162,181 @@ func HandleImageUpload(w http.ResponseWriter, r *http.Request) {
 
 	// Create filename with UUID
 	filename := fmt.Sprintf("%s.jpg", imageID)
-	fmt.Println("filename@@@@@@@@@@@@@@@@@@@@@", filename)
 
-	// Upload to R2 Cloudflare
-	imagePath, err := uploadToR2(processedData, filename)
+	// Upload to the configured storage backend
+	imagePath, err := uploadImageToStorage(context.Background(), processedData, filename)
 	if err != nil {
-		log.Printf("Error uploading to R2: %v", err)
-		models.WriteServiceError(w, "Failed to upload image to storage", false, true, http.StatusInternalServerError)
-		return
+		log.Printf("Error uploading to storage: %v", err)
+		return ImageUploadResponse{}, fmt.Errorf("Failed to upload image to storage")
 	}
-	// fmt.Println("imageURL@@@@@@@@@@@@@@@@@@@@@", imageURL)
+
+	// Responsive variants are best effort; without them the resolver falls back to the main file
+	variants := generateImageVariantsAsync(imageID, img)
 
 	// Prepare response
 	filename = "/" + filename
-	response := ImageUploadResponse{
-		ImagePath: imagePath,
-		ImageID:   imageID,
-		FileSize:  int64(len(processedData)),
-		Message:   "Image uploaded successfully",
-		Success:   true,
-		Timestamp: time.Now().Format(time.RFC3339),
-		FileName:  filename,
+	return ImageUploadResponse{
+		ImagePath:  imagePath,
+		ImageID:    imageID,
+		FileSize:   int64(len(processedData)),
+		Message:    "Image uploaded successfully",
+		Success:    true,
+		Timestamp:  time.Now().Format(time.RFC3339),
+		FileName:   filename,
+		Variants:   variants,
+		Duplicates: fingerprintUploadedImage(imageID, img, excludeItemID, storeID),
+	}, nil
+}
+
+// defaultDuplicateMaxDistance is how many of the 64 dHash bits may differ for two photos
+// to count as near-duplicates; override with IMAGE_DUPLICATE_MAX_DISTANCE
+const defaultDuplicateMaxDistance = 8
+
+// fingerprintUploadedImage stores the fingerprints of an upload and returns the item
+// images that look the same. Failures are logged and yield no warnings.
+func fingerprintUploadedImage(imageID string, img image.Image, excludeItemID string, storeID string) []models.ImageDuplicate {
+	fingerprint := imagehash.Compute(img)
+	hash := fingerprint.DHash
+	if err := models.SaveImageFingerprint(imageID, hash, fingerprint.Histogram); err != nil {
+		log.Printf("Error saving fingerprint of image %s: %v", imageID, err)
 	}
 
-	models.WriteServiceResponse(w, "Image uploaded successfully", response, true, true, http.StatusOK)
+	maxDistance := defaultDuplicateMaxDistance
+	if v, err := strconv.Atoi(os.Getenv("IMAGE_DUPLICATE_MAX_DISTANCE")); err == nil && v >= 0 && v <= 64 {
+		maxDistance = v
+	}
+	duplicates, err := models.FindNearDuplicateItemImages(hash, maxDistance, imageID, excludeItemID, storeID, 5)
+	if err != nil {
+		log.Printf("Error looking up duplicates of image %s: %v", imageID, err)
+		return nil
+	}
+	if len(duplicates) > 0 {
+		log.Printf("Image %s looks like %d existing item image(s), closest on item %s", imageID, len(duplicates), duplicates[0].ItemID)
+	}
+	return duplicates
+}
+
+// decodeUploadedImage decodes an upload and applies its EXIF orientation, so phone photos
+// come out upright before the metadata is dropped by re-encoding
+func decodeUploadedImage(imageData []byte) (image.Image, string, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	img, err := imaging.Decode(bytes.NewReader(imageData), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	return img, format, nil
 }
 
 // processImage processes the image according to specifications
 func processImage(imageData []byte, config ImageProcessingConfig) ([]byte, error) {
-	// Decode image from bytes
-	reader := bytes.NewReader(imageData)
-	img, format, err := image.Decode(reader)
+	img, format, err := decodeUploadedImage(imageData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode image: %v", err)
+		return nil, err
 	}
+	return processDecodedImage(img, format, config)
+}
 
+// processDecodedImage resizes and encodes an already decoded image
+func processDecodedImage(img image.Image, format string, config ImageProcessingConfig) ([]byte, error) {
 	// Get original dimensions
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
 
-	// Resize if necessary, maintaining aspect ratio
-	var resizedImg image.Image = img
-	if width > config.MaxWidth {
-		newHeight := int(float64(height) * float64(config.MaxWidth) / float64(width))
-		resizedImg = imaging.Resize(img, config.MaxWidth, newHeight, imaging.Lanczos)
-	}
-
-	// Convert to JPEG and encode with specified quality
-	var buf bytes.Buffer
-	opts := &jpeg.Options{Quality: config.Quality}
+	resizedImg := resizeToWidth(img, config.MaxWidth)
 
-	err = jpeg.Encode(&buf, resizedImg, opts)
+	data, err := encodeImage(resizedImg, config.Format, config.Quality)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode processed image: %v", err)
 	}
 
-	log.Printf("Image processed: %s -> JPEG, original: %dx%d, final: %dx%d",
-		format, width, height, resizedImg.Bounds().Dx(), resizedImg.Bounds().Dy())
+	log.Printf("Image processed: %s -> %s, original: %dx%d, final: %dx%d",
+		format, config.Format, width, height, resizedImg.Bounds().Dx(), resizedImg.Bounds().Dy())
 
-	return buf.Bytes(), nil
+	return data, nil
 }
 
-// uploadToR2 uploads the processed image to Cloudflare R2
-func uploadToR2(imageData []byte, filename string) (string, error) {
-	// Get R2 configuration from environment variables
-	r2AccessKey := os.Getenv("R2_ACCESS_KEY_ID")
-	r2SecretKey := os.Getenv("R2_SECRET_ACCESS_KEY")
-	r2Endpoint := os.Getenv("R2_ENDPOINT")
-	r2BucketName := os.Getenv("R2_BUCKET_NAME")
-	r2PublicDomain := os.Getenv("R2_PUBLIC_DOMAIN")
-
-	if r2AccessKey == "" || r2SecretKey == "" || r2Endpoint == "" || r2BucketName == "" {
-		return "", fmt.Errorf("R2 configuration missing. Please set R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY, R2_ENDPOINT, and R2_BUCKET_NAME environment variables")
+// resizeToWidth scales img down to maxWidth, maintaining aspect ratio. Narrower images are returned as is.
+func resizeToWidth(img image.Image, maxWidth int) image.Image {
+	width := img.Bounds().Dx()
+	if width <= maxWidth {
+		return img
 	}
+	newHeight := int(float64(img.Bounds().Dy()) * float64(maxWidth) / float64(width))
+	return imaging.Resize(img, maxWidth, newHeight, imaging.Lanczos)
+}
 
-	// Create custom AWS config for R2
-	r2Config := aws.Config{
-		Credentials: credentials.NewStaticCredentialsProvider(r2AccessKey, r2SecretKey, ""),
-		Region:      "auto",
+// encodeImage encodes img as JPEG or lossy WebP at the given quality
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "", models.ImageFormatJPEG:
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+	case models.ImageFormatWebP:
+		if err := webp.Encode(&buf, img, webp.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported image format %q", format)
 	}
+	return buf.Bytes(), nil
+}
 
-	// Create S3 client for R2 with custom endpoint
-	s3Client := s3.NewFromConfig(r2Config, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(r2Endpoint)
-		o.UsePathStyle = true
-	})
+// imageKey maps an image filename onto its storage key. Uploads and deletes both go
+// through here so they always agree on where an image lives.
+func imageKey(filename string) string {
+	return os.Getenv("STORAGE_IMAGE_PREFIX") + strings.TrimPrefix(filename, "/")
+}
 
-	// Create the put object input
-	putObjectInput := &s3.PutObjectInput{
-		Bucket:        aws.String(r2BucketName),
-		Key:           aws.String(filename),
-		Body:          bytes.NewReader(imageData),
-		ContentType:   aws.String("image/jpeg"),
-		ContentLength: aws.Int64(int64(len(imageData))),
+// uploadImageToStorage stores a processed image and returns its public URL
+func uploadImageToStorage(ctx context.Context, imageData []byte, filename string) (string, error) {
+	blob, err := storage.Default()
+	if err != nil {
+		return "", err
+	}
+	key := imageKey(filename)
+	contentType := "image/jpeg"
+	if strings.HasSuffix(filename, ".webp") {
+		contentType = "image/webp"
 	}
+	if err := blob.Put(ctx, key, imageData, contentType); err != nil {
+		return "", err
+	}
+	return blob.URL(key), nil
+}
 
-	// Upload the file
-	_, err := s3Client.PutObject(context.TODO(), putObjectInput)
+// deleteImageFromStorage removes an image by filename, together with its responsive variants
+func deleteImageFromStorage(ctx context.Context, filename string) error {
+	blob, err := storage.Default()
 	if err != nil {
-		return "", fmt.Errorf("failed to upload to R2: %v", err)
+		return err
 	}
-
-	// Construct public URL
-	var imageURL string
-	if r2PublicDomain != "" {
-		imageURL = fmt.Sprintf("https://%s/%s", r2PublicDomain, filename)
-	} else {
-		imageURL = fmt.Sprintf("%s/%s/%s", r2Endpoint, r2BucketName, filename)
+	if err := blob.Delete(ctx, imageKey(filename)); err != nil {
+		return err
 	}
-
-	return imageURL, nil
+	if imageID := models.ImageIDFromPath(filename); imageID != "" {
+		variants, err := models.GetImageVariants(imageID)
+		if err != nil {
+			return err
+		}
+		for _, v := range variants {
+			if err := blob.Delete(ctx, v.StorageKey); err != nil {
+				return err
+			}
+		}
+		if err := models.DeleteImageVariants(imageID); err != nil {
+			return err
+		}
+		if err := models.DeleteImageFingerprint(imageID); err != nil {
+			return err
+		}
+	}
+	log.Printf("Successfully deleted image: %s", filename)
+	return nil
 }
 
 // isValidImageType checks if the content type is a supported image format
@@ -243,7 +351,7 @@ func isValidImageType(contentType string) bool {
 	return slices.Contains(validTypes, strings.ToLower(contentType))
 }
 
-// HandleImageUploadURL handles DELETE requests to remove images from R2 storage
+// HandleImageDelete handles DELETE requests to remove images from storage
 func HandleImageDelete(w http.ResponseWriter, r *http.Request) {
 	// Get authenticated user ID from context
 	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
@@ -273,10 +381,26 @@ func HandleImageDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete from R2 Cloudflare
-	err = deleteFromR2(filename)
+	// Refuse to delete an image an item (or any other registered source) still uses
+	reference := models.ImageIDFromPath(filename)
+	if reference == "" {
+		reference = filename
+	}
+	sources, err := models.GetImageReferences(reference)
+	if err != nil {
+		log.Printf("Error checking references of image %s: %v", filename, err)
+		models.WriteServiceError(w, "Failed to check image references", false, true, http.StatusInternalServerError)
+		return
+	}
+	if len(sources) > 0 {
+		models.WriteServiceError(w, "Image is still referenced by "+strings.Join(sources, ", "), false, true, http.StatusConflict)
+		return
+	}
+
+	// Delete from the configured storage backend
+	err = deleteImageFromStorage(r.Context(), filename)
 	if err != nil {
-		log.Printf("Error deleting from R2: %v", err)
+		log.Printf("Error deleting from storage: %v", err)
 		models.WriteServiceError(w, "Failed to delete image from storage", false, true, http.StatusInternalServerError)
 		return
 	}
@@ -318,43 +442,3 @@ func extractFilenameFromPath(imagePath string) (string, error) {
 
 	return filename, nil
 }
-
-// deleteFromR2 deletes an image from Cloudflare R2 storage
-func deleteFromR2(filename string) error {
-	// Get R2 configuration from environment variables
-	r2AccessKey := os.Getenv("R2_ACCESS_KEY_ID")
-	r2SecretKey := os.Getenv("R2_SECRET_ACCESS_KEY")
-	r2Endpoint := os.Getenv("R2_ENDPOINT")
-	r2BucketName := os.Getenv("R2_BUCKET_NAME")
-
-	if r2AccessKey == "" || r2SecretKey == "" || r2Endpoint == "" || r2BucketName == "" {
-		return fmt.Errorf("R2 configuration missing. Please set R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY, R2_ENDPOINT, and R2_BUCKET_NAME environment variables")
-	}
-
-	// Create custom AWS config for R2
-	r2Config := aws.Config{
-		Credentials: credentials.NewStaticCredentialsProvider(r2AccessKey, r2SecretKey, ""),
-		Region:      "auto",
-	}
-
-	// Create S3 client for R2 with custom endpoint
-	s3Client := s3.NewFromConfig(r2Config, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(r2Endpoint)
-		o.UsePathStyle = true
-	})
-
-	// Create the delete object input
-	deleteObjectInput := &s3.DeleteObjectInput{
-		Bucket: aws.String(r2BucketName),
-		Key:    aws.String("images/" + filename),
-	}
-
-	// Delete the file
-	_, err := s3Client.DeleteObject(context.TODO(), deleteObjectInput)
-	if err != nil {
-		return fmt.Errorf("failed to delete from R2: %v", err)
-	}
-
-	log.Printf("Successfully deleted image: %s", filename)
-	return nil
-}
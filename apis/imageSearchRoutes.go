@@ -0,0 +1,255 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/imagehash"
+	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/storage"
+)
+
+const (
+	defaultPhotoSearchLimit    = 10
+	maxPhotoSearchLimit        = 50
+	defaultFingerprintBackfill = 50
+	maxFingerprintBackfill     = 500
+)
+
+// fingerprintCacheTTL is how long a store's fingerprint set is reused between photo searches.
+// New uploads show up in results after at most this long.
+const fingerprintCacheTTL = time.Minute
+
+type cachedFingerprints struct {
+	fingerprints []models.ItemImageFingerprint
+	expires      time.Time
+}
+
+var (
+	fingerprintCacheMu sync.Mutex
+	fingerprintCache   = map[string]cachedFingerprints{}
+	// loadFingerprints reads a store's fingerprints on a cache miss; tests replace it
+	loadFingerprints = models.GetItemImageFingerprints
+)
+
+// storeFingerprints returns the fingerprints of the item images visible in storeID, loading
+// them at most once per fingerprintCacheTTL so every search does not read the whole table
+func storeFingerprints(storeID string) ([]models.ItemImageFingerprint, error) {
+	fingerprintCacheMu.Lock()
+	cached, ok := fingerprintCache[storeID]
+	fingerprintCacheMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.fingerprints, nil
+	}
+
+	fingerprints, err := loadFingerprints(storeID)
+	if err != nil {
+		return nil, err
+	}
+	fingerprintCacheMu.Lock()
+	fingerprintCache[storeID] = cachedFingerprints{fingerprints: fingerprints, expires: time.Now().Add(fingerprintCacheTTL)}
+	fingerprintCacheMu.Unlock()
+	return fingerprints, nil
+}
+
+// PhotoSearchMatch is one item that looks like the searched photo
+type PhotoSearchMatch struct {
+	ItemID          string  `json:"item_id"`
+	Name            string  `json:"name"`
+	Code            string  `json:"code"`
+	Barcode         string  `json:"barcode"`
+	ImageID         string  `json:"image_id"`
+	ImagePath       string  `json:"image_path"`
+	Score           float64 `json:"score"`            // 0-1, higher is more similar
+	HashDistance    int     `json:"hash_distance"`    // differing dHash bits of the best matching image
+	ColorSimilarity float64 `json:"color_similarity"` // histogram intersection, 0-1
+}
+
+// BackfillFingerprintsRequest defines how many attached images to fingerprint in one call
+type BackfillFingerprintsRequest struct {
+	Limit int `json:"limit"`
+}
+
+// HandleSearchItemsByPhoto handles POST requests that find items by a product photo.
+// Form fields: image (required), limit (default 10) and min_score (0-1, default 0).
+// The photo is compared locally against the fingerprints of the item images visible in the active
+// store, cached for fingerprintCacheTTL; it is not stored.
+func HandleSearchItemsByPhoto(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleSearchItemsByPhoto---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.Email == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+
+	fileData, _, uploadErr := readUploadedImage(r)
+	if uploadErr != nil {
+		models.WriteServiceError(w, uploadErr.Message, false, true, uploadErr.Status)
+		return
+	}
+
+	limit := defaultPhotoSearchLimit
+	if raw := r.FormValue("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			models.WriteServiceError(w, "limit must be a positive integer", false, true, http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxPhotoSearchLimit)
+	}
+	minScore := 0.0
+	if raw := r.FormValue("min_score"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			models.WriteServiceError(w, "min_score must be between 0 and 1", false, true, http.StatusBadRequest)
+			return
+		}
+		minScore = parsed
+	}
+
+	img, _, err := decodeUploadedImage(fileData)
+	if err != nil {
+		log.Printf("Error decoding search photo: %v", err)
+		models.WriteServiceError(w, "Failed to process image", false, true, http.StatusBadRequest)
+		return
+	}
+	query := imagehash.Compute(img)
+
+	fingerprints, err := loadFingerprints(storeID)
+	if err != nil {
+		log.Printf("Error loading item image fingerprints: %v", err)
+		models.WriteServiceError(w, "Failed to search items by photo", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	// Keep the best matching image of each item
+	best := map[string]PhotoSearchMatch{}
+	for _, f := range fingerprints {
+		stored := imagehash.Fingerprint{DHash: f.DHash, Histogram: f.Histogram}
+		score := query.Similarity(stored)
+		if score < minScore {
+			continue
+		}
+		if current, ok := best[f.ItemID]; ok && current.Score >= score {
+			continue
+		}
+		best[f.ItemID] = PhotoSearchMatch{
+			ItemID:          f.ItemID,
+			Name:            f.ItemName,
+			Code:            f.Code,
+			Barcode:         f.Barcode,
+			ImageID:         f.ImageID,
+			ImagePath:       f.ImagePath,
+			Score:           score,
+			HashDistance:    imagehash.Distance(query.DHash, f.DHash),
+			ColorSimilarity: imagehash.HistogramSimilarity(query.Histogram, f.Histogram),
+		}
+	}
+
+	matches := make([]PhotoSearchMatch, 0, len(best))
+	for _, match := range best {
+		match.Score = math.Round(match.Score*1000) / 1000
+		match.ColorSimilarity = math.Round(match.ColorSimilarity*1000) / 1000
+		matches = append(matches, match)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ItemID < matches[j].ItemID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	response := map[string]interface{}{
+		"matches":         matches,
+		"compared_images": len(fingerprints),
+	}
+	models.WriteServiceResponse(w, "Photo search completed", response, true, true, http.StatusOK)
+}
+
+// HandleBackfillImageFingerprints handles POST requests that fingerprint item images stored
+// before fingerprints (or colour histograms) existed, so photo search can find them
+func HandleBackfillImageFingerprints(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleBackfillImageFingerprints---")
+	var request BackfillFingerprintsRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+			return
+		}
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultFingerprintBackfill
+	}
+	if request.Limit > maxFingerprintBackfill {
+		request.Limit = maxFingerprintBackfill
+	}
+
+	blob, err := storage.Default()
+	if err != nil {
+		log.Printf("Storage unavailable for fingerprint backfill: %v", err)
+		models.WriteServiceError(w, "Storage is not configured", false, true, http.StatusInternalServerError)
+		return
+	}
+	paths, err := models.GetItemImagePathsMissingFingerprints(request.Limit)
+	if err != nil {
+		log.Printf("Error loading images to fingerprint: %v", err)
+		models.WriteServiceError(w, "Failed to load images to fingerprint", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	processed := 0
+	failures := map[string]string{}
+	for _, imagePath := range paths {
+		filename, err := extractFilenameFromPath(imagePath)
+		if err != nil {
+			failures[imagePath] = err.Error()
+			continue
+		}
+		data, _, err := blob.Get(r.Context(), imageKey(filename))
+		if err != nil {
+			failures[imagePath] = err.Error()
+			continue
+		}
+		img, _, err := decodeUploadedImage(data)
+		if err != nil {
+			failures[imagePath] = err.Error()
+			continue
+		}
+
+		imageID := models.FingerprintImageID(imagePath)
+		fingerprint := imagehash.Compute(img)
+		if err := models.SaveImageFingerprint(imageID, fingerprint.DHash, fingerprint.Histogram); err != nil {
+			failures[imagePath] = err.Error()
+			continue
+		}
+		processed++
+	}
+
+	response := map[string]interface{}{
+		"processed": processed,
+		"failed":    failures,
+	}
+	models.WriteServiceResponse(w, "Image fingerprints backfilled", response, true, true, http.StatusOK)
+}
@@ -0,0 +1,80 @@
+package apis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// stubFingerprints replaces the database loader for one test and counts the loads per store
+func stubFingerprints(t *testing.T, result []models.ItemImageFingerprint, err error) map[string]int {
+	t.Helper()
+	loads := map[string]int{}
+	original := loadFingerprints
+	loadFingerprints = func(storeID string) ([]models.ItemImageFingerprint, error) {
+		loads[storeID]++
+		return result, err
+	}
+	fingerprintCacheMu.Lock()
+	fingerprintCache = map[string]cachedFingerprints{}
+	fingerprintCacheMu.Unlock()
+	t.Cleanup(func() {
+		loadFingerprints = original
+		fingerprintCache = map[string]cachedFingerprints{}
+	})
+	return loads
+}
+
+func TestStoreFingerprintsCachesPerStore(t *testing.T) {
+	want := []models.ItemImageFingerprint{{ItemID: "item-1", DHash: 42}}
+	loads := stubFingerprints(t, want, nil)
+
+	// Miss, then hit
+	for i := 0; i < 2; i++ {
+		got, err := storeFingerprints("store-a")
+		if err != nil {
+			t.Fatalf("storeFingerprints: %v", err)
+		}
+		if len(got) != 1 || got[0].ItemID != "item-1" {
+			t.Fatalf("storeFingerprints = %+v, want %+v", got, want)
+		}
+	}
+	if loads["store-a"] != 1 {
+		t.Errorf("loaded store-a %d times, want once", loads["store-a"])
+	}
+
+	// Another store has its own entry
+	if _, err := storeFingerprints("store-b"); err != nil {
+		t.Fatalf("storeFingerprints: %v", err)
+	}
+	if loads["store-b"] != 1 {
+		t.Errorf("loaded store-b %d times, want once", loads["store-b"])
+	}
+}
+
+func TestStoreFingerprintsReloadsAfterTTL(t *testing.T) {
+	loads := stubFingerprints(t, nil, nil)
+	fingerprintCache["store-a"] = cachedFingerprints{expires: time.Now().Add(-time.Second)}
+
+	if _, err := storeFingerprints("store-a"); err != nil {
+		t.Fatalf("storeFingerprints: %v", err)
+	}
+	if loads["store-a"] != 1 {
+		t.Errorf("an expired entry was loaded %d times, want once", loads["store-a"])
+	}
+}
+
+func TestStoreFingerprintsDoesNotCacheErrors(t *testing.T) {
+	loads := stubFingerprints(t, nil, errors.New("database connection error"))
+
+	for i := 0; i < 2; i++ {
+		if _, err := storeFingerprints("store-a"); err == nil {
+			t.Fatal("storeFingerprints hid the load error")
+		}
+	}
+	if loads["store-a"] != 2 {
+		t.Errorf("loaded %d times, want a retry after the error", loads["store-a"])
+	}
+}
@@ -0,0 +1,312 @@
+package apis
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/storage"
+)
+
+// Default variant set; override with IMAGE_VARIANT_WIDTHS and IMAGE_VARIANT_FORMATS
+var (
+	defaultVariantWidths  = []int{128, 320, 600, 1200}
+	defaultVariantFormats = []string{models.ImageFormatJPEG, models.ImageFormatWebP}
+)
+
+const variantQuality = 70
+
+// variantWorkers bounds how many uploads have their variants encoded at the same time. An
+// upload takes a slot before its background work starts, so at most this many decoded images
+// are held for variants; further uploads wait for a slot.
+const variantWorkers = 2
+
+var variantSlots = make(chan struct{}, variantWorkers)
+
+// ImageVariantResponse describes one variant of an upload. FileSize is only known once the
+// variant has been stored.
+type ImageVariantResponse struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Format   string `json:"format"`
+	URL      string `json:"url"`
+	FileSize int64  `json:"file_size,omitempty"`
+}
+
+// imageVariant is one size and format to generate
+type imageVariant struct {
+	width    int
+	height   int
+	format   string
+	filename string
+}
+
+// imageVariantWidths reads IMAGE_VARIANT_WIDTHS ("128,320,600,1200"), ignoring invalid entries
+func imageVariantWidths() []int {
+	raw := os.Getenv("IMAGE_VARIANT_WIDTHS")
+	if raw == "" {
+		return defaultVariantWidths
+	}
+	widths := []int{}
+	for _, part := range strings.Split(raw, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || width <= 0 || width > 4096 {
+			log.Printf("Ignoring invalid IMAGE_VARIANT_WIDTHS entry %q", part)
+			continue
+		}
+		widths = append(widths, width)
+	}
+	if len(widths) == 0 {
+		return defaultVariantWidths
+	}
+	sort.Ints(widths)
+	return widths
+}
+
+// imageVariantFormats reads IMAGE_VARIANT_FORMATS ("jpeg" or "jpeg,webp")
+func imageVariantFormats() []string {
+	raw := os.Getenv("IMAGE_VARIANT_FORMATS")
+	if raw == "" {
+		return defaultVariantFormats
+	}
+	formats := []string{}
+	for _, part := range strings.Split(raw, ",") {
+		format := strings.ToLower(strings.TrimSpace(part))
+		if format == "jpg" {
+			format = models.ImageFormatJPEG
+		}
+		if format != models.ImageFormatJPEG && format != models.ImageFormatWebP {
+			log.Printf("Ignoring invalid IMAGE_VARIANT_FORMATS entry %q", part)
+			continue
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return defaultVariantFormats
+	}
+	return formats
+}
+
+// variantFilename is the file name of one variant, stored next to the main "<id>.jpg"
+func variantFilename(imageID string, width int, format string) string {
+	ext := "jpg"
+	if format == models.ImageFormatWebP {
+		ext = "webp"
+	}
+	return fmt.Sprintf("%s/%d.%s", imageID, width, ext)
+}
+
+// planImageVariants lists the variants of an image of the given size: every configured width
+// in every configured format. Widths above the original collapse onto the original width, so
+// nothing is upscaled.
+func planImageVariants(imageID string, width int, height int) []imageVariant {
+	seen := map[int]bool{}
+	plan := []imageVariant{}
+	for _, variantWidth := range imageVariantWidths() {
+		if variantWidth > width {
+			variantWidth = width
+		}
+		if seen[variantWidth] {
+			continue
+		}
+		seen[variantWidth] = true
+		variantHeight := height
+		if variantWidth < width {
+			variantHeight = int(float64(height) * float64(variantWidth) / float64(width))
+		}
+		for _, format := range imageVariantFormats() {
+			plan = append(plan, imageVariant{
+				width:    variantWidth,
+				height:   variantHeight,
+				format:   format,
+				filename: variantFilename(imageID, variantWidth, format),
+			})
+		}
+	}
+	return plan
+}
+
+// generateImageVariantsAsync stores the variants of an upload in the background and returns
+// where they will be. Keys are derived from the image ID, so the URLs are known up front; until
+// a variant exists the resolver falls back to the main file. It blocks while every worker slot
+// is busy, which bounds how many decoded images wait for encoding.
+func generateImageVariantsAsync(imageID string, img image.Image) []ImageVariantResponse {
+	plan := planImageVariants(imageID, img.Bounds().Dx(), img.Bounds().Dy())
+	responses := []ImageVariantResponse{}
+	blob, err := storage.Default()
+	if err != nil {
+		log.Printf("Skipping variants for image %s: %v", imageID, err)
+		return responses
+	}
+	for _, variant := range plan {
+		responses = append(responses, ImageVariantResponse{
+			Width:  variant.width,
+			Height: variant.height,
+			Format: variant.format,
+			URL:    blob.URL(imageKey(variant.filename)),
+		})
+	}
+
+	variantSlots <- struct{}{}
+	go func() {
+		defer func() { <-variantSlots }()
+		if err := generateImageVariants(context.Background(), imageID, img, plan); err != nil {
+			log.Printf("Error generating variants for image %s: %v", imageID, err)
+		}
+	}()
+	return responses
+}
+
+// generateImageVariants resizes and encodes every planned variant, stores the files and
+// records them. What was stored is recorded even when a later variant fails.
+func generateImageVariants(ctx context.Context, imageID string, img image.Image, plan []imageVariant) error {
+	records := []models.ImageVariant{}
+	var genErr error
+	var scaled image.Image
+	for _, variant := range plan {
+		// The plan lists every format of a width together, so each width is resized once
+		if scaled == nil || scaled.Bounds().Dx() != variant.width {
+			scaled = resizeToWidth(img, variant.width)
+		}
+		data, err := encodeImage(scaled, variant.format, variantQuality)
+		if err != nil {
+			genErr = fmt.Errorf("failed to encode %dpx %s: %v", variant.width, variant.format, err)
+			break
+		}
+		if _, err := uploadImageToStorage(ctx, data, variant.filename); err != nil {
+			genErr = fmt.Errorf("failed to store %s: %v", variant.filename, err)
+			break
+		}
+		records = append(records, models.ImageVariant{
+			ImageID:    imageID,
+			Width:      variant.width,
+			Height:     scaled.Bounds().Dy(),
+			Format:     variant.format,
+			StorageKey: imageKey(variant.filename),
+			FileSize:   int64(len(data)),
+			CreatedAt:  time.Now(),
+		})
+	}
+
+	if err := models.SaveImageVariants(records); err != nil {
+		return err
+	}
+	log.Printf("Stored %d of %d variants for image %s", len(records), len(plan), imageID)
+	return genErr
+}
+
+// HandleResolveImage handles GET requests for the best variant of an image and redirects to it.
+//
+// Query parameters:
+//   - w: display width in CSS pixels (omit for the largest variant)
+//   - dpr: device pixel ratio, 1 to 4 (default 1)
+//   - format: jpeg, webp or auto (default); auto serves WebP when the Accept header allows it
+//
+// Images uploaded before variants existed redirect to their original "<id>.jpg".
+func HandleResolveImage(w http.ResponseWriter, r *http.Request) {
+	imageID := strings.TrimSuffix(mux.Vars(r)["imageId"], ".jpg")
+	if _, err := uuid.Parse(imageID); err != nil {
+		models.WriteServiceError(w, "Invalid image ID", false, false, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	width := 0
+	if raw := query.Get("w"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			models.WriteServiceError(w, "w must be a positive integer", false, false, http.StatusBadRequest)
+			return
+		}
+		width = parsed
+	}
+	dpr := 1.0
+	if raw := query.Get("dpr"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed <= 0 {
+			models.WriteServiceError(w, "dpr must be a positive number", false, false, http.StatusBadRequest)
+			return
+		}
+		dpr = math.Min(math.Max(parsed, 1), 4)
+	}
+	format := strings.ToLower(query.Get("format"))
+	switch format {
+	case "", "auto":
+		format = models.ImageFormatJPEG
+		if strings.Contains(r.Header.Get("Accept"), "image/webp") {
+			format = models.ImageFormatWebP
+		}
+	case "jpg", models.ImageFormatJPEG:
+		format = models.ImageFormatJPEG
+	case models.ImageFormatWebP:
+	default:
+		models.WriteServiceError(w, "format must be jpeg, webp or auto", false, false, http.StatusBadRequest)
+		return
+	}
+
+	blob, err := storage.Default()
+	if err != nil {
+		log.Printf("Error resolving image %s: %v", imageID, err)
+		models.WriteServiceError(w, "Storage is not configured", false, false, http.StatusInternalServerError)
+		return
+	}
+	variants, err := models.GetImageVariants(imageID)
+	if err != nil {
+		log.Printf("Error loading variants of image %s: %v", imageID, err)
+		models.WriteServiceError(w, "Failed to resolve image", false, false, http.StatusInternalServerError)
+		return
+	}
+
+	// Variants of a fresh upload may still be generating, so the fallback is cached briefly
+	key := imageKey(imageID + ".jpg")
+	maxAge := 60
+	if best, ok := pickImageVariant(variants, int(math.Ceil(float64(width)*dpr)), format); ok {
+		key = best.StorageKey
+		maxAge = 86400
+	}
+
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+	http.Redirect(w, r, blob.URL(key), http.StatusFound)
+}
+
+// pickImageVariant returns the narrowest variant at least targetWidth wide in the wanted
+// format, or the widest one when none is wide enough. A targetWidth of 0 asks for the widest.
+// Falls back to any format when the wanted one was not generated.
+func pickImageVariant(variants []models.ImageVariant, targetWidth int, format string) (models.ImageVariant, bool) {
+	candidates := []models.ImageVariant{}
+	for _, v := range variants {
+		if v.Format == format {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = variants
+	}
+	if len(candidates) == 0 {
+		return models.ImageVariant{}, false
+	}
+
+	// variants come ordered by width
+	best := candidates[len(candidates)-1]
+	if targetWidth <= 0 {
+		return best, true
+	}
+	for _, v := range candidates {
+		if v.Width >= targetWidth {
+			return v, true
+		}
+	}
+	return best, true
+}
@@ -0,0 +1,73 @@
+package apis
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+func TestPlanImageVariants(t *testing.T) {
+	t.Setenv("IMAGE_VARIANT_WIDTHS", "")
+	t.Setenv("IMAGE_VARIANT_FORMATS", "")
+
+	plan := planImageVariants("0f8fad5b-d9cb-469f-a165-70867728950e", 800, 400)
+	want := []imageVariant{
+		{128, 64, models.ImageFormatJPEG, "0f8fad5b-d9cb-469f-a165-70867728950e/128.jpg"},
+		{128, 64, models.ImageFormatWebP, "0f8fad5b-d9cb-469f-a165-70867728950e/128.webp"},
+		{320, 160, models.ImageFormatJPEG, "0f8fad5b-d9cb-469f-a165-70867728950e/320.jpg"},
+		{320, 160, models.ImageFormatWebP, "0f8fad5b-d9cb-469f-a165-70867728950e/320.webp"},
+		{600, 300, models.ImageFormatJPEG, "0f8fad5b-d9cb-469f-a165-70867728950e/600.jpg"},
+		{600, 300, models.ImageFormatWebP, "0f8fad5b-d9cb-469f-a165-70867728950e/600.webp"},
+		// 1200 is wider than the upload, so it collapses onto the original width
+		{800, 400, models.ImageFormatJPEG, "0f8fad5b-d9cb-469f-a165-70867728950e/800.jpg"},
+		{800, 400, models.ImageFormatWebP, "0f8fad5b-d9cb-469f-a165-70867728950e/800.webp"},
+	}
+	if len(plan) != len(want) {
+		t.Fatalf("plan = %+v, want %+v", plan, want)
+	}
+	for i := range want {
+		if plan[i] != want[i] {
+			t.Errorf("plan[%d] = %+v, want %+v", i, plan[i], want[i])
+		}
+	}
+}
+
+func TestPlanImageVariantsSmallImage(t *testing.T) {
+	t.Setenv("IMAGE_VARIANT_WIDTHS", "128,320")
+	t.Setenv("IMAGE_VARIANT_FORMATS", "jpeg")
+
+	plan := planImageVariants("id", 100, 50)
+	if len(plan) != 1 || plan[0].width != 100 || plan[0].height != 50 {
+		t.Errorf("plan = %+v, want a single variant at the original size", plan)
+	}
+}
+
+func TestEncodeImageWebPIsLossy(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 320, 240))
+	noise := rand.New(rand.NewSource(1))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			n := uint8(noise.Intn(24))
+			img.Set(x, y, color.NRGBA{R: uint8(x*200/320) + n, G: uint8(y*200/240) + n, B: 90 + n, A: 255})
+		}
+	}
+
+	jpegData, err := encodeImage(img, models.ImageFormatJPEG, variantQuality)
+	if err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	webpData, err := encodeImage(img, models.ImageFormatWebP, variantQuality)
+	if err != nil {
+		t.Fatalf("encode webp: %v", err)
+	}
+	if len(webpData) >= len(jpegData) {
+		t.Errorf("webp is %d bytes, jpeg %d; want the lossy webp smaller", len(webpData), len(jpegData))
+	}
+	if _, format, err := image.Decode(bytes.NewReader(webpData)); err != nil || format != "webp" {
+		t.Errorf("decode webp: format %q, err %v", format, err)
+	}
+}
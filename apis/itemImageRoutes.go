@@ -0,0 +1,195 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/storage"
+)
+
+// AttachItemImageRequest defines the request body for attaching an uploaded image to an item
+type AttachItemImageRequest struct {
+	ImagePath string `json:"image_path"` // URL or file name returned by /upload/image
+	Role      string `json:"role"`       // front, back, ingredients, shelf or other
+	IsPrimary bool   `json:"is_primary"`
+}
+
+// ReorderItemImagesRequest lists every image id of the item in the new display order
+type ReorderItemImagesRequest struct {
+	ImageIDs []int64 `json:"image_ids"`
+}
+
+// ItemImageResponse adds the public URL to a stored item image
+type ItemImageResponse struct {
+	models.ItemImage
+	URL string `json:"url"`
+}
+
+// HandleGetItemImages handles GET requests for an item's images in display order
+func HandleGetItemImages(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	writeItemImages(w, itemID, "Item images retrieved successfully")
+}
+
+// HandleAttachItemImage handles POST requests that attach an uploaded image to an item
+func HandleAttachItemImage(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleAttachItemImage---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	var request AttachItemImageRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	if request.ImagePath == "" {
+		models.WriteServiceError(w, "image_path is required", false, true, http.StatusBadRequest)
+		return
+	}
+	if request.Role == "" {
+		request.Role = models.ImageRoleOther
+	}
+	if !models.IsImageRole(request.Role) {
+		models.WriteServiceError(w, "Invalid role. Use front, back, ingredients, shelf or other", false, true, http.StatusBadRequest)
+		return
+	}
+
+	// Store the bare "/<file>" form, same as HandleCreateItem
+	filename, err := extractFilenameFromPath(request.ImagePath)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid image path format", false, true, http.StatusBadRequest)
+		return
+	}
+
+	ensureItemVersioned(r, itemID)
+	_, err = models.AttachItemImage(models.ItemImage{
+		ItemID:    itemID,
+		ImagePath: "/" + filename,
+		Role:      request.Role,
+		IsPrimary: request.IsPrimary,
+		CreatedBy: userEmail,
+	})
+	if err != nil {
+		log.Printf("Error attaching image to item %s: %v", itemID, err)
+		models.WriteServiceError(w, "Failed to attach image", false, true, http.StatusInternalServerError)
+		return
+	}
+	recordItemVersion(r, itemID, models.ItemVersionImages)
+	writeItemImages(w, itemID, "Image attached successfully")
+}
+
+// HandleReorderItemImages handles PUT requests that set the display order of an item's images
+func HandleReorderItemImages(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	var request ReorderItemImagesRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+
+	ensureItemVersioned(r, itemID)
+	if err := models.ReorderItemImages(itemID, request.ImageIDs); err != nil {
+		log.Printf("Error reordering images of item %s: %v", itemID, err)
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusBadRequest)
+		return
+	}
+	recordItemVersion(r, itemID, models.ItemVersionImages)
+	writeItemImages(w, itemID, "Images reordered successfully")
+}
+
+// HandleSetPrimaryItemImage handles PUT requests that make one image the item's primary image
+func HandleSetPrimaryItemImage(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	imageID, err := strconv.ParseInt(mux.Vars(r)["imageId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid image ID", false, true, http.StatusBadRequest)
+		return
+	}
+
+	ensureItemVersioned(r, itemID)
+	if err := models.SetPrimaryItemImage(itemID, imageID); err != nil {
+		log.Printf("Error setting primary image of item %s: %v", itemID, err)
+		models.WriteServiceError(w, "Image not found", false, true, http.StatusNotFound)
+		return
+	}
+	recordItemVersion(r, itemID, models.ItemVersionImages)
+	writeItemImages(w, itemID, "Primary image updated successfully")
+}
+
+// HandleDetachItemImage handles DELETE requests that remove an image from an item.
+// The file stays in storage; use /delete/image to remove it.
+func HandleDetachItemImage(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	imageID, err := strconv.ParseInt(mux.Vars(r)["imageId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid image ID", false, true, http.StatusBadRequest)
+		return
+	}
+
+	ensureItemVersioned(r, itemID)
+	if _, err := models.DetachItemImage(itemID, imageID); err != nil {
+		log.Printf("Error detaching image %d from item %s: %v", imageID, itemID, err)
+		models.WriteServiceError(w, "Image not found", false, true, http.StatusNotFound)
+		return
+	}
+	recordItemVersion(r, itemID, models.ItemVersionImages)
+	writeItemImages(w, itemID, "Image detached successfully")
+}
+
+// writeItemImages responds with the item's current image list
+func writeItemImages(w http.ResponseWriter, itemID string, message string) {
+	images, err := models.GetItemImages(itemID)
+	if err != nil {
+		log.Printf("Error loading images of item %s: %v", itemID, err)
+		models.WriteServiceError(w, "Failed to retrieve item images", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	blob, _ := storage.Default()
+	response := []ItemImageResponse{}
+	for _, img := range images {
+		entry := ItemImageResponse{ItemImage: img}
+		if blob != nil {
+			entry.URL = blob.URL(imageKey(img.ImagePath))
+		}
+		response = append(response, entry)
+	}
+	models.WriteServiceResponse(w, message, response, true, true, http.StatusOK)
+}
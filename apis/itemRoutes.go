@@ -1,7 +1,9 @@
 package apis
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
 	"github.com/jimyeongjung/owlverload_api/models"
 )
 
@@ -70,42 +73,100 @@ type LookupItemRequest struct {
 	Value      string `json:"value"`
 }
 
+// visibleItem returns the item after checking it is in the active store's catalogue. It
+// answers the request itself and returns false otherwise.
+func visibleItem(w http.ResponseWriter, r *http.Request, itemID string) (models.Item, bool) {
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return models.Item{}, false
+	}
+	item, err := models.GetItemById(itemID)
+	if err != nil || !item.VisibleInStore(storeID) {
+		models.WriteServiceError(w, "Item not found", false, true, http.StatusNotFound)
+		return models.Item{}, false
+	}
+	return item, true
+}
+
 func HandleGetItemById(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("--- HandleGetItemById started --- ")
 	// /api/v1/getItemById?itemId=${id}
 	itemId := r.URL.Query().Get("itemId")
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	item, err := models.GetItemById(itemId)
-	if err != nil {
+	if err != nil || !item.VisibleInStore(storeID) {
 		models.WriteServiceError(w, "Item not found", false, true, http.StatusNotFound)
 		return
 	}
-	stocks, err := models.GetStocksByItemId(itemId)
+	stocks, err := models.GetStocksByItemId(itemId, storeID)
 	if err != nil {
 		models.WriteServiceError(w, "Stocks not found", false, true, http.StatusNotFound)
 		return
 	}
 	item.Stock = stocks
+	images, err := models.GetItemImages(itemId)
+	if err != nil {
+		fmt.Println("---Error fetching item images---", err)
+	}
+	item.Images = images
+	w.Header().Set("ETag", middleware.ETag("item", item.ID, item.RowVersion))
 	models.WriteServiceResponse(w, "Item found", item, true, true, http.StatusOK)
 	fmt.Println("--- HandleGetItemById ended --- ")
 }
 
 func HandleUpdateItemById(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("--- HandleUpdateItemById started --- ")
-	itemId := r.URL.Query().Get("itemId")
-	item, err := models.GetItemById(itemId)
+	item, ok := visibleItem(w, r, r.URL.Query().Get("itemId"))
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		models.WriteServiceError(w, "Item not found", false, true, http.StatusNotFound)
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
 		return
 	}
-	models.WriteServiceResponse(w, "Item found", item, true, true, http.StatusOK)
+	// GET /getItemById returns the item with the ETag to send back here
+	if len(bytes.TrimSpace(body)) == 0 {
+		models.WriteServiceError(w, "Request body is required", false, true, http.StatusBadRequest)
+		return
+	}
+
+	userEmail := firebase.GetTokenClaimsFromContext(r.Context()).Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
+		return
+	}
+	var update models.Item
+	if err := json.Unmarshal(body, &update); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	// The query parameter names the item; an ID in the body cannot redirect the write
+	update.ID = item.ID
+	if update.Tag == nil {
+		// Leave the tags alone when the body does not mention them
+		if update.Tag, err = models.GetTagsForItem(item.ID); err != nil {
+			models.WriteServiceError(w, "Failed to read item tags", false, true, http.StatusInternalServerError)
+			return
+		}
+	}
+	applyItemUpdate(w, r, update, userEmail)
 	fmt.Println("--- HandleUpdateItemById ended --- ")
 }
 
 func HandleGetItemByCode(w http.ResponseWriter, r *http.Request) {
 	code := r.URL.Query().Get("code")
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 	item, err := models.GetItemByCode(code)
-	if err != nil {
+	if err != nil || !item.VisibleInStore(storeID) {
 		models.WriteServiceError(w, "Item not found", false, true, http.StatusNotFound)
 		return
 	}
@@ -123,13 +184,17 @@ func HandleGetItemByBarcode(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "Either barcode or code or itemId is required", false, true, http.StatusBadRequest)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	var item models.Item
 	var err error
 
 	// First try to find by barcode
 	if barcode != "" {
-		item, err = models.GetItemByBarcode(barcode)
+		item, err = models.GetItemByBarcode(barcode, storeID)
 		if err != nil {
 			w.WriteHeader(204)
 			json.NewEncoder(w).Encode(models.ServiceResponse{
@@ -191,6 +256,10 @@ func HandleStockIn(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "Stock type is required (BOX, BUNDLE, or SINGLE)", false, true, http.StatusBadRequest)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// If itemID is not provided, try to get it from barcode or code
 	var itemID string
@@ -199,7 +268,7 @@ func HandleStockIn(w http.ResponseWriter, r *http.Request) {
 	} else {
 		var item models.Item
 		if request.Barcode != "" {
-			item, err = models.GetItemByBarcode(request.Barcode)
+			item, err = models.GetItemByBarcode(request.Barcode, storeID)
 		} else if request.Code != "" {
 			item, err = models.GetItemByCode(request.Code)
 		}
@@ -211,11 +280,17 @@ func HandleStockIn(w http.ResponseWriter, r *http.Request) {
 		}
 		itemID = item.ID
 	}
+	// Store-specific items can only be stocked by their own store
+	if item, err := models.GetItemById(itemID); err != nil || !item.VisibleInStore(storeID) {
+		models.WriteServiceError(w, "Failed to find item: item not found", false, true, http.StatusNotFound)
+		return
+	}
 
 	// Create a new stock record
 	stock := models.Stock{
 		StockId:           fmt.Sprintf("stock_%d", time.Now().UnixNano()),
 		ItemId:            itemID,
+		StoreID:           storeID,
 		ExpiryDate:        request.ExpiryDate,
 		Notes:             request.Notes,
 		CreatedAt:         time.Now(),
@@ -238,56 +313,17 @@ func HandleStockIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get database instance and start a transaction
-	db := models.GetDBInstance(models.GetDBConfig())
-	tx, err := db.Begin()
-	if err != nil {
-		log.Printf("Failed to start transaction: %v", err)
-		models.WriteServiceError(w, "Internal server error", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Defer a rollback in case anything fails
-	// If the transaction commits successfully, this rollback will be a no-op
-	defer func() {
-		if tx != nil {
-			tx.Rollback()
-		}
-	}()
-
 	fmt.Println("stock.stock.RegisteringPerson", stock.RegisteringPerson)
-	// Insert stock within transaction
-	stockQuery := "INSERT INTO stocks (fkproduct_id, stock_type, box_number, pcs_number, bundle_number, expiry_date, location, registering_person, notes, discount_rate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?,?)"
-	_, err = tx.Exec(stockQuery, stock.ItemId, stock.StockType, stock.BoxNumber, stock.PCSNumber, stock.BundleNumber, stock.ExpiryDate, stock.Location, stock.RegisteringPerson, stock.Notes, stock.DiscountRate)
-
-	if err != nil {
-		log.Printf("Error adding stock in transaction: %v", err)
-		models.WriteServiceError(w, fmt.Sprintf("Failed to add stock: %v", err), false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Record the transaction within the same DB transaction
-	transactionQuery := "INSERT INTO stock_transactions (fkitem_id, quantity, transaction_type, fkuser_email) VALUES (?, ?, ?, ?)"
-	_, err = tx.Exec(transactionQuery, itemID, request.Quantity, "in", userEmail)
+	// Insert the stock and record the transaction in one DB transaction
+	err = models.ReceiveStock(stock, request.Quantity, userEmail)
 	if err != nil {
-		log.Printf("Error recording transaction in DB transaction: %v", err)
-		models.WriteServiceError(w, fmt.Sprintf("Failed to record transaction: %v", err), false, true, http.StatusInternalServerError)
+		log.Printf("Error adding stock: %v", err)
+		writeStoreScopedError(w, err, "Failed to add stock")
 		return
 	}
 
-	// Commit the transaction
-	err = tx.Commit()
-	if err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		models.WriteServiceError(w, "Failed to complete the stock operation. Please try again.", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Set tx to nil to prevent the deferred rollback from doing anything
-	tx = nil
-
 	// Fetch the updated stock list for the item
-	updatedStocks, err := models.GetStocksByItemId(itemID)
+	updatedStocks, err := models.GetStocksByItemId(itemID, storeID)
 	if err != nil {
 		log.Printf("Error fetching updated stock list: %v", err)
 		// Continue anyway - we'll just return the original stock data
@@ -316,6 +352,7 @@ func HandleStockIn(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Return success response with the updated item and stock information
+	setStockETag(w, updatedStocks, stock.StockId)
 	models.WriteServiceResponse(w, "Stock added successfully", response, true, true, http.StatusOK)
 }
 
@@ -378,103 +415,30 @@ func HandleStockOut(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Calculate current and remaining quantity based on the requested stock type
-	currentQuantity := 0
-	switch StockType(normalizedType) {
-	case StockTypeBox:
-		currentQuantity = request.Stock.BoxNumber
-	case StockTypeBundle:
-		currentQuantity = request.Stock.BundleNumber
-	case StockTypePCS:
-		currentQuantity = request.Stock.PCSNumber
-	}
-
-	deductedQuantity := currentQuantity - request.Quantity
-	fmt.Printf("---Current stock (%s): %d, Requested quantity: %d, Remaining: %d---\n",
-		normalizedType, currentQuantity, request.Quantity, deductedQuantity)
-
-	if deductedQuantity < 0 {
-		models.WriteServiceError(w, fmt.Sprintf(
-			"Stock can't be deducted more than you have. Current quantity %d, requested quantity %d",
-			currentQuantity, request.Quantity,
-		), false, true, http.StatusBadRequest)
+	storeID, ok := activeStore(w, r)
+	if !ok {
 		return
 	}
 
-	// Get database instance and start a transaction
-	db := models.GetDBInstance(models.GetDBConfig())
-	tx, err := db.Begin()
+	// Deduct from the lot as stored in the active store, not the quantities sent by the client
+	issued, err := models.IssueStock(request.Stock.StockId, storeID, models.StockType(normalizedType), request.Quantity, userEmail)
 	if err != nil {
-		fmt.Printf("---Failed to start transaction: %v---\n", err)
-		models.WriteServiceError(w, "Internal server error", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Defer a rollback in case anything fails
-	// If the transaction commits successfully, this rollback will be a no-op
-	defer func() {
-		if tx != nil {
-			fmt.Println("---Rolling back transaction - this is expected if there was an error---")
-			tx.Rollback()
-		}
-	}()
-
-	// Update or remove stock within the transaction
-	if deductedQuantity > 0 {
-		// Update only the correct column based on type
-		column := ""
-		switch StockType(normalizedType) {
-		case StockTypeBox:
-			column = "box_number"
-		case StockTypeBundle:
-			column = "bundle_number"
-		case StockTypePCS:
-			column = "pcs_number"
-		}
-
-		query := fmt.Sprintf("UPDATE stocks SET %s = %s - ? WHERE stock_id = ?", column, column)
-		_, err = tx.Exec(query, request.Quantity, request.Stock.StockId)
-		if err != nil {
-			fmt.Printf("---Error updating stock in transaction: %v---\n", err)
-			models.WriteServiceError(w, fmt.Sprintf("Failed to update stock: %v", err), false, true, http.StatusInternalServerError)
+		fmt.Printf("---Error removing stock: %v---\n", err)
+		if errors.Is(err, models.ErrInsufficientStock) {
+			models.WriteServiceError(w, fmt.Sprintf(
+				"Stock can't be deducted more than you have. Current quantity %d, requested quantity %d",
+				issued.Quantity(models.StockType(normalizedType)), request.Quantity,
+			), false, true, http.StatusBadRequest)
 			return
 		}
-		fmt.Printf("---Stock quantity (%s) updated successfully---\n", normalizedType)
-	} else {
-		// Remaining is exactly 0 for the selected type; remove the stock row
-		query := "DELETE FROM stocks WHERE stock_id = ?"
-		_, err = tx.Exec(query, request.Stock.StockId)
-		if err != nil {
-			fmt.Printf("---Error removing stock in transaction: %v---\n", err)
-			models.WriteServiceError(w, fmt.Sprintf("Failed to remove stock: %v", err), false, true, http.StatusInternalServerError)
-			return
-		}
-		fmt.Printf("---Stock removed successfully (type=%s)---\n", normalizedType)
-	}
-
-	// Record the transaction within the same DB transaction
-	transactionQuery := "INSERT INTO stock_transactions (fkitem_id, quantity, transaction_type, fkuser_email) VALUES (?, ?, ?, ?)"
-	_, err = tx.Exec(transactionQuery, request.Stock.ItemId, request.Quantity, "out", userEmail)
-	if err != nil {
-		fmt.Printf("---Error recording transaction in DB: %v---\n", err)
-		models.WriteServiceError(w, fmt.Sprintf("Failed to record transaction: %v", err), false, true, http.StatusInternalServerError)
+		writeStoreScopedError(w, err, "Failed to remove stock")
 		return
 	}
 	fmt.Println("---Transaction recorded successfully---")
-
-	// Commit the transaction
-	err = tx.Commit()
-	if err != nil {
-		fmt.Printf("---Error committing transaction: %v---\n", err)
-		models.WriteServiceError(w, "Failed to complete the stock operation. Please try again.", false, true, http.StatusInternalServerError)
-		return
-	}
-
-	// Set tx to nil to prevent the deferred rollback from doing anything
-	tx = nil
+	request.Stock.ItemId = issued.ItemId
 
 	// Fetch the updated stock list for the item
-	updatedStocks, err := models.GetStocksByItemId(request.Stock.ItemId)
+	updatedStocks, err := models.GetStocksByItemId(request.Stock.ItemId, storeID)
 	if err != nil {
 		fmt.Printf("---Error fetching updated stock list: %v---\n", err)
 		// Continue anyway - we'll just return a success message without the updated stock list
@@ -506,9 +470,21 @@ func HandleStockOut(w http.ResponseWriter, r *http.Request) {
 
 	// Return success response with the updated stock list
 	fmt.Println("---Returning success response with the updated stock list---")
+	setStockETag(w, updatedStocks, request.Stock.StockId)
 	models.WriteServiceResponse(w, "Stock removed successfully", response, true, true, http.StatusOK)
 }
 
+// setStockETag sets the ETag of the lot a stock request acted on, when it is still in stocks
+// (a lot issued down to zero is deleted and gets none)
+func setStockETag(w http.ResponseWriter, stocks []models.Stock, stockID string) {
+	for _, stock := range stocks {
+		if stock.StockId == stockID {
+			w.Header().Set("ETag", middleware.ETag("stock", stock.StockId, stock.RowVersion))
+			return
+		}
+	}
+}
+
 // HandleCreateItem handles POST requests to create a new item
 func HandleCreateItem(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("---HandleCreateItem started --- ")
@@ -521,6 +497,10 @@ func HandleCreateItem(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	body, err := io.ReadAll(r.Body)
 	fmt.Println("---BODY---", string(body))
@@ -531,6 +511,11 @@ func HandleCreateItem(w http.ResponseWriter, r *http.Request) {
 
 	var item models.Item
 	err = json.Unmarshal(body, &item)
+	// store_id makes the item part of the active store's catalogue only
+	if item.StoreID != "" && item.StoreID != storeID {
+		models.WriteServiceError(w, "store_id must be the store you are acting in", false, true, http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		fmt.Println("---err---", err)
 		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
@@ -599,7 +584,7 @@ func HandleCreateItem(w http.ResponseWriter, r *http.Request) {
 	// Create the item (this will also handle tag associations)
 	createdItem, err := models.CreateItem(item)
 	if err != nil {
-		fmt.Println("---Error creating item: %v---", err)
+		fmt.Printf("---Error creating item: %v---\n", err)
 		models.WriteServiceError(w, fmt.Sprintf("Failed to create item: %v", err), false, true, http.StatusInternalServerError)
 		return
 	}
@@ -607,7 +592,7 @@ func HandleCreateItem(w http.ResponseWriter, r *http.Request) {
 	// Fetch the complete item with all associated data for the response
 	completeItem, err := models.GetItemById(createdItem.ID)
 	if err != nil {
-		fmt.Println("---Error fetching complete item data: %v---", err)
+		fmt.Printf("---Error fetching complete item data: %v---\n", err)
 		// Continue with the basic item data if we can't fetch complete data
 		completeItem = createdItem
 	}
@@ -615,16 +600,20 @@ func HandleCreateItem(w http.ResponseWriter, r *http.Request) {
 	// Get associated tags for the response
 	tags, err := models.GetTagsForItem(completeItem.ID)
 	if err != nil {
-		fmt.Println("---Error fetching tags for item: %v---", err)
+		fmt.Printf("---Error fetching tags for item: %v---\n", err)
 		// Continue with empty tags if error
 		tags = []models.Tag{}
 	}
 	completeItem.Tag = tags
 
+	if _, err := models.RecordItemVersion(completeItem.ID, models.ItemVersionCreate, tokenClaims.Email, 0); err != nil {
+		log.Printf("Error recording first version of item %s: %v", completeItem.ID, err)
+	}
+
 	// Get stocks for the item (should be empty for new items)
-	stocks, err := models.GetStocksByItemId(completeItem.ID)
+	stocks, err := models.GetStocksByItemId(completeItem.ID, storeID)
 	if err != nil {
-		fmt.Println("---Error fetching stocks for item: %v---", err)
+		fmt.Printf("---Error fetching stocks for item: %v---\n", err)
 		stocks = []models.Stock{} // Empty array if error
 	}
 	completeItem.Stock = stocks
@@ -668,7 +657,7 @@ func HandleUpdateItem(w http.ResponseWriter, r *http.Request) {
 	// Parse the request body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		fmt.Println("---Failed to read request body: %v---", err)
+		fmt.Printf("---Failed to read request body: %v---\n", err)
 		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
 		return
 	}
@@ -705,10 +694,49 @@ func HandleUpdateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	applyItemUpdate(w, r, item, userEmail)
+}
+
+// applyItemUpdate writes item and its tags, guarded by If-Match or the body's row_version, and
+// answers with the updated item. A stale version gets 412 with the current item.
+func applyItemUpdate(w http.ResponseWriter, r *http.Request, item models.Item, userEmail string) {
+	// Snapshot the item as UpdateItem will find it, for the audit log and the version check
+	beforeID := item.ID
+	if beforeID == "" {
+		if byCode, err := models.GetItemByCode(item.Code); err == nil {
+			beforeID = byCode.ID
+		}
+	}
+	// Only items in the active store's catalogue can be changed
+	before, ok := visibleItem(w, r, beforeID)
+	if !ok {
+		return
+	}
+	before.Tag, _ = models.GetTagsForItem(before.ID)
+	etag := middleware.ETag("item", before.ID, before.RowVersion)
+	if !middleware.IfMatch(r, etag) || (item.RowVersion != 0 && item.RowVersion != before.RowVersion) {
+		writeItemPreconditionFailed(w, before)
+		return
+	}
+	// Write only over the version just checked, so a concurrent edit in between is caught too
+	item.ID = before.ID
+	item.RowVersion = before.RowVersion
+
+	// Keep the pre-edit state of items edited before versioning existed
+	if err := models.EnsureItemVersioned(before.ID, userEmail); err != nil {
+		log.Printf("Error recording initial version of item %s: %v", before.ID, err)
+	}
+
 	// Update the item
 	updatedItem, err := models.UpdateItem(item)
+	if errors.Is(err, models.ErrVersionConflict) {
+		current, _ := models.GetItemById(item.ID)
+		current.Tag, _ = models.GetTagsForItem(item.ID)
+		writeItemPreconditionFailed(w, current)
+		return
+	}
 	if err != nil {
-		fmt.Println("---Error updating item: %v---", err)
+		fmt.Printf("---Error updating item: %v---\n", err)
 		models.WriteServiceError(w, fmt.Sprintf("Failed to update item: %v", err), false, true, http.StatusInternalServerError)
 		return
 	}
@@ -740,6 +768,11 @@ func HandleUpdateItem(w http.ResponseWriter, r *http.Request) {
 		updatedItem.Tag = []models.Tag{} // Empty array if error
 	}
 
+	middleware.RecordChange(r, "item", updatedItem.ID, before, updatedItem)
+	if _, err := models.RecordItemVersion(updatedItem.ID, models.ItemVersionUpdate, userEmail, 0); err != nil {
+		log.Printf("Error recording version of item %s: %v", updatedItem.ID, err)
+	}
+
 	// Extract tag names for convenience
 	var tagNames []string
 	for _, tag := range updatedItem.Tag {
@@ -753,9 +786,17 @@ func HandleUpdateItem(w http.ResponseWriter, r *http.Request) {
 		"message":   "Item updated successfully",
 	}
 
+	w.Header().Set("ETag", middleware.ETag("item", updatedItem.ID, updatedItem.RowVersion))
 	models.WriteServiceResponse(w, "Item updated successfully", response, true, true, http.StatusOK)
 }
 
+// writeItemPreconditionFailed answers 412 with the item as it is now and its ETag, so the
+// client can merge its edit and retry
+func writeItemPreconditionFailed(w http.ResponseWriter, current models.Item) {
+	w.Header().Set("ETag", middleware.ETag("item", current.ID, current.RowVersion))
+	models.WriteServiceResponse(w, "Item was modified by someone else; reload and retry", current, false, true, http.StatusPreconditionFailed)
+}
+
 // HandleGetItems handles GET requests to get all items
 func HandleGetItems(w http.ResponseWriter, r *http.Request) {
 	// Get authentication user ID from context
@@ -766,6 +807,10 @@ func HandleGetItems(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// Check for optional filters
 	category := r.URL.Query().Get("category")
@@ -773,7 +818,7 @@ func HandleGetItems(w http.ResponseWriter, r *http.Request) {
 	searchTerm := r.URL.Query().Get("search")
 
 	// Fetch all items
-	items, err := models.GetAllItems()
+	items, err := models.GetAllItems(storeID)
 	if err != nil {
 		log.Printf("Error retrieving items: %v", err)
 		models.WriteServiceError(w, "Failed to retrieve items", false, true, http.StatusInternalServerError)
@@ -852,6 +897,10 @@ func HandleSearchItems(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// Parse the request body
 	body, err := io.ReadAll(r.Body)
@@ -877,7 +926,7 @@ func HandleSearchItems(w http.ResponseWriter, r *http.Request) {
 
 	// Perform the search
 	// In a real implementation, this would be a database query with pagination
-	items, err := models.GetAllItems()
+	items, err := models.GetAllItems(storeID)
 	if err != nil {
 		log.Printf("Error retrieving items: %v", err)
 		models.WriteServiceError(w, "Failed to retrieve items", false, true, http.StatusInternalServerError)
@@ -972,6 +1021,10 @@ func HandleLookupItems(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// Parse the request body
 	body, err := io.ReadAll(r.Body)
@@ -1015,7 +1068,7 @@ func HandleLookupItems(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Perform the search with LIKE query
-	items, err := models.SearchItemsByField(lookupRequest.SearchType, lookupRequest.Value)
+	items, err := models.SearchItemsByField(lookupRequest.SearchType, lookupRequest.Value, storeID)
 	// fmt.Println("@@items", items)
 	if err != nil {
 		log.Printf("Error searching for items: %v", err)
@@ -1068,9 +1121,13 @@ func HandleGetItemsWithMissingInfo(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// Fetch all items
-	items, err := models.GetAllItems()
+	items, err := models.GetAllItems(storeID)
 	if err != nil {
 		log.Printf("Error retrieving items: %v", err)
 		models.WriteServiceError(w, "Failed to retrieve items with missing information", false, true, http.StatusInternalServerError)
@@ -1121,7 +1178,7 @@ func HandleGetItemsWithMissingInfo(w http.ResponseWriter, r *http.Request) {
 	var itemsWithStockAndMissingInfo []map[string]interface{}
 	for _, item := range itemsWithMissingInfo {
 		// Get stock information for this item
-		stocks, err := models.GetStocksByItemId(item.ID)
+		stocks, err := models.GetStocksByItemId(item.ID, storeID)
 		if err != nil {
 			log.Printf("Error retrieving stock for item %s: %v", item.ID, err)
 			// Continue anyway, we'll just return the item without stock
@@ -1181,6 +1238,10 @@ func HandleGetItemsPaginated(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// Get pagination parameters from query string
 	pageStr := r.URL.Query().Get("page")
@@ -1212,7 +1273,7 @@ func HandleGetItemsPaginated(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * limit
 
 	// Fetch paginated items from database
-	items, totalCount, err := models.GetItemsPaginated(offset, limit, tagParams)
+	items, totalCount, err := models.GetItemsPaginated(offset, limit, tagParams, storeID)
 	if err != nil {
 		log.Printf("Error retrieving paginated items: %v", err)
 		models.WriteServiceError(w, "Failed to retrieve items", false, true, http.StatusInternalServerError)
@@ -1269,6 +1330,10 @@ func HandleGetItemsExpiringWithinDays(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// Get 'within' parameter from query string
 	withinStr := r.URL.Query().Get("within")
@@ -1291,7 +1356,7 @@ func HandleGetItemsExpiringWithinDays(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get items expiring within the specified days
-	expiringItems, err := models.GetItemsExpiringWithinDays(withinDays)
+	expiringItems, err := models.GetItemsExpiringWithinDays(withinDays, storeID)
 	if err != nil {
 		log.Printf("Error retrieving expiring items: %v", err)
 		models.WriteServiceError(w, fmt.Sprintf("Failed to retrieve expiring items: %v", err), false, true, http.StatusInternalServerError)
@@ -0,0 +1,170 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// pathItem returns the {itemId} of the path after checking the item is in the active store's
+// catalogue. It answers the request itself and returns false otherwise.
+func pathItem(w http.ResponseWriter, r *http.Request) (string, bool) {
+	item, ok := visibleItem(w, r, mux.Vars(r)["itemId"])
+	return item.ID, ok
+}
+
+// HandleGetItemVersions handles GET requests listing an item's versions, newest first
+func HandleGetItemVersions(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	versions, err := models.GetItemVersions(itemID)
+	if err != nil {
+		log.Printf("Error listing versions of item %s: %v", itemID, err)
+		models.WriteServiceError(w, "Failed to retrieve item versions", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Item versions retrieved successfully", versions, true, true, http.StatusOK)
+}
+
+// HandleGetItemVersion handles GET requests for one version of an item
+func HandleGetItemVersion(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		models.WriteServiceError(w, "Invalid version", false, true, http.StatusBadRequest)
+		return
+	}
+	version, err := models.GetItemVersion(itemID, number)
+	if err != nil {
+		writeItemVersionError(w, err, "Failed to retrieve item version")
+		return
+	}
+	models.WriteServiceResponse(w, "Item version retrieved successfully", version, true, true, http.StatusOK)
+}
+
+// HandleDiffItemVersions handles GET requests comparing two versions of an item.
+// Query: from and to version numbers; to defaults to the latest version
+func HandleDiffItemVersions(w http.ResponseWriter, r *http.Request) {
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		models.WriteServiceError(w, "from must be a version number", false, true, http.StatusBadRequest)
+		return
+	}
+	to := 0
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			models.WriteServiceError(w, "to must be a version number", false, true, http.StatusBadRequest)
+			return
+		}
+	} else {
+		versions, err := models.GetItemVersions(itemID)
+		if err != nil || len(versions) == 0 {
+			writeItemVersionError(w, models.ErrItemVersionNotFound, "")
+			return
+		}
+		to = versions[0].Version
+	}
+
+	diff, err := models.DiffItemVersions(itemID, from, to)
+	if err != nil {
+		writeItemVersionError(w, err, "Failed to compare item versions")
+		return
+	}
+	response := map[string]interface{}{
+		"item_id": itemID,
+		"from":    from,
+		"to":      to,
+		"changes": diff,
+	}
+	models.WriteServiceResponse(w, "Item versions compared successfully", response, true, true, http.StatusOK)
+}
+
+// HandleRestoreItemVersion handles POST requests that write an old version back to the item.
+// The restore is a new edit, so it becomes the item's next version and can itself be undone.
+func HandleRestoreItemVersion(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleRestoreItemVersion---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.Email == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	number, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		models.WriteServiceError(w, "Invalid version", false, true, http.StatusBadRequest)
+		return
+	}
+
+	before, _ := models.GetItemById(itemID)
+	before.Tag, _ = models.GetTagsForItem(itemID)
+	if !middleware.IfMatch(r, middleware.ETag("item", itemID, before.RowVersion)) {
+		writeItemPreconditionFailed(w, before)
+		return
+	}
+	if err := models.EnsureItemVersioned(itemID, tokenClaims.Email); err != nil {
+		log.Printf("Error recording initial version of item %s: %v", itemID, err)
+	}
+
+	item, version, err := models.RestoreItemVersion(itemID, number, before.RowVersion, tokenClaims.Email)
+	if errors.Is(err, models.ErrVersionConflict) {
+		current, _ := models.GetItemById(itemID)
+		current.Tag, _ = models.GetTagsForItem(itemID)
+		writeItemPreconditionFailed(w, current)
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring item %s to version %d: %v", itemID, number, err)
+		writeItemVersionError(w, err, "Failed to restore item version")
+		return
+	}
+	middleware.RecordChange(r, "item", itemID, before, item)
+
+	response := map[string]interface{}{
+		"item":    item,
+		"version": version,
+	}
+	w.Header().Set("ETag", middleware.ETag("item", itemID, item.RowVersion))
+	models.WriteServiceResponse(w, fmt.Sprintf("Item restored to version %d", number), response, true, true, http.StatusOK)
+}
+
+// ensureItemVersioned keeps the pre-edit state of items edited before versioning existed.
+// Call it before changing the item.
+func ensureItemVersioned(r *http.Request, itemID string) {
+	if err := models.EnsureItemVersioned(itemID, firebase.GetTokenClaimsFromContext(r.Context()).Email); err != nil {
+		log.Printf("Error recording initial version of item %s: %v", itemID, err)
+	}
+}
+
+// recordItemVersion stores the item's state after a change as its next version
+func recordItemVersion(r *http.Request, itemID string, changeType string) {
+	if _, err := models.RecordItemVersion(itemID, changeType, firebase.GetTokenClaimsFromContext(r.Context()).Email, 0); err != nil {
+		log.Printf("Error recording version of item %s: %v", itemID, err)
+	}
+}
+
+func writeItemVersionError(w http.ResponseWriter, err error, fallback string) {
+	if errors.Is(err, models.ErrItemVersionNotFound) {
+		models.WriteServiceError(w, "Item version not found", false, true, http.StatusNotFound)
+		return
+	}
+	models.WriteServiceError(w, fmt.Sprintf("%s: %v", fallback, err), false, true, http.StatusInternalServerError)
+}
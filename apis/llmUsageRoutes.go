@@ -0,0 +1,274 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/llm"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// AI features recorded in the usage ledger
+const (
+	llmFeatureBarcodeAnalyze = "barcode_analyze"
+	llmFeatureProductImage   = "product_image"
+	llmFeatureEnrichment     = "enrichment"
+	llmFeatureTranslation    = "translation"
+)
+
+// usageMeter checks the caller's quotas and writes every AI call to the llm_usage ledger
+type usageMeter struct {
+	userUID   string
+	userEmail string
+	branch    string
+	feature   string
+}
+
+// newUsageMeter builds a meter for the authenticated user, looking up their branch
+func newUsageMeter(claims firebase.TokenClaims, feature string) *usageMeter {
+	branch := ""
+	if claims.UID != "" {
+		var err error
+		branch, err = models.GetUserBranch(claims.UID)
+		if err != nil {
+			log.Printf("Error looking up branch for %s: %v", claims.Email, err)
+		}
+	}
+	return &usageMeter{
+		userUID:   claims.UID,
+		userEmail: claims.Email,
+		branch:    branch,
+		feature:   feature,
+	}
+}
+
+// meteredProviderFromEnv returns the configured provider wrapped with the caller's usage meter
+func meteredProviderFromEnv(claims firebase.TokenClaims, feature string) (llm.Provider, error) {
+	provider, err := llm.NewProviderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return llm.WithMeter(provider, newUsageMeter(claims, feature)), nil
+}
+
+// Allow refuses the call once any applicable daily or monthly quota is used up.
+// Ledger errors are logged and the call is let through; accounting should not take the analyzer down.
+func (m *usageMeter) Allow(ctx context.Context) error {
+	quotas, err := models.GetApplicableLLMQuotas(m.userEmail, m.branch)
+	if err != nil {
+		log.Printf("Error loading LLM quotas for %s: %v", m.userEmail, err)
+		return nil
+	}
+
+	now := time.Now()
+	for _, quota := range quotas {
+		subject := m.userEmail
+		if quota.Scope == models.LLMQuotaScopeBranch {
+			subject = m.branch
+		}
+		since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if quota.Period == models.LLMQuotaPeriodMonthly {
+			since = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		}
+
+		tokens, cost, err := models.GetLLMUsageTotals(quota.Scope, subject, since)
+		if err != nil {
+			log.Printf("Error loading LLM usage for %s %s: %v", quota.Scope, subject, err)
+			continue
+		}
+		if quota.MaxTokens > 0 && tokens >= quota.MaxTokens {
+			return &llm.QuotaError{Scope: quota.Scope, Subject: subject, Period: quota.Period,
+				Reason: fmt.Sprintf("%d of %d tokens used", tokens, quota.MaxTokens)}
+		}
+		if quota.MaxCostUSD > 0 && cost >= quota.MaxCostUSD {
+			return &llm.QuotaError{Scope: quota.Scope, Subject: subject, Period: quota.Period,
+				Reason: fmt.Sprintf("$%.4f of $%.2f spent", cost, quota.MaxCostUSD)}
+		}
+	}
+	return nil
+}
+
+// Record writes the call to the ledger
+func (m *usageMeter) Record(ctx context.Context, call llm.CallRecord) {
+	usage := models.LLMUsage{
+		UserUID:          m.userUID,
+		UserEmail:        m.userEmail,
+		Branch:           m.branch,
+		Feature:          m.feature,
+		Provider:         call.Provider,
+		Model:            call.Model,
+		PromptTokens:     call.Usage.PromptTokens,
+		CompletionTokens: call.Usage.CompletionTokens,
+		TotalTokens:      call.Usage.TotalTokens,
+		CostUSD:          call.CostUSD,
+		Outcome:          models.LLMOutcomeSuccess,
+		DurationMs:       call.Duration.Milliseconds(),
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if call.Err != nil {
+		usage.Outcome = models.LLMOutcomeError
+		if errors.Is(call.Err, llm.ErrQuotaExceeded) {
+			usage.Outcome = models.LLMOutcomeQuotaExceeded
+		}
+		usage.Error = call.Err.Error()
+	}
+	if err := models.RecordLLMUsage(usage); err != nil {
+		log.Printf("Error recording LLM usage for %s: %v", m.userEmail, err)
+	}
+}
+
+// HandleGetLLMUsageReport handles GET requests for the AI usage breakdown.
+// Query: from/to (YYYY-MM-DD, default this month), group_by (comma separated:
+// user, branch, model, feature, outcome, day, month; default user,model), user, branch.
+func HandleGetLLMUsageReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	if v := query.Get("from"); v != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			models.WriteServiceError(w, "Invalid from date, expected YYYY-MM-DD", false, true, http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if v := query.Get("to"); v != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			models.WriteServiceError(w, "Invalid to date, expected YYYY-MM-DD", false, true, http.StatusBadRequest)
+			return
+		}
+		to = parsed.AddDate(0, 0, 1) // inclusive of the whole "to" day
+	}
+
+	groupBy := []string{"user", "model"}
+	if v, ok := query["group_by"]; ok {
+		groupBy = []string{}
+		for _, group := range strings.Split(strings.Join(v, ","), ",") {
+			group = strings.TrimSpace(group)
+			if group == "" {
+				continue
+			}
+			if !models.IsLLMUsageGroup(group) {
+				models.WriteServiceError(w, "Invalid group_by value: "+group, false, true, http.StatusBadRequest)
+				return
+			}
+			groupBy = append(groupBy, group)
+		}
+	}
+
+	rows, err := models.GetLLMUsageReport(from, to, groupBy, query.Get("user"), query.Get("branch"))
+	if err != nil {
+		log.Printf("Error building LLM usage report: %v", err)
+		models.WriteServiceError(w, "Failed to build usage report", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	totals := models.LLMUsageReportRow{Group: map[string]string{}}
+	for _, row := range rows {
+		totals.Calls += row.Calls
+		totals.Errors += row.Errors
+		totals.Rejected += row.Rejected
+		totals.PromptTokens += row.PromptTokens
+		totals.CompletionTokens += row.CompletionTokens
+		totals.TotalTokens += row.TotalTokens
+		totals.CostUSD += row.CostUSD
+	}
+
+	response := map[string]interface{}{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"group_by": groupBy,
+		"rows":     rows,
+		"totals":   totals,
+	}
+	models.WriteServiceResponse(w, "Usage report retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// HandleGetLLMQuotas handles GET requests to list the configured AI quotas
+func HandleGetLLMQuotas(w http.ResponseWriter, r *http.Request) {
+	quotas, err := models.GetLLMQuotas()
+	if err != nil {
+		log.Printf("Error listing LLM quotas: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve quotas", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Quotas retrieved successfully", quotas, true, true, http.StatusOK)
+}
+
+// HandleSaveLLMQuota handles PUT requests that create or replace a quota.
+// Subject "*" sets the default for every user or branch without its own quota.
+func HandleSaveLLMQuota(w http.ResponseWriter, r *http.Request) {
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	var quota models.LLMQuota
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &quota); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+
+	quota.Subject = strings.TrimSpace(quota.Subject)
+	if quota.Scope != models.LLMQuotaScopeUser && quota.Scope != models.LLMQuotaScopeBranch {
+		models.WriteServiceError(w, "Scope must be user or branch", false, true, http.StatusBadRequest)
+		return
+	}
+	if quota.Period != models.LLMQuotaPeriodDaily && quota.Period != models.LLMQuotaPeriodMonthly {
+		models.WriteServiceError(w, "Period must be daily or monthly", false, true, http.StatusBadRequest)
+		return
+	}
+	if quota.Subject == "" {
+		models.WriteServiceError(w, "Subject is required", false, true, http.StatusBadRequest)
+		return
+	}
+	if quota.MaxTokens < 0 || quota.MaxCostUSD < 0 || (quota.MaxTokens == 0 && quota.MaxCostUSD == 0) {
+		models.WriteServiceError(w, "Set max_tokens and/or max_cost_usd to a positive value", false, true, http.StatusBadRequest)
+		return
+	}
+	quota.UpdatedBy = userEmail
+
+	saved, err := models.SaveLLMQuota(quota)
+	if err != nil {
+		log.Printf("Error saving LLM quota: %v", err)
+		models.WriteServiceError(w, "Failed to save quota", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Quota saved successfully", saved, true, true, http.StatusOK)
+}
+
+// HandleDeleteLLMQuota handles DELETE requests to remove a quota
+func HandleDeleteLLMQuota(w http.ResponseWriter, r *http.Request) {
+	quotaID, err := strconv.ParseInt(mux.Vars(r)["quotaId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid quota ID", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := models.DeleteLLMQuota(quotaID); err != nil {
+		models.WriteServiceError(w, "Quota not found", false, true, http.StatusNotFound)
+		return
+	}
+	models.WriteServiceResponse(w, "Quota deleted successfully", nil, true, true, http.StatusOK)
+}
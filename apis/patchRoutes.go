@@ -0,0 +1,170 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// MergePatchContentType is the media type of an RFC 7396 JSON merge patch
+const MergePatchContentType = "application/merge-patch+json"
+
+// readMergePatch checks the content type of a PATCH request and returns its body. Plain
+// application/json is accepted too. It answers the request itself and returns false otherwise.
+func readMergePatch(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != MergePatchContentType && mediaType != "application/json") {
+			w.Header().Set("Accept-Patch", MergePatchContentType)
+			models.WriteServiceError(w, "Content-Type must be "+MergePatchContentType, false, true, http.StatusUnsupportedMediaType)
+			return nil, false
+		}
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// writePatchError answers a patch that could not be parsed or applied
+func writePatchError(w http.ResponseWriter, err error, fallback string) {
+	var validation *models.PatchValidationError
+	switch {
+	case errors.As(err, &validation):
+		models.WriteServiceResponse(w, "Invalid patch", validation, false, true, http.StatusBadRequest)
+	case errors.Is(err, models.ErrInvalidPatch):
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusBadRequest)
+	case errors.Is(err, models.ErrStockNotFound):
+		models.WriteServiceError(w, "Stock not found", false, true, http.StatusNotFound)
+	default:
+		models.WriteServiceError(w, fmt.Sprintf("%s: %v", fallback, err), false, true, http.StatusInternalServerError)
+	}
+}
+
+// HandlePatchItem handles PATCH requests applying a JSON merge patch to an item: fields left
+// out are unchanged and fields set to null are cleared. "tags" replaces the tag list, and
+// "row_version" or If-Match make the write conditional as on PUT /updateItem.
+func HandlePatchItem(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandlePatchItem---")
+	userEmail := firebase.GetTokenClaimsFromContext(r.Context()).Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
+		return
+	}
+	itemID, ok := pathItem(w, r)
+	if !ok {
+		return
+	}
+	body, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+	patch, err := models.ParseItemPatch(body)
+	if err != nil {
+		writePatchError(w, err, "Failed to read patch")
+		return
+	}
+
+	before, err := models.GetItemById(itemID)
+	if err != nil {
+		models.WriteServiceError(w, "Item not found", false, true, http.StatusNotFound)
+		return
+	}
+	before.Tag, _ = models.GetTagsForItem(itemID)
+	if !middleware.IfMatch(r, middleware.ETag("item", itemID, before.RowVersion)) ||
+		(patch.RowVersion != 0 && patch.RowVersion != before.RowVersion) {
+		writeItemPreconditionFailed(w, before)
+		return
+	}
+	if patch.Empty() {
+		w.Header().Set("ETag", middleware.ETag("item", itemID, before.RowVersion))
+		models.WriteServiceResponse(w, "Nothing to update", before, true, true, http.StatusOK)
+		return
+	}
+
+	// Keep the pre-edit state of items edited before versioning existed
+	if err := models.EnsureItemVersioned(itemID, userEmail); err != nil {
+		log.Printf("Error recording initial version of item %s: %v", itemID, err)
+	}
+	item, err := models.PatchItem(itemID, before.RowVersion, patch)
+	if errors.Is(err, models.ErrVersionConflict) {
+		current, _ := models.GetItemById(itemID)
+		current.Tag, _ = models.GetTagsForItem(itemID)
+		writeItemPreconditionFailed(w, current)
+		return
+	}
+	if err != nil {
+		log.Printf("Error patching item %s: %v", itemID, err)
+		writePatchError(w, err, "Failed to update item")
+		return
+	}
+
+	middleware.RecordChange(r, "item", itemID, before, item)
+	if _, err := models.RecordItemVersion(itemID, models.ItemVersionUpdate, userEmail, 0); err != nil {
+		log.Printf("Error recording version of item %s: %v", itemID, err)
+	}
+	w.Header().Set("ETag", middleware.ETag("item", itemID, item.RowVersion))
+	models.WriteServiceResponse(w, "Item updated successfully", item, true, true, http.StatusOK)
+}
+
+// HandlePatchStock handles PATCH requests applying a JSON merge patch to the details of a lot
+// of the active store (expiry date, location, discount rate and notes)
+func HandlePatchStock(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandlePatchStock---")
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+	stockID := mux.Vars(r)["stockId"]
+	body, ok := readMergePatch(w, r)
+	if !ok {
+		return
+	}
+	patch, err := models.ParseStockPatch(body)
+	if err != nil {
+		writePatchError(w, err, "Failed to read patch")
+		return
+	}
+
+	before, err := models.GetStock(stockID, storeID)
+	if err != nil {
+		writePatchError(w, err, "Failed to retrieve stock")
+		return
+	}
+	if !middleware.IfMatch(r, middleware.ETag("stock", stockID, before.RowVersion)) ||
+		(patch.RowVersion != 0 && patch.RowVersion != before.RowVersion) {
+		writeStockPreconditionFailed(w, before)
+		return
+	}
+	if patch.Empty() {
+		w.Header().Set("ETag", middleware.ETag("stock", stockID, before.RowVersion))
+		models.WriteServiceResponse(w, "Nothing to update", before, true, true, http.StatusOK)
+		return
+	}
+
+	stock, err := models.PatchStock(stockID, storeID, before.RowVersion, patch)
+	if errors.Is(err, models.ErrVersionConflict) {
+		current, _ := models.GetStock(stockID, storeID)
+		writeStockPreconditionFailed(w, current)
+		return
+	}
+	if err != nil {
+		log.Printf("Error patching stock %s: %v", stockID, err)
+		writePatchError(w, err, "Failed to update stock")
+		return
+	}
+
+	middleware.RecordChange(r, "stock", stockID, before, stock)
+	w.Header().Set("ETag", middleware.ETag("stock", stockID, stock.RowVersion))
+	models.WriteServiceResponse(w, "Stock updated successfully", stock, true, true, http.StatusOK)
+}
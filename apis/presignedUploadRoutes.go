@@ -0,0 +1,224 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/storage"
+)
+
+const (
+	// maxDirectUploadSize matches the multipart limit of /upload/image
+	maxDirectUploadSize = 32 << 20
+	presignedUploadTTL  = 15 * time.Minute
+	// rawUploadPrefix holds unprocessed uploads; unfinalised ones are collected by image GC
+	rawUploadPrefix = "uploads/"
+)
+
+// PresignUploadRequest describes the file the client is about to upload
+type PresignUploadRequest struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"` // exact size in bytes
+}
+
+// PresignUploadResponse tells the client where and how to PUT the file
+type PresignUploadResponse struct {
+	UploadID  string            `json:"upload_id"`
+	UploadURL string            `json:"upload_url"`
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"` // must be sent with the PUT
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// FinalizeUploadRequest identifies the uploaded file to process
+type FinalizeUploadRequest struct {
+	UploadID string `json:"upload_id"`
+	ItemID   string `json:"item_id"` // optional, same as the item_id form field of /upload/image
+}
+
+// HandlePresignImageUpload handles POST requests for a presigned PUT URL. The client uploads
+// the raw file straight to the bucket and then calls /upload/image/finalize.
+func HandlePresignImageUpload(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandlePresignImageUpload---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	var request PresignUploadRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	request.ContentType = strings.ToLower(request.ContentType)
+	if !isValidImageType(request.ContentType) {
+		models.WriteServiceError(w, "Invalid image type. Only JPEG, PNG, and WebP are supported", false, true, http.StatusBadRequest)
+		return
+	}
+	if request.Size <= 0 {
+		models.WriteServiceError(w, "size is required", false, true, http.StatusBadRequest)
+		return
+	}
+	if request.Size > maxDirectUploadSize {
+		models.WriteServiceError(w, fmt.Sprintf("Image is too large. The limit is %d MB", maxDirectUploadSize>>20), false, true, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	blob, err := storage.Default()
+	if err != nil {
+		log.Printf("Storage unavailable for presigned upload: %v", err)
+		models.WriteServiceError(w, "Storage is not configured", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	uploadID := uuid.New().String()
+	key := imageKey(rawUploadPrefix + uploadID)
+	uploadURL, err := blob.PresignUpload(r.Context(), key, request.ContentType, request.Size, presignedUploadTTL)
+	if err != nil {
+		log.Printf("Error presigning upload %s: %v", key, err)
+		models.WriteServiceError(w, "Failed to create upload URL", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	upload, err := models.CreateImageUpload(models.ImageUpload{
+		ID:          uploadID,
+		StorageKey:  key,
+		ContentType: request.ContentType,
+		Size:        request.Size,
+		CreatedBy:   userEmail,
+		ExpiresAt:   time.Now().Add(presignedUploadTTL),
+	})
+	if err != nil {
+		log.Printf("Error recording upload %s: %v", uploadID, err)
+		models.WriteServiceError(w, "Failed to create upload URL", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	response := PresignUploadResponse{
+		UploadID:  upload.ID,
+		UploadURL: uploadURL,
+		Method:    http.MethodPut,
+		Headers:   map[string]string{"Content-Type": upload.ContentType},
+		ExpiresAt: upload.ExpiresAt,
+	}
+	models.WriteServiceResponse(w, "Upload URL created successfully", response, true, true, http.StatusOK)
+}
+
+// HandleFinalizeImageUpload handles POST requests that process a file uploaded through a
+// presigned URL: it runs the same pipeline as /upload/image and deletes the raw object
+func HandleFinalizeImageUpload(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleFinalizeImageUpload---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	var request FinalizeUploadRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil || request.UploadID == "" {
+		models.WriteServiceError(w, "upload_id is required", false, true, http.StatusBadRequest)
+		return
+	}
+
+	upload, err := models.GetImageUpload(request.UploadID)
+	if err != nil || upload.CreatedBy != userEmail {
+		models.WriteServiceError(w, "Upload not found", false, true, http.StatusNotFound)
+		return
+	}
+	if upload.Status != models.ImageUploadPending {
+		models.WriteServiceError(w, "Upload is already "+upload.Status, false, true, http.StatusConflict)
+		return
+	}
+
+	blob, err := storage.Default()
+	if err != nil {
+		log.Printf("Storage unavailable for finalizing upload: %v", err)
+		models.WriteServiceError(w, "Storage is not configured", false, true, http.StatusInternalServerError)
+		return
+	}
+	if err := models.ClaimImageUpload(upload.ID); err != nil {
+		models.WriteServiceError(w, "Upload is already being finalized", false, true, http.StatusConflict)
+		return
+	}
+
+	data, _, err := blob.Get(r.Context(), upload.StorageKey)
+	if err != nil {
+		releaseImageUpload(upload.ID)
+		if errors.Is(err, storage.ErrNotFound) {
+			models.WriteServiceError(w, "File has not been uploaded yet", false, true, http.StatusConflict)
+			return
+		}
+		log.Printf("Error fetching raw upload %s: %v", upload.StorageKey, err)
+		models.WriteServiceError(w, "Failed to read uploaded file", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	// The bucket should already have enforced these, but not every driver can
+	if int64(len(data)) != upload.Size || int64(len(data)) > maxDirectUploadSize {
+		rejectImageUpload(r, blob, upload, "uploaded file size does not match the presigned size")
+		models.WriteServiceError(w, "Uploaded file size does not match the requested size", false, true, http.StatusBadRequest)
+		return
+	}
+	if !isValidImageType(http.DetectContentType(data)) {
+		rejectImageUpload(r, blob, upload, "uploaded file is not a JPEG, PNG or WebP image")
+		models.WriteServiceError(w, "Invalid image type. Only JPEG, PNG, and WebP are supported", false, true, http.StatusBadRequest)
+		return
+	}
+
+	response, err := storeUploadedImage(data, request.ItemID, firebase.GetTokenClaimsFromContext(r.Context()).StoreID)
+	if err != nil {
+		releaseImageUpload(upload.ID)
+		log.Printf("Error storing finalized upload %s: %v", upload.ID, err)
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.FinishImageUpload(upload.ID, models.ImageUploadFinalized, response.ImageID, ""); err != nil {
+		log.Printf("Error marking upload %s finalized: %v", upload.ID, err)
+	}
+	if err := blob.Delete(r.Context(), upload.StorageKey); err != nil {
+		// Image GC removes it later
+		log.Printf("Error deleting raw upload %s: %v", upload.StorageKey, err)
+	}
+
+	models.WriteServiceResponse(w, "Image uploaded successfully", response, true, true, http.StatusOK)
+}
+
+// releaseImageUpload hands a claimed upload back so finalize can be retried
+func releaseImageUpload(uploadID string) {
+	if err := models.FinishImageUpload(uploadID, models.ImageUploadPending, "", ""); err != nil {
+		log.Printf("Error releasing upload %s: %v", uploadID, err)
+	}
+}
+
+// rejectImageUpload fails an upload that broke its limits and deletes the raw object
+func rejectImageUpload(r *http.Request, blob storage.Blob, upload models.ImageUpload, reason string) {
+	if err := models.FinishImageUpload(upload.ID, models.ImageUploadFailed, "", reason); err != nil {
+		log.Printf("Error marking upload %s failed: %v", upload.ID, err)
+	}
+	if err := blob.Delete(r.Context(), upload.StorageKey); err != nil {
+		log.Printf("Error deleting rejected upload %s: %v", upload.StorageKey, err)
+	}
+}
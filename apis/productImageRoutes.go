@@ -0,0 +1,194 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/llm"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+const productImagePrompt = `Read the product label in this photo. Return the information in this exact JSON format:
+
+{
+"name": {
+	"english": "",
+	"korean": "",
+	"japanese": "",
+	"chinese": ""
+},
+"expiry_date": "",
+"ingredients": "",
+"ingredients_translated": "",
+"allergens": [],
+"contains_alcohol": "Yes" or "No" or "Unclear",
+"contains_pork": "Yes" or "No" or "Unclear",
+"contains_beef": "Yes" or "No" or "Unclear",
+"is_plant_based": "Yes" or "No" or "Unclear",
+"halal_status": "Halal" or "Not Halal" or "Unclear",
+"reasoning": ""
+}
+"expiry_date" is the printed best-before or use-by date as YYYY-MM-DD, or "" if it is not visible.
+"ingredients" is the ingredient list as printed, "ingredients_translated" is the same list in English.
+"allergens" lists allergens in English (e.g. "milk", "wheat", "soy").
+Fill the names you can read and translate the rest. Explain anything you could not read in the reasoning field.
+Do not include any other text in your response.`
+
+// HandleAnalyzeProductImage handles POST requests to read a product label photo with the vision model.
+// Optional form fields: store_image=true keeps the processed photo in storage, item_id attaches it to
+// an item (image_role, default "front", says what the photo shows).
+func HandleAnalyzeProductImage(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleAnalyzeProductImage---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	fileData, _, uploadErr := readUploadedImage(r)
+	if uploadErr != nil {
+		models.WriteServiceError(w, uploadErr.Message, false, true, uploadErr.Status)
+		return
+	}
+
+	itemID := r.FormValue("item_id")
+	storeImage, _ := strconv.ParseBool(r.FormValue("store_image"))
+	imageRole := r.FormValue("image_role")
+	if imageRole == "" {
+		imageRole = models.ImageRoleFront
+	}
+	if !models.IsImageRole(imageRole) {
+		models.WriteServiceError(w, "Invalid image_role", false, true, http.StatusBadRequest)
+		return
+	}
+	if itemID != "" {
+		if _, ok := visibleItem(w, r, itemID); !ok {
+			return
+		}
+		storeImage = true
+	}
+
+	provider, err := meteredProviderFromEnv(tokenClaims, llmFeatureProductImage)
+	if err != nil {
+		log.Printf("LLM provider unavailable: %v", err)
+		models.WriteServiceError(w, "Server configuration error", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	analysis, _, err := analyzeProductImage(r.Context(), provider, fileData)
+	if err != nil {
+		log.Printf("Error analyzing product image: %v", err)
+		writeAnalysisError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"analysis": analysis,
+	}
+
+	if storeImage {
+		upload, err := storeUploadedImage(fileData, itemID, tokenClaims.StoreID)
+		if err != nil {
+			log.Printf("Error storing analyzed image: %v", err)
+			models.WriteServiceError(w, err.Error(), false, true, http.StatusInternalServerError)
+			return
+		}
+		response["image"] = upload
+
+		if itemID != "" {
+			// Items keep the bare "/<file>" path, same as HandleCreateItem.
+			// The photo only becomes primary when the item has none yet.
+			attached, err := models.AttachItemImage(models.ItemImage{
+				ItemID:    itemID,
+				ImagePath: upload.FileName,
+				Role:      imageRole,
+				CreatedBy: userEmail,
+			})
+			if err != nil {
+				log.Printf("Error attaching image to item %s: %v", itemID, err)
+				models.WriteServiceError(w, "Image stored but could not be attached to the item", false, true, http.StatusInternalServerError)
+				return
+			}
+			response["item_id"] = itemID
+			response["item_image"] = attached
+		}
+	}
+
+	models.WriteServiceResponse(w, "Product analysis completed", response, true, true, http.StatusOK)
+}
+
+// analyzeProductImage sends a downscaled copy of the photo to the vision model and parses the label data
+func analyzeProductImage(ctx context.Context, provider llm.Provider, imageData []byte) (ProductAnalysisResult, llm.Usage, error) {
+	// Labels need more detail than the 600px thumbnail, but full phone photos waste tokens
+	visionData, err := processImage(imageData, ImageProcessingConfig{
+		MaxWidth:  1600,
+		Quality:   85,
+		Format:    "jpeg",
+		StripExif: true,
+	})
+	if err != nil {
+		return ProductAnalysisResult{}, llm.Usage{}, fmt.Errorf("failed to prepare image: %v", err)
+	}
+
+	resp, err := provider.Chat(ctx, llm.ChatRequest{
+		Model:    llm.VisionModel(),
+		JSONMode: true,
+		Messages: []llm.Message{
+			{
+				Role:    "system",
+				Content: "You are a product label reader for a grocery store. You extract names, ingredients, allergens, dietary information and printed dates from product photos and answer in JSON.",
+			},
+			{
+				Role:    "user",
+				Content: productImagePrompt,
+				Images:  []llm.Image{{MimeType: "image/jpeg", Data: visionData}},
+			},
+		},
+	})
+	if err != nil {
+		return ProductAnalysisResult{}, resp.Usage, err
+	}
+
+	result, err := parseProductAnalysis(resp.Content)
+	result.Model = resp.Model
+	return result, resp.Usage, err
+}
+
+// parseProductAnalysis decodes the model output, tolerating a markdown code fence around the JSON
+func parseProductAnalysis(content string) (ProductAnalysisResult, error) {
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	var result ProductAnalysisResult
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &result); err != nil {
+		return ProductAnalysisResult{}, fmt.Errorf("failed to parse analysis content: %v", err)
+	}
+	return result, nil
+}
+
+// writeAnalysisError maps analyzer failures onto service errors
+func writeAnalysisError(w http.ResponseWriter, err error) {
+	var quotaErr *llm.QuotaError
+	if errors.As(err, &quotaErr) {
+		models.WriteServiceError(w, "AI usage quota exceeded: "+quotaErr.Error(), false, true, http.StatusTooManyRequests)
+		return
+	}
+	var apiErr *llm.APIError
+	if errors.As(err, &apiErr) {
+		// The provider's body can echo prompts or account details, so it stays in the log
+		log.Printf("LLM API error (status %d): %s", apiErr.StatusCode, apiErr.Body)
+		models.WriteServiceError(w, "The AI provider could not process the request", false, true, http.StatusBadGateway)
+		return
+	}
+	models.WriteServiceError(w, "Failed to analyze product", false, true, http.StatusInternalServerError)
+}
@@ -0,0 +1,290 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+const (
+	defaultReviewPageSize = 20
+	maxReviewPageSize     = 100
+)
+
+// SuggestionReview is a suggestion together with its field-level diff against the item
+type SuggestionReview struct {
+	Suggestion models.AISuggestion          `json:"suggestion"`
+	ItemName   string                       `json:"item_name"`
+	Fields     []models.SuggestionFieldDiff `json:"fields"`
+}
+
+// FieldReviewDecision is the reviewer's action on one field: accept, edit or reject
+type FieldReviewDecision struct {
+	Field  string `json:"field"`
+	Action string `json:"action"`
+	Value  string `json:"value"` // required when action is "edit"
+}
+
+// ReviewSuggestionRequest defines the request body for reviewing a suggestion
+type ReviewSuggestionRequest struct {
+	Decisions []FieldReviewDecision `json:"decisions"`
+}
+
+// HandleGetSuggestions handles GET requests for the review queue.
+// Defaults to pending suggestions; pass status= (empty) to list all.
+// Only suggestions for items in the active store's catalogue are listed.
+func HandleGetSuggestions(w http.ResponseWriter, r *http.Request) {
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	status := models.SuggestionStatusPending
+	if _, ok := query["status"]; ok {
+		status = query.Get("status")
+	}
+	itemID := query.Get("item_id")
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+	if pageSize < 1 {
+		pageSize = defaultReviewPageSize
+	}
+	if pageSize > maxReviewPageSize {
+		pageSize = maxReviewPageSize
+	}
+
+	suggestions, total, err := models.GetAISuggestions(status, itemID, storeID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("Error listing AI suggestions: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve suggestions", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"suggestions": suggestions,
+		"total":       total,
+		"page":        page,
+		"page_size":   pageSize,
+	}
+	models.WriteServiceResponse(w, "Suggestions retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// HandleGetSuggestion handles GET requests for one suggestion shown as a field-level diff
+func HandleGetSuggestion(w http.ResponseWriter, r *http.Request) {
+	suggestionID, err := strconv.ParseInt(mux.Vars(r)["suggestionId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid suggestion ID", false, true, http.StatusBadRequest)
+		return
+	}
+	if _, _, ok := visibleSuggestion(w, r, suggestionID); !ok {
+		return
+	}
+
+	review, err := loadSuggestionReview(suggestionID)
+	if err != nil {
+		log.Printf("Error loading suggestion %d: %v", suggestionID, err)
+		models.WriteServiceError(w, "Suggestion not found", false, true, http.StatusNotFound)
+		return
+	}
+	models.WriteServiceResponse(w, "Suggestion retrieved successfully", review, true, true, http.StatusOK)
+}
+
+// HandleReviewSuggestion handles POST requests that accept, edit or reject suggested fields.
+// Accepted and edited values are written like a merge patch: If-Match makes the write
+// conditional, a stale item answers 412, and the change is audited and versioned. Once every
+// field has a decision the suggestion is closed as applied (anything accepted) or rejected.
+func HandleReviewSuggestion(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleReviewSuggestion---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	userEmail := tokenClaims.Email
+	if userEmail == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	suggestionID, err := strconv.ParseInt(mux.Vars(r)["suggestionId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid suggestion ID", false, true, http.StatusBadRequest)
+		return
+	}
+
+	var request ReviewSuggestionRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	if len(request.Decisions) == 0 {
+		models.WriteServiceError(w, "At least one decision is required", false, true, http.StatusBadRequest)
+		return
+	}
+
+	suggestion, before, ok := visibleSuggestion(w, r, suggestionID)
+	if !ok {
+		return
+	}
+	if suggestion.Status != models.SuggestionStatusPending {
+		models.WriteServiceError(w, "Suggestion has already been "+suggestion.Status, false, true, http.StatusConflict)
+		return
+	}
+	existing, err := models.GetSuggestionDecisions(suggestionID)
+	if err != nil {
+		log.Printf("Error loading decisions for suggestion %d: %v", suggestionID, err)
+		models.WriteServiceError(w, "Failed to load suggestion decisions", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	decisions := []models.SuggestionFieldDecision{}
+	seen := map[string]bool{}
+	itemChanged := false
+	for _, d := range request.Decisions {
+		suggested, ok := suggestion.Changes[d.Field]
+		if !ok {
+			models.WriteServiceError(w, "Field is not part of this suggestion: "+d.Field, false, true, http.StatusBadRequest)
+			return
+		}
+		if _, done := existing[d.Field]; done || seen[d.Field] {
+			models.WriteServiceError(w, "Field has already been reviewed: "+d.Field, false, true, http.StatusConflict)
+			return
+		}
+		seen[d.Field] = true
+
+		decision := models.SuggestionFieldDecision{
+			Field:          d.Field,
+			SuggestedValue: suggested,
+			ReviewedBy:     userEmail,
+			ReviewedAt:     now,
+		}
+		switch strings.ToLower(d.Action) {
+		case "accept":
+			decision.Decision = models.FieldDecisionAccepted
+			decision.AppliedValue = suggested
+		case "edit":
+			value := strings.TrimSpace(d.Value)
+			if value == "" {
+				models.WriteServiceError(w, "A value is required to edit "+d.Field, false, true, http.StatusBadRequest)
+				return
+			}
+			decision.Decision = models.FieldDecisionEdited
+			decision.AppliedValue = value
+		case "reject":
+			decision.Decision = models.FieldDecisionRejected
+		default:
+			models.WriteServiceError(w, "Action must be accept, edit or reject", false, true, http.StatusBadRequest)
+			return
+		}
+
+		if decision.Decision != models.FieldDecisionRejected {
+			if models.IsDietaryFlagField(d.Field) {
+				if _, err := strconv.ParseBool(decision.AppliedValue); err != nil {
+					models.WriteServiceError(w, d.Field+" must be true or false", false, true, http.StatusBadRequest)
+					return
+				}
+			}
+			itemChanged = true
+		}
+		decisions = append(decisions, decision)
+	}
+
+	before.Tag, _ = models.GetTagsForItem(before.ID)
+	if itemChanged {
+		if !middleware.IfMatch(r, middleware.ETag("item", before.ID, before.RowVersion)) {
+			writeItemPreconditionFailed(w, before)
+			return
+		}
+		ensureItemVersioned(r, suggestion.ItemID)
+	}
+	item, err := models.SaveSuggestionDecisions(suggestion, before.RowVersion, decisions)
+	if errors.Is(err, models.ErrVersionConflict) {
+		current, _ := models.GetItemById(suggestion.ItemID)
+		current.Tag, _ = models.GetTagsForItem(suggestion.ItemID)
+		writeItemPreconditionFailed(w, current)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrSuggestionReviewed) {
+			models.WriteServiceError(w, "Suggestion was reviewed by someone else, reload and try again", false, true, http.StatusConflict)
+			return
+		}
+		log.Printf("Error applying suggestion %d to item %s: %v", suggestionID, suggestion.ItemID, err)
+		models.WriteServiceError(w, "Failed to save review decisions", false, true, http.StatusInternalServerError)
+		return
+	}
+	if itemChanged {
+		middleware.RecordChange(r, "item", item.ID, before, item)
+		recordItemVersion(r, suggestion.ItemID, models.ItemVersionReview)
+	}
+	w.Header().Set("ETag", middleware.ETag("item", item.ID, item.RowVersion))
+
+	review, err := loadSuggestionReview(suggestionID)
+	if err != nil {
+		log.Printf("Error reloading suggestion %d: %v", suggestionID, err)
+		models.WriteServiceResponse(w, "Suggestion reviewed successfully", nil, true, true, http.StatusOK)
+		return
+	}
+	models.WriteServiceResponse(w, "Suggestion reviewed successfully", review, true, true, http.StatusOK)
+}
+
+// visibleSuggestion loads a suggestion and its item, answering 404 itself when the item is
+// not in the active store's catalogue
+func visibleSuggestion(w http.ResponseWriter, r *http.Request, suggestionID int64) (models.AISuggestion, models.Item, bool) {
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return models.AISuggestion{}, models.Item{}, false
+	}
+	suggestion, err := models.GetAISuggestion(suggestionID)
+	if err != nil {
+		models.WriteServiceError(w, "Suggestion not found", false, true, http.StatusNotFound)
+		return models.AISuggestion{}, models.Item{}, false
+	}
+	item, err := models.GetItemById(suggestion.ItemID)
+	if err != nil || !item.VisibleInStore(storeID) {
+		models.WriteServiceError(w, "Suggestion not found", false, true, http.StatusNotFound)
+		return models.AISuggestion{}, models.Item{}, false
+	}
+	return suggestion, item, true
+}
+
+func loadSuggestionReview(suggestionID int64) (SuggestionReview, error) {
+	suggestion, err := models.GetAISuggestion(suggestionID)
+	if err != nil {
+		return SuggestionReview{}, err
+	}
+	current, err := models.GetItemReviewValues(suggestion.ItemID)
+	if err != nil {
+		return SuggestionReview{}, err
+	}
+	decisions, err := models.GetSuggestionDecisions(suggestionID)
+	if err != nil {
+		return SuggestionReview{}, err
+	}
+
+	review := SuggestionReview{
+		Suggestion: suggestion,
+		Fields:     models.BuildSuggestionDiff(suggestion, current, decisions),
+	}
+	if item, err := models.GetItemById(suggestion.ItemID); err == nil {
+		review.ItemName = item.Name
+	}
+	return review, nil
+}
@@ -0,0 +1,123 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// SetUserRoleRequest defines the request body for assigning a role
+type SetUserRoleRequest struct {
+	Role string `json:"role"` // staff, supervisor, manager or admin
+}
+
+// HandleGetMyPermissions handles GET requests for the caller's role and permissions,
+// so clients can hide actions the user cannot perform
+func HandleGetMyPermissions(w http.ResponseWriter, r *http.Request) {
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	response := map[string]interface{}{
+		"role":        tokenClaims.Role,
+		"permissions": middleware.RolePermissions(tokenClaims.Role),
+	}
+	models.WriteServiceResponse(w, "Permissions retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// HandleGetUserRoles handles GET requests listing every user with their effective role
+func HandleGetUserRoles(w http.ResponseWriter, r *http.Request) {
+	assignments, err := models.GetUserRoleAssignments()
+	if err != nil {
+		log.Printf("Error listing user roles: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve user roles", false, true, http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"roles": models.Roles,
+		"users": assignments,
+	}
+	models.WriteServiceResponse(w, "User roles retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// HandleSetUserRole handles PUT requests that assign a role to a user. With
+// RBAC_SYNC_CUSTOM_CLAIMS=true the role is also mirrored into the user's Firebase custom claims.
+func HandleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleSetUserRole---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	uid := mux.Vars(r)["uid"]
+
+	var request SetUserRoleRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	request.Role = strings.ToLower(strings.TrimSpace(request.Role))
+	if !models.IsRole(request.Role) {
+		models.WriteServiceError(w, "Invalid role. Use staff, supervisor, manager or admin", false, true, http.StatusBadRequest)
+		return
+	}
+	// An admin demoting themselves could leave nobody able to assign roles
+	if uid == tokenClaims.UID && request.Role != models.RoleAdmin {
+		models.WriteServiceError(w, "You cannot change your own role", false, true, http.StatusBadRequest)
+		return
+	}
+
+	if err := models.SetUserRole(uid, request.Role, tokenClaims.Email); err != nil {
+		log.Printf("Error assigning role %s to %s: %v", request.Role, uid, err)
+		if err.Error() == "user not found" {
+			models.WriteServiceError(w, "User not found", false, true, http.StatusNotFound)
+			return
+		}
+		models.WriteServiceError(w, "Failed to assign role", false, true, http.StatusInternalServerError)
+		return
+	}
+	middleware.InvalidateRoleCache(uid)
+
+	claimsSynced := false
+	if os.Getenv("RBAC_SYNC_CUSTOM_CLAIMS") == "true" {
+		if err := syncRoleClaim(r.Context(), uid, request.Role); err != nil {
+			// The DB stays the source of truth; the claim is only a hint for clients
+			log.Printf("Error syncing role claim of %s: %v", uid, err)
+		} else {
+			claimsSynced = true
+		}
+	}
+
+	response := map[string]interface{}{
+		"uid":           uid,
+		"role":          request.Role,
+		"claims_synced": claimsSynced,
+	}
+	models.WriteServiceResponse(w, "Role assigned successfully", response, true, true, http.StatusOK)
+}
+
+// syncRoleClaim sets the "role" custom claim, keeping the user's other custom claims
+func syncRoleClaim(ctx context.Context, uid string, role string) error {
+	client := firebase.AuthClient()
+	if client == nil {
+		return fmt.Errorf("firebase is not initialized")
+	}
+	user, err := client.GetUser(ctx, uid)
+	if err != nil {
+		return err
+	}
+	claims := map[string]interface{}{}
+	for k, v := range user.CustomClaims {
+		claims[k] = v
+	}
+	claims["role"] = role
+	return client.SetCustomUserClaims(ctx, uid, claims)
+}
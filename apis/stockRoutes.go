@@ -2,9 +2,11 @@ package apis
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/jimyeongjung/owlverload_api/middleware"
 	"github.com/jimyeongjung/owlverload_api/models"
 )
 
@@ -17,7 +19,7 @@ func HandleStockUpdate(w http.ResponseWriter, r *http.Request) {
 	var stock models.Stock
 	err := json.NewDecoder(r.Body).Decode(&stock)
 	if err != nil {
-		fmt.Println("---Error decoding stock update request: %v---", err)
+		fmt.Printf("---Error decoding stock update request: %v---\n", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -28,36 +30,44 @@ func HandleStockUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db := models.GetDBInstance(models.GetDBConfig())
-	query := "UPDATE stocks SET expiry_date = ?, location = ?, discount_rate = ? WHERE stock_id = ?"
-	_, err = db.Exec(query, stock.ExpiryDate, stock.Location, stock.DiscountRate, stock.StockId)
-	if err != nil {
-		fmt.Println("---Error updating stock: %v---", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	storeID, ok := activeStore(w, r)
+	if !ok {
 		return
 	}
-
-	var updatedStock models.Stock
-	querySelect := "SELECT stock_id, fkproduct_id, stock_type, box_number, pcs_number, bundle_number, expiry_date, location, registering_person, notes, discount_rate, created_at FROM stocks WHERE stock_id = ?"
-	err = db.QueryRow(querySelect, stock.StockId).Scan(
-		&updatedStock.StockId,
-		&updatedStock.ItemId,
-		&updatedStock.StockType,
-		&updatedStock.BoxNumber,
-		&updatedStock.PCSNumber,
-		&updatedStock.BundleNumber,
-		&updatedStock.ExpiryDate,
-		&updatedStock.Location,
-		&updatedStock.RegisteringPerson,
-		&updatedStock.Notes,
-		&updatedStock.DiscountRate,
-		&updatedStock.CreatedAt,
-	)
+	// Only lots of the active store can be changed
+	stock.StoreID = storeID
+	before, err := models.GetStock(stock.StockId, storeID)
+	if err == nil {
+		if !middleware.IfMatch(r, middleware.ETag("stock", before.StockId, before.RowVersion)) ||
+			(stock.RowVersion != 0 && stock.RowVersion != before.RowVersion) {
+			writeStockPreconditionFailed(w, before)
+			return
+		}
+		stock.RowVersion = before.RowVersion
+	}
+	updatedStock, err := models.UpdateStockDetails(stock)
 	if err != nil {
-		fmt.Println("---Error selecting stock: %v---", err)
+		fmt.Printf("---Error updating stock: %v---\n", err)
+		if errors.Is(err, models.ErrStockNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, models.ErrVersionConflict) {
+			current, _ := models.GetStock(stock.StockId, storeID)
+			writeStockPreconditionFailed(w, current)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	middleware.RecordChange(r, "stock", updatedStock.StockId, before, updatedStock)
+	w.Header().Set("ETag", middleware.ETag("stock", updatedStock.StockId, updatedStock.RowVersion))
 	models.WriteServiceResponse(w, "Stock updated successfully", updatedStock, true, true, http.StatusOK)
 }
+
+// writeStockPreconditionFailed answers 412 with the lot as it is now and its ETag
+func writeStockPreconditionFailed(w http.ResponseWriter, current models.Stock) {
+	w.Header().Set("ETag", middleware.ETag("stock", current.StockId, current.RowVersion))
+	models.WriteServiceResponse(w, "Stock was modified by someone else; reload and retry", current, false, true, http.StatusPreconditionFailed)
+}
@@ -0,0 +1,148 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// StoreRequest defines the request body for creating or editing a store
+type StoreRequest struct {
+	Code    string `json:"code"`
+	Name    string `json:"name"`
+	Branch  string `json:"branch"` // users.branch value of the store's staff
+	Address string `json:"address"`
+	Active  *bool  `json:"active"`
+}
+
+// activeStore returns the store the request acts in. It answers 400 and returns false
+// when the caller has no store, so handlers can simply return.
+func activeStore(w http.ResponseWriter, r *http.Request) (string, bool) {
+	storeID := firebase.GetTokenClaimsFromContext(r.Context()).StoreID
+	if storeID == "" {
+		models.WriteServiceError(w, "No store selected. Set your branch or send the "+middleware.StoreHeader+" header", false, true, http.StatusBadRequest)
+		return "", false
+	}
+	return storeID, true
+}
+
+// writeStoreScopedError maps the errors of store-scoped model functions to responses
+func writeStoreScopedError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, models.ErrNoStore):
+		models.WriteServiceError(w, "No store selected. Set your branch or send the "+middleware.StoreHeader+" header", false, true, http.StatusBadRequest)
+	case errors.Is(err, models.ErrStockNotFound):
+		models.WriteServiceError(w, "Stock not found in this store", false, true, http.StatusNotFound)
+	default:
+		models.WriteServiceError(w, fmt.Sprintf("%s: %v", fallback, err), false, true, http.StatusInternalServerError)
+	}
+}
+
+// HandleGetStores handles GET requests listing the stores and the one the caller acts in
+func HandleGetStores(w http.ResponseWriter, r *http.Request) {
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	stores, err := models.GetStores()
+	if err != nil {
+		log.Printf("Error listing stores: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve stores", false, true, http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"stores":       stores,
+		"active_store": tokenClaims.StoreID,
+	}
+	models.WriteServiceResponse(w, "Stores retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// HandleCreateStore handles POST requests that add a store
+func HandleCreateStore(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleCreateStore---")
+	request, ok := decodeStoreRequest(w, r)
+	if !ok {
+		return
+	}
+	if request.Code == "" || request.Name == "" {
+		models.WriteServiceError(w, "code and name are required", false, true, http.StatusBadRequest)
+		return
+	}
+
+	store, err := models.CreateStore(models.Store{
+		Code:    request.Code,
+		Name:    request.Name,
+		Branch:  request.Branch,
+		Address: request.Address,
+	})
+	if err != nil {
+		log.Printf("Error creating store %s: %v", request.Code, err)
+		models.WriteServiceError(w, "Failed to create store", false, true, http.StatusInternalServerError)
+		return
+	}
+	middleware.ClearStoreCache()
+	models.WriteServiceResponse(w, "Store created successfully", store, true, true, http.StatusCreated)
+}
+
+// HandleUpdateStore handles PUT requests that edit or (de)activate a store
+func HandleUpdateStore(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleUpdateStore---")
+	storeID := mux.Vars(r)["storeId"]
+	existing, err := models.GetStore(storeID)
+	if err != nil {
+		models.WriteServiceError(w, "Store not found", false, true, http.StatusNotFound)
+		return
+	}
+	request, ok := decodeStoreRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if request.Code != "" {
+		existing.Code = request.Code
+	}
+	if request.Name != "" {
+		existing.Name = request.Name
+	}
+	if request.Branch != "" {
+		existing.Branch = request.Branch
+	}
+	if request.Address != "" {
+		existing.Address = request.Address
+	}
+	if request.Active != nil {
+		existing.Active = *request.Active
+	}
+
+	store, err := models.UpdateStore(existing)
+	if err != nil {
+		log.Printf("Error updating store %s: %v", storeID, err)
+		models.WriteServiceError(w, "Failed to update store", false, true, http.StatusInternalServerError)
+		return
+	}
+	middleware.ClearStoreCache()
+	models.WriteServiceResponse(w, "Store updated successfully", store, true, true, http.StatusOK)
+}
+
+func decodeStoreRequest(w http.ResponseWriter, r *http.Request) (StoreRequest, bool) {
+	var request StoreRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return request, false
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return request, false
+	}
+	request.Code = strings.TrimSpace(request.Code)
+	request.Name = strings.TrimSpace(request.Name)
+	request.Branch = strings.TrimSpace(request.Branch)
+	return request, true
+}
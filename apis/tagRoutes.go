@@ -8,8 +8,8 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/gorilla/mux"
 	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
 	"github.com/jimyeongjung/owlverload_api/models"
 )
 
@@ -39,6 +39,10 @@ func HandleGetRecommendedItems(w http.ResponseWriter, r *http.Request) {
 		models.WriteServiceError(w, "User authentication required", false, true, http.StatusUnauthorized)
 		return
 	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
 
 	// Parse the request body
 	body, err := io.ReadAll(r.Body)
@@ -74,6 +78,7 @@ func HandleGetRecommendedItems(w http.ResponseWriter, r *http.Request) {
 		recommendRequest.TagIDs,
 		recommendRequest.Limit,
 		recommendRequest.Page,
+		storeID,
 	)
 
 	if err != nil {
@@ -265,6 +270,22 @@ func HandleAssociateItemWithTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only items in the active store's catalogue can be tagged
+	item, ok := visibleItem(w, r, associateRequest.ItemID)
+	if !ok {
+		return
+	}
+
+	before, _ := models.GetTagsForItem(associateRequest.ItemID)
+	if !middleware.IfMatch(r, middleware.ETag("item", item.ID, item.RowVersion)) {
+		item.Tag = before
+		writeItemPreconditionFailed(w, item)
+		return
+	}
+	if err := models.EnsureItemVersioned(associateRequest.ItemID, userEmail); err != nil {
+		log.Printf("Error recording initial version of item %s: %v", associateRequest.ItemID, err)
+	}
+
 	// Associate the item with the tags
 	err = models.AssociateItemWithTags(associateRequest.ItemID, associateRequest.TagIDs)
 	if err != nil {
@@ -273,6 +294,10 @@ func HandleAssociateItemWithTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, err := models.RecordItemVersion(associateRequest.ItemID, models.ItemVersionTags, userEmail, 0); err != nil {
+		log.Printf("Error recording version of item %s: %v", associateRequest.ItemID, err)
+	}
+
 	// Get all tags for the item after association
 	tags, err := models.GetTagsForItem(associateRequest.ItemID)
 	if err != nil {
@@ -282,6 +307,10 @@ func HandleAssociateItemWithTags(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	middleware.RecordChange(r, "item_tags", associateRequest.ItemID, before, tags)
+	if current, err := models.GetItemById(associateRequest.ItemID); err == nil {
+		w.Header().Set("ETag", middleware.ETag("item", current.ID, current.RowVersion))
+	}
 	models.WriteServiceResponse(w, "Item associated with tags successfully", tags, true, true, http.StatusOK)
 }
 
@@ -298,9 +327,8 @@ func HandleGetTagsForItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get item ID from query params
-	itemID := mux.Vars(r)["itemId"]
-	if itemID == "" {
-		models.WriteServiceError(w, "Item ID is required", false, true, http.StatusBadRequest)
+	itemID, ok := pathItem(w, r)
+	if !ok {
 		return
 	}
 
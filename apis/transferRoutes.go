@@ -0,0 +1,210 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// CreateTransferRequest defines the request body for requesting a transfer out of the active store
+type CreateTransferRequest struct {
+	ToStoreID string                `json:"to_store_id"`
+	Notes     string                `json:"notes"`
+	Lines     []TransferLineRequest `json:"lines"`
+}
+
+// TransferLineRequest is a quantity of one lot of the active store
+type TransferLineRequest struct {
+	StockID   string `json:"stock_id"`
+	StockType string `json:"stock_type"` // BOX, BUNDLE or PCS
+	Quantity  int    `json:"quantity"`
+}
+
+// ReceiveTransferRequest lists what arrived; without lines everything outstanding is received
+type ReceiveTransferRequest struct {
+	Lines []models.TransferReceipt `json:"lines"`
+}
+
+// HandleCreateTransfer handles POST requests for a transfer order from the active store
+func HandleCreateTransfer(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleCreateTransfer---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.Email == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+
+	var request CreateTransferRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	if request.ToStoreID == "" || len(request.Lines) == 0 {
+		models.WriteServiceError(w, "to_store_id and at least one line are required", false, true, http.StatusBadRequest)
+		return
+	}
+
+	lines := make([]models.TransferLine, 0, len(request.Lines))
+	for _, line := range request.Lines {
+		lines = append(lines, models.TransferLine{
+			StockID:   line.StockID,
+			StockType: models.StockType(strings.ToUpper(line.StockType)),
+			Quantity:  line.Quantity,
+		})
+	}
+
+	order, err := models.CreateTransfer(storeID, request.ToStoreID, request.Notes, lines, tokenClaims.Email)
+	if err != nil {
+		log.Printf("Error creating transfer from %s to %s: %v", storeID, request.ToStoreID, err)
+		writeTransferError(w, err)
+		return
+	}
+	models.WriteServiceResponse(w, "Transfer requested successfully", order, true, true, http.StatusCreated)
+}
+
+// HandleGetTransfers handles GET requests listing transfers of the active store.
+// Query: direction=outgoing|incoming, status, limit (default 50)
+func HandleGetTransfers(w http.ResponseWriter, r *http.Request) {
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+	direction := r.URL.Query().Get("direction")
+	if direction != "" && direction != "outgoing" && direction != "incoming" {
+		models.WriteServiceError(w, "direction must be outgoing or incoming", false, true, http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+
+	orders, err := models.GetTransfers(storeID, direction, r.URL.Query().Get("status"), limit)
+	if err != nil {
+		log.Printf("Error listing transfers of %s: %v", storeID, err)
+		models.WriteServiceError(w, "Failed to retrieve transfers", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Transfers retrieved successfully", orders, true, true, http.StatusOK)
+}
+
+// HandleGetTransfer handles GET requests for one transfer with its lines
+func HandleGetTransfer(w http.ResponseWriter, r *http.Request) {
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+	transferID, ok := transferIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	order, err := models.GetTransfer(transferID, storeID)
+	if err != nil {
+		writeTransferError(w, err)
+		return
+	}
+	models.WriteServiceResponse(w, "Transfer retrieved successfully", order, true, true, http.StatusOK)
+}
+
+// HandleDispatchTransfer handles POST requests that ship a requested transfer from the active store
+func HandleDispatchTransfer(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleDispatchTransfer---")
+	handleTransferTransition(w, r, "Transfer dispatched successfully", func(transferID int64, storeID string, userEmail string) (models.TransferOrder, error) {
+		return models.DispatchTransfer(transferID, storeID, userEmail)
+	})
+}
+
+// HandleReceiveTransfer handles POST requests that book a dispatched transfer into the active store
+func HandleReceiveTransfer(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleReceiveTransfer---")
+	var request ReceiveTransferRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+			return
+		}
+	}
+	handleTransferTransition(w, r, "Transfer received successfully", func(transferID int64, storeID string, userEmail string) (models.TransferOrder, error) {
+		return models.ReceiveTransfer(transferID, storeID, request.Lines, userEmail)
+	})
+}
+
+// HandleCancelTransfer handles POST requests that withdraw a transfer before dispatch
+func HandleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleCancelTransfer---")
+	handleTransferTransition(w, r, "Transfer cancelled successfully", func(transferID int64, storeID string, userEmail string) (models.TransferOrder, error) {
+		return models.CancelTransfer(transferID, storeID, userEmail)
+	})
+}
+
+func handleTransferTransition(w http.ResponseWriter, r *http.Request, message string, transition func(transferID int64, storeID string, userEmail string) (models.TransferOrder, error)) {
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.Email == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+	transferID, ok := transferIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := transition(transferID, storeID, tokenClaims.Email)
+	if err != nil {
+		log.Printf("Error updating transfer %d in %s: %v", transferID, storeID, err)
+		writeTransferError(w, err)
+		return
+	}
+	models.WriteServiceResponse(w, message, order, true, true, http.StatusOK)
+}
+
+func transferIDFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	transferID, err := strconv.ParseInt(mux.Vars(r)["transferId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid transfer ID", false, true, http.StatusBadRequest)
+		return 0, false
+	}
+	return transferID, true
+}
+
+// writeTransferError maps transfer model errors to responses
+func writeTransferError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrTransferNotFound):
+		models.WriteServiceError(w, "Transfer not found", false, true, http.StatusNotFound)
+	case errors.Is(err, models.ErrTransferState):
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusConflict)
+	case errors.Is(err, models.ErrInsufficientStock):
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusConflict)
+	case errors.Is(err, models.ErrTransferInvalid):
+		models.WriteServiceError(w, err.Error(), false, true, http.StatusBadRequest)
+	default:
+		writeStoreScopedError(w, err, "Failed to update transfer")
+	}
+}
@@ -0,0 +1,452 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/llm"
+	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/translation"
+)
+
+const (
+	defaultTranslationBatchLimit = 20
+	maxTranslationBatchLimit     = 50
+	translationConcurrency       = 4
+	translationItemTimeout       = time.Minute
+	translationSuggestionSource  = "translation"
+)
+
+// TranslateItemRequest defines the request body for translating one item's name
+type TranslateItemRequest struct {
+	Mode      string   `json:"mode"`      // "llm" or "glossary"; defaults to TRANSLATION_MODE
+	Languages []string `json:"languages"` // subset of eng, kor, jpn, chn; defaults to all missing
+	Overwrite bool     `json:"overwrite"` // also propose languages that already have a name
+}
+
+// TranslateBatchRequest defines the request body for translating the items under some tags
+type TranslateBatchRequest struct {
+	TagIDs    []string `json:"tag_ids"`
+	Mode      string   `json:"mode"`
+	Languages []string `json:"languages"`
+	Limit     int      `json:"limit"`
+}
+
+// TranslationOutcome reports what happened to one item of a translation request
+type TranslationOutcome struct {
+	ItemID     string               `json:"item_id"`
+	Name       string               `json:"name"`
+	Suggestion *models.AISuggestion `json:"suggestion,omitempty"`
+	PendingID  int64                `json:"pending_suggestion_id,omitempty"` // set when skipped for a pending suggestion
+	Notes      string               `json:"notes,omitempty"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// HandleTranslateItem handles POST requests that propose missing language names for one item.
+// The proposal is queued as an AI suggestion for review; nothing is written to the item.
+func HandleTranslateItem(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleTranslateItem---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.Email == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	var request TranslateItemRequest
+	if !readOptionalJSON(w, r, &request) {
+		return
+	}
+	if !validTranslationLanguages(w, request.Languages) {
+		return
+	}
+
+	item, ok := visibleItem(w, r, mux.Vars(r)["itemId"])
+	if !ok {
+		return
+	}
+	if strings.TrimSpace(item.Name) == "" {
+		models.WriteServiceError(w, "Item has no name to translate", false, true, http.StatusBadRequest)
+		return
+	}
+
+	translator, err := newTranslator(tokenClaims, request.Mode)
+	if err != nil {
+		log.Printf("Translator unavailable: %v", err)
+		models.WriteServiceError(w, "Server configuration error", false, true, http.StatusInternalServerError)
+		return
+	}
+	glossary, err := loadTranslationGlossary()
+	if err != nil {
+		log.Printf("Error loading glossary: %v", err)
+		models.WriteServiceError(w, "Failed to load glossary", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), translationItemTimeout)
+	defer cancel()
+	outcome, err := translateItem(ctx, translator, item, request.Languages, request.Overwrite, glossary, tokenClaims.Email)
+	if err != nil {
+		log.Printf("Error translating item %s: %v", item.ID, err)
+		writeAnalysisError(w, err)
+		return
+	}
+
+	message := "Translation queued for review"
+	switch {
+	case outcome.PendingID != 0:
+		message = "A translation is already pending review"
+	case outcome.Suggestion == nil:
+		message = "No translation to propose"
+	}
+	models.WriteServiceResponse(w, message, outcome, true, true, http.StatusOK)
+}
+
+// HandleTranslateItemsByTag handles POST requests that propose missing names for tagged items
+func HandleTranslateItemsByTag(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleTranslateItemsByTag---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.Email == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return
+	}
+
+	var request TranslateBatchRequest
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+	storeID, ok := activeStore(w, r)
+	if !ok {
+		return
+	}
+	if len(request.TagIDs) == 0 {
+		models.WriteServiceError(w, "At least one tag is required", false, true, http.StatusBadRequest)
+		return
+	}
+	if !validTranslationLanguages(w, request.Languages) {
+		return
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultTranslationBatchLimit
+	}
+	if request.Limit > maxTranslationBatchLimit {
+		request.Limit = maxTranslationBatchLimit
+	}
+
+	translator, err := newTranslator(tokenClaims, request.Mode)
+	if err != nil {
+		log.Printf("Translator unavailable: %v", err)
+		models.WriteServiceError(w, "Server configuration error", false, true, http.StatusInternalServerError)
+		return
+	}
+	glossary, err := loadTranslationGlossary()
+	if err != nil {
+		log.Printf("Error loading glossary: %v", err)
+		models.WriteServiceError(w, "Failed to load glossary", false, true, http.StatusInternalServerError)
+		return
+	}
+	items, err := models.GetItemsMissingNamesByTags(request.TagIDs, storeID, request.Limit)
+	if err != nil {
+		log.Printf("Error loading items for translation: %v", err)
+		models.WriteServiceError(w, "Failed to load items", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, translationConcurrency)
+	outcomes := make([]TranslationOutcome, len(items))
+	quotaExceeded := false
+	for i, item := range items {
+		slots <- struct{}{}
+		mu.Lock()
+		stop := quotaExceeded
+		mu.Unlock()
+		if stop {
+			<-slots
+			outcomes[i] = TranslationOutcome{ItemID: item.ID, Name: item.Name, Error: "skipped: AI usage quota exceeded"}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, item models.Item) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			ctx, cancel := context.WithTimeout(r.Context(), translationItemTimeout)
+			defer cancel()
+			outcome, err := translateItem(ctx, translator, item, request.Languages, false, glossary, tokenClaims.Email)
+			if err != nil {
+				outcome = TranslationOutcome{ItemID: item.ID, Name: item.Name, Error: err.Error()}
+				if errors.Is(err, llm.ErrQuotaExceeded) {
+					mu.Lock()
+					quotaExceeded = true
+					mu.Unlock()
+				}
+			}
+			outcomes[i] = outcome
+		}(i, item)
+	}
+	wg.Wait()
+
+	queued, failed := 0, 0
+	for _, outcome := range outcomes {
+		if outcome.Suggestion != nil {
+			queued++
+		}
+		if outcome.Error != "" {
+			failed++
+		}
+	}
+	response := map[string]interface{}{
+		"total_items": len(items),
+		"queued":      queued,
+		"failed":      failed,
+		"items":       outcomes,
+	}
+	models.WriteServiceResponse(w, "Translations queued for review", response, true, true, http.StatusOK)
+}
+
+// translateItem proposes the missing (or requested) names for one item and queues them as a
+// suggestion. An item with a translation still waiting for review is skipped, so repeated runs
+// do not pile up duplicates.
+func translateItem(ctx context.Context, translator translation.Translator, item models.Item, languages []string, overwrite bool, glossary []translation.Term, createdBy string) (TranslationOutcome, error) {
+	outcome := TranslationOutcome{ItemID: item.ID, Name: item.Name}
+	pendingID, err := models.GetPendingSuggestionID(item.ID, translationSuggestionSource)
+	if err != nil {
+		return outcome, err
+	}
+	if pendingID != 0 {
+		outcome.PendingID = pendingID
+		outcome.Notes = fmt.Sprintf("suggestion %d is still pending review", pendingID)
+		return outcome, nil
+	}
+	known := map[string]string{
+		translation.LangEnglish:  item.NameEng,
+		translation.LangKorean:   item.NameKor,
+		translation.LangJapanese: item.NameJpn,
+		translation.LangChinese:  item.NameChn,
+	}
+	if len(languages) == 0 {
+		languages = translation.Languages
+	}
+	targets := []string{}
+	for _, lang := range languages {
+		if overwrite || known[lang] == "" {
+			targets = append(targets, lang)
+		}
+	}
+	if len(targets) == 0 {
+		outcome.Notes = "item already has every requested name"
+		return outcome, nil
+	}
+
+	result, err := translator.Translate(ctx, translation.Request{
+		Name:      item.Name,
+		Known:     known,
+		Languages: targets,
+		Glossary:  glossary,
+	})
+	if err != nil {
+		return outcome, err
+	}
+	outcome.Notes = result.Notes
+
+	changes := map[string]string{}
+	for _, lang := range targets {
+		if name := result.Names[lang]; name != "" && name != known[lang] {
+			changes["name_"+lang] = name
+		}
+	}
+	if len(changes) == 0 {
+		return outcome, nil
+	}
+
+	model := result.Model
+	if model == "" {
+		model = translator.Name()
+	}
+	suggestion, err := models.CreateAISuggestion(models.AISuggestion{
+		ItemID:    item.ID,
+		Source:    translationSuggestionSource,
+		Model:     model,
+		Changes:   changes,
+		Reasoning: result.Notes,
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		return outcome, err
+	}
+	outcome.Suggestion = &suggestion
+	return outcome, nil
+}
+
+// newTranslator builds the translator for the requested mode, metering LLM calls to the caller
+func newTranslator(claims firebase.TokenClaims, mode string) (translation.Translator, error) {
+	if mode == "" {
+		mode = translation.DefaultMode()
+	}
+	var provider llm.Provider
+	if mode == translation.ModeLLM {
+		var err error
+		provider, err = meteredProviderFromEnv(claims, llmFeatureTranslation)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return translation.NewTranslator(mode, provider)
+}
+
+// loadTranslationGlossary converts the stored glossary into translator terms
+func loadTranslationGlossary() ([]translation.Term, error) {
+	stored, err := models.GetGlossaryTerms()
+	if err != nil {
+		return nil, err
+	}
+	terms := []translation.Term{}
+	for _, t := range stored {
+		terms = append(terms, translation.Term{
+			Source: t.Term,
+			Translations: map[string]string{
+				translation.LangEnglish:  t.NameEng,
+				translation.LangKorean:   t.NameKor,
+				translation.LangJapanese: t.NameJpn,
+				translation.LangChinese:  t.NameChn,
+			},
+		})
+	}
+	return terms, nil
+}
+
+func validTranslationLanguages(w http.ResponseWriter, languages []string) bool {
+	for _, lang := range languages {
+		if !translation.IsLanguage(lang) {
+			models.WriteServiceError(w, "Unsupported language: "+lang+" (use eng, kor, jpn or chn)", false, true, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// readOptionalJSON decodes the body into v when there is one; it writes the error response itself
+func readOptionalJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return false
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, v); err != nil {
+			models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// HandleGetGlossary handles GET requests to list the translation glossary
+func HandleGetGlossary(w http.ResponseWriter, r *http.Request) {
+	terms, err := models.GetGlossaryTerms()
+	if err != nil {
+		log.Printf("Error listing glossary: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve glossary", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Glossary retrieved successfully", terms, true, true, http.StatusOK)
+}
+
+// HandleCreateGlossaryTerm handles POST requests to add a glossary term
+func HandleCreateGlossaryTerm(w http.ResponseWriter, r *http.Request) {
+	term, ok := readGlossaryTerm(w, r)
+	if !ok {
+		return
+	}
+	created, err := models.CreateGlossaryTerm(term)
+	if err != nil {
+		log.Printf("Error creating glossary term: %v", err)
+		models.WriteServiceError(w, "Failed to create glossary term", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Glossary term created successfully", created, true, true, http.StatusCreated)
+}
+
+// HandleUpdateGlossaryTerm handles PUT requests to replace a glossary term
+func HandleUpdateGlossaryTerm(w http.ResponseWriter, r *http.Request) {
+	termID, err := strconv.ParseInt(mux.Vars(r)["termId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid term ID", false, true, http.StatusBadRequest)
+		return
+	}
+	term, ok := readGlossaryTerm(w, r)
+	if !ok {
+		return
+	}
+	term.ID = termID
+	updated, err := models.UpdateGlossaryTerm(term)
+	if err != nil {
+		log.Printf("Error updating glossary term %d: %v", termID, err)
+		models.WriteServiceError(w, "Failed to update glossary term", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "Glossary term updated successfully", updated, true, true, http.StatusOK)
+}
+
+// HandleDeleteGlossaryTerm handles DELETE requests to remove a glossary term
+func HandleDeleteGlossaryTerm(w http.ResponseWriter, r *http.Request) {
+	termID, err := strconv.ParseInt(mux.Vars(r)["termId"], 10, 64)
+	if err != nil {
+		models.WriteServiceError(w, "Invalid term ID", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := models.DeleteGlossaryTerm(termID); err != nil {
+		models.WriteServiceError(w, "Glossary term not found", false, true, http.StatusNotFound)
+		return
+	}
+	models.WriteServiceResponse(w, "Glossary term deleted successfully", nil, true, true, http.StatusOK)
+}
+
+func readGlossaryTerm(w http.ResponseWriter, r *http.Request) (models.GlossaryTerm, bool) {
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	if tokenClaims.Email == "" {
+		models.WriteServiceError(w, "User authentication required", false, false, http.StatusUnauthorized)
+		return models.GlossaryTerm{}, false
+	}
+
+	var term models.GlossaryTerm
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return models.GlossaryTerm{}, false
+	}
+	if err := json.Unmarshal(body, &term); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return models.GlossaryTerm{}, false
+	}
+	term.Term = strings.TrimSpace(term.Term)
+	if term.Term == "" {
+		models.WriteServiceError(w, "Term is required", false, true, http.StatusBadRequest)
+		return models.GlossaryTerm{}, false
+	}
+	if term.NameEng == "" && term.NameKor == "" && term.NameJpn == "" && term.NameChn == "" {
+		models.WriteServiceError(w, "At least one translation is required", false, true, http.StatusBadRequest)
+		return models.GlossaryTerm{}, false
+	}
+	term.UpdatedBy = tokenClaims.Email
+	return term, true
+}
@@ -2,81 +2,249 @@ package apis
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/middleware"
 	"github.com/jimyeongjung/owlverload_api/models"
 )
 
-type UserRequest struct {
-	User models.User `json:"user"`
+// HandleSignIn handles POST requests recording a sign-in. The caller sends their ID token as
+// a Bearer token; the user record is created or refreshed from the verified claims only, and the
+// stored user is returned with its role, permissions and home store.
+func HandleSignIn(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleSignIn---")
+	verifier, err := firebase.DefaultVerifier()
+	if err != nil {
+		log.Printf("Sign-in: token verifier is not available: %v", err)
+		models.WriteServiceError(w, "Authentication is not available", false, false, http.StatusServiceUnavailable)
+		return
+	}
+	tokenClaims, errorMessage, ok := middleware.VerifyBearerToken(r, verifier)
+	if !ok {
+		models.WriteServiceError(w, errorMessage, false, false, http.StatusUnauthorized)
+		return
+	}
+
+	active, err := models.IsUserActive(tokenClaims.UID)
+	if err != nil {
+		log.Printf("Sign-in: failed to check status of %s: %v", tokenClaims.UID, err)
+		models.WriteServiceError(w, "Failed to sign in", false, false, http.StatusInternalServerError)
+		return
+	}
+	if !active {
+		models.WriteServiceError(w, "This account has been deactivated", false, true, http.StatusForbidden)
+		return
+	}
+
+	user, err := models.SignInUser(models.User{
+		Uid:           tokenClaims.UID,
+		Email:         tokenClaims.Email,
+		DisplayName:   tokenClaims.DisplayName,
+		EmailVerified: tokenClaims.EmailVerified,
+		IsAnonymous:   tokenClaims.IsAnonymous,
+		PhoneNumber:   tokenClaims.PhoneNumber,
+		PhotoURL:      tokenClaims.PhotoURL,
+		ProviderId:    tokenClaims.ProviderId,
+	})
+	if err != nil {
+		log.Printf("Sign-in: failed to save user %s: %v", tokenClaims.UID, err)
+		models.WriteServiceError(w, "Failed to save user", false, false, http.StatusInternalServerError)
+		return
+	}
+
+	// Pick up role or store changes made while the user was away
+	middleware.InvalidateUserCache(user.Uid)
+	role, err := models.ResolveUserRole(user.Uid, user.Email, tokenClaims.EmailVerified)
+	if err != nil {
+		log.Printf("Sign-in: failed to resolve role of %s: %v", user.Uid, err)
+		models.WriteServiceError(w, "Failed to sign in", false, true, http.StatusInternalServerError)
+		return
+	}
+	storeID, err := models.ResolveUserStore(user.Uid)
+	if err != nil {
+		log.Printf("Sign-in: failed to resolve store of %s: %v", user.Uid, err)
+		models.WriteServiceError(w, "Failed to sign in", false, true, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"user":        user,
+		"role":        role,
+		"permissions": middleware.RolePermissions(role),
+		"store_id":    storeID,
+	}
+	models.WriteServiceResponse(w, "Success", response, true, true, http.StatusOK)
 }
 
-// HandleSignIn handles POST requests to save user data
-func HandleSignIn(w http.ResponseWriter, r *http.Request) {
+// HandleGetMe handles GET requests for the caller's profile with their role and active store
+func HandleGetMe(w http.ResponseWriter, r *http.Request) {
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	user, err := models.GetUser(tokenClaims.UID)
+	if errors.Is(err, models.ErrUserNotFound) {
+		models.WriteServiceError(w, "User not found", false, false, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading profile of %s: %v", tokenClaims.UID, err)
+		models.WriteServiceError(w, "Failed to retrieve profile", false, true, http.StatusInternalServerError)
+		return
+	}
+	response := map[string]interface{}{
+		"user":         user,
+		"role":         tokenClaims.Role,
+		"active_store": tokenClaims.StoreID,
+	}
+	models.WriteServiceResponse(w, "Profile retrieved successfully", response, true, true, http.StatusOK)
+}
+
+// HandleUpdateMe handles PUT requests that edit the caller's own profile: display name, phone
+// number, preferred language, default store and default location
+func HandleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleUpdateMe---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
 
-	// Parse the request body
+	var request models.UserProfileUpdate
 	body, err := io.ReadAll(r.Body)
-	result := make([]models.User, 1)
+	if err != nil {
+		models.WriteServiceError(w, "Failed to read request body", false, true, http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		models.WriteServiceError(w, "Invalid request format", false, true, http.StatusBadRequest)
+		return
+	}
+
+	user, err := models.UpdateUserProfile(tokenClaims.UID, request)
+	if errors.Is(err, models.ErrUserNotFound) {
+		models.WriteServiceError(w, "User not found", false, false, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating profile of %s: %v", tokenClaims.UID, err)
+		models.WriteServiceError(w, fmt.Sprintf("Failed to update profile: %v", err), false, true, http.StatusBadRequest)
+		return
+	}
+	// A new default store changes the home store
+	middleware.InvalidateUserCache(tokenClaims.UID)
+	models.WriteServiceResponse(w, "Profile updated successfully", user, true, true, http.StatusOK)
+}
 
+// HandleGetUsers handles GET requests listing users.
+// Query: q (email, name, uid or branch), status=active|inactive, limit (default 50), offset
+func HandleGetUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	if status != "" && status != "active" && status != "inactive" {
+		models.WriteServiceError(w, "status must be active or inactive", false, true, http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 && v <= 500 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(query.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+
+	users, total, err := models.GetUsers(strings.TrimSpace(query.Get("q")), status, limit, offset)
 	if err != nil {
-		models.WriteServiceError(w, "Failed to save user: uid is empty", false, false, http.StatusBadRequest)
-		if err != nil {
-			log.Printf("Failed to write service error: %v", err)
-		}
+		log.Printf("Error listing users: %v", err)
+		models.WriteServiceError(w, "Failed to retrieve users", false, true, http.StatusInternalServerError)
 		return
 	}
+	response := map[string]interface{}{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	}
+	models.WriteServiceResponse(w, "Users retrieved successfully", response, true, true, http.StatusOK)
+}
 
-	var userRequest UserRequest
-	err = json.Unmarshal(body, &userRequest)
+// HandleGetUser handles GET requests for one user
+func HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	uid := mux.Vars(r)["uid"]
+	user, err := models.GetUser(uid)
+	if errors.Is(err, models.ErrUserNotFound) {
+		models.WriteServiceError(w, "User not found", false, true, http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		models.WriteServiceError(w, "Failed to save user: uid is empty", false, false, http.StatusBadRequest)
-		if err != nil {
-			log.Printf("Failed to write service error: %v", err)
-		}
-		return
-	}
-
-	user := userRequest.User
-	fmt.Println("user params:", user)
-
-	if user.Uid == "" {
-		models.WriteServiceError(w, "Failed to save user: uid is empty", false, false, http.StatusBadRequest)
-		if err != nil {
-			log.Printf("Failed to write service error: %v", err)
-		}
-		return
-	}
-	// check if user exists
-	isSaved := user.IsUserSaved(user.Uid)
-
-	if isSaved {
-		// update login time
-		user.LoginAt = time.Now()
-		user, err = user.Update(user.Uid)
-		if err != nil {
-			fmt.Println("err:", err)
-		}
-	} else {
-		// save user
-		user, err = user.Save()
-		if err != nil {
-			// http.Error(w, "Failed to save user", http.StatusInternalServerError)
-			models.WriteServiceError(w, "Failed to save user", false, false, http.StatusInternalServerError)
-			if err != nil {
-				log.Printf("Failed to write service error: %v", err)
-			}
-			return
-		}
-	}
-
-	result[0] = user
-
-	// return user data
-	// service response
-	models.WriteServiceResponse(w, "Success", result, true, true, http.StatusOK)
-	fmt.Println("---User response sent---")
+		log.Printf("Error loading user %s: %v", uid, err)
+		models.WriteServiceError(w, "Failed to retrieve user", false, true, http.StatusInternalServerError)
+		return
+	}
+	models.WriteServiceResponse(w, "User retrieved successfully", user, true, true, http.StatusOK)
+}
+
+// HandleDeactivateUser handles POST requests that stop a user from using the API
+func HandleDeactivateUser(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleDeactivateUser---")
+	handleSetUserActive(w, r, false, "User deactivated successfully")
+}
+
+// HandleReactivateUser handles POST requests that let a deactivated user back in
+func HandleReactivateUser(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleReactivateUser---")
+	handleSetUserActive(w, r, true, "User reactivated successfully")
+}
+
+func handleSetUserActive(w http.ResponseWriter, r *http.Request, active bool, message string) {
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	uid := mux.Vars(r)["uid"]
+	if uid == tokenClaims.UID {
+		models.WriteServiceError(w, "You cannot change your own account status", false, true, http.StatusBadRequest)
+		return
+	}
+
+	user, err := models.SetUserActive(uid, active, tokenClaims.Email)
+	if errors.Is(err, models.ErrUserNotFound) {
+		models.WriteServiceError(w, "User not found", false, true, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error setting user %s active=%t: %v", uid, active, err)
+		models.WriteServiceError(w, "Failed to update user", false, true, http.StatusInternalServerError)
+		return
+	}
+	middleware.InvalidateUserCache(uid)
+	models.WriteServiceResponse(w, message, user, true, true, http.StatusOK)
+}
+
+// HandleDeleteUser handles DELETE requests that remove a user's personal data. Their history is
+// kept under an anonymised actor, except the hash-chained audit log (see models.DeleteUser).
+func HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	fmt.Println("---HandleDeleteUser---")
+	tokenClaims := firebase.GetTokenClaimsFromContext(r.Context())
+	uid := mux.Vars(r)["uid"]
+	if uid == tokenClaims.UID {
+		models.WriteServiceError(w, "You cannot delete your own account", false, true, http.StatusBadRequest)
+		return
+	}
+
+	actor, err := models.DeleteUser(uid, tokenClaims.Email)
+	if errors.Is(err, models.ErrUserNotFound) {
+		models.WriteServiceError(w, "User not found", false, true, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting user %s: %v", uid, err)
+		models.WriteServiceError(w, "Failed to delete user", false, true, http.StatusInternalServerError)
+		return
+	}
+	middleware.InvalidateUserCache(uid)
+	response := map[string]interface{}{
+		"uid":              uid,
+		"anonymised_actor": actor,
+	}
+	models.WriteServiceResponse(w, "User deleted successfully", response, true, true, http.StatusOK)
 }
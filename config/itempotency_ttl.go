@@ -10,18 +10,23 @@ const (
 	// 기본값 (운영에서는 환경변수로 덮어쓰기)
 	defaultProcessingTTLms int64 = 30_000     // 30s
 	defaultDoneTTLms       int64 = 86_400_000 // 24h
+	defaultMaxReplayBytes        = 256 << 10  // 256KiB
 )
 
 var (
-	ttlOnce sync.Once
-	procTTL int64 = defaultProcessingTTLms
-	doneTTL int64 = defaultDoneTTLms
+	ttlOnce   sync.Once
+	procTTL   int64 = defaultProcessingTTLms
+	doneTTL   int64 = defaultDoneTTLms
+	failOpen        = true
+	maxReplay       = defaultMaxReplayBytes
 )
 
 // ENV
 //
 //	IDEM_PROCESSING_TTL_MS  예: 30000 (30초)
 //	IDEM_DONE_TTL_MS        예: 86400000 (24시간)
+//	IDEM_FAIL_MODE          open (default) | closed
+//	IDEM_MAX_REPLAY_BYTES   예: 262144 (256KiB)
 func initTTLs() {
 	if v := os.Getenv("IDEM_PROCESSING_TTL_MS"); v != "" {
 		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
@@ -33,6 +38,14 @@ func initTTLs() {
 			doneTTL = n
 		}
 	}
+	if v := os.Getenv("IDEM_MAX_REPLAY_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			maxReplay = n
+		}
+	}
+	if v := os.Getenv("IDEM_FAIL_MODE"); v == "closed" {
+		failOpen = false
+	}
 }
 
 // 임시 처리 락 TTL(ms)
@@ -46,3 +59,17 @@ func DoneTTL() int64 {
 	ttlOnce.Do(initTTLs)
 	return doneTTL
 }
+
+// IdempotencyFailOpen reports whether requests go ahead without the duplicate check when the
+// idempotency store is unavailable (open), or are refused with 503 (closed)
+func IdempotencyFailOpen() bool {
+	ttlOnce.Do(initTTLs)
+	return failOpen
+}
+
+// IdempotencyMaxReplayBytes is the largest response body kept for replaying to retries; larger
+// responses are replayed as a short "already processed" reply
+func IdempotencyMaxReplayBytes() int {
+	ttlOnce.Do(initTTLs)
+	return maxReplay
+}
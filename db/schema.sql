@@ -27,4 +27,365 @@ CREATE TABLE IF NOT EXISTS stock_transactions (
 -- Index for faster queries
 CREATE INDEX idx_stock_transactions_item_id ON stock_transactions(item_id);
 CREATE INDEX idx_stock_transactions_user_id ON stock_transactions(user_id);
-CREATE INDEX idx_items_barcode ON items(barcode);
\ No newline at end of file
+CREATE INDEX idx_items_barcode ON items(barcode);
+
+-- AI suggestions waiting for human review (one row per suggested change set)
+CREATE TABLE IF NOT EXISTS ai_suggestions (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    item_id VARCHAR(128) NOT NULL,
+    job_id BIGINT NULL,
+    source VARCHAR(32) NOT NULL,
+    model VARCHAR(64),
+    changes JSON NOT NULL,
+    reasoning TEXT,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_ai_suggestions_item_status ON ai_suggestions(item_id, status);
+
+-- Batch AI enrichment jobs
+CREATE TABLE IF NOT EXISTS enrichment_jobs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    status VARCHAR(32) NOT NULL,
+    concurrency INT NOT NULL,
+    budget_tokens INT NOT NULL,
+    total_items INT NOT NULL DEFAULT 0,
+    processed INT NOT NULL DEFAULT 0,
+    succeeded INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    prompt_tokens INT NOT NULL DEFAULT 0,
+    completion_tokens INT NOT NULL DEFAULT 0,
+    started_by VARCHAR(255) NOT NULL,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS enrichment_job_failures (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    job_id BIGINT NOT NULL,
+    item_id VARCHAR(128) NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (job_id) REFERENCES enrichment_jobs(id) ON DELETE CASCADE
+);
+
+-- Reviewer decisions on AI suggestions, one row per field
+CREATE TABLE IF NOT EXISTS ai_suggestion_reviews (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    suggestion_id BIGINT NOT NULL,
+    field VARCHAR(64) NOT NULL,
+    decision VARCHAR(16) NOT NULL,
+    suggested_value TEXT,
+    applied_value TEXT,
+    reviewed_by VARCHAR(255) NOT NULL,
+    reviewed_at TIMESTAMP NOT NULL,
+    UNIQUE KEY uq_ai_suggestion_reviews_field (suggestion_id, field),
+    FOREIGN KEY (suggestion_id) REFERENCES ai_suggestions(id) ON DELETE CASCADE
+);
+
+-- Ledger of every LLM call (including calls refused by a quota)
+CREATE TABLE IF NOT EXISTS llm_usage (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_uid VARCHAR(128),
+    user_email VARCHAR(255),
+    branch VARCHAR(128),
+    feature VARCHAR(64) NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    model VARCHAR(64) NOT NULL,
+    prompt_tokens INT NOT NULL DEFAULT 0,
+    completion_tokens INT NOT NULL DEFAULT 0,
+    total_tokens INT NOT NULL DEFAULT 0,
+    cost_usd DECIMAL(12, 6) NOT NULL DEFAULT 0,
+    outcome VARCHAR(16) NOT NULL,
+    error TEXT,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_llm_usage_user_created ON llm_usage(user_email, created_at);
+CREATE INDEX idx_llm_usage_branch_created ON llm_usage(branch, created_at);
+
+-- Daily/monthly token and cost caps; subject '*' is the default for the scope
+CREATE TABLE IF NOT EXISTS llm_quotas (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    scope VARCHAR(16) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    period VARCHAR(16) NOT NULL,
+    max_tokens INT NOT NULL DEFAULT 0,
+    max_cost_usd DECIMAL(12, 4) NOT NULL DEFAULT 0,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE KEY uq_llm_quotas_subject (scope, subject, period)
+);
+
+-- Store glossary of brand and product terms with their fixed translations
+CREATE TABLE IF NOT EXISTS translation_glossary (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    term VARCHAR(255) NOT NULL UNIQUE,
+    name_eng VARCHAR(255),
+    name_kor VARCHAR(255),
+    name_jpn VARCHAR(255),
+    name_chn VARCHAR(255),
+    notes TEXT,
+    updated_by VARCHAR(255),
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Images attached to an item; the primary one is mirrored into items.image_path. image_id is the
+-- upload's UUID (the file name for older images), so fingerprint lookups join on an index.
+CREATE TABLE IF NOT EXISTS item_images (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    item_id VARCHAR(128) NOT NULL,
+    image_path VARCHAR(512) NOT NULL,
+    image_id VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL DEFAULT 'other',
+    sort_order INT NOT NULL DEFAULT 0,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_item_images_item ON item_images(item_id, sort_order);
+CREATE INDEX idx_item_images_image ON item_images(image_id);
+
+-- Items whose image_path predates item_images get it as their primary image, so listing, duplicate
+-- detection and search-by-photo see it. image_id follows models.FingerprintImageID; fingerprint the
+-- new rows with POST /api/v1/admin/images/fingerprints/backfill.
+INSERT INTO item_images (item_id, image_path, image_id, role, sort_order, is_primary, created_at)
+SELECT i.item_id, i.image_path,
+    IF(CHAR_LENGTH(SUBSTRING_INDEX(SUBSTRING_INDEX(i.image_path, '/', -1), '.', 1)) = 36,
+        SUBSTRING_INDEX(SUBSTRING_INDEX(i.image_path, '/', -1), '.', 1),
+        SUBSTRING_INDEX(i.image_path, '/', -1)),
+    'front', 0, TRUE, NOW()
+FROM items i
+WHERE IFNULL(i.image_path, '') NOT IN ('', '/')
+    AND NOT EXISTS (SELECT 1 FROM item_images ii WHERE ii.item_id = i.item_id);
+
+-- Responsive sizes/formats generated for each upload, all under the upload's image id
+CREATE TABLE IF NOT EXISTS image_variants (
+    image_id VARCHAR(64) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    format VARCHAR(8) NOT NULL,
+    storage_key VARCHAR(512) NOT NULL,
+    file_size BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (image_id, width, format)
+);
+
+-- Image garbage collection runs: a scan records candidates, a later pass deletes them
+CREATE TABLE IF NOT EXISTS image_gc_runs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    status VARCHAR(16) NOT NULL,
+    grace_hours INT NOT NULL,
+    scanned_objects INT NOT NULL DEFAULT 0,
+    candidates INT NOT NULL DEFAULT 0,
+    candidate_bytes BIGINT NOT NULL DEFAULT 0,
+    deleted INT NOT NULL DEFAULT 0,
+    deleted_bytes BIGINT NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    started_by VARCHAR(255) NOT NULL,
+    deleted_by VARCHAR(255),
+    error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    scanned_at TIMESTAMP NULL,
+    deleted_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS image_gc_candidates (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    run_id BIGINT NOT NULL,
+    image_id VARCHAR(64) NOT NULL,
+    storage_key VARCHAR(512) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    last_modified TIMESTAMP NULL,
+    status VARCHAR(16) NOT NULL,
+    reason TEXT,
+    FOREIGN KEY (run_id) REFERENCES image_gc_runs(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_image_gc_candidates_run ON image_gc_candidates(run_id, status);
+
+-- Perceptual hash of each upload, used to flag near-duplicate product photos, and its colour
+-- histogram (64 bins) for search-by-photo, NULL until backfilled
+CREATE TABLE IF NOT EXISTS image_fingerprints (
+    image_id VARCHAR(64) PRIMARY KEY,
+    dhash BIGINT UNSIGNED NOT NULL,
+    histogram VARBINARY(64) NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- Raw uploads made through presigned PUT URLs, processed by /upload/image/finalize
+CREATE TABLE IF NOT EXISTS image_uploads (
+    id VARCHAR(64) PRIMARY KEY,
+    storage_key VARCHAR(512) NOT NULL,
+    content_type VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    image_id VARCHAR(64),
+    error TEXT,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    finalized_at TIMESTAMP NULL
+);
+
+-- Role each user acts with (staff, supervisor, manager, admin); users without a row
+-- fall back to their designation, RBAC_ADMIN_EMAILS, then staff
+CREATE TABLE IF NOT EXISTS user_roles (
+    firebase_uid VARCHAR(128) PRIMARY KEY,
+    role VARCHAR(16) NOT NULL,
+    assigned_by VARCHAR(255),
+    assigned_at TIMESTAMP NOT NULL
+);
+
+-- Stores (branches). Stock, locations, markdowns and stock transactions belong to one store;
+-- items are shared unless items.store_id names the store they belong to
+CREATE TABLE IF NOT EXISTS stores (
+    id VARCHAR(64) PRIMARY KEY,
+    code VARCHAR(32) NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    branch VARCHAR(255) NULL UNIQUE,
+    address VARCHAR(512),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Existing single-store data moves into the default store
+INSERT IGNORE INTO stores (id, code, name) VALUES ('default', 'DEFAULT', 'Main store');
+
+ALTER TABLE stocks ADD COLUMN store_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE stock_transactions ADD COLUMN store_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE items ADD COLUMN store_id VARCHAR(64) NULL;
+CREATE INDEX idx_stocks_store_product ON stocks(store_id, fkproduct_id);
+CREATE INDEX idx_stock_transactions_store ON stock_transactions(store_id, created_at);
+CREATE INDEX idx_items_store ON items(store_id);
+
+-- Inter-store transfer orders: requested -> dispatched (in transit) -> partially_received/received,
+-- or cancelled before dispatch. Every transition is also written to stock_transactions.
+CREATE TABLE IF NOT EXISTS transfer_orders (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    from_store_id VARCHAR(64) NOT NULL,
+    to_store_id VARCHAR(64) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    notes TEXT,
+    requested_by VARCHAR(255) NOT NULL,
+    requested_at TIMESTAMP NOT NULL,
+    dispatched_by VARCHAR(255),
+    dispatched_at TIMESTAMP NULL,
+    received_by VARCHAR(255),
+    received_at TIMESTAMP NULL,
+    cancelled_by VARCHAR(255),
+    cancelled_at TIMESTAMP NULL
+);
+CREATE INDEX idx_transfer_orders_from ON transfer_orders(from_store_id, status);
+CREATE INDEX idx_transfer_orders_to ON transfer_orders(to_store_id, status);
+
+CREATE TABLE IF NOT EXISTS transfer_order_lines (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    transfer_id BIGINT NOT NULL,
+    stock_id VARCHAR(128) NOT NULL,
+    item_id VARCHAR(128) NOT NULL,
+    stock_type VARCHAR(16) NOT NULL,
+    quantity INT NOT NULL,
+    expiry_date TIMESTAMP NULL,
+    location VARCHAR(255),
+    lot_notes TEXT,
+    discount_rate INT NOT NULL DEFAULT 0,
+    received_quantity INT NOT NULL DEFAULT 0,
+    missing_quantity INT NOT NULL DEFAULT 0,
+    discrepancy TEXT,
+    FOREIGN KEY (transfer_id) REFERENCES transfer_orders(id) ON DELETE CASCADE
+);
+
+ALTER TABLE stock_transactions ADD COLUMN transfer_id BIGINT NULL;
+ALTER TABLE stocks ADD COLUMN origin_stock_id VARCHAR(128) NULL;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    store_id VARCHAR(64) NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    last_used_ip VARCHAR(64),
+    revoked_by VARCHAR(255),
+    revoked_at TIMESTAMP NULL,
+    FOREIGN KEY (store_id) REFERENCES stores(id)
+);
+
+-- Profile settings and account status of users; deleted users stay as anonymised, inactive rows
+ALTER TABLE users ADD COLUMN preferred_language VARCHAR(16) NULL;
+ALTER TABLE users ADD COLUMN default_store_id VARCHAR(64) NULL;
+ALTER TABLE users ADD COLUMN default_location VARCHAR(255) NULL;
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE users ADD COLUMN deactivated_by VARCHAR(255) NULL;
+ALTER TABLE users ADD COLUMN deactivated_at TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP NULL;
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMP NULL;
+
+-- Audit log of mutating requests. Each hash covers the entry and the previous hash; payloads
+-- are TEXT rather than JSON so MySQL does not reformat the hashed bytes.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    request_id VARCHAR(64) NOT NULL,
+    actor_uid VARCHAR(128) NOT NULL,
+    actor_email VARCHAR(255) NOT NULL,
+    actor_role VARCHAR(32) NOT NULL,
+    store_id VARCHAR(64),
+    method VARCHAR(8) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    path VARCHAR(512) NOT NULL,
+    entity_type VARCHAR(64) NOT NULL,
+    entity_id VARCHAR(128),
+    before_json MEDIUMTEXT,
+    after_json MEDIUMTEXT,
+    diff_json MEDIUMTEXT,
+    status INT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL
+);
+CREATE INDEX idx_audit_log_entity ON audit_log(entity_type, entity_id, created_at);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_email, created_at);
+CREATE INDEX idx_audit_log_created ON audit_log(created_at);
+
+-- Head of the audit hash chain, locked while appending
+CREATE TABLE IF NOT EXISTS audit_chain (
+    id TINYINT PRIMARY KEY,
+    last_id BIGINT NOT NULL,
+    last_hash CHAR(64) NOT NULL
+);
+INSERT IGNORE INTO audit_chain (id, last_id, last_hash) VALUES (1, 0, '');
+
+-- Numbered snapshots of an item's editable fields and tags
+CREATE TABLE IF NOT EXISTS item_versions (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    item_id VARCHAR(128) NOT NULL,
+    version INT NOT NULL,
+    change_type VARCHAR(16) NOT NULL,
+    restored_from INT NULL,
+    snapshot JSON NOT NULL,
+    changed_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE KEY uniq_item_version (item_id, version)
+);
+
+-- Optimistic concurrency: bumped on every write, exposed as the ETag of items and stock lots
+ALTER TABLE items ADD COLUMN row_version INT NOT NULL DEFAULT 1;
+ALTER TABLE stocks ADD COLUMN row_version INT NOT NULL DEFAULT 1;
+
+-- Idempotency keys for IDEM_STORE=mysql; key_hash is the derived key, a SHA-256 hex of the
+-- caller, route and Idempotency-Key header
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key_hash CHAR(64) PRIMARY KEY,
+    state VARCHAR(16) NOT NULL,
+    result MEDIUMBLOB NULL,
+    expires_at DATETIME(3) NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_idempotency_keys_expires ON idempotency_keys(expires_at);
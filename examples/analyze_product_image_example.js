@@ -1,30 +1,26 @@
 // Example client-side code for calling the analyzeProductImage API endpoint
 
-// Function to convert file to base64
-function fileToBase64(file) {
-  return new Promise((resolve, reject) => {
-    const reader = new FileReader();
-    reader.readAsDataURL(file);
-    reader.onload = () => resolve(reader.result.split(',')[1]); // Split to get just the base64 part
-    reader.onerror = error => reject(error);
-  });
-}
-
 // Function to analyze a product image
-async function analyzeProductImage(imageFile, authToken) {
+// Optional: pass { itemId } to store the processed photo and attach it to that item,
+// or { storeImage: true } to keep the photo without attaching it.
+async function analyzeProductImage(imageFile, authToken, options = {}) {
   try {
-    // Convert image to base64
-    const base64Image = await fileToBase64(imageFile);
-    
+    // The endpoint takes the same multipart "image" field as /api/v1/upload/image
+    const formData = new FormData();
+    formData.append('image', imageFile);
+    if (options.itemId) {
+      formData.append('item_id', options.itemId);
+    }
+    if (options.storeImage) {
+      formData.append('store_image', 'true');
+    }
+
     const response = await fetch('http://your-api-url/api/v1/analyzeProductImage', {
       method: 'POST',
       headers: {
-        'Content-Type': 'application/json',
         'Authorization': `Bearer ${authToken}` // Pass Firebase auth token for authentication
       },
-      body: JSON.stringify({
-        image: base64Image
-      })
+      body: formData
     });
 
     const data = await response.json();
@@ -36,7 +32,21 @@ async function analyzeProductImage(imageFile, authToken) {
       // {
       //   message: "Product analysis completed",
       //   payload: {
-      //     analysis: "1. Product Name: Example Product\n2. Expiry Date: 01/01/2025\n..."
+      //     analysis: {
+      //       name: { english: "...", korean: "...", japanese: "...", chinese: "..." },
+      //       expiry_date: "2025-01-01",
+      //       ingredients: "...",
+      //       ingredients_translated: "...",
+      //       allergens: ["wheat", "soy"],
+      //       contains_alcohol: "No",
+      //       contains_pork: "No",
+      //       contains_beef: "Unclear",
+      //       is_plant_based: "No",
+      //       halal_status: "Unclear",
+      //       reasoning: "..."
+      //     },
+      //     image: { image_path: "...", image_id: "...", ... }, // only when stored
+      //     item_id: "..."                                     // only when attached
       //   },
       //   success: true,
       //   userExists: true
@@ -88,15 +98,14 @@ function ProductScanner() {
       // Call the API
       const response = await analyzeProductImage(image, token);
       
-      // Parse the analysis to display in a structured way
-      const analysisLines = response.payload.analysis.split('\n');
+      const analysis = response.payload.analysis;
       const parsedAnalysis = {
-        productName: analysisLines[0].replace('1. Product Name:', '').trim(),
-        expiryDate: analysisLines[1].replace('2. Expiry Date:', '').trim(),
-        ingredients: analysisLines[2].replace('3. Ingredients:', '').trim(),
-        alcohol: analysisLines[3].replace('4. Alcohol:', '').trim(),
-        halal: analysisLines[4].replace('5. Halal:', '').trim(),
-        reasoning: analysisLines[5].replace('6. Reasoning:', '').trim()
+        productName: analysis.name.english,
+        expiryDate: analysis.expiry_date,
+        ingredients: analysis.ingredients_translated,
+        alcohol: analysis.contains_alcohol,
+        halal: analysis.halal_status,
+        reasoning: analysis.reasoning
       };
       
       // Handle success
@@ -11,6 +11,14 @@ import (
 	"google.golang.org/api/option"
 )
 
+// authClient is kept for handlers that manage Firebase users (e.g. custom claims)
+var authClient *auth.Client
+
+// AuthClient returns the client created by InitFirebaseApp, or nil before it ran
+func AuthClient() *auth.Client {
+	return authClient
+}
+
 // Initialize Firebase app once at startup
 func InitFirebaseApp() (*auth.Client, error) {
 	ctx := context.Background()
@@ -40,6 +48,7 @@ func InitFirebaseApp() (*auth.Client, error) {
 	// 	log.Fatalf("error initializing client: %v\n", err)
 	// }
 
+	authClient = client
 	return client, nil
 }
 
@@ -70,6 +79,9 @@ type TokenClaims struct {
 	LoginAt       time.Time `json:"loginAt"`
 	CreatedAt     time.Time `json:"createdAt"`
 	Aud           string    `json:"aud"`
+	Role          string    `json:"role"`                 // set by middleware.RequirePermission
+	StoreID       string    `json:"store_id"`             // set by middleware.ResolveStore
+	APIKeyID      int64     `json:"api_key_id,omitempty"` // set when authenticated by middleware.AuthenticateAPIKey
 }
 
 // WithUserContext creates a context with user information
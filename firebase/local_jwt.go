@@ -0,0 +1,213 @@
+package firebase
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// localJWTLeeway absorbs clock skew when checking exp and nbf
+const localJWTLeeway = 30 * time.Second
+
+// LocalJWTConfig configures LocalJWTVerifier. Algorithm defaults to HS256 when a secret is
+// set and RS256 otherwise; PublicKey is a PEM block or the path of a PEM file.
+type LocalJWTConfig struct {
+	Algorithm string
+	Secret    string
+	PublicKey string
+	Issuer    string // optional, checked against "iss" when set
+	Audience  string // optional, checked against "aud" when set
+}
+
+// LocalJWTVerifier checks JWTs against a locally configured key, without calling Firebase
+type LocalJWTVerifier struct {
+	algorithm string
+	secret    []byte
+	publicKey *rsa.PublicKey
+	issuer    string
+	audience  string
+}
+
+// NewLocalJWTVerifier validates the configuration and loads the key
+func NewLocalJWTVerifier(config LocalJWTConfig) (*LocalJWTVerifier, error) {
+	v := &LocalJWTVerifier{
+		algorithm: strings.ToUpper(config.Algorithm),
+		issuer:    config.Issuer,
+		audience:  config.Audience,
+	}
+	if v.algorithm == "" {
+		v.algorithm = "RS256"
+		if config.Secret != "" {
+			v.algorithm = "HS256"
+		}
+	}
+
+	switch v.algorithm {
+	case "HS256":
+		if len(config.Secret) < 32 {
+			return nil, fmt.Errorf("AUTH_JWT_SECRET must be at least 32 bytes for HS256")
+		}
+		v.secret = []byte(config.Secret)
+	case "RS256":
+		key, err := parseRSAPublicKey(config.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		v.publicKey = key
+	default:
+		return nil, fmt.Errorf("unsupported AUTH_JWT_ALG %q, use HS256 or RS256", config.Algorithm)
+	}
+	return v, nil
+}
+
+func parseRSAPublicKey(value string) (*rsa.PublicKey, error) {
+	if value == "" {
+		return nil, fmt.Errorf("AUTH_JWT_PUBLIC_KEY is required for RS256")
+	}
+	data := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, fmt.Errorf("failed to read public key: %v", err)
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an RSA key")
+	}
+	return key, nil
+}
+
+func (v *LocalJWTVerifier) Driver() string {
+	return "local"
+}
+
+// Verify checks the signature, exp, nbf and the optional issuer and audience. The UID is
+// taken from "sub", falling back to "user_id" and "uid".
+func (v *LocalJWTVerifier) Verify(ctx context.Context, token string) (TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return TokenClaims{}, fmt.Errorf("invalid token: expected three segments")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return TokenClaims{}, fmt.Errorf("invalid token header: %v", err)
+	}
+	// The algorithm is fixed by configuration, never chosen by the token
+	if header.Alg != v.algorithm {
+		return TokenClaims{}, fmt.Errorf("invalid token: algorithm %q is not accepted", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return TokenClaims{}, fmt.Errorf("invalid token signature encoding")
+	}
+	if err := v.verifySignature(parts[0]+"."+parts[1], signature); err != nil {
+		return TokenClaims{}, err
+	}
+
+	raw := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return TokenClaims{}, fmt.Errorf("invalid token payload: %v", err)
+	}
+	now := time.Now()
+	exp, ok := raw["exp"].(float64)
+	if !ok {
+		return TokenClaims{}, fmt.Errorf("invalid token: missing exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(localJWTLeeway)) {
+		return TokenClaims{}, fmt.Errorf("token has expired")
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(localJWTLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return TokenClaims{}, fmt.Errorf("invalid token: not valid yet")
+	}
+	if v.issuer != "" && stringClaim(raw, "iss") != v.issuer {
+		return TokenClaims{}, fmt.Errorf("invalid token: unexpected issuer")
+	}
+	if v.audience != "" && !hasAudience(raw["aud"], v.audience) {
+		return TokenClaims{}, fmt.Errorf("invalid token: unexpected audience")
+	}
+
+	uid := stringClaim(raw, "sub")
+	if uid == "" {
+		uid = stringClaim(raw, "user_id")
+	}
+	if uid == "" {
+		uid = stringClaim(raw, "uid")
+	}
+	if uid == "" {
+		return TokenClaims{}, fmt.Errorf("invalid token: missing subject")
+	}
+
+	claims := ClaimsFromMap(uid, raw)
+	if claims.ProviderId == "" {
+		claims.ProviderId = "local"
+	}
+	if v.audience != "" {
+		claims.Aud = v.audience
+	}
+	return claims, nil
+}
+
+func (v *LocalJWTVerifier) verifySignature(signingInput string, signature []byte) error {
+	switch v.algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return fmt.Errorf("invalid signature")
+		}
+	case "RS256":
+		digest := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, into interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+// hasAudience accepts both the string and the array form of "aud"
+func hasAudience(aud interface{}, want string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == want
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package firebase
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, secret []byte, alg string, claims map[string]interface{}) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]string{"alg": alg, "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":            "user-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"exp":            float64(time.Now().Add(time.Hour).Unix()),
+	}
+}
+
+func newHS256Verifier(t *testing.T, config LocalJWTConfig) *LocalJWTVerifier {
+	t.Helper()
+	config.Secret = testSecret
+	v, err := NewLocalJWTVerifier(config)
+	if err != nil {
+		t.Fatalf("NewLocalJWTVerifier: %v", err)
+	}
+	return v
+}
+
+func TestLocalJWTVerifierHS256(t *testing.T) {
+	v := newHS256Verifier(t, LocalJWTConfig{})
+	if v.algorithm != "HS256" {
+		t.Fatalf("algorithm = %q, want HS256 when a secret is set", v.algorithm)
+	}
+
+	claims, err := v.Verify(context.Background(), signHS256(t, []byte(testSecret), "HS256", validClaims()))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.UID != "user-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+	if claims.ProviderId != "local" {
+		t.Errorf("ProviderId = %q, want local", claims.ProviderId)
+	}
+
+	if _, err := v.Verify(context.Background(), signHS256(t, []byte(strings.Repeat("x", 32)), "HS256", validClaims())); err == nil {
+		t.Error("token signed with another secret was accepted")
+	}
+}
+
+func TestLocalJWTVerifierRejectsShortSecret(t *testing.T) {
+	if _, err := NewLocalJWTVerifier(LocalJWTConfig{Secret: "short"}); err == nil {
+		t.Error("a secret shorter than 32 bytes was accepted")
+	}
+}
+
+func TestLocalJWTVerifierRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	v, err := NewLocalJWTVerifier(LocalJWTConfig{PublicKey: publicPEM})
+	if err != nil {
+		t.Fatalf("NewLocalJWTVerifier: %v", err)
+	}
+	if v.algorithm != "RS256" {
+		t.Fatalf("algorithm = %q, want RS256 without a secret", v.algorithm)
+	}
+
+	claims, err := v.Verify(context.Background(), signRS256(t, key, validClaims()))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.UID != "user-1" {
+		t.Errorf("UID = %q, want user-1", claims.UID)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if _, err := v.Verify(context.Background(), signRS256(t, other, validClaims())); err == nil {
+		t.Error("token signed with another key was accepted")
+	}
+
+	// Algorithm confusion: an HS256 token keyed with the public key must not pass an RS256 verifier
+	if _, err := v.Verify(context.Background(), signHS256(t, []byte(publicPEM), "HS256", validClaims())); err == nil {
+		t.Error("HS256 token signed with the RSA public key was accepted")
+	}
+}
+
+func TestLocalJWTVerifierRejectsOtherAlgorithms(t *testing.T) {
+	v := newHS256Verifier(t, LocalJWTConfig{})
+	for _, alg := range []string{"none", "RS256", "hs256"} {
+		token := signHS256(t, []byte(testSecret), alg, validClaims())
+		if _, err := v.Verify(context.Background(), token); err == nil {
+			t.Errorf("token with alg %q was accepted", alg)
+		}
+	}
+
+	unsigned := encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, validClaims()) + "."
+	if _, err := v.Verify(context.Background(), unsigned); err == nil {
+		t.Error("unsigned token was accepted")
+	}
+	if _, err := v.Verify(context.Background(), "not-a-token"); err == nil {
+		t.Error("malformed token was accepted")
+	}
+}
+
+func TestLocalJWTVerifierTimeClaims(t *testing.T) {
+	v := newHS256Verifier(t, LocalJWTConfig{})
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		modify func(map[string]interface{})
+		ok     bool
+	}{
+		{"valid", func(map[string]interface{}) {}, true},
+		{"missing exp", func(c map[string]interface{}) { delete(c, "exp") }, false},
+		{"expired", func(c map[string]interface{}) { c["exp"] = float64(now.Add(-time.Hour).Unix()) }, false},
+		{"expired within leeway", func(c map[string]interface{}) { c["exp"] = float64(now.Add(-10 * time.Second).Unix()) }, true},
+		{"not valid yet", func(c map[string]interface{}) { c["nbf"] = float64(now.Add(time.Hour).Unix()) }, false},
+		{"nbf within leeway", func(c map[string]interface{}) { c["nbf"] = float64(now.Add(10 * time.Second).Unix()) }, true},
+		{"exp of the wrong type", func(c map[string]interface{}) { c["exp"] = "tomorrow" }, false},
+		{"missing subject", func(c map[string]interface{}) { delete(c, "sub") }, false},
+		{"user_id instead of sub", func(c map[string]interface{}) { delete(c, "sub"); c["user_id"] = "user-1" }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+			_, err := v.Verify(context.Background(), signHS256(t, []byte(testSecret), "HS256", claims))
+			if tt.ok && err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("Verify accepted the token")
+			}
+		})
+	}
+}
+
+func TestLocalJWTVerifierIssuerAndAudience(t *testing.T) {
+	v := newHS256Verifier(t, LocalJWTConfig{Issuer: "https://issuer.example", Audience: "owlverload"})
+
+	tests := []struct {
+		name string
+		iss  interface{}
+		aud  interface{}
+		ok   bool
+	}{
+		{"matching", "https://issuer.example", "owlverload", true},
+		{"audience in a list", "https://issuer.example", []string{"other", "owlverload"}, true},
+		{"wrong issuer", "https://evil.example", "owlverload", false},
+		{"missing issuer", nil, "owlverload", false},
+		{"wrong audience", "https://issuer.example", "other", false},
+		{"audience list without ours", "https://issuer.example", []string{"other"}, false},
+		{"missing audience", "https://issuer.example", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			if tt.iss != nil {
+				claims["iss"] = tt.iss
+			}
+			if tt.aud != nil {
+				claims["aud"] = tt.aud
+			}
+			result, err := v.Verify(context.Background(), signHS256(t, []byte(testSecret), "HS256", claims))
+			if tt.ok && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("Verify accepted the token")
+			}
+			if tt.ok && result.Aud != "owlverload" {
+				t.Errorf("Aud = %q, want owlverload", result.Aud)
+			}
+		})
+	}
+}
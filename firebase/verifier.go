@@ -0,0 +1,119 @@
+package firebase
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/auth"
+)
+
+// TokenVerifier turns a bearer token into the caller's claims
+type TokenVerifier interface {
+	// Driver names the implementation ("firebase", "local")
+	Driver() string
+	Verify(ctx context.Context, token string) (TokenClaims, error)
+}
+
+var (
+	defaultVerifierOnce sync.Once
+	defaultVerifier     TokenVerifier
+	defaultVerifierErr  error
+)
+
+// DefaultVerifier returns the process-wide verifier configured by the environment
+func DefaultVerifier() (TokenVerifier, error) {
+	defaultVerifierOnce.Do(func() {
+		defaultVerifier, defaultVerifierErr = NewVerifierFromEnv()
+	})
+	return defaultVerifier, defaultVerifierErr
+}
+
+// NewVerifierFromEnv builds the verifier named by AUTH_DRIVER:
+//   - "firebase" (default): Firebase ID tokens, using FIREBASE_CREDENTIALS
+//   - "local": JWTs signed with AUTH_JWT_SECRET (HS256) or AUTH_JWT_PUBLIC_KEY (RS256), for
+//     running offline and integration tests
+func NewVerifierFromEnv() (TokenVerifier, error) {
+	switch driver := os.Getenv("AUTH_DRIVER"); driver {
+	case "", "firebase":
+		client, err := InitFirebaseApp()
+		if err != nil {
+			return nil, err
+		}
+		return NewFirebaseVerifier(client), nil
+	case "local":
+		return NewLocalJWTVerifier(LocalJWTConfig{
+			Algorithm: os.Getenv("AUTH_JWT_ALG"),
+			Secret:    os.Getenv("AUTH_JWT_SECRET"),
+			PublicKey: os.Getenv("AUTH_JWT_PUBLIC_KEY"),
+			Issuer:    os.Getenv("AUTH_JWT_ISSUER"),
+			Audience:  os.Getenv("AUTH_JWT_AUDIENCE"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown AUTH_DRIVER %q", driver)
+	}
+}
+
+// FirebaseVerifier checks Firebase ID tokens with the Admin SDK
+type FirebaseVerifier struct {
+	client *auth.Client
+}
+
+// NewFirebaseVerifier wraps an initialised Firebase auth client
+func NewFirebaseVerifier(client *auth.Client) *FirebaseVerifier {
+	return &FirebaseVerifier{client: client}
+}
+
+func (v *FirebaseVerifier) Driver() string {
+	return "firebase"
+}
+
+func (v *FirebaseVerifier) Verify(ctx context.Context, token string) (TokenClaims, error) {
+	decoded, err := v.client.VerifyIDToken(ctx, token)
+	if err != nil {
+		return TokenClaims{}, err
+	}
+	claims := ClaimsFromMap(decoded.UID, decoded.Claims)
+	if decoded.Firebase.SignInProvider != "" {
+		claims.ProviderId = decoded.Firebase.SignInProvider
+	}
+	claims.Aud = decoded.Audience
+	return claims, nil
+}
+
+// ClaimsFromMap builds TokenClaims from raw JWT claims. Every field but the UID is optional,
+// and claims of an unexpected type are treated as missing.
+func ClaimsFromMap(uid string, raw map[string]interface{}) TokenClaims {
+	claims := TokenClaims{
+		UID:           uid,
+		Email:         stringClaim(raw, "email"),
+		DisplayName:   stringClaim(raw, "name"),
+		EmailVerified: boolClaim(raw, "email_verified"),
+		IsAnonymous:   boolClaim(raw, "is_anonymous"),
+		PhoneNumber:   stringClaim(raw, "phone_number"),
+		PhotoURL:      stringClaim(raw, "picture"),
+		ProviderId:    stringClaim(raw, "provider_id"),
+		Aud:           stringClaim(raw, "aud"),
+		LoginAt:       time.Now(),
+		CreatedAt:     time.Now(),
+	}
+	if claims.PhotoURL == "" {
+		claims.PhotoURL = stringClaim(raw, "photo_url")
+	}
+	if authTime, ok := raw["auth_time"].(float64); ok {
+		claims.LoginAt = time.Unix(int64(authTime), 0)
+	}
+	return claims
+}
+
+func stringClaim(raw map[string]interface{}, name string) string {
+	value, _ := raw[name].(string)
+	return value
+}
+
+func boolClaim(raw map[string]interface{}, name string) bool {
+	value, _ := raw[name].(bool)
+	return value
+}
@@ -0,0 +1,81 @@
+package firebase
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaimsFromMapMissingClaims(t *testing.T) {
+	before := time.Now()
+	claims := ClaimsFromMap("user-1", map[string]interface{}{})
+
+	if claims.UID != "user-1" {
+		t.Errorf("UID = %q, want user-1", claims.UID)
+	}
+	if claims.Email != "" || claims.DisplayName != "" || claims.PhoneNumber != "" || claims.PhotoURL != "" ||
+		claims.ProviderId != "" || claims.Aud != "" {
+		t.Errorf("missing string claims should be empty, got %+v", claims)
+	}
+	if claims.EmailVerified || claims.IsAnonymous {
+		t.Errorf("missing bool claims should be false, got %+v", claims)
+	}
+	if claims.LoginAt.Before(before) || claims.CreatedAt.Before(before) {
+		t.Errorf("LoginAt and CreatedAt should default to now, got %v and %v", claims.LoginAt, claims.CreatedAt)
+	}
+}
+
+func TestClaimsFromMapNilMap(t *testing.T) {
+	claims := ClaimsFromMap("user-1", nil)
+	if claims.UID != "user-1" || claims.Email != "" {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestClaimsFromMapWrongTypes(t *testing.T) {
+	claims := ClaimsFromMap("user-1", map[string]interface{}{
+		"email":          42,
+		"email_verified": "true",
+		"name":           []interface{}{"a"},
+		"auth_time":      "yesterday",
+		"aud":            []interface{}{"owlverload"},
+	})
+	if claims.Email != "" || claims.DisplayName != "" || claims.Aud != "" {
+		t.Errorf("claims of the wrong type should be treated as missing, got %+v", claims)
+	}
+	if claims.EmailVerified {
+		t.Error(`email_verified "true" (a string) should not count as verified`)
+	}
+}
+
+func TestClaimsFromMapPresentClaims(t *testing.T) {
+	authTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	claims := ClaimsFromMap("user-1", map[string]interface{}{
+		"email":          "user@example.com",
+		"name":           "User One",
+		"email_verified": true,
+		"is_anonymous":   false,
+		"phone_number":   "+8210",
+		"photo_url":      "https://example.com/a.jpg",
+		"provider_id":    "password",
+		"aud":            "owlverload",
+		"auth_time":      float64(authTime.Unix()),
+	})
+	if claims.Email != "user@example.com" || claims.DisplayName != "User One" || !claims.EmailVerified ||
+		claims.PhoneNumber != "+8210" || claims.ProviderId != "password" || claims.Aud != "owlverload" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if claims.PhotoURL != "https://example.com/a.jpg" {
+		t.Errorf("PhotoURL = %q, want the photo_url fallback", claims.PhotoURL)
+	}
+	if !claims.LoginAt.Equal(authTime) {
+		t.Errorf("LoginAt = %v, want %v", claims.LoginAt, authTime)
+	}
+
+	withPicture := ClaimsFromMap("user-1", map[string]interface{}{
+		"picture":   "https://example.com/picture.jpg",
+		"photo_url": "https://example.com/a.jpg",
+	})
+	if withPicture.PhotoURL != "https://example.com/picture.jpg" {
+		t.Errorf("PhotoURL = %q, want picture to win over photo_url", withPicture.PhotoURL)
+	}
+}
@@ -0,0 +1,100 @@
+// Package imagehash computes perceptual fingerprints of product photos so that
+// near-identical pictures can be found without any external service.
+package imagehash
+
+import (
+	"image"
+	"math/bits"
+
+	"github.com/disintegration/imaging"
+)
+
+// DHash is a 64-bit difference hash: the image is shrunk to 9x8 greyscale and each
+// bit records whether a pixel is brighter than its right neighbour. Re-encoding,
+// resizing and small exposure changes flip only a few bits.
+func DHash(img image.Image) uint64 {
+	small := imaging.Grayscale(imaging.Resize(img, 9, 8, imaging.Box))
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.Pix[small.PixOffset(x, y)]
+			right := small.Pix[small.PixOffset(x+1, y)]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Distance is the number of differing bits between two hashes (0 = identical, 64 = opposite)
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// histogramBins is the number of colour bins: 4 levels per RGB channel
+const histogramBins = 64
+
+// ColorHistogram quantises the image to 4 levels per channel and returns the share of
+// pixels in each of the 64 bins, scaled to 0-255. It ignores layout, so it complements
+// DHash for photos taken from a slightly different angle.
+func ColorHistogram(img image.Image) []byte {
+	small := imaging.Resize(img, 64, 64, imaging.Box)
+	counts := make([]int, histogramBins)
+	total := 0
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		r, g, b := small.Pix[i]>>6, small.Pix[i+1]>>6, small.Pix[i+2]>>6
+		counts[int(r)<<4|int(g)<<2|int(b)]++
+		total++
+	}
+
+	histogram := make([]byte, histogramBins)
+	if total == 0 {
+		return histogram
+	}
+	for i, count := range counts {
+		histogram[i] = byte((count*255 + total/2) / total)
+	}
+	return histogram
+}
+
+// HistogramSimilarity is the intersection of two histograms, from 0 (no shared colours) to 1
+func HistogramSimilarity(a, b []byte) float64 {
+	if len(a) != histogramBins || len(b) != histogramBins {
+		return 0
+	}
+	shared := 0
+	for i := range a {
+		if a[i] < b[i] {
+			shared += int(a[i])
+		} else {
+			shared += int(b[i])
+		}
+	}
+	if shared > 255 {
+		shared = 255
+	}
+	return float64(shared) / 255
+}
+
+// Fingerprint holds every signature stored for an image
+type Fingerprint struct {
+	DHash     uint64
+	Histogram []byte // nil for images fingerprinted before histograms existed
+}
+
+// Compute fingerprints an image
+func Compute(img image.Image) Fingerprint {
+	return Fingerprint{DHash: DHash(img), Histogram: ColorHistogram(img)}
+}
+
+// Similarity scores two fingerprints from 0 to 1, weighting layout (dHash) over colour.
+// Only the hash is compared when either side has no histogram.
+func (f Fingerprint) Similarity(other Fingerprint) float64 {
+	hashScore := 1 - float64(Distance(f.DHash, other.DHash))/64
+	if len(f.Histogram) == 0 || len(other.Histogram) == 0 {
+		return hashScore
+	}
+	return 0.6*hashScore + 0.4*HistogramSimilarity(f.Histogram, other.Histogram)
+}
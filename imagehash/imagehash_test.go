@@ -0,0 +1,134 @@
+package imagehash
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+// gradient is a horizontal greyscale ramp, brightening to the right or, when reversed, to the left
+func gradient(width, height int, reversed bool) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		level := uint8(x * 255 / (width - 1))
+		if reversed {
+			level = 255 - level
+		}
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.NRGBA{R: level, G: level, B: level, A: 255})
+		}
+	}
+	return img
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0b1011, 0b0001, 2},
+		{0, math.MaxUint64, 64},
+		{0xF0F0F0F0F0F0F0F0, 0x0F0F0F0F0F0F0F0F, 64},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%#x, %#x) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDHash(t *testing.T) {
+	img := gradient(256, 128, false)
+
+	if got := DHash(img); got != DHash(img) {
+		t.Fatal("DHash is not deterministic")
+	}
+	// Brightening to the right means no pixel is brighter than its right neighbour
+	if got := DHash(img); got != 0 {
+		t.Errorf("DHash(gradient) = %#x, want 0", got)
+	}
+	if got := Distance(DHash(img), DHash(gradient(256, 128, true))); got != 64 {
+		t.Errorf("distance to the mirrored gradient = %d, want 64", got)
+	}
+
+	resized := imaging.Resize(img, 120, 60, imaging.Lanczos)
+	if got := Distance(DHash(img), DHash(resized)); got > 4 {
+		t.Errorf("distance to a resized copy = %d, want at most 4", got)
+	}
+}
+func solid(c color.NRGBA) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 32; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestColorHistogram(t *testing.T) {
+	histogram := ColorHistogram(solid(color.NRGBA{R: 255, A: 255}))
+	if len(histogram) != histogramBins {
+		t.Fatalf("len = %d, want %d", len(histogram), histogramBins)
+	}
+	// Pure red quantises to r=3, g=0, b=0
+	for i, share := range histogram {
+		want := byte(0)
+		if i == 3<<4 {
+			want = 255
+		}
+		if share != want {
+			t.Errorf("bin %d = %d, want %d", i, share, want)
+		}
+	}
+}
+
+func TestHistogramSimilarity(t *testing.T) {
+	red := ColorHistogram(solid(color.NRGBA{R: 255, A: 255}))
+	blue := ColorHistogram(solid(color.NRGBA{B: 255, A: 255}))
+
+	tests := []struct {
+		name string
+		a, b []byte
+		want float64
+	}{
+		{"identical", red, red, 1},
+		{"disjoint", red, blue, 0},
+		{"missing", nil, red, 0},
+		{"wrong length", red[:10], red[:10], 0},
+	}
+	for _, tt := range tests {
+		if got := HistogramSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: HistogramSimilarity = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprintSimilarity(t *testing.T) {
+	img := gradient(256, 128, false)
+	fp := Compute(img)
+
+	if got := fp.Similarity(fp); got != 1 {
+		t.Errorf("Similarity to itself = %v, want 1", got)
+	}
+
+	mirrored := Compute(gradient(256, 128, true))
+	// Same colours, opposite layout: only the colour part scores
+	if got := fp.Similarity(mirrored); math.Abs(got-0.4) > 0.01 {
+		t.Errorf("Similarity to the mirrored gradient = %v, want about 0.4", got)
+	}
+
+	// Without a histogram only the hash counts
+	legacy := Fingerprint{DHash: mirrored.DHash}
+	if got := fp.Similarity(legacy); got != 0 {
+		t.Errorf("hash-only Similarity = %v, want 0", got)
+	}
+	if got := (Fingerprint{DHash: fp.DHash}).Similarity(Fingerprint{DHash: fp.DHash ^ 0xFF}); got != 1-8.0/64 {
+		t.Errorf("hash-only Similarity = %v, want %v", got, 1-8.0/64)
+	}
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQuotaExceeded is matched (via errors.Is) by every QuotaError
+var ErrQuotaExceeded = errors.New("llm quota exceeded")
+
+// QuotaError tells the caller which quota stopped the call
+type QuotaError struct {
+	Scope   string // "user" or "branch"
+	Subject string // user email or branch name
+	Period  string // "daily" or "monthly"
+	Reason  string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %s quota exceeded for %s: %s", e.Period, e.Scope, e.Subject, e.Reason)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// CallRecord describes one finished (or refused) provider call
+type CallRecord struct {
+	Provider string
+	Model    string
+	Usage    Usage
+	CostUSD  float64
+	Duration time.Duration
+	Err      error
+}
+
+// Meter decides whether a call may go out and records every call that was attempted
+type Meter interface {
+	Allow(ctx context.Context) error
+	Record(ctx context.Context, call CallRecord)
+}
+
+type meteredProvider struct {
+	provider Provider
+	meter    Meter
+}
+
+// WithMeter wraps a provider so each Chat call is checked against quotas and recorded
+func WithMeter(provider Provider, meter Meter) Provider {
+	return &meteredProvider{provider: provider, meter: meter}
+}
+
+func (m *meteredProvider) Name() string {
+	return m.provider.Name()
+}
+
+func (m *meteredProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	model := req.Model
+	if model == "" {
+		model = DefaultModel()
+	}
+
+	if err := m.meter.Allow(ctx); err != nil {
+		m.meter.Record(ctx, CallRecord{Provider: m.provider.Name(), Model: model, Err: err})
+		return ChatResponse{}, err
+	}
+
+	start := time.Now()
+	resp, err := m.provider.Chat(ctx, req)
+	if resp.Model != "" {
+		model = resp.Model
+	}
+	m.meter.Record(ctx, CallRecord{
+		Provider: m.provider.Name(),
+		Model:    model,
+		Usage:    resp.Usage,
+		CostUSD:  EstimateCost(model, resp.Usage),
+		Duration: time.Since(start),
+		Err:      err,
+	})
+	return resp, err
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultOpenAIBaseURL = "https://api.openai.com/v1"
+
+// OpenAIProvider talks to the OpenAI chat completions API (or a compatible endpoint)
+type OpenAIProvider struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// APIError is returned when the provider answers with a non-200 status
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("llm api error (status %d): %s", e.StatusCode, e.Body)
+}
+
+func NewOpenAIProvider(apiKey string, baseURL string) *OpenAIProvider {
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	return &OpenAIProvider{
+		apiKey:  apiKey,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 90 * time.Second},
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type openAIMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type openAIRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Usage   Usage  `json:"usage"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// Chat sends the request to /chat/completions. Messages with images are sent as
+// content parts with base64 data URLs so no public image URL is needed.
+func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	if req.Model == "" {
+		req.Model = DefaultModel()
+	}
+
+	body := openAIRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+	}
+	if req.JSONMode {
+		body.ResponseFormat = &openAIResponseFormat{Type: "json_object"}
+	}
+	for _, m := range req.Messages {
+		if len(m.Images) == 0 {
+			body.Messages = append(body.Messages, openAIMessage{Role: m.Role, Content: m.Content})
+			continue
+		}
+		parts := []openAIContentPart{{Type: "text", Text: m.Content}}
+		for _, img := range m.Images {
+			dataURL := "data:" + img.MimeType + ";base64," + base64.StdEncoding.EncodeToString(img.Data)
+			parts = append(parts, openAIContentPart{
+				Type:     "image_url",
+				ImageURL: &openAIImageURL{URL: dataURL, Detail: "high"},
+			})
+		}
+		body.Messages = append(body.Messages, openAIMessage{Role: m.Role, Content: parts})
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to marshal llm request: %v", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to create llm request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to reach llm provider: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to read llm response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ChatResponse{}, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var parsed openAIResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return ChatResponse{}, fmt.Errorf("failed to parse llm response: %v", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return ChatResponse{Model: parsed.Model, Usage: parsed.Usage}, fmt.Errorf("llm response contained no choices")
+	}
+
+	return ChatResponse{
+		Model:   parsed.Model,
+		Content: parsed.Choices[0].Message.Content,
+		Usage:   parsed.Usage,
+	}, nil
+}
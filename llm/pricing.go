@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Price is the list price of a model in USD per million tokens
+type Price struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// defaultPrices are used unless LLM_PRICING overrides them
+var defaultPrices = map[string]Price{
+	"gpt-4o":       {Prompt: 2.50, Completion: 10.00},
+	"gpt-4o-mini":  {Prompt: 0.15, Completion: 0.60},
+	"gpt-4.1":      {Prompt: 2.00, Completion: 8.00},
+	"gpt-4.1-mini": {Prompt: 0.40, Completion: 1.60},
+}
+
+var (
+	pricesOnce sync.Once
+	prices     map[string]Price
+)
+
+// Prices returns the pricing table. LLM_PRICING may hold a JSON object such as
+// {"gpt-4o": {"prompt": 2.5, "completion": 10}} to add or override models.
+func Prices() map[string]Price {
+	pricesOnce.Do(func() {
+		prices = map[string]Price{}
+		for model, price := range defaultPrices {
+			prices[model] = price
+		}
+		if raw := os.Getenv("LLM_PRICING"); raw != "" {
+			var overrides map[string]Price
+			if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+				log.Printf("Ignoring invalid LLM_PRICING: %v", err)
+				return
+			}
+			for model, price := range overrides {
+				prices[model] = price
+			}
+		}
+	})
+	return prices
+}
+
+// EstimateCost prices a call in USD. Dated model names ("gpt-4o-2024-08-06") use the
+// longest matching prefix; unknown models cost 0.
+func EstimateCost(model string, usage Usage) float64 {
+	table := Prices()
+	price, ok := table[model]
+	if !ok {
+		best := ""
+		for name, p := range table {
+			if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+				best, price = name, p
+			}
+		}
+		if best == "" {
+			return 0
+		}
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1_000_000
+}
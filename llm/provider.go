@@ -0,0 +1,82 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Image is an inline image attached to a chat message
+type Image struct {
+	MimeType string
+	Data     []byte
+}
+
+// Message is a single chat message sent to the provider
+type Message struct {
+	Role    string
+	Content string
+	Images  []Image
+}
+
+// ChatRequest describes one completion call
+type ChatRequest struct {
+	Model     string
+	Messages  []Message
+	JSONMode  bool
+	MaxTokens int
+}
+
+// Usage holds the token counts reported by the provider
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatResponse is the provider-neutral completion result
+type ChatResponse struct {
+	Model   string `json:"model"`
+	Content string `json:"content"`
+	Usage   Usage  `json:"usage"`
+}
+
+// Provider is implemented by every LLM backend the server can talk to
+type Provider interface {
+	Name() string
+	Chat(ctx context.Context, req ChatRequest) (ChatResponse, error)
+}
+
+// ErrNotConfigured is returned when no provider credentials are available
+var ErrNotConfigured = errors.New("llm provider is not configured")
+
+// DefaultModel returns the text model used when a request does not name one
+func DefaultModel() string {
+	if v := os.Getenv("LLM_MODEL"); v != "" {
+		return v
+	}
+	return "gpt-4o"
+}
+
+// VisionModel returns the model used for requests carrying images
+func VisionModel() string {
+	if v := os.Getenv("LLM_VISION_MODEL"); v != "" {
+		return v
+	}
+	return DefaultModel()
+}
+
+// NewProviderFromEnv builds the provider selected by LLM_PROVIDER (default "openai")
+func NewProviderFromEnv() (Provider, error) {
+	switch name := os.Getenv("LLM_PROVIDER"); name {
+	case "", "openai":
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, ErrNotConfigured
+		}
+		return NewOpenAIProvider(apiKey, os.Getenv("OPENAI_BASE_URL")), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", name)
+	}
+}
@@ -9,9 +9,11 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 	"github.com/jimyeongjung/owlverload_api/apis"
+	"github.com/jimyeongjung/owlverload_api/config"
 	"github.com/jimyeongjung/owlverload_api/firebase"
 	"github.com/jimyeongjung/owlverload_api/middleware"
 	"github.com/jimyeongjung/owlverload_api/models"
+	"github.com/jimyeongjung/owlverload_api/storage"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
 )
@@ -67,17 +69,44 @@ func main() {
 		log.Fatal(db.Err)
 	}
 
+	// enrichment jobs run in-process, so any still marked running died with the previous process
+	if interrupted, err := models.FailInterruptedEnrichmentJobs(); err != nil {
+		log.Printf("Failed to mark interrupted enrichment jobs: %v", err)
+	} else if interrupted > 0 {
+		log.Printf("Marked %d interrupted enrichment jobs as failed", interrupted)
+	}
+
+	// blob storage for images (R2/S3, local disk or memory, see STORAGE_DRIVER)
+	blobStore, err := storage.Default()
+	if err != nil {
+		log.Printf("Storage is not configured, image uploads will fail: %v", err)
+	}
+
 	// router
 	r := mux.NewRouter()
 
-	// cors
-	r.Use(cors.AllowAll().Handler)
+	// cors: as cors.AllowAll, but browsers may also read the ETag sent for If-Match and the
+	// replay marker of idempotent retries
+	r.Use(cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"ETag", middleware.IdempotentReplayedHeader},
+	}).Handler)
 
-	// Initialize Firebase app
-	firebaseClient, err := firebase.InitFirebaseApp()
+	// Initialize the token verifier: Firebase, or a local JWT key with AUTH_DRIVER=local
+	tokenVerifier, err := firebase.DefaultVerifier()
 	if err != nil {
 		log.Fatal(err)
 	}
+	log.Printf("Token verifier: %s", tokenVerifier.Driver())
 
 	// Define authentication middleware
 	// authConfig := middleware.AuthenticationConfig{
@@ -98,9 +127,26 @@ func main() {
 	apiRouter := r.PathPrefix("/api/v1/").Subrouter()
 	apiRouter.Use(func(next http.Handler) http.Handler {
 		fmt.Println("--- coming in here 2--- ")
-		return middleware.ValidateFirebaseToken(next, firebaseClient)
+		// Firebase ID token, or X-API-Key for devices and scripts
+		return middleware.Authenticate(next, tokenVerifier)
+	})
+	// Role-based permissions per route, see middleware/rbac.go for the matrix
+	apiRouter.Use(middleware.RequirePermission)
+	// Active store from X-Store-ID or the user's branch, see middleware/store.go
+	apiRouter.Use(middleware.ResolveStore)
+	// Duplicate-request protection with response replay, backed by Redis, MySQL or memory per
+	// IDEM_STORE. Keys are scoped to the caller, so it runs after authentication; replays skip
+	// the audit log since they change nothing.
+	idempotencyStore, err := middleware.DefaultIdempotencyStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Idempotency store: %s", idempotencyStore.Driver())
+	apiRouter.Use(func(next http.Handler) http.Handler {
+		return middleware.Idempotency(next, idempotencyStore, config.IdempotencyFailOpen())
 	})
-	r.Use(middleware.IdempotencyMiddleware)
+	// Hash-chained audit log of every mutating request, see middleware/audit.go
+	apiRouter.Use(middleware.Audit)
 
 	// Public routes (no authentication required)
 	r.HandleFunc("/public/api/v1/auth/signin", apis.HandleSignIn).Methods("POST")
@@ -113,6 +159,14 @@ func main() {
 		w.Write([]byte("OK"))
 	}).Methods("GET")
 
+	// Best-fit responsive variant of an uploaded image, usable directly as an <img> src
+	r.HandleFunc("/public/images/{imageId}", apis.HandleResolveImage).Methods("GET")
+
+	// Files of the local storage driver, served like a public bucket
+	if local, ok := blobStore.(*storage.Local); ok {
+		r.PathPrefix(storage.LocalMountPath).Handler(local.Handler())
+	}
+
 	// Protected routes (authentication required)
 	// Stock/Item routes
 	fmt.Println("--- coming in here --- ")
@@ -126,6 +180,7 @@ func main() {
 	apiRouter.HandleFunc("/stockIn", apis.HandleStockIn).Methods("POST")
 	apiRouter.HandleFunc("/stockOut", apis.HandleStockOut).Methods("POST")
 	apiRouter.HandleFunc("/stockUpdate", apis.HandleStockUpdate).Methods("PUT")
+	apiRouter.HandleFunc("/stocks/{stockId}", apis.HandlePatchStock).Methods("PATCH")
 	// apiRouter.HandleFunc("/createItem", apis.HandleCreateItem).Methods("POST")
 	apiRouter.HandleFunc("/registerItem", apis.HandleRegisterItem).Methods("POST")
 	apiRouter.HandleFunc("/updateItem", apis.HandleUpdateItem).Methods("PUT")
@@ -134,8 +189,25 @@ func main() {
 	apiRouter.HandleFunc("/searchItems", apis.HandleSearchItems).Methods("POST")
 	apiRouter.HandleFunc("/getItemsWithMissingInfo", apis.HandleGetItemsWithMissingInfo).Methods("GET")
 	apiRouter.HandleFunc("/lookupItems", apis.HandleLookupItems).Methods("POST")
+	apiRouter.HandleFunc("/searchItemsByPhoto", apis.HandleSearchItemsByPhoto).Methods("POST")
 	apiRouter.HandleFunc("/getItemsExpiringWithinDays", apis.HandleGetItemsExpiringWithinDays).Methods("GET")
 
+	// Partial updates with JSON merge patch (RFC 7396)
+	apiRouter.HandleFunc("/items/{itemId}", apis.HandlePatchItem).Methods("PATCH")
+
+	// Item image routes
+	apiRouter.HandleFunc("/items/{itemId}/images", apis.HandleGetItemImages).Methods("GET")
+	apiRouter.HandleFunc("/items/{itemId}/images", apis.HandleAttachItemImage).Methods("POST")
+	apiRouter.HandleFunc("/items/{itemId}/images/order", apis.HandleReorderItemImages).Methods("PUT")
+	apiRouter.HandleFunc("/items/{itemId}/images/{imageId}/primary", apis.HandleSetPrimaryItemImage).Methods("PUT")
+	apiRouter.HandleFunc("/items/{itemId}/images/{imageId}", apis.HandleDetachItemImage).Methods("DELETE")
+
+	// Item version history
+	apiRouter.HandleFunc("/items/{itemId}/versions", apis.HandleGetItemVersions).Methods("GET")
+	apiRouter.HandleFunc("/items/{itemId}/versions/diff", apis.HandleDiffItemVersions).Methods("GET")
+	apiRouter.HandleFunc("/items/{itemId}/versions/{version}", apis.HandleGetItemVersion).Methods("GET")
+	apiRouter.HandleFunc("/items/{itemId}/versions/{version}/restore", apis.HandleRestoreItemVersion).Methods("POST")
+
 	// Tag routes
 	apiRouter.HandleFunc("/tags", apis.HandleGetAllTags).Methods("GET")
 	apiRouter.HandleFunc("/tags/create", apis.HandleCreateTag).Methods("POST")
@@ -150,11 +222,81 @@ func main() {
 
 	// AI Helper routes
 	apiRouter.HandleFunc("/analyze_barcode", apis.HandleBarcodeAnalyze).Methods("POST")
+	apiRouter.HandleFunc("/analyzeProductImage", apis.HandleAnalyzeProductImage).Methods("POST")
+
+	// AI enrichment job routes (admin)
+	apiRouter.HandleFunc("/admin/enrichment/jobs", apis.HandleStartEnrichmentJob).Methods("POST")
+	apiRouter.HandleFunc("/admin/enrichment/jobs", apis.HandleGetEnrichmentJobs).Methods("GET")
+	apiRouter.HandleFunc("/admin/enrichment/jobs/{jobId}", apis.HandleGetEnrichmentJob).Methods("GET")
+
+	// Translation routes
+	apiRouter.HandleFunc("/items/{itemId}/translations", apis.HandleTranslateItem).Methods("POST")
+	apiRouter.HandleFunc("/translations/batch", apis.HandleTranslateItemsByTag).Methods("POST")
+	apiRouter.HandleFunc("/translations/glossary", apis.HandleGetGlossary).Methods("GET")
+	apiRouter.HandleFunc("/translations/glossary", apis.HandleCreateGlossaryTerm).Methods("POST")
+	apiRouter.HandleFunc("/translations/glossary/{termId}", apis.HandleUpdateGlossaryTerm).Methods("PUT")
+	apiRouter.HandleFunc("/translations/glossary/{termId}", apis.HandleDeleteGlossaryTerm).Methods("DELETE")
+
+	// AI usage accounting routes (admin)
+	apiRouter.HandleFunc("/admin/llm/usage", apis.HandleGetLLMUsageReport).Methods("GET")
+	apiRouter.HandleFunc("/admin/llm/quotas", apis.HandleGetLLMQuotas).Methods("GET")
+	apiRouter.HandleFunc("/admin/llm/quotas", apis.HandleSaveLLMQuota).Methods("PUT")
+	apiRouter.HandleFunc("/admin/llm/quotas/{quotaId}", apis.HandleDeleteLLMQuota).Methods("DELETE")
+
+	// AI suggestion review routes
+	apiRouter.HandleFunc("/reviews/suggestions", apis.HandleGetSuggestions).Methods("GET")
+	apiRouter.HandleFunc("/reviews/suggestions/{suggestionId}", apis.HandleGetSuggestion).Methods("GET")
+	apiRouter.HandleFunc("/reviews/suggestions/{suggestionId}", apis.HandleReviewSuggestion).Methods("POST")
 
 	// Image upload routes
 	apiRouter.HandleFunc("/upload/image", apis.HandleImageUpload).Methods("POST")
+	apiRouter.HandleFunc("/upload/image/presign", apis.HandlePresignImageUpload).Methods("POST")
+	apiRouter.HandleFunc("/upload/image/finalize", apis.HandleFinalizeImageUpload).Methods("POST")
 	apiRouter.HandleFunc("/delete/image", apis.HandleImageDelete).Methods("DELETE")
 
+	// Image garbage collection: dry-run scan, report, then delete pass
+	apiRouter.HandleFunc("/admin/images/gc", apis.HandleStartImageGC).Methods("POST")
+	apiRouter.HandleFunc("/admin/images/gc", apis.HandleGetImageGCRuns).Methods("GET")
+	apiRouter.HandleFunc("/admin/images/gc/{runId}", apis.HandleGetImageGCRun).Methods("GET")
+	apiRouter.HandleFunc("/admin/images/gc/{runId}/delete", apis.HandleDeleteImageGCRun).Methods("POST")
+	apiRouter.HandleFunc("/admin/images/fingerprints/backfill", apis.HandleBackfillImageFingerprints).Methods("POST")
+
+	// Profile and user management
+	apiRouter.HandleFunc("/me", apis.HandleGetMe).Methods("GET")
+	apiRouter.HandleFunc("/me", apis.HandleUpdateMe).Methods("PUT")
+	apiRouter.HandleFunc("/admin/users", apis.HandleGetUsers).Methods("GET")
+	apiRouter.HandleFunc("/admin/users/{uid}", apis.HandleGetUser).Methods("GET")
+	apiRouter.HandleFunc("/admin/users/{uid}/deactivate", apis.HandleDeactivateUser).Methods("POST")
+	apiRouter.HandleFunc("/admin/users/{uid}/reactivate", apis.HandleReactivateUser).Methods("POST")
+	apiRouter.HandleFunc("/admin/users/{uid}", apis.HandleDeleteUser).Methods("DELETE")
+
+	// Roles and permissions
+	apiRouter.HandleFunc("/me/permissions", apis.HandleGetMyPermissions).Methods("GET")
+	apiRouter.HandleFunc("/admin/roles", apis.HandleGetUserRoles).Methods("GET")
+	apiRouter.HandleFunc("/admin/users/{uid}/role", apis.HandleSetUserRole).Methods("PUT")
+
+	// Stores (branches)
+	apiRouter.HandleFunc("/stores", apis.HandleGetStores).Methods("GET")
+	apiRouter.HandleFunc("/admin/stores", apis.HandleCreateStore).Methods("POST")
+	apiRouter.HandleFunc("/admin/stores/{storeId}", apis.HandleUpdateStore).Methods("PUT")
+
+	// Inter-store transfers
+	apiRouter.HandleFunc("/transfers", apis.HandleCreateTransfer).Methods("POST")
+	apiRouter.HandleFunc("/transfers", apis.HandleGetTransfers).Methods("GET")
+	apiRouter.HandleFunc("/transfers/{transferId}", apis.HandleGetTransfer).Methods("GET")
+	apiRouter.HandleFunc("/transfers/{transferId}/dispatch", apis.HandleDispatchTransfer).Methods("POST")
+	apiRouter.HandleFunc("/transfers/{transferId}/receive", apis.HandleReceiveTransfer).Methods("POST")
+	apiRouter.HandleFunc("/transfers/{transferId}/cancel", apis.HandleCancelTransfer).Methods("POST")
+
+	// Audit log
+	apiRouter.HandleFunc("/audit", apis.HandleGetAuditLog).Methods("GET")
+	apiRouter.HandleFunc("/admin/audit/verify", apis.HandleVerifyAuditLog).Methods("GET")
+
+	// Device / kiosk API keys
+	apiRouter.HandleFunc("/admin/api-keys", apis.HandleCreateAPIKey).Methods("POST")
+	apiRouter.HandleFunc("/admin/api-keys", apis.HandleGetAPIKeys).Methods("GET")
+	apiRouter.HandleFunc("/admin/api-keys/{keyId}", apis.HandleRevokeAPIKey).Methods("DELETE")
+
 	// Start server
 	log.Println("Server starting on port 8080...")
 	log.Fatal(http.ListenAndServe(":8080", r))
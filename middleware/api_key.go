@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// APIKeyHeader carries a device or script API key instead of a Firebase bearer token
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyProvider is the ProviderId of principals authenticated by an API key
+const apiKeyProvider = "api_key"
+
+// Authenticate accepts either an API key in X-API-Key or a bearer token in Authorization.
+// Both fill the same firebase.TokenClaims principal, so everything downstream is unaware of
+// which one was used.
+func Authenticate(next http.Handler, verifier firebase.TokenVerifier) http.Handler {
+	tokenAuth := ValidateToken(next, verifier)
+	keyAuth := AuthenticateAPIKey(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(APIKeyHeader) != "" {
+			keyAuth.ServeHTTP(w, r)
+			return
+		}
+		tokenAuth.ServeHTTP(w, r)
+	})
+}
+
+// AuthenticateAPIKey is a middleware that checks the X-API-Key header. The key's role and
+// store are put on the claims; RequirePermission and ResolveStore keep them as they are.
+func AuthenticateAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := models.AuthenticateAPIKey(strings.TrimSpace(r.Header.Get(APIKeyHeader)))
+		if errors.Is(err, models.ErrInvalidAPIKey) {
+			models.WriteServiceError(w, "Invalid, revoked or expired API key", false, false, http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("API key: failed to check key: %v", err)
+			models.WriteServiceError(w, "Failed to check API key", false, false, http.StatusInternalServerError)
+			return
+		}
+
+		if err := models.TouchAPIKey(key.ID, clientIP(r)); err != nil {
+			// Don't fail the request just because we couldn't record the use
+			log.Printf("API key: failed to record use of key %d: %v", key.ID, err)
+		}
+
+		tokenClaims := firebase.TokenClaims{
+			UID:         fmt.Sprintf("apikey:%d", key.ID),
+			Email:       fmt.Sprintf("apikey:%d:%s", key.ID, key.Prefix),
+			DisplayName: key.Name,
+			ProviderId:  apiKeyProvider,
+			LoginAt:     time.Now(),
+			CreatedAt:   key.CreatedAt,
+			Role:        key.Role,
+			StoreID:     key.StoreID,
+			APIKeyID:    key.ID,
+		}
+		next.ServeHTTP(w, r.WithContext(firebase.WithUserContext(r.Context(), tokenClaims)))
+	})
+}
+
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []*net.IPNet
+)
+
+// loadTrustedProxies parses TRUSTED_PROXIES, a comma-separated list of IPs or CIDRs of the
+// proxies allowed to set X-Forwarded-For
+func loadTrustedProxies() {
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("API key: ignoring invalid TRUSTED_PROXIES entry %q", entry)
+			continue
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+}
+
+func isTrustedProxy(ip string) bool {
+	trustedProxiesOnce.Do(loadTrustedProxies)
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the peer address. X-Forwarded-For is only read when the peer is one of
+// TRUSTED_PROXIES, and then the nearest hop that is not a trusted proxy is used, since
+// clients can put anything in the leftmost entries.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" || isTrustedProxy(hop) {
+			continue
+		}
+		return hop
+	}
+	return host
+}
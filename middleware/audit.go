@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// RequestIDHeader carries the request ID; one is generated when the client sends none
+const RequestIDHeader = "X-Request-ID"
+
+type auditContextKey struct{}
+
+// auditChange is an entity change reported by a handler with RecordChange
+type auditChange struct {
+	entityType string
+	entityID   string
+	before     json.RawMessage
+	after      json.RawMessage
+}
+
+type auditRecord struct {
+	mu      sync.Mutex
+	changes []auditChange
+}
+
+// statusRecorder remembers the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Audit writes an audit log entry for every mutating request once the handler is done. It must
+// run after ResolveStore so the actor, role and store are known. Handlers that change an entity
+// report its before and after state with RecordChange; other requests get one entry naming the
+// route and its first path variable.
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestID := strings.TrimSpace(r.Header.Get(RequestIDHeader))
+		if requestID == "" || len(requestID) > 64 {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		record := &auditRecord{}
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, record)))
+
+		claims := firebase.GetTokenClaimsFromContext(r.Context())
+		base := models.AuditEntry{
+			RequestID:  requestID,
+			ActorUID:   claims.UID,
+			ActorEmail: claims.Email,
+			ActorRole:  claims.Role,
+			StoreID:    claims.StoreID,
+			Method:     r.Method,
+			Route:      RouteKey(r),
+			Path:       r.URL.Path,
+			Status:     recorder.status,
+		}
+		if base.Status == 0 {
+			base.Status = http.StatusOK
+		}
+
+		record.mu.Lock()
+		changes := record.changes
+		record.mu.Unlock()
+		if len(changes) == 0 {
+			changes = []auditChange{routeEntity(r)}
+		}
+
+		for _, change := range changes {
+			entry := base
+			entry.EntityType = change.entityType
+			entry.EntityID = change.entityID
+			entry.Before = change.before
+			entry.After = change.after
+			diff, err := models.DiffJSON(change.before, change.after)
+			if err != nil {
+				log.Printf("Audit: failed to diff %s %s: %v", change.entityType, change.entityID, err)
+			}
+			entry.Diff = diff
+			if _, err := models.AppendAuditEntry(entry); err != nil {
+				log.Printf("Audit: failed to record %s %s (request %s): %v", entry.Route, entry.EntityID, requestID, err)
+			}
+		}
+	})
+}
+
+// routeEntity names the entity of a request from its route: the first path segment as the type
+// and the first path variable as the ID
+func routeEntity(r *http.Request) auditChange {
+	change := auditChange{}
+	route := strings.SplitN(RouteKey(r), " ", 2)
+	if len(route) == 2 {
+		segments := strings.Split(strings.Trim(route[1], "/"), "/")
+		change.entityType = segments[0]
+		if change.entityType == "admin" && len(segments) > 1 {
+			change.entityType = segments[1]
+		}
+		for _, segment := range segments {
+			if strings.HasPrefix(segment, "{") {
+				change.entityID = mux.Vars(r)[strings.Trim(segment, "{}")]
+				break
+			}
+		}
+	}
+	return change
+}
+
+// RecordChange reports an entity change of the current request to the audit log, with its state
+// before and after (either may be nil for creations and deletions). It does nothing outside a
+// request handled by Audit.
+func RecordChange(r *http.Request, entityType string, entityID string, before interface{}, after interface{}) {
+	record, ok := r.Context().Value(auditContextKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+	change := auditChange{entityType: entityType, entityID: entityID}
+	var err error
+	if before != nil {
+		if change.before, err = json.Marshal(before); err != nil {
+			log.Printf("Audit: failed to encode %s %s: %v", entityType, entityID, err)
+		}
+	}
+	if after != nil {
+		if change.after, err = json.Marshal(after); err != nil {
+			log.Printf("Audit: failed to encode %s %s: %v", entityType, entityID, err)
+		}
+	}
+	record.mu.Lock()
+	record.changes = append(record.changes, change)
+	record.mu.Unlock()
+}
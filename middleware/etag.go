@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ETag is the entity tag of one version of a row, e.g. "item:abc:3"
+func ETag(kind string, id string, rowVersion int) string {
+	return fmt.Sprintf("%q", fmt.Sprintf("%s:%s:%d", kind, id, rowVersion))
+}
+
+// IfMatch reports whether the request's If-Match header allows writing over etag. Requests
+// without the header are let through, so clients that predate ETags keep working.
+func IfMatch(r *http.Request, etag string) bool {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		// Weak validators compare the same here; the row version is exact either way
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
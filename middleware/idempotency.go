@@ -9,128 +9,86 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"net/url"
-	"os"
-	"strings"
+	"time"
 
 	"fmt"
 
 	"github.com/jimyeongjung/owlverload_api/config"
+	"github.com/jimyeongjung/owlverload_api/firebase"
 	"github.com/jimyeongjung/owlverload_api/models"
-	"github.com/redis/go-redis/v9"
 )
 
-var redisClient *redis.Client
-
-func getRedis() *redis.Client {
-	rawURL := os.Getenv("REDIS_URL")
-
-	u, err := url.Parse(rawURL)
-	if err != nil {
-		log.Fatalf("failed to parse REDIS_URL: %v", err)
-	}
-	password, _ := u.User.Password()
-	if redisClient != nil {
-		return redisClient
-	}
-
-	// password := os.Getenv("REDIS_PASSWORD")
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     u.Host,
-		Password: password,
-		DB:       0,
-	})
-	return redisClient
-}
-
-var beginScript = redis.NewScript(`
-local v = redis.call('GET', KEYS[1])
-if not v then
-  redis.call('SET', KEYS[1], 'processing', 'PX', ARGV[1])
-  return {1, ''}
-elseif v == 'processing' then
-  return {0, ''}
-else
-  return {2, v}
-end
-`)
-
-var finishScript = redis.NewScript(`
-local v = redis.call('GET', KEYS[1])
-if v == 'processing' then
-  redis.call('SET', KEYS[1], 'done:'..ARGV[1], 'PX', ARGV[2])
-  return 1
-else
-  return 0
-end
-`)
-
 func sha256Hex(b []byte) string {
 	h := sha256.Sum256(b)
 	return hex.EncodeToString(h[:])
 }
 
-func deriveIdempotencyKey(r *http.Request, body []byte) string {
+// deriveIdempotencyKey scopes the request's key to the caller, active store and route, so a key
+// reused by another user or on another endpoint never replays someone else's response. Routes
+// include the query string, since handlers such as /updateItemById take their target from it.
+// Without an Idempotency-Key header the request hash is the key.
+func deriveIdempotencyKey(r *http.Request, requestHash string) string {
+	claims := firebase.GetTokenClaimsFromContext(r.Context())
+	scope := claims.UID + "|" + claims.StoreID
 	key := r.Header.Get("Idempotency-Key")
-	if key != "" {
-		return key
-	}
-	base := r.Method + "|" + r.URL.Path + "|" + string(body)
-	return sha256Hex([]byte(base))
-}
-
-func beginIdempotency(ctx context.Context, key string, processingTTLms int64) (int64, string, error) {
-	c := getRedis()
-
-	res, err := beginScript.Run(ctx, c, []string{"idem:" + key}, processingTTLms).Result()
-	if err != nil {
-		fmt.Println("---beginIdempotency error---", err)
-		return -1, "", err
-	}
-	fmt.Println("---redis connection result---", res)
-	vals := res.([]interface{})
-	code := vals[0].(int64)
-	val := ""
-	if vals[1] != nil {
-		val = vals[1].(string)
-	}
-	return code, val, nil
-}
-
-func finishIdempotency(ctx context.Context, key, ref string, doneTTLms int64) error {
-	c := getRedis()
-	_, err := finishScript.Run(ctx, c, []string{"idem:" + key}, ref, doneTTLms).Result()
-	return err
-}
-
-func parseDoneRef(v string) string {
-	const prefix = "done:"
-	if strings.HasPrefix(v, prefix) {
-		return strings.TrimPrefix(v, prefix)
+	if key == "" {
+		return sha256Hex([]byte(scope + "|" + requestHash))
 	}
-	return v
+	return sha256Hex([]byte(scope + "|" + r.Method + "|" + r.URL.RequestURI() + "|" + key))
 }
 
 // ------------------------
 // Idempotency Middleware
 // ------------------------
 
+// idemResponseWriter passes the response through and keeps a copy of up to limit body bytes
 type idemResponseWriter struct {
 	http.ResponseWriter
-	status int
+	status   int
+	body     bytes.Buffer
+	limit    int
+	overflow bool
 }
 
 func (w *idemResponseWriter) WriteHeader(code int) {
-	w.status = code
+	if w.status == 0 {
+		w.status = code
+	}
 	w.ResponseWriter.WriteHeader(code)
 }
 
+func (w *idemResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.overflow {
+		if w.body.Len()+len(b) > w.limit {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
 func isMutatingMethod(m string) bool {
-	return m == http.MethodPost || m == http.MethodPut || m == http.MethodDelete
+	return m == http.MethodPost || m == http.MethodPut || m == http.MethodPatch || m == http.MethodDelete
+}
+
+// writeAlreadyProcessed is the reply to a retry whose response was not kept
+func writeAlreadyProcessed(w http.ResponseWriter, ref string) {
+	models.WriteServiceResponse(w, "Already processed (idempotent)", map[string]any{"ref": ref}, true, true, http.StatusOK)
 }
 
-func IdempotencyMiddleware(next http.Handler) http.Handler {
-	fmt.Println("--IdempotencyMiddleware begin--")
+// Idempotency makes retries of a mutating request safe. A request whose key (the
+// Idempotency-Key header, or a hash of method, path and body) is running gets 409, and one that
+// already succeeded gets the original status, headers and body again, marked with
+// Idempotent-Replayed: true. It must run after authentication, since keys are scoped to the
+// caller. When store is unavailable the request goes ahead unchecked if failOpen, and gets 503
+// otherwise.
+func Idempotency(next http.Handler, store IdempotencyStore, failOpen bool) http.Handler {
+	fmt.Println("--IdempotencyMiddleware begin--", store.Driver())
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !isMutatingMethod(r.Method) {
 			next.ServeHTTP(w, r)
@@ -142,55 +100,86 @@ func IdempotencyMiddleware(next http.Handler) http.Handler {
 		_ = r.Body.Close()
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-		idemKey := deriveIdempotencyKey(r, body)
+		requestHash := sha256Hex([]byte(r.Method + "|" + r.URL.RequestURI() + "|" + string(body)))
+		idemKey := deriveIdempotencyKey(r, requestHash)
 
-		code, val, err := beginIdempotency(r.Context(), idemKey, config.ProcessingTTL())
+		state, result, err := store.Begin(r.Context(), idemKey, time.Duration(config.ProcessingTTL())*time.Millisecond)
 		if err != nil {
-			log.Printf("idempotency begin error (middleware): %v", err)
+			log.Printf("idempotency begin error (middleware, %s store): %v", store.Driver(), err)
+			if !failOpen {
+				w.Header().Set("Retry-After", "3")
+				models.WriteServiceError(w, "Duplicate request check unavailable. Please retry.", false, true, http.StatusServiceUnavailable)
+				return
+			}
+			// fail open: run the request without the duplicate check
+			next.ServeHTTP(w, r)
+			return
 		}
-		switch code {
-		case 0:
+		switch state {
+		case IdempotencyInProgress:
 			w.Header().Set("Retry-After", "3")
 			// prevent duplicate request
 			// return here so the handler is not called
 			models.WriteServiceError(w, "Duplicate request in progress. Please retry.", false, true, http.StatusConflict)
 			return
-		case 2:
-			// it's already responded to the client
-			ref := parseDoneRef(val)
-			models.WriteServiceResponse(w, "Already processed (idempotent)", map[string]any{"ref": ref}, true, true, http.StatusOK)
+		case IdempotencyDone:
+			// it's already responded to the client; send the same response again
+			original, err := decodeIdempotentResponse(result)
+			if err != nil {
+				log.Printf("idempotency replay error (middleware): %v", err)
+				original = idempotentResponse{Truncated: true}
+			}
+			if original.RequestHash != "" && original.RequestHash != requestHash {
+				models.WriteServiceError(w, "Idempotency-Key was already used for a different request", false, true, http.StatusUnprocessableEntity)
+				return
+			}
+			original.replay(w)
 			return
 		}
 
 		// 핸들러 실행
-		iw := &idemResponseWriter{ResponseWriter: w, status: 0}
+		iw := &idemResponseWriter{ResponseWriter: w, limit: config.IdempotencyMaxReplayBytes()}
 		next.ServeHTTP(iw, r)
 
 		if iw.status == 0 {
 			iw.status = http.StatusOK
 		}
-		if iw.status >= 200 && iw.status < 300 {
-			// if success (not 5xx) then mark as done
-
-			ref := iw.Header().Get("Idempotency-Ref")
-			if ref == "" {
-				ref = sha256Hex([]byte(r.Method + "|" + r.URL.Path + "|" + string(body)))
-			}
+		if iw.status < 200 || iw.status >= 300 {
+			// the handler already answered with the error; free the key so the request can be
+			// sent again
+			releaseIdempotency(r.Context(), store, idemKey)
+			return
+		}
 
-			// mark as done
-			if err := finishIdempotency(r.Context(), idemKey, ref, config.DoneTTL()); err != nil {
-				log.Printf("idempotency finish error (middleware): %v", err)
-			}
-		} else {
-			// client error
-			// delete the idempotency key, so the next request can proceed
-			if iw.status >= 400 && iw.status < 500 {
-				_ = getRedis().Del(r.Context(), "idem:"+idemKey).Err()
-				models.WriteServiceError(w, "Client error. Please check your request and try again.", false, true, iw.status)
-			} else {
-				_ = getRedis().Del(r.Context(), "idem:"+idemKey).Err()
-				models.WriteServiceError(w, "Internal server error. Please try again later.", false, true, iw.status)
-			}
+		// success: keep the response for retries and mark as done
+		ref := iw.Header().Get("Idempotency-Ref")
+		if ref == "" {
+			ref = requestHash
+		}
+		response := idempotentResponse{
+			RequestHash: requestHash,
+			Ref:         ref,
+			Status:      iw.status,
+			Header:      selectReplayHeaders(iw.Header()),
+			Body:        iw.body.Bytes(),
+			Truncated:   iw.overflow,
+		}
+		if response.Truncated {
+			response.Body = nil
+		}
+		encoded, err := response.encode()
+		if err != nil {
+			log.Printf("idempotency encode error (middleware): %v", err)
+			encoded = []byte(ref)
+		}
+		if err := store.Finish(r.Context(), idemKey, encoded, time.Duration(config.DoneTTL())*time.Millisecond); err != nil {
+			log.Printf("idempotency finish error (middleware): %v", err)
 		}
 	})
 }
+
+func releaseIdempotency(ctx context.Context, store IdempotencyStore, key string) {
+	if err := store.Release(ctx, key); err != nil {
+		log.Printf("idempotency release error (middleware): %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryIdempotencyEntry struct {
+	done    bool
+	result  []byte
+	expires time.Time
+}
+
+// MemoryIdempotencyStore keeps keys in process memory. Retries only match when they reach the
+// same instance, so it suits single-instance deployments and tests.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]memoryIdempotencyEntry{}}
+}
+
+func (s *MemoryIdempotencyStore) Driver() string {
+	return "memory"
+}
+
+func (s *MemoryIdempotencyStore) Begin(ctx context.Context, key string, processingTTL time.Duration) (IdempotencyState, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		if entry.done {
+			return IdempotencyDone, entry.result, nil
+		}
+		return IdempotencyInProgress, nil, nil
+	}
+	s.entries[key] = memoryIdempotencyEntry{expires: now.Add(processingTTL)}
+	return IdempotencyStarted, nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Finish(ctx context.Context, key string, result []byte, doneTTL time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && !entry.done {
+		s.entries[key] = memoryIdempotencyEntry{done: true, result: result, expires: time.Now().Add(doneTTL)}
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[key]; ok && !entry.done {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// sweep drops expired entries, at most once a minute. The caller holds s.mu.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
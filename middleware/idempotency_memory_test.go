@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryIdempotencyStoreLifecycle(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	state, _, err := store.Begin(ctx, "key", time.Minute)
+	if err != nil || state != IdempotencyStarted {
+		t.Fatalf("first Begin = %v, %v; want started", state, err)
+	}
+	state, _, _ = store.Begin(ctx, "key", time.Minute)
+	if state != IdempotencyInProgress {
+		t.Fatalf("second Begin = %v, want in progress", state)
+	}
+
+	if err := store.Finish(ctx, "key", []byte("result"), time.Hour); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	state, result, _ := store.Begin(ctx, "key", time.Minute)
+	if state != IdempotencyDone || string(result) != "result" {
+		t.Fatalf("Begin after Finish = %v, %q; want done with the result", state, result)
+	}
+
+	// A finished key keeps its result
+	if err := store.Release(ctx, "key"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if state, _, _ := store.Begin(ctx, "key", time.Minute); state != IdempotencyDone {
+		t.Errorf("Begin after releasing a finished key = %v, want done", state)
+	}
+}
+
+func TestMemoryIdempotencyStoreRelease(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	store.Begin(ctx, "key", time.Minute)
+	if err := store.Release(ctx, "key"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if state, _, _ := store.Begin(ctx, "key", time.Minute); state != IdempotencyStarted {
+		t.Errorf("Begin after Release = %v, want started", state)
+	}
+
+	// Finishing a key that was never claimed stores nothing
+	store.Finish(ctx, "other", []byte("result"), time.Hour)
+	if state, _, _ := store.Begin(ctx, "other", time.Minute); state != IdempotencyStarted {
+		t.Errorf("Begin after an unclaimed Finish = %v, want started", state)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+
+	store.Begin(ctx, "processing", 10*time.Millisecond)
+	store.Begin(ctx, "done", time.Minute)
+	store.Finish(ctx, "done", []byte("result"), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if state, _, _ := store.Begin(ctx, "processing", time.Minute); state != IdempotencyStarted {
+		t.Errorf("Begin after the processing TTL = %v, want started", state)
+	}
+	if state, _, _ := store.Begin(ctx, "done", time.Minute); state != IdempotencyStarted {
+		t.Errorf("Begin after the done TTL = %v, want started", state)
+	}
+}
+
+func TestMemoryIdempotencyStoreSweep(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	now := time.Now()
+	store.entries["expired"] = memoryIdempotencyEntry{expires: now.Add(-time.Second)}
+	store.entries["live"] = memoryIdempotencyEntry{expires: now.Add(time.Hour)}
+
+	store.sweep(now)
+	if _, ok := store.entries["expired"]; ok {
+		t.Error("sweep kept an expired entry")
+	}
+	if _, ok := store.entries["live"]; !ok {
+		t.Error("sweep dropped a live entry")
+	}
+
+	// A second sweep within the minute is skipped
+	store.entries["expired"] = memoryIdempotencyEntry{expires: now.Add(-time.Second)}
+	store.sweep(now.Add(30 * time.Second))
+	if _, ok := store.entries["expired"]; !ok {
+		t.Error("sweep ran again within a minute")
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// MySQLIdempotencyStore keeps keys in the idempotency_keys table, for deployments without
+// Redis. The middleware's keys are already SHA-256 hex, so they are stored as they are.
+type MySQLIdempotencyStore struct {
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+// NewMySQLIdempotencyStore uses the shared database connection
+func NewMySQLIdempotencyStore() *MySQLIdempotencyStore {
+	return &MySQLIdempotencyStore{}
+}
+
+func (s *MySQLIdempotencyStore) Driver() string {
+	return "mysql"
+}
+
+func (s *MySQLIdempotencyStore) Begin(ctx context.Context, key string, processingTTL time.Duration) (IdempotencyState, []byte, error) {
+	now := time.Now()
+	s.purge(now)
+	state, result, err := models.BeginIdempotencyKey(key, now, now.Add(processingTTL))
+	if err != nil {
+		return 0, nil, err
+	}
+	switch state {
+	case models.IdempotencyKeyProcessing:
+		return IdempotencyInProgress, nil, nil
+	case models.IdempotencyKeyDone:
+		return IdempotencyDone, result, nil
+	}
+	return IdempotencyStarted, nil, nil
+}
+
+func (s *MySQLIdempotencyStore) Finish(ctx context.Context, key string, result []byte, doneTTL time.Duration) error {
+	return models.FinishIdempotencyKey(key, result, time.Now().Add(doneTTL))
+}
+
+func (s *MySQLIdempotencyStore) Release(ctx context.Context, key string) error {
+	return models.ReleaseIdempotencyKey(key)
+}
+
+// purge deletes expired keys in the background, at most every ten minutes
+func (s *MySQLIdempotencyStore) purge(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastPurge) < 10*time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPurge = now
+	s.mu.Unlock()
+
+	go func() {
+		if _, err := models.PurgeIdempotencyKeys(now, 1000); err != nil {
+			log.Printf("Idempotency: failed to purge expired keys: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var beginScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v then
+  redis.call('SET', KEYS[1], 'processing', 'PX', ARGV[1])
+  return {1, ''}
+elseif v == 'processing' then
+  return {0, ''}
+else
+  return {2, v}
+end
+`)
+
+var finishScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v == 'processing' then
+  redis.call('SET', KEYS[1], 'done:'..ARGV[1], 'PX', ARGV[2])
+  return 1
+else
+  return 0
+end
+`)
+
+// releaseScript only drops a key still being processed, never a stored result
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == 'processing' then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisIdempotencyStore keeps keys in Redis as "processing" or "done:<result>", updated by Lua
+// scripts so concurrent requests see a consistent state
+type RedisIdempotencyStore struct {
+	client *redis.Client
+}
+
+// NewRedisIdempotencyStore wraps a Redis client
+func NewRedisIdempotencyStore(client *redis.Client) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{client: client}
+}
+
+// NewRedisIdempotencyStoreFromURL connects to a redis:// URL. The connection is made lazily,
+// so an unreachable server shows up as errors from Begin rather than here.
+func NewRedisIdempotencyStoreFromURL(rawURL string) (*RedisIdempotencyStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse REDIS_URL: %v", err)
+	}
+	password, _ := u.User.Password()
+	return NewRedisIdempotencyStore(redis.NewClient(&redis.Options{
+		Addr:     u.Host,
+		Password: password,
+		DB:       0,
+	})), nil
+}
+
+func (s *RedisIdempotencyStore) Driver() string {
+	return "redis"
+}
+
+func redisIdempotencyKey(key string) string {
+	return "idem:" + key
+}
+
+func (s *RedisIdempotencyStore) Begin(ctx context.Context, key string, processingTTL time.Duration) (IdempotencyState, []byte, error) {
+	res, err := beginScript.Run(ctx, s.client, []string{redisIdempotencyKey(key)}, processingTTL.Milliseconds()).Result()
+	if err != nil {
+		fmt.Println("---beginIdempotency error---", err)
+		return 0, nil, err
+	}
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return 0, nil, fmt.Errorf("unexpected idempotency script result %v", res)
+	}
+	code, _ := vals[0].(int64)
+	switch code {
+	case 0:
+		return IdempotencyInProgress, nil, nil
+	case 2:
+		v, _ := vals[1].(string)
+		return IdempotencyDone, []byte(strings.TrimPrefix(v, "done:")), nil
+	}
+	return IdempotencyStarted, nil, nil
+}
+
+func (s *RedisIdempotencyStore) Finish(ctx context.Context, key string, result []byte, doneTTL time.Duration) error {
+	return finishScript.Run(ctx, s.client, []string{redisIdempotencyKey(key)}, result, doneTTL.Milliseconds()).Err()
+}
+
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return releaseScript.Run(ctx, s.client, []string{redisIdempotencyKey(key)}).Err()
+}
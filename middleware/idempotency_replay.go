@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// IdempotentReplayedHeader marks a response replayed from an earlier identical request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// replayHeaders are the response headers kept for replay; the rest describe the connection or
+// are recomputed
+var replayHeaders = []string{"Content-Type", "Content-Language", "ETag", "Location", "Idempotency-Ref", RequestIDHeader}
+
+// idempotentResponse is a finished response kept in the idempotency store
+type idempotentResponse struct {
+	RequestHash string      `json:"request_hash"` // method, path and body of the original request
+	Ref         string      `json:"ref"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body,omitempty"`
+	Truncated   bool        `json:"truncated,omitempty"` // body was over the size limit and not kept
+}
+
+// encode gzips the response for the store. Gzip output starts with 0x1f 0x8b, which tells it
+// apart from the bare refs stored before responses were kept.
+func (resp idempotentResponse) encode() ([]byte, error) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeIdempotentResponse reads a stored result. A bare ref from before responses were kept
+// comes back as a truncated response.
+func decodeIdempotentResponse(stored []byte) (idempotentResponse, error) {
+	if len(stored) < 2 || stored[0] != 0x1f || stored[1] != 0x8b {
+		return idempotentResponse{Ref: string(stored), Status: http.StatusOK, Truncated: true}, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		return idempotentResponse{}, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return idempotentResponse{}, err
+	}
+	var resp idempotentResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return idempotentResponse{}, err
+	}
+	return resp, nil
+}
+
+// selectReplayHeaders copies the headers kept for replay
+func selectReplayHeaders(header http.Header) http.Header {
+	selected := http.Header{}
+	for _, name := range replayHeaders {
+		if values := header.Values(name); len(values) > 0 {
+			selected[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return selected
+}
+
+// replay writes a stored response to a retry, marked with Idempotent-Replayed
+func (resp idempotentResponse) replay(w http.ResponseWriter) {
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	if resp.Truncated {
+		// Only the ref survives; answer as before responses were kept
+		writeAlreadyProcessed(w, resp.Ref)
+		return
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
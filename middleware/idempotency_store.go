@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// IdempotencyState is what Begin found for a key
+type IdempotencyState int
+
+const (
+	// IdempotencyStarted means the key was free and the caller now holds it
+	IdempotencyStarted IdempotencyState = iota
+	// IdempotencyInProgress means another request with the key is still running
+	IdempotencyInProgress
+	// IdempotencyDone means a request with the key already finished; its result is returned
+	IdempotencyDone
+)
+
+// IdempotencyStore remembers which mutating requests are running or done, so retries of the
+// same request are not applied twice
+type IdempotencyStore interface {
+	// Driver names the implementation ("redis", "memory", "mysql")
+	Driver() string
+	// Begin claims key for processingTTL. For a finished key it returns the stored result.
+	Begin(ctx context.Context, key string, processingTTL time.Duration) (IdempotencyState, []byte, error)
+	// Finish marks a claimed key done with result, kept for doneTTL
+	Finish(ctx context.Context, key string, result []byte, doneTTL time.Duration) error
+	// Release frees a claimed key without a result, so the request can be sent again
+	Release(ctx context.Context, key string) error
+}
+
+var (
+	defaultIdempotencyOnce  sync.Once
+	defaultIdempotencyStore IdempotencyStore
+	defaultIdempotencyErr   error
+)
+
+// DefaultIdempotencyStore returns the process-wide idempotency store configured by the
+// environment
+func DefaultIdempotencyStore() (IdempotencyStore, error) {
+	defaultIdempotencyOnce.Do(func() {
+		defaultIdempotencyStore, defaultIdempotencyErr = NewIdempotencyStoreFromEnv()
+	})
+	return defaultIdempotencyStore, defaultIdempotencyErr
+}
+
+// NewIdempotencyStoreFromEnv builds the store named by IDEM_STORE:
+//   - "redis" (default): Redis at REDIS_URL, shared by every instance
+//   - "memory": in-process map, for a single instance and tests
+//   - "mysql": the idempotency_keys table, for deployments without Redis
+func NewIdempotencyStoreFromEnv() (IdempotencyStore, error) {
+	switch driver := os.Getenv("IDEM_STORE"); driver {
+	case "", "redis":
+		return NewRedisIdempotencyStoreFromURL(os.Getenv("REDIS_URL"))
+	case "memory":
+		return NewMemoryIdempotencyStore(), nil
+	case "mysql":
+		return NewMySQLIdempotencyStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown IDEM_STORE %q", driver)
+	}
+}
@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// Permission names one guarded capability
+type Permission string
+
+const (
+	PermItemsRead     Permission = "items:read"
+	PermItemsWrite    Permission = "items:write"
+	PermStockWrite    Permission = "stock:write"
+	PermStockDiscount Permission = "stock:discount"
+	PermStockTransfer Permission = "stock:transfer"
+	PermImagesUpload  Permission = "images:upload"
+	PermImagesDelete  Permission = "images:delete"
+	PermAIUse         Permission = "ai:use"
+	PermAIBatch       Permission = "ai:batch"
+	PermReviewsWrite  Permission = "reviews:write"
+	PermGlossaryWrite Permission = "glossary:write"
+	PermAuditRead     Permission = "audit:read"
+	PermAdmin         Permission = "admin"
+)
+
+// permissionRoles is the least privileged role holding each permission
+var permissionRoles = map[Permission]string{
+	PermItemsRead:     models.RoleStaff,
+	PermStockWrite:    models.RoleStaff,
+	PermImagesUpload:  models.RoleStaff,
+	PermAIUse:         models.RoleStaff,
+	PermItemsWrite:    models.RoleSupervisor,
+	PermStockDiscount: models.RoleSupervisor,
+	PermStockTransfer: models.RoleSupervisor,
+	PermReviewsWrite:  models.RoleSupervisor,
+	PermImagesDelete:  models.RoleManager,
+	PermAIBatch:       models.RoleManager,
+	PermGlossaryWrite: models.RoleManager,
+	PermAuditRead:     models.RoleManager,
+	PermAdmin:         models.RoleAdmin,
+}
+
+// routePermissions maps "METHOD /path/template" (relative to /api/v1) to the permission it needs.
+// Routes missing here are refused, so new routes must be added when they are registered.
+var routePermissions = map[string]Permission{
+	"POST /createNewItem":                             PermItemsWrite,
+	"GET /getItemByBarcode":                           PermItemsRead,
+	"GET /getItemByCode":                              PermItemsRead,
+	"GET /getItemById":                                PermItemsRead,
+	"PUT /updateItemById":                             PermItemsWrite,
+	"POST /stockIn":                                   PermStockWrite,
+	"POST /stockOut":                                  PermStockWrite,
+	"PUT /stockUpdate":                                PermStockDiscount,
+	"PATCH /stocks/{stockId}":                         PermStockDiscount,
+	"POST /registerItem":                              PermItemsWrite,
+	"PUT /updateItem":                                 PermItemsWrite,
+	"GET /getItems":                                   PermItemsRead,
+	"GET /getItemsPaginated":                          PermItemsRead,
+	"POST /searchItems":                               PermItemsRead,
+	"GET /getItemsWithMissingInfo":                    PermItemsRead,
+	"POST /lookupItems":                               PermItemsRead,
+	"POST /searchItemsByPhoto":                        PermAIUse,
+	"GET /getItemsExpiringWithinDays":                 PermItemsRead,
+	"PATCH /items/{itemId}":                           PermItemsWrite,
+	"GET /items/{itemId}/images":                      PermItemsRead,
+	"POST /items/{itemId}/images":                     PermItemsWrite,
+	"PUT /items/{itemId}/images/order":                PermItemsWrite,
+	"PUT /items/{itemId}/images/{imageId}/primary":    PermItemsWrite,
+	"DELETE /items/{itemId}/images/{imageId}":         PermItemsWrite,
+	"GET /items/{itemId}/versions":                    PermItemsRead,
+	"GET /items/{itemId}/versions/diff":               PermItemsRead,
+	"GET /items/{itemId}/versions/{version}":          PermItemsRead,
+	"POST /items/{itemId}/versions/{version}/restore": PermItemsWrite,
+	"GET /tags":                                       PermItemsRead,
+	"POST /tags/create":                               PermItemsWrite,
+	"GET /tags/popular":                               PermItemsRead,
+	"GET /tags/search":                                PermItemsRead,
+	"GET /tags/item/{itemId}":                         PermItemsRead,
+	"POST /tags/associate":                            PermItemsWrite,
+	"POST /recommendations":                           PermItemsRead,
+	"POST /saveBarcode":                               PermItemsWrite,
+	"POST /analyze_barcode":                           PermAIUse,
+	"POST /analyzeProductImage":                       PermAIUse,
+	"POST /admin/enrichment/jobs":                     PermAIBatch,
+	"GET /admin/enrichment/jobs":                      PermAIBatch,
+	"GET /admin/enrichment/jobs/{jobId}":              PermAIBatch,
+	"POST /items/{itemId}/translations":               PermAIUse,
+	"POST /translations/batch":                        PermAIBatch,
+	"GET /translations/glossary":                      PermItemsRead,
+	"POST /translations/glossary":                     PermGlossaryWrite,
+	"PUT /translations/glossary/{termId}":             PermGlossaryWrite,
+	"DELETE /translations/glossary/{termId}":          PermGlossaryWrite,
+	"GET /admin/llm/usage":                            PermAdmin,
+	"GET /admin/llm/quotas":                           PermAdmin,
+	"PUT /admin/llm/quotas":                           PermAdmin,
+	"DELETE /admin/llm/quotas/{quotaId}":              PermAdmin,
+	"GET /reviews/suggestions":                        PermReviewsWrite,
+	"GET /reviews/suggestions/{suggestionId}":         PermReviewsWrite,
+	"POST /reviews/suggestions/{suggestionId}":        PermReviewsWrite,
+	"POST /upload/image":                              PermImagesUpload,
+	"POST /upload/image/presign":                      PermImagesUpload,
+	"POST /upload/image/finalize":                     PermImagesUpload,
+	"DELETE /delete/image":                            PermImagesDelete,
+	"POST /admin/images/gc":                           PermAdmin,
+	"GET /admin/images/gc":                            PermAdmin,
+	"GET /admin/images/gc/{runId}":                    PermAdmin,
+	"POST /admin/images/gc/{runId}/delete":            PermAdmin,
+	"POST /admin/images/fingerprints/backfill":        PermAdmin,
+	"GET /me/permissions":                             PermItemsRead,
+	"GET /admin/roles":                                PermAdmin,
+	"PUT /admin/users/{uid}/role":                     PermAdmin,
+	"GET /stores":                                     PermItemsRead,
+	"POST /admin/stores":                              PermAdmin,
+	"PUT /admin/stores/{storeId}":                     PermAdmin,
+	"POST /transfers":                                 PermStockTransfer,
+	"GET /transfers":                                  PermItemsRead,
+	"GET /transfers/{transferId}":                     PermItemsRead,
+	"POST /transfers/{transferId}/dispatch":           PermStockTransfer,
+	"POST /transfers/{transferId}/receive":            PermStockWrite,
+	"POST /transfers/{transferId}/cancel":             PermStockTransfer,
+	"POST /admin/api-keys":                            PermAdmin,
+	"GET /admin/api-keys":                             PermAdmin,
+	"DELETE /admin/api-keys/{keyId}":                  PermAdmin,
+	"GET /me":                                         PermItemsRead,
+	"PUT /me":                                         PermItemsRead,
+	"GET /admin/users":                                PermAdmin,
+	"GET /admin/users/{uid}":                          PermAdmin,
+	"POST /admin/users/{uid}/deactivate":              PermAdmin,
+	"POST /admin/users/{uid}/reactivate":              PermAdmin,
+	"DELETE /admin/users/{uid}":                       PermAdmin,
+	"GET /audit":                                      PermAuditRead,
+	"GET /admin/audit/verify":                         PermAdmin,
+}
+
+const apiPathPrefix = "/api/v1"
+
+// roleCacheTTL bounds how long a role change takes to apply without InvalidateRoleCache
+const roleCacheTTL = 30 * time.Second
+
+type cachedRole struct {
+	role    string
+	expires time.Time
+}
+
+var (
+	roleCacheMu sync.Mutex
+	roleCache   = map[string]cachedRole{}
+)
+
+// userRole resolves the caller's role, caching it briefly so each request does not hit the DB.
+// API keys carry their role themselves.
+func userRole(claims firebase.TokenClaims) (string, error) {
+	if claims.APIKeyID != 0 {
+		return claims.Role, nil
+	}
+	roleCacheMu.Lock()
+	cached, ok := roleCache[claims.UID]
+	roleCacheMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.role, nil
+	}
+
+	role, err := models.ResolveUserRole(claims.UID, claims.Email, claims.EmailVerified)
+	if err != nil {
+		return "", err
+	}
+	roleCacheMu.Lock()
+	roleCache[claims.UID] = cachedRole{role: role, expires: time.Now().Add(roleCacheTTL)}
+	roleCacheMu.Unlock()
+	return role, nil
+}
+
+// InvalidateRoleCache makes the next request of uid re-read its role
+func InvalidateRoleCache(uid string) {
+	roleCacheMu.Lock()
+	defer roleCacheMu.Unlock()
+	delete(roleCache, uid)
+}
+
+// RouteKey is the routePermissions key of the matched route
+func RouteKey(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	template = "/" + strings.TrimLeft(strings.TrimPrefix(template, apiPathPrefix), "/")
+	return r.Method + " " + template
+}
+
+// HasPermission reports whether role holds permission
+func HasPermission(role string, permission Permission) bool {
+	required, ok := permissionRoles[permission]
+	return ok && models.RoleLevel(role) >= models.RoleLevel(required)
+}
+
+// RolePermissions lists the permissions a role holds
+func RolePermissions(role string) []string {
+	permissions := []string{}
+	for permission := range permissionRoles {
+		if HasPermission(role, permission) {
+			permissions = append(permissions, string(permission))
+		}
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// RequirePermission enforces the permission matrix on the apiRouter subrouter. It must run after
+// ValidateFirebaseToken; the resolved role is added to the token claims in the context.
+func RequirePermission(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := RouteKey(r)
+		permission, ok := routePermissions[key]
+		if !ok {
+			log.Printf("RBAC: no permission configured for %q, refusing", key)
+			models.WriteServiceError(w, "Access to this endpoint is not configured", false, true, http.StatusForbidden)
+			return
+		}
+
+		claims := firebase.GetTokenClaimsFromContext(r.Context())
+		// Keys issued before roles were capped may still say admin
+		if claims.APIKeyID != 0 && permission == PermAdmin {
+			models.WriteServiceError(w, "API keys cannot use admin endpoints", false, true, http.StatusForbidden)
+			return
+		}
+		role, err := userRole(claims)
+		if err != nil {
+			log.Printf("RBAC: failed to resolve role of %s: %v", claims.UID, err)
+			models.WriteServiceError(w, "Failed to check permissions", false, true, http.StatusInternalServerError)
+			return
+		}
+		if !HasPermission(role, permission) {
+			models.WriteServiceError(w, "Your role ("+role+") does not have the "+string(permission)+" permission", false, true, http.StatusForbidden)
+			return
+		}
+
+		claims.Role = role
+		next.ServeHTTP(w, r.WithContext(firebase.SaveTokenClaimsToContext(r.Context(), claims)))
+	})
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// StoreHeader selects the store a request acts in; without it the user's home store is used
+const StoreHeader = "X-Store-ID"
+
+// storeOverrideRole is the least privileged role that may act in stores other than its own
+const storeOverrideRole = models.RoleManager
+
+type cachedStore struct {
+	storeID string
+	expires time.Time
+}
+
+var (
+	storeCacheMu sync.Mutex
+	storeCache   = map[string]cachedStore{}
+)
+
+// homeStore resolves the store of the caller's branch, caching it like the role
+func homeStore(uid string) (string, error) {
+	storeCacheMu.Lock()
+	cached, ok := storeCache[uid]
+	storeCacheMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.storeID, nil
+	}
+
+	storeID, err := models.ResolveUserStore(uid)
+	if err != nil {
+		return "", err
+	}
+	storeCacheMu.Lock()
+	storeCache[uid] = cachedStore{storeID: storeID, expires: time.Now().Add(roleCacheTTL)}
+	storeCacheMu.Unlock()
+	return storeID, nil
+}
+
+// ClearStoreCache drops every cached home store, e.g. after a store's branch mapping changed
+func ClearStoreCache() {
+	storeCacheMu.Lock()
+	defer storeCacheMu.Unlock()
+	storeCache = map[string]cachedStore{}
+}
+
+// ResolveStore sets the store the request acts in on the token claims. It must run after
+// RequirePermission. Managers and admins may pick any active store with X-Store-ID; everyone
+// else is held to their home store. The claims' StoreID stays empty for users without a
+// store, which store-scoped model functions refuse with models.ErrNoStore. API keys are bound
+// to their store whatever their role.
+func ResolveStore(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := firebase.GetTokenClaimsFromContext(r.Context())
+		if claims.APIKeyID != 0 {
+			if requested := strings.TrimSpace(r.Header.Get(StoreHeader)); requested != "" && requested != claims.StoreID {
+				models.WriteServiceError(w, "This API key can only access store "+claims.StoreID, false, true, http.StatusForbidden)
+				return
+			}
+			w.Header().Set(StoreHeader, claims.StoreID)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		storeID, err := homeStore(claims.UID)
+		if err != nil {
+			log.Printf("Store: failed to resolve home store of %s: %v", claims.UID, err)
+			models.WriteServiceError(w, "Failed to resolve your store", false, true, http.StatusInternalServerError)
+			return
+		}
+
+		if requested := strings.TrimSpace(r.Header.Get(StoreHeader)); requested != "" && requested != storeID {
+			if models.RoleLevel(claims.Role) < models.RoleLevel(storeOverrideRole) {
+				models.WriteServiceError(w, "You can only access your own store", false, true, http.StatusForbidden)
+				return
+			}
+			store, err := models.GetStore(requested)
+			if err != nil || !store.Active {
+				models.WriteServiceError(w, "Unknown or inactive store: "+requested, false, true, http.StatusBadRequest)
+				return
+			}
+			storeID = store.ID
+		}
+
+		if storeID != "" {
+			w.Header().Set(StoreHeader, storeID)
+		}
+		claims.StoreID = storeID
+		next.ServeHTTP(w, r.WithContext(firebase.SaveTokenClaimsToContext(r.Context(), claims)))
+	})
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jimyeongjung/owlverload_api/firebase"
+	"github.com/jimyeongjung/owlverload_api/models"
+)
+
+// lastSeenInterval bounds how often a user's last_seen_at is written
+const lastSeenInterval = 5 * time.Minute
+
+type cachedStatus struct {
+	active  bool
+	expires time.Time
+}
+
+var (
+	statusCacheMu sync.Mutex
+	statusCache   = map[string]cachedStatus{}
+
+	lastSeenMu sync.Mutex
+	lastSeen   = map[string]time.Time{}
+)
+
+// userActive reports whether uid may use the API, caching it like the role
+func userActive(uid string) (bool, error) {
+	statusCacheMu.Lock()
+	cached, ok := statusCache[uid]
+	statusCacheMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.active, nil
+	}
+
+	active, err := models.IsUserActive(uid)
+	if err != nil {
+		return false, err
+	}
+	statusCacheMu.Lock()
+	statusCache[uid] = cachedStatus{active: active, expires: time.Now().Add(roleCacheTTL)}
+	statusCacheMu.Unlock()
+	return active, nil
+}
+
+// InvalidateUserCache makes the next request of uid re-read its status, role and home store,
+// e.g. after the user was deactivated or changed their default store
+func InvalidateUserCache(uid string) {
+	statusCacheMu.Lock()
+	delete(statusCache, uid)
+	statusCacheMu.Unlock()
+
+	InvalidateRoleCache(uid)
+
+	storeCacheMu.Lock()
+	delete(storeCache, uid)
+	storeCacheMu.Unlock()
+}
+
+// touchLastSeen updates last_seen_at, creating the user on first sight, unless this process
+// already did so within lastSeenInterval. Failures are logged and never fail the request.
+func touchLastSeen(claims firebase.TokenClaims) {
+	now := time.Now()
+	lastSeenMu.Lock()
+	if seen, ok := lastSeen[claims.UID]; ok && now.Sub(seen) < lastSeenInterval {
+		lastSeenMu.Unlock()
+		return
+	}
+	lastSeen[claims.UID] = now
+	lastSeenMu.Unlock()
+
+	user := models.User{
+		Uid:           claims.UID,
+		Email:         claims.Email,
+		DisplayName:   claims.DisplayName,
+		EmailVerified: claims.EmailVerified,
+		PhotoURL:      claims.PhotoURL,
+		ProviderId:    claims.ProviderId,
+	}
+	if err := models.TouchUserLastSeen(user); err != nil {
+		log.Printf("Auth: failed to record last seen of %s: %v", claims.UID, err)
+		lastSeenMu.Lock()
+		delete(lastSeen, claims.UID)
+		lastSeenMu.Unlock()
+	}
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	SuggestionStatusPending = "pending"
+)
+
+// AISuggestion is a set of AI-proposed field values for an item, waiting for human review.
+// Changes is keyed by the item's JSON field name (e.g. "name_kor", "is_halal").
+type AISuggestion struct {
+	ID        int64             `json:"id"`
+	ItemID    string            `json:"item_id"`
+	JobID     int64             `json:"job_id,omitempty"`
+	Source    string            `json:"source"`
+	Model     string            `json:"model"`
+	Changes   map[string]string `json:"changes"`
+	Reasoning string            `json:"reasoning"`
+	Status    string            `json:"status"`
+	CreatedBy string            `json:"created_by"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// CreateAISuggestion stores a new pending suggestion
+func CreateAISuggestion(suggestion AISuggestion) (AISuggestion, error) {
+	fmt.Println("---CREATEAISUGGESTION---", suggestion.ItemID, suggestion.Source)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return AISuggestion{}, fmt.Errorf("database connection error")
+	}
+
+	changes, err := json.Marshal(suggestion.Changes)
+	if err != nil {
+		return AISuggestion{}, fmt.Errorf("failed to encode suggestion changes: %v", err)
+	}
+
+	suggestion.Status = SuggestionStatusPending
+	suggestion.CreatedAt = time.Now()
+
+	var jobID sql.NullInt64
+	if suggestion.JobID != 0 {
+		jobID = sql.NullInt64{Int64: suggestion.JobID, Valid: true}
+	}
+
+	query := "INSERT INTO ai_suggestions (item_id, job_id, source, model, changes, reasoning, status, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, suggestion.ItemID, jobID, suggestion.Source, suggestion.Model, string(changes), suggestion.Reasoning, suggestion.Status, suggestion.CreatedBy, suggestion.CreatedAt)
+	if err != nil {
+		return AISuggestion{}, fmt.Errorf("failed to save suggestion: %v", err)
+	}
+	suggestion.ID, err = result.LastInsertId()
+	if err != nil {
+		return AISuggestion{}, fmt.Errorf("failed to get suggestion id: %v", err)
+	}
+
+	return suggestion, nil
+}
+
+// GetPendingSuggestionID returns the id of a pending suggestion from source for the item, or 0
+// when there is none
+func GetPendingSuggestionID(itemID string, source string) (int64, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return 0, fmt.Errorf("database connection error")
+	}
+
+	var id int64
+	err := db.QueryRow("SELECT id FROM ai_suggestions WHERE item_id = ? AND source = ? AND status = ? ORDER BY id LIMIT 1",
+		itemID, source, SuggestionStatusPending).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// apiKeyPrefix marks owlverload API keys so leaked ones are easy to spot
+const apiKeyPrefix = "owk_"
+
+// apiKeyTouchInterval limits how often last_used_at is written for a busy key
+const apiKeyTouchInterval = time.Minute
+
+// ErrInvalidAPIKey is returned for unknown, revoked and expired keys alike
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// ErrAPIKeyNotFound is returned when revoking a key that does not exist or is already revoked
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// MaxAPIKeyRole is the highest role an API key may carry; admin work needs a signed-in user
+const MaxAPIKeyRole = RoleManager
+
+// APIKey lets a device or script act in one store with one role without a Firebase token.
+// Only the SHA-256 hash of the key is stored; the key itself is shown once on creation.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // first characters of the key, for recognising it
+	StoreID    string     `json:"store_id"`
+	Role       string     `json:"role"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedBy  string     `json:"revoked_by,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key can still be used
+func (k APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey issues a key for storeID acting as role and returns it with its plaintext,
+// which cannot be recovered later
+func CreateAPIKey(name string, storeID string, role string, expiresAt *time.Time, createdBy string) (APIKey, string, error) {
+	fmt.Println("---CREATEAPIKEY---", name, storeID, role, createdBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return APIKey{}, "", fmt.Errorf("database connection error")
+	}
+	if !IsRole(role) {
+		return APIKey{}, "", fmt.Errorf("unknown role %q", role)
+	}
+	if RoleLevel(role) > RoleLevel(MaxAPIKeyRole) {
+		return APIKey{}, "", fmt.Errorf("API keys cannot have the %s role", role)
+	}
+	if store, err := GetStore(storeID); err != nil || !store.Active {
+		return APIKey{}, "", fmt.Errorf("unknown or inactive store %s", storeID)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", fmt.Errorf("failed to generate key: %v", err)
+	}
+	plaintext := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := APIKey{
+		Name:      name,
+		Prefix:    plaintext[:len(apiKeyPrefix)+6],
+		StoreID:   storeID,
+		Role:      role,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	result, err := db.Exec("INSERT INTO api_keys (name, prefix, key_hash, store_id, role, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		key.Name, key.Prefix, hashAPIKey(plaintext), key.StoreID, key.Role, key.CreatedBy, key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return APIKey{}, "", fmt.Errorf("failed to create API key: %v", err)
+	}
+	if key.ID, err = result.LastInsertId(); err != nil {
+		return APIKey{}, "", err
+	}
+	return key, plaintext, nil
+}
+
+const apiKeyColumns = "id, name, prefix, store_id, role, created_by, created_at, expires_at, last_used_at, IFNULL(last_used_ip, ''), IFNULL(revoked_by, ''), revoked_at"
+
+func scanAPIKey(row rowScanner) (APIKey, error) {
+	var key APIKey
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.StoreID, &key.Role, &key.CreatedBy, &key.CreatedAt,
+		&expiresAt, &lastUsedAt, &key.LastUsedIP, &key.RevokedBy, &revokedAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+// AuthenticateAPIKey returns the active key matching plaintext
+func AuthenticateAPIKey(plaintext string) (APIKey, error) {
+	if !strings.HasPrefix(plaintext, apiKeyPrefix) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return APIKey{}, fmt.Errorf("database connection error")
+	}
+
+	key, err := scanAPIKey(db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hashAPIKey(plaintext)))
+	if err == sql.ErrNoRows {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	if !key.Active() {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	return key, nil
+}
+
+// TouchAPIKey records a use of the key, at most once per apiKeyTouchInterval
+func TouchAPIKey(id int64, ip string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	now := time.Now()
+	_, err := db.Exec("UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		now, ip, id, now.Add(-apiKeyTouchInterval))
+	return err
+}
+
+// GetAPIKeys lists every key, newest first
+func GetAPIKeys() ([]APIKey, error) {
+	fmt.Println("---GETAPIKEYS---")
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey disables a key for good
+func RevokeAPIKey(id int64, revokedBy string) error {
+	fmt.Println("---REVOKEAPIKEY---", id, revokedBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	result, err := db.Exec("UPDATE api_keys SET revoked_by = ?, revoked_at = ? WHERE id = ? AND revoked_at IS NULL", revokedBy, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
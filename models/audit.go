@@ -0,0 +1,311 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// AuditEntry records one mutating request, or one entity it changed. Entries are chained:
+// each hash covers the entry and the previous entry's hash, so editing or deleting a row breaks
+// the chain from that row on.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	RequestID  string          `json:"request_id"`
+	ActorUID   string          `json:"actor_uid"`
+	ActorEmail string          `json:"actor_email"`
+	ActorRole  string          `json:"actor_role"`
+	StoreID    string          `json:"store_id,omitempty"`
+	Method     string          `json:"method"`
+	Route      string          `json:"route"` // route template, e.g. "PUT /updateItem"
+	Path       string          `json:"path"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+	Status     int             `json:"status"`
+	CreatedAt  time.Time       `json:"created_at"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+// AuditFilter narrows GetAuditEntries; zero values are ignored
+type AuditFilter struct {
+	EntityType string
+	EntityID   string
+	Actor      string // actor email or UID
+	From       time.Time
+	To         time.Time
+	BeforeID   int64 // for paging backwards through the log
+	Limit      int
+}
+
+// AuditVerification is the outcome of checking a stretch of the chain
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	FirstID  int64  `json:"first_id,omitempty"`
+	LastID   int64  `json:"last_id,omitempty"`
+	BrokenAt int64  `json:"broken_at,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// computeHash hashes the entry's content together with the previous hash. Every field except
+// ID and Hash is covered.
+func (e AuditEntry) computeHash() string {
+	content := strings.Join([]string{
+		e.PrevHash, e.RequestID, e.ActorUID, e.ActorEmail, e.ActorRole, e.StoreID,
+		e.Method, e.Route, e.Path, e.EntityType, e.EntityID,
+		string(e.Before), string(e.After), string(e.Diff),
+		fmt.Sprint(e.Status), e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "\x1f")
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// DiffJSON lists the top-level fields that differ between two JSON objects as
+// {"field": {"before": ..., "after": ...}}. Values that are not objects are compared whole.
+func DiffJSON(before json.RawMessage, after json.RawMessage) (json.RawMessage, error) {
+	if len(before) == 0 && len(after) == 0 {
+		return nil, nil
+	}
+	var beforeValue, afterValue interface{}
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &beforeValue); err != nil {
+			return nil, err
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &afterValue); err != nil {
+			return nil, err
+		}
+	}
+
+	beforeFields, beforeIsObject := beforeValue.(map[string]interface{})
+	afterFields, afterIsObject := afterValue.(map[string]interface{})
+	if !beforeIsObject || !afterIsObject {
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			return nil, nil
+		}
+		return json.Marshal(map[string]interface{}{"before": beforeValue, "after": afterValue})
+	}
+
+	diff := map[string]interface{}{}
+	for field, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[field]) {
+			diff[field] = map[string]interface{}{"before": value, "after": afterFields[field]}
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok && value != nil {
+			diff[field] = map[string]interface{}{"before": nil, "after": value}
+		}
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(diff)
+}
+
+// AppendAuditEntry adds an entry to the end of the chain. The chain head row is locked so
+// concurrent writers are serialised.
+func AppendAuditEntry(entry AuditEntry) (AuditEntry, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return AuditEntry{}, fmt.Errorf("database connection error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.QueryRow("SELECT last_hash FROM audit_chain WHERE id = 1 FOR UPDATE").Scan(&entry.PrevHash); err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to lock audit chain: %v", err)
+	}
+	// DATETIME(6) keeps microseconds, so the stored time hashes the same when verified
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Hash = entry.computeHash()
+
+	result, err := tx.Exec(`INSERT INTO audit_log (request_id, actor_uid, actor_email, actor_role, store_id, method, route, path,
+		entity_type, entity_id, before_json, after_json, diff_json, status, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.RequestID, entry.ActorUID, entry.ActorEmail, entry.ActorRole, entry.StoreID, entry.Method, entry.Route, entry.Path,
+		entry.EntityType, entry.EntityID, nullableJSON(entry.Before), nullableJSON(entry.After), nullableJSON(entry.Diff),
+		entry.Status, entry.CreatedAt, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to write audit entry: %v", err)
+	}
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return AuditEntry{}, err
+	}
+	if _, err := tx.Exec("UPDATE audit_chain SET last_id = ?, last_hash = ? WHERE id = 1", entry.ID, entry.Hash); err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to advance audit chain: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return AuditEntry{}, fmt.Errorf("failed to commit: %v", err)
+	}
+	tx = nil
+	return entry, nil
+}
+
+func nullableJSON(value json.RawMessage) interface{} {
+	if len(value) == 0 {
+		return nil
+	}
+	return string(value)
+}
+
+const auditColumns = `id, request_id, actor_uid, actor_email, actor_role, IFNULL(store_id, ''), method, route, path,
+	entity_type, IFNULL(entity_id, ''), IFNULL(before_json, ''), IFNULL(after_json, ''), IFNULL(diff_json, ''),
+	status, created_at, prev_hash, hash`
+
+func scanAuditEntry(row rowScanner) (AuditEntry, error) {
+	var entry AuditEntry
+	var before, after, diff string
+	err := row.Scan(&entry.ID, &entry.RequestID, &entry.ActorUID, &entry.ActorEmail, &entry.ActorRole, &entry.StoreID,
+		&entry.Method, &entry.Route, &entry.Path, &entry.EntityType, &entry.EntityID, &before, &after, &diff,
+		&entry.Status, &entry.CreatedAt, &entry.PrevHash, &entry.Hash)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	if before != "" {
+		entry.Before = json.RawMessage(before)
+	}
+	if after != "" {
+		entry.After = json.RawMessage(after)
+	}
+	if diff != "" {
+		entry.Diff = json.RawMessage(diff)
+	}
+	return entry, nil
+}
+
+// GetAuditEntries lists entries matching filter, newest first
+func GetAuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	fmt.Println("---GETAUDITENTRIES---", filter.EntityType, filter.EntityID, filter.Actor)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	where := []string{"1 = 1"}
+	args := []interface{}{}
+	if filter.EntityType != "" {
+		where = append(where, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		where = append(where, "entity_id = ?")
+		args = append(args, filter.EntityID)
+	}
+	if filter.Actor != "" {
+		where = append(where, "(actor_email = ? OR actor_uid = ?)")
+		args = append(args, filter.Actor, filter.Actor)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+	if filter.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 100
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := db.Query("SELECT "+auditColumns+" FROM audit_log WHERE "+strings.Join(where, " AND ")+" ORDER BY id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// VerifyAuditChain recomputes the hashes of up to limit entries starting at fromID and checks
+// each links to the one before it. When it reaches the end of the log it also checks the chain
+// head, which catches entries removed from the end.
+func VerifyAuditChain(fromID int64, limit int) (AuditVerification, error) {
+	fmt.Println("---VERIFYAUDITCHAIN---", fromID, limit)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return AuditVerification{}, fmt.Errorf("database connection error")
+	}
+
+	prevHash := ""
+	err := db.QueryRow("SELECT hash FROM audit_log WHERE id < ? ORDER BY id DESC LIMIT 1", fromID).Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return AuditVerification{}, err
+	}
+
+	rows, err := db.Query("SELECT "+auditColumns+" FROM audit_log WHERE id >= ? ORDER BY id LIMIT ?", fromID, limit)
+	if err != nil {
+		return AuditVerification{}, err
+	}
+	defer rows.Close()
+
+	result := AuditVerification{Valid: true}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return AuditVerification{}, err
+		}
+		if result.Checked == 0 {
+			result.FirstID = entry.ID
+		}
+		result.Checked++
+		result.LastID = entry.ID
+
+		if entry.PrevHash != prevHash {
+			result.Valid, result.BrokenAt, result.Reason = false, entry.ID, "entry does not link to the previous entry; an entry was removed or altered"
+			return result, nil
+		}
+		if entry.computeHash() != entry.Hash {
+			result.Valid, result.BrokenAt, result.Reason = false, entry.ID, "entry content does not match its hash"
+			return result, nil
+		}
+		prevHash = entry.Hash
+	}
+	if err := rows.Err(); err != nil {
+		return AuditVerification{}, err
+	}
+
+	if result.Checked < limit {
+		var lastID int64
+		var lastHash string
+		if err := db.QueryRow("SELECT last_id, last_hash FROM audit_chain WHERE id = 1").Scan(&lastID, &lastHash); err != nil {
+			return AuditVerification{}, err
+		}
+		if lastHash != prevHash {
+			result.Valid, result.BrokenAt, result.Reason = false, lastID, "chain head does not match the last entry; entries were removed from the end"
+		}
+	}
+	return result, nil
+}
@@ -58,10 +58,10 @@ func NewSQLDB(dbConfig DBConfig) *SQLDB {
 
 // Enhanced Query method with logging
 func (s *SQLDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	fmt.Println("Query: %s\nArgs: %v", query, args)
+	fmt.Printf("Query: %s\nArgs: %v\n", query, args)
 	rows, err := s.DB.Query(query, args...)
 	if err != nil {
-		fmt.Println("Query failed: %v\nQuery: %s\nArgs: %v", err, query, args)
+		fmt.Printf("Query failed: %v\nQuery: %s\nArgs: %v\n", err, query, args)
 	}
 	return rows, err
 }
@@ -70,23 +70,23 @@ func (s *SQLDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
 func (s *SQLDB) QueryRow(query string, args ...interface{}) *sql.Row {
 	row := s.DB.QueryRow(query, args...)
 	if row != nil {
-		fmt.Println("QueryRow failed: %v\nQuery: %s\nArgs: %v", row, query, args)
+		fmt.Printf("QueryRow failed: %v\nQuery: %s\nArgs: %v\n", row, query, args)
 	}
 	return row
 }
 
 // Enhanced Exec method with logging
 func (s *SQLDB) Exec(query string, args ...interface{}) (sql.Result, error) {
-	fmt.Println("Query: %s\nArgs: %v", query, args)
+	fmt.Printf("Query: %s\nArgs: %v\n", query, args)
 	result, err := s.DB.Exec(query, args...)
 	if err != nil {
-		fmt.Println("Exec failed: %v\nQuery: %s\nArgs: %v", err, query, args)
+		fmt.Printf("Exec failed: %v\nQuery: %s\nArgs: %v\n", err, query, args)
 	} else {
 		// Log affected rows for INSERT/UPDATE/DELETE queries
 		if rowsAffected, err := result.RowsAffected(); err == nil {
-			fmt.Println("Query affected %d rows", rowsAffected)
+			fmt.Printf("Query affected %d rows\n", rowsAffected)
 		} else {
-			fmt.Println("Query affected %d rows", rowsAffected)
+			fmt.Printf("Query affected %d rows\n", rowsAffected)
 		}
 	}
 	return result, err
@@ -94,10 +94,10 @@ func (s *SQLDB) Exec(query string, args ...interface{}) (sql.Result, error) {
 
 // Enhanced Prepare method with logging
 func (s *SQLDB) Prepare(query string) (*sql.Stmt, error) {
-	fmt.Println("Prepare: %s", query)
+	fmt.Printf("Prepare: %s\n", query)
 	stmt, err := s.DB.Prepare(query)
 	if err != nil {
-		fmt.Println("Prepare failed: %v\nQuery: %s", err, query)
+		fmt.Printf("Prepare failed: %v\nQuery: %s\n", err, query)
 	}
 	return stmt, err
 }
@@ -114,7 +114,7 @@ func GetDBConfig() DBConfig {
 
 	// Verify that we have all required configuration
 	if config.DB_USER == "" || config.DB_HOST == "" || config.DB_PORT == "" || config.DB_NAME == "" {
-		fmt.Println("Incomplete database configuration: User=%s, Host=%s, Port=%s, Name=%s",
+		fmt.Printf("Incomplete database configuration: User=%s, Host=%s, Port=%s, Name=%s\n",
 			maskEmpty(config.DB_USER), maskEmpty(config.DB_HOST),
 			maskEmpty(config.DB_PORT), maskEmpty(config.DB_NAME))
 	}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	EnrichmentJobRunning        = "running"
+	EnrichmentJobCompleted      = "completed"
+	EnrichmentJobBudgetExceeded = "budget_exceeded"
+	EnrichmentJobQuotaExceeded  = "quota_exceeded"
+	EnrichmentJobFailed         = "failed"
+)
+
+// EnrichmentJob tracks one batch run of the AI analyzer over items with missing information
+type EnrichmentJob struct {
+	ID               int64      `json:"id"`
+	Status           string     `json:"status"`
+	Concurrency      int        `json:"concurrency"`
+	BudgetTokens     int        `json:"budget_tokens"`
+	TotalItems       int        `json:"total_items"`
+	Processed        int        `json:"processed"`
+	Succeeded        int        `json:"succeeded"`
+	Failed           int        `json:"failed"`
+	Skipped          int        `json:"skipped"`
+	PromptTokens     int        `json:"prompt_tokens"`
+	CompletionTokens int        `json:"completion_tokens"`
+	StartedBy        string     `json:"started_by"`
+	Error            string     `json:"error,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+// EnrichmentJobFailure records why a single item could not be enriched
+type EnrichmentJobFailure struct {
+	JobID     int64     `json:"job_id"`
+	ItemID    string    `json:"item_id"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EnrichmentCandidate is an item together with the fields the analyzer should fill
+type EnrichmentCandidate struct {
+	Item          Item     `json:"item"`
+	MissingFields []string `json:"missing_fields"`
+}
+
+// CreateEnrichmentJob inserts a job row in the running state
+func CreateEnrichmentJob(job EnrichmentJob) (EnrichmentJob, error) {
+	fmt.Println("---CREATEENRICHMENTJOB---", job.StartedBy, job.TotalItems)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return EnrichmentJob{}, fmt.Errorf("database connection error")
+	}
+
+	job.Status = EnrichmentJobRunning
+	job.CreatedAt = time.Now()
+
+	query := "INSERT INTO enrichment_jobs (status, concurrency, budget_tokens, total_items, started_by, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, job.Status, job.Concurrency, job.BudgetTokens, job.TotalItems, job.StartedBy, job.CreatedAt)
+	if err != nil {
+		return EnrichmentJob{}, fmt.Errorf("failed to create enrichment job: %v", err)
+	}
+	job.ID, err = result.LastInsertId()
+	if err != nil {
+		return EnrichmentJob{}, fmt.Errorf("failed to get enrichment job id: %v", err)
+	}
+	return job, nil
+}
+
+// SaveEnrichmentJobProgress writes the counters and status of a running or finished job
+func SaveEnrichmentJobProgress(job EnrichmentJob) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	query := `UPDATE enrichment_jobs
+	SET status = ?, processed = ?, succeeded = ?, failed = ?, skipped = ?, prompt_tokens = ?, completion_tokens = ?, error = ?, finished_at = ?
+	WHERE id = ?`
+	_, err := db.Exec(query, job.Status, job.Processed, job.Succeeded, job.Failed, job.Skipped,
+		job.PromptTokens, job.CompletionTokens, job.Error, job.FinishedAt, job.ID)
+	return err
+}
+
+// FailInterruptedEnrichmentJobs marks jobs still in the running state as failed. Jobs run inside
+// the server process, so at startup any running job was cut off by a restart or crash and would
+// otherwise show as running forever. Returns the number of jobs marked.
+func FailInterruptedEnrichmentJobs() (int64, error) {
+	fmt.Println("---FAILINTERRUPTEDENRICHMENTJOBS---")
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return 0, fmt.Errorf("database connection error")
+	}
+
+	query := `UPDATE enrichment_jobs
+	SET status = ?, skipped = skipped + GREATEST(total_items - processed, 0), error = ?, finished_at = ?
+	WHERE status = ?`
+	result, err := db.Exec(query, EnrichmentJobFailed, "interrupted by a server restart", time.Now(), EnrichmentJobRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark interrupted enrichment jobs: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// RecordEnrichmentFailure stores the error for one item of a job
+func RecordEnrichmentFailure(jobID int64, itemID string, message string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	_, err := db.Exec("INSERT INTO enrichment_job_failures (job_id, item_id, error, created_at) VALUES (?, ?, ?, ?)",
+		jobID, itemID, message, time.Now())
+	return err
+}
+
+const enrichmentJobColumns = "id, status, concurrency, budget_tokens, total_items, processed, succeeded, failed, skipped, prompt_tokens, completion_tokens, started_by, IFNULL(error, ''), created_at, finished_at"
+
+func scanEnrichmentJob(scanner interface{ Scan(...interface{}) error }) (EnrichmentJob, error) {
+	var job EnrichmentJob
+	var finishedAt sql.NullTime
+	err := scanner.Scan(
+		&job.ID,
+		&job.Status,
+		&job.Concurrency,
+		&job.BudgetTokens,
+		&job.TotalItems,
+		&job.Processed,
+		&job.Succeeded,
+		&job.Failed,
+		&job.Skipped,
+		&job.PromptTokens,
+		&job.CompletionTokens,
+		&job.StartedBy,
+		&job.Error,
+		&job.CreatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return EnrichmentJob{}, err
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return job, nil
+}
+
+// GetEnrichmentJob retrieves a job by id
+func GetEnrichmentJob(id int64) (EnrichmentJob, error) {
+	fmt.Println("---GETENRICHMENTJOB---", id)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return EnrichmentJob{}, fmt.Errorf("database connection error")
+	}
+
+	job, err := scanEnrichmentJob(db.QueryRow("SELECT "+enrichmentJobColumns+" FROM enrichment_jobs WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return EnrichmentJob{}, fmt.Errorf("enrichment job not found")
+		}
+		return EnrichmentJob{}, err
+	}
+	return job, nil
+}
+
+// GetEnrichmentJobs lists the most recent jobs
+func GetEnrichmentJobs(limit int) ([]EnrichmentJob, error) {
+	fmt.Println("---GETENRICHMENTJOBS---", limit)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := db.Query("SELECT "+enrichmentJobColumns+" FROM enrichment_jobs ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []EnrichmentJob{}
+	for rows.Next() {
+		job, err := scanEnrichmentJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetEnrichmentJobFailures lists the per-item failures of a job
+func GetEnrichmentJobFailures(jobID int64) ([]EnrichmentJobFailure, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT job_id, item_id, error, created_at FROM enrichment_job_failures WHERE job_id = ? ORDER BY id", jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []EnrichmentJobFailure{}
+	for rows.Next() {
+		var failure EnrichmentJobFailure
+		if err := rows.Scan(&failure.JobID, &failure.ItemID, &failure.Error, &failure.CreatedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
+// GetItemsMissingEnrichment returns items lacking translated names, ingredients or dietary flags.
+// Items that already have a pending suggestion are skipped so a job never queues the same work twice.
+func GetItemsMissingEnrichment(limit int) ([]EnrichmentCandidate, error) {
+	fmt.Println("---GETITEMSMISSINGENRICHMENT---", limit)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+
+	query := `
+		SELECT i.item_id,
+		IFNULL(i.code, ''),
+		IFNULL(i.barcode, ''),
+		IFNULL(i.name, ''),
+		IFNULL(i.name_jpn, ''),
+		IFNULL(i.name_chn, ''),
+		IFNULL(i.name_kor, ''),
+		IFNULL(i.name_eng, ''),
+		IFNULL(i.ingredients, ''),
+		i.is_halal IS NULL,
+		i.is_pork_contained IS NULL,
+		i.is_beef_contained IS NULL,
+		i.is_plant_based IS NULL
+		FROM items i
+		WHERE (IFNULL(i.name, '') <> '' OR IFNULL(i.barcode, '') <> '')
+		AND (
+			IFNULL(i.name_jpn, '') = '' OR IFNULL(i.name_chn, '') = '' OR IFNULL(i.name_kor, '') = '' OR IFNULL(i.name_eng, '') = ''
+			OR IFNULL(i.ingredients, '') = ''
+			OR i.is_halal IS NULL OR i.is_pork_contained IS NULL OR i.is_beef_contained IS NULL OR i.is_plant_based IS NULL
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM ai_suggestions s WHERE s.item_id = i.item_id AND s.status = 'pending'
+		)
+		ORDER BY i.created_at DESC
+		LIMIT ?
+	`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []EnrichmentCandidate{}
+	for rows.Next() {
+		var item Item
+		var halalMissing, porkMissing, beefMissing, plantMissing bool
+		err := rows.Scan(
+			&item.ID,
+			&item.Code,
+			&item.BarCode,
+			&item.Name,
+			&item.NameJpn,
+			&item.NameChn,
+			&item.NameKor,
+			&item.NameEng,
+			&item.Ingredients,
+			&halalMissing,
+			&porkMissing,
+			&beefMissing,
+			&plantMissing,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		checks := []struct {
+			field   string
+			missing bool
+		}{
+			{"name_jpn", item.NameJpn == ""},
+			{"name_chn", item.NameChn == ""},
+			{"name_kor", item.NameKor == ""},
+			{"name_eng", item.NameEng == ""},
+			{"ingredients", item.Ingredients == ""},
+			{"is_halal", halalMissing},
+			{"is_pork_contained", porkMissing},
+			{"is_beef_contained", beefMissing},
+			{"is_plant_based", plantMissing},
+		}
+		missing := []string{}
+		for _, check := range checks {
+			if check.missing {
+				missing = append(missing, check.field)
+			}
+		}
+		candidates = append(candidates, EnrichmentCandidate{Item: item, MissingFields: missing})
+	}
+	return candidates, rows.Err()
+}
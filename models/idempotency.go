@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Idempotency key states stored in idempotency_keys
+const (
+	IdempotencyKeyProcessing = "processing"
+	IdempotencyKeyDone       = "done"
+)
+
+// BeginIdempotencyKey claims keyHash until expiresAt unless a live entry holds it. It returns
+// "" when the key was claimed, otherwise the state of the live entry and, once done, its result.
+func BeginIdempotencyKey(keyHash string, now time.Time, expiresAt time.Time) (string, []byte, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return "", nil, fmt.Errorf("database connection error")
+	}
+	now, expiresAt = now.UTC(), expiresAt.UTC()
+
+	// An expired entry is taken over in place. expires_at is assigned last because MySQL
+	// evaluates the assignments in order, so the conditions above it see the old value.
+	result, err := db.Exec(`INSERT INTO idempotency_keys (key_hash, state, result, expires_at) VALUES (?, ?, NULL, ?)
+		ON DUPLICATE KEY UPDATE
+			state = IF(expires_at <= ?, ?, state),
+			result = IF(expires_at <= ?, NULL, result),
+			expires_at = IF(expires_at <= ?, ?, expires_at)`,
+		keyHash, IdempotencyKeyProcessing, expiresAt,
+		now, IdempotencyKeyProcessing, now, now, expiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to claim idempotency key: %v", err)
+	}
+	// 1 for a new row, 2 for a taken-over one, 0 when a live entry was left alone
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		return "", nil, nil
+	}
+
+	var state string
+	var stored []byte
+	err = db.QueryRow("SELECT state, result FROM idempotency_keys WHERE key_hash = ?", keyHash).Scan(&state, &stored)
+	if err == sql.ErrNoRows {
+		// Released between the two statements; the retry will claim it
+		return IdempotencyKeyProcessing, nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return state, stored, nil
+}
+
+// FinishIdempotencyKey stores the result of a claimed key and keeps it until expiresAt
+func FinishIdempotencyKey(keyHash string, result []byte, expiresAt time.Time) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	_, err := db.Exec("UPDATE idempotency_keys SET state = ?, result = ?, expires_at = ? WHERE key_hash = ? AND state = ?",
+		IdempotencyKeyDone, result, expiresAt.UTC(), keyHash, IdempotencyKeyProcessing)
+	return err
+}
+
+// ReleaseIdempotencyKey drops a key that is still being processed
+func ReleaseIdempotencyKey(keyHash string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	_, err := db.Exec("DELETE FROM idempotency_keys WHERE key_hash = ? AND state = ?", keyHash, IdempotencyKeyProcessing)
+	return err
+}
+
+// PurgeIdempotencyKeys deletes up to limit entries that expired before now
+func PurgeIdempotencyKeys(now time.Time, limit int) (int64, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return 0, fmt.Errorf("database connection error")
+	}
+	result, err := db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ? LIMIT ?", now.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
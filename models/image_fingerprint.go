@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// ImageDuplicate is an item image whose fingerprint is close to a new upload
+type ImageDuplicate struct {
+	ItemID    string `json:"item_id"`
+	ItemName  string `json:"item_name"`
+	ImageID   string `json:"image_id"`
+	ImagePath string `json:"image_path"`
+	Distance  int    `json:"distance"` // differing dHash bits, 0 = identical
+}
+
+// ItemImageFingerprint is the stored fingerprint of an image attached to an item
+type ItemImageFingerprint struct {
+	ItemID    string
+	ItemName  string
+	Code      string
+	Barcode   string
+	ImageID   string
+	ImagePath string
+	DHash     uint64
+	Histogram []byte
+}
+
+// SaveImageFingerprint stores the perceptual hash and colour histogram of an uploaded image
+func SaveImageFingerprint(imageID string, dhash uint64, histogram []byte) error {
+	fmt.Println("---SAVEIMAGEFINGERPRINT---", imageID)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	_, err := db.Exec(`INSERT INTO image_fingerprints (image_id, dhash, histogram, created_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE dhash = VALUES(dhash), histogram = VALUES(histogram)`,
+		imageID, dhash, histogram, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save image fingerprint: %v", err)
+	}
+	return nil
+}
+
+// DeleteImageFingerprint drops the fingerprint of a deleted image
+func DeleteImageFingerprint(imageID string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	_, err := db.Exec("DELETE FROM image_fingerprints WHERE image_id = ?", imageID)
+	return err
+}
+
+// FindNearDuplicateItemImages returns item images within maxDistance bits of dhash, closest first.
+// excludeImageID skips the upload itself and excludeItemID skips the item it is being attached to.
+// Only items visible in storeID are considered.
+func FindNearDuplicateItemImages(dhash uint64, maxDistance int, excludeImageID string, excludeItemID string, storeID string, limit int) ([]ImageDuplicate, error) {
+	fmt.Println("---FINDNEARDUPLICATEITEMIMAGES---", excludeImageID, maxDistance)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+	if limit <= 0 {
+		limit = 5
+	}
+
+	query := `
+		SELECT ii.item_id, IFNULL(i.name, ''), f.image_id, ii.image_path, BIT_COUNT(f.dhash ^ ?) AS distance
+		FROM image_fingerprints f
+		JOIN item_images ii ON ii.image_id = f.image_id
+		JOIN items i ON i.item_id = ii.item_id
+		WHERE f.image_id <> ? AND ii.item_id <> ? AND BIT_COUNT(f.dhash ^ ?) <= ? AND ` + catalogueFilter("i") + `
+		ORDER BY distance, ii.item_id
+		LIMIT ?`
+	rows, err := db.Query(query, dhash, excludeImageID, excludeItemID, dhash, maxDistance, storeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := []ImageDuplicate{}
+	for rows.Next() {
+		var d ImageDuplicate
+		if err := rows.Scan(&d.ItemID, &d.ItemName, &d.ImageID, &d.ImagePath, &d.Distance); err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, d)
+	}
+	return duplicates, rows.Err()
+}
+
+// GetItemImageFingerprints loads the fingerprints of every image attached to an item visible in storeID
+func GetItemImageFingerprints(storeID string) ([]ItemImageFingerprint, error) {
+	fmt.Println("---GETITEMIMAGEFINGERPRINTS---", storeID)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	query := `
+		SELECT ii.item_id, IFNULL(i.name, ''), IFNULL(i.code, ''), IFNULL(i.barcode, ''), f.image_id, ii.image_path, f.dhash, f.histogram
+		FROM image_fingerprints f
+		JOIN item_images ii ON ii.image_id = f.image_id
+		JOIN items i ON i.item_id = ii.item_id
+		WHERE ` + catalogueFilter("i")
+	rows, err := db.Query(query, storeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints := []ItemImageFingerprint{}
+	for rows.Next() {
+		var f ItemImageFingerprint
+		if err := rows.Scan(&f.ItemID, &f.ItemName, &f.Code, &f.Barcode, &f.ImageID, &f.ImagePath, &f.DHash, &f.Histogram); err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, f)
+	}
+	return fingerprints, rows.Err()
+}
+
+// GetItemImagePathsMissingFingerprints lists attached image paths with no fingerprint,
+// or one stored before colour histograms were added
+func GetItemImagePathsMissingFingerprints(limit int) ([]string, error) {
+	fmt.Println("---GETITEMIMAGEPATHSMISSINGFINGERPRINTS---", limit)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+
+	query := `
+		SELECT DISTINCT ii.image_path
+		FROM item_images ii
+		LEFT JOIN image_fingerprints f ON f.image_id = ii.image_id
+		WHERE f.image_id IS NULL OR f.histogram IS NULL
+		LIMIT ?`
+	rows, err := db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+	for rows.Next() {
+		var imagePath string
+		if err := rows.Scan(&imagePath); err != nil {
+			return nil, err
+		}
+		paths = append(paths, imagePath)
+	}
+	return paths, rows.Err()
+}
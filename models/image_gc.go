@@ -0,0 +1,250 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Image GC runs first scan (a dry run that only records candidates) and, once
+// reviewed, delete the candidates in a separate pass.
+const (
+	ImageGCRunScanning = "scanning"
+	ImageGCRunScanned  = "scanned"
+	ImageGCRunDeleting = "deleting"
+	ImageGCRunDeleted  = "deleted"
+	ImageGCRunFailed   = "failed"
+
+	ImageGCCandidatePending = "pending"
+	ImageGCCandidateDeleted = "deleted"
+	ImageGCCandidateSkipped = "skipped"
+)
+
+// ImageGCRun is one garbage collection pass over the image bucket
+type ImageGCRun struct {
+	ID             int64      `json:"id"`
+	Status         string     `json:"status"`
+	GraceHours     int        `json:"grace_hours"`
+	ScannedObjects int        `json:"scanned_objects"`
+	Candidates     int        `json:"candidates"`
+	CandidateBytes int64      `json:"candidate_bytes"`
+	Deleted        int        `json:"deleted"`
+	DeletedBytes   int64      `json:"deleted_bytes"`
+	Skipped        int        `json:"skipped"`
+	StartedBy      string     `json:"started_by"`
+	DeletedBy      string     `json:"deleted_by,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ScannedAt      *time.Time `json:"scanned_at,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+// ImageGCCandidate is one unreferenced object found by a scan
+type ImageGCCandidate struct {
+	ID           int64     `json:"id"`
+	RunID        int64     `json:"run_id"`
+	ImageID      string    `json:"image_id"`
+	StorageKey   string    `json:"storage_key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Status       string    `json:"status"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// CreateImageGCRun inserts a run in the scanning state
+func CreateImageGCRun(run ImageGCRun) (ImageGCRun, error) {
+	fmt.Println("---CREATEIMAGEGCRUN---", run.StartedBy, run.GraceHours)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return ImageGCRun{}, fmt.Errorf("database connection error")
+	}
+
+	run.Status = ImageGCRunScanning
+	run.CreatedAt = time.Now()
+	result, err := db.Exec("INSERT INTO image_gc_runs (status, grace_hours, started_by, created_at) VALUES (?, ?, ?, ?)",
+		run.Status, run.GraceHours, run.StartedBy, run.CreatedAt)
+	if err != nil {
+		return ImageGCRun{}, fmt.Errorf("failed to create image gc run: %v", err)
+	}
+	run.ID, err = result.LastInsertId()
+	if err != nil {
+		return ImageGCRun{}, fmt.Errorf("failed to get image gc run id: %v", err)
+	}
+	return run, nil
+}
+
+// SaveImageGCRunProgress writes the counters and status of a run
+func SaveImageGCRunProgress(run ImageGCRun) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	query := `UPDATE image_gc_runs
+	SET status = ?, scanned_objects = ?, candidates = ?, candidate_bytes = ?, deleted = ?, deleted_bytes = ?, skipped = ?,
+	deleted_by = ?, error = ?, scanned_at = ?, deleted_at = ?
+	WHERE id = ?`
+	_, err := db.Exec(query, run.Status, run.ScannedObjects, run.Candidates, run.CandidateBytes, run.Deleted, run.DeletedBytes, run.Skipped,
+		run.DeletedBy, run.Error, run.ScannedAt, run.DeletedAt, run.ID)
+	return err
+}
+
+// StartImageGCDeletion moves a scanned run to deleting. It fails when the run was
+// never scanned successfully or its delete pass already started.
+func StartImageGCDeletion(runID int64, deletedBy string) (ImageGCRun, error) {
+	fmt.Println("---STARTIMAGEGCDELETION---", runID, deletedBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return ImageGCRun{}, fmt.Errorf("database connection error")
+	}
+
+	result, err := db.Exec("UPDATE image_gc_runs SET status = ?, deleted_by = ? WHERE id = ? AND status = ?",
+		ImageGCRunDeleting, deletedBy, runID, ImageGCRunScanned)
+	if err != nil {
+		return ImageGCRun{}, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ImageGCRun{}, fmt.Errorf("image gc run %d is not awaiting deletion", runID)
+	}
+	return GetImageGCRun(runID)
+}
+
+const imageGCRunColumns = "id, status, grace_hours, scanned_objects, candidates, candidate_bytes, deleted, deleted_bytes, skipped, started_by, IFNULL(deleted_by, ''), IFNULL(error, ''), created_at, scanned_at, deleted_at"
+
+func scanImageGCRun(scanner interface{ Scan(...interface{}) error }) (ImageGCRun, error) {
+	var run ImageGCRun
+	var scannedAt, deletedAt sql.NullTime
+	err := scanner.Scan(&run.ID, &run.Status, &run.GraceHours, &run.ScannedObjects, &run.Candidates, &run.CandidateBytes,
+		&run.Deleted, &run.DeletedBytes, &run.Skipped, &run.StartedBy, &run.DeletedBy, &run.Error, &run.CreatedAt, &scannedAt, &deletedAt)
+	if err != nil {
+		return ImageGCRun{}, err
+	}
+	if scannedAt.Valid {
+		run.ScannedAt = &scannedAt.Time
+	}
+	if deletedAt.Valid {
+		run.DeletedAt = &deletedAt.Time
+	}
+	return run, nil
+}
+
+// GetImageGCRun retrieves a run by id
+func GetImageGCRun(id int64) (ImageGCRun, error) {
+	fmt.Println("---GETIMAGEGCRUN---", id)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return ImageGCRun{}, fmt.Errorf("database connection error")
+	}
+
+	run, err := scanImageGCRun(db.QueryRow("SELECT "+imageGCRunColumns+" FROM image_gc_runs WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ImageGCRun{}, fmt.Errorf("image gc run not found")
+		}
+		return ImageGCRun{}, err
+	}
+	return run, nil
+}
+
+// GetImageGCRuns lists the most recent runs
+func GetImageGCRuns(limit int) ([]ImageGCRun, error) {
+	fmt.Println("---GETIMAGEGCRUNS---", limit)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := db.Query("SELECT "+imageGCRunColumns+" FROM image_gc_runs ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []ImageGCRun{}
+	for rows.Next() {
+		run, err := scanImageGCRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// SaveImageGCCandidates records the objects a scan found
+func SaveImageGCCandidates(runID int64, candidates []ImageGCCandidate) error {
+	fmt.Println("---SAVEIMAGEGCCANDIDATES---", runID, len(candidates))
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.Prepare("INSERT INTO image_gc_candidates (run_id, image_id, storage_key, size, last_modified, status) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range candidates {
+		if _, err := stmt.Exec(runID, c.ImageID, c.StorageKey, c.Size, c.LastModified, ImageGCCandidatePending); err != nil {
+			return fmt.Errorf("failed to save gc candidate %s: %v", c.StorageKey, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx = nil
+	return nil
+}
+
+// GetImageGCCandidates lists the candidates of a run, optionally filtered by status
+func GetImageGCCandidates(runID int64, status string) ([]ImageGCCandidate, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	query := "SELECT id, run_id, image_id, storage_key, size, last_modified, status, IFNULL(reason, '') FROM image_gc_candidates WHERE run_id = ?"
+	args := []interface{}{runID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	rows, err := db.Query(query+" ORDER BY image_id, storage_key", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candidates := []ImageGCCandidate{}
+	for rows.Next() {
+		var c ImageGCCandidate
+		if err := rows.Scan(&c.ID, &c.RunID, &c.ImageID, &c.StorageKey, &c.Size, &c.LastModified, &c.Status, &c.Reason); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// MarkImageGCCandidate records the outcome of deleting one candidate
+func MarkImageGCCandidate(id int64, status string, reason string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	_, err := db.Exec("UPDATE image_gc_candidates SET status = ?, reason = ? WHERE id = ?", status, reason, id)
+	return err
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ImageReferenceSource is a column that stores image paths or URLs. Every feature that
+// keeps uploaded images must register its column so GC and deletes see the reference.
+// For JSON columns JSONPath selects the string, or array of strings, holding the paths.
+type ImageReferenceSource struct {
+	Name     string // reported to the client, e.g. "item_images"
+	Table    string
+	Column   string
+	JSONPath string // e.g. "$.image_path"; empty for plain text columns
+}
+
+var (
+	imageReferenceMu      sync.RWMutex
+	imageReferenceSources = []ImageReferenceSource{
+		{Name: "item_images", Table: "item_images", Column: "image_path"},
+		{Name: "items", Table: "items", Column: "image_path"},
+		// Old versions keep their images so a restore never points at a deleted file
+		{Name: "item_versions", Table: "item_versions", Column: "snapshot", JSONPath: "$.image_path"},
+		{Name: "item_versions", Table: "item_versions", Column: "snapshot", JSONPath: "$.image_paths"},
+	}
+)
+
+// RegisterImageReferenceSource adds a column to the image reference registry
+func RegisterImageReferenceSource(source ImageReferenceSource) {
+	imageReferenceMu.Lock()
+	defer imageReferenceMu.Unlock()
+	imageReferenceSources = append(imageReferenceSources, source)
+}
+
+// ImageReferenceSources returns the registered reference columns
+func ImageReferenceSources() []ImageReferenceSource {
+	imageReferenceMu.RLock()
+	defer imageReferenceMu.RUnlock()
+	return append([]ImageReferenceSource(nil), imageReferenceSources...)
+}
+
+// ImageIDFromPath extracts the upload's image id from a stored path, URL or storage key:
+// "/<id>.jpg", "https://cdn/<id>.jpg", "images/<id>/320.webp". Returns "" for anything
+// that was not produced by the upload pipeline.
+func ImageIDFromPath(imagePath string) string {
+	if parsed, err := url.Parse(imagePath); err == nil && parsed.Scheme != "" {
+		imagePath = parsed.Path
+	}
+	imagePath = strings.Trim(imagePath, "/")
+	if imagePath == "" {
+		return ""
+	}
+
+	base := path.Base(imagePath)
+	name := strings.TrimSuffix(base, path.Ext(base))
+	if _, err := uuid.Parse(name); err == nil {
+		return name
+	}
+	// Variants live under a directory named after the image id
+	if dir := path.Base(path.Dir(imagePath)); dir != "." {
+		if _, err := uuid.Parse(dir); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// escapeLike escapes the LIKE wildcards in value for use with ESCAPE '!'
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
+
+// imagePathsFromJSON returns the strings in a JSON string or array of strings
+func imagePathsFromJSON(raw string) []string {
+	var single string
+	if err := json.Unmarshal([]byte(raw), &single); err == nil {
+		return []string{single}
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(raw), &list); err == nil {
+		return list
+	}
+	return nil
+}
+
+// FingerprintImageID is the image_fingerprints key of a stored image path: the upload's image
+// id, or the file name for images from before the upload pipeline used UUIDs
+func FingerprintImageID(imagePath string) string {
+	if id := ImageIDFromPath(imagePath); id != "" {
+		return id
+	}
+	if parsed, err := url.Parse(imagePath); err == nil && parsed.Scheme != "" {
+		imagePath = parsed.Path
+	}
+	base := path.Base(imagePath)
+	if base == "." || base == "/" {
+		return ""
+	}
+	return base
+}
+
+// GetReferencedImageIDs scans every registered source and maps image ids to the sources referencing them
+func GetReferencedImageIDs() (map[string][]string, error) {
+	fmt.Println("---GETREFERENCEDIMAGEIDS---")
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	references := map[string][]string{}
+	addReference := func(id string, name string) {
+		for _, existing := range references[id] {
+			if existing == name {
+				return
+			}
+		}
+		references[id] = append(references[id], name)
+	}
+	for _, source := range ImageReferenceSources() {
+		query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IS NOT NULL AND %s <> ''", source.Column, source.Table, source.Column, source.Column)
+		args := []interface{}{}
+		if source.JSONPath != "" {
+			query = fmt.Sprintf("SELECT JSON_EXTRACT(%s, ?) FROM %s WHERE JSON_EXTRACT(%s, ?) IS NOT NULL", source.Column, source.Table, source.Column)
+			args = append(args, source.JSONPath, source.JSONPath)
+		}
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image references from %s: %v", source.Name, err)
+		}
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			imagePaths := []string{value}
+			if source.JSONPath != "" {
+				imagePaths = imagePathsFromJSON(value)
+			}
+			for _, imagePath := range imagePaths {
+				if id := ImageIDFromPath(imagePath); id != "" {
+					addReference(id, source.Name)
+				}
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return references, nil
+}
+
+// GetImageReferences lists the sources that still reference an image id
+func GetImageReferences(imageID string) ([]string, error) {
+	fmt.Println("---GETIMAGEREFERENCES---", imageID)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	pattern := "%" + escapeLike(imageID) + "%"
+	sources := []string{}
+	found := map[string]bool{}
+	for _, source := range ImageReferenceSources() {
+		if found[source.Name] {
+			continue
+		}
+		var count int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s LIKE ? ESCAPE '!'", source.Table, source.Column)
+		args := []interface{}{pattern}
+		if source.JSONPath != "" {
+			query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE JSON_SEARCH(%s, 'one', ?, '!', ?) IS NOT NULL", source.Table, source.Column)
+			args = append(args, source.JSONPath)
+		}
+		if err := db.QueryRow(query, args...).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to check image references in %s: %v", source.Name, err)
+		}
+		if count > 0 {
+			found[source.Name] = true
+			sources = append(sources, source.Name)
+		}
+	}
+	return sources, nil
+}
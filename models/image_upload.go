@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Direct-to-bucket uploads move pending -> processing -> finalized (or failed when the
+// uploaded file breaks the limits it was presigned with)
+const (
+	ImageUploadPending    = "pending"
+	ImageUploadProcessing = "processing"
+	ImageUploadFinalized  = "finalized"
+	ImageUploadFailed     = "failed"
+)
+
+// ImageUpload is a presigned raw upload waiting to be processed
+type ImageUpload struct {
+	ID          string     `json:"id"`
+	StorageKey  string     `json:"storage_key"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	Status      string     `json:"status"`
+	ImageID     string     `json:"image_id,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	FinalizedAt *time.Time `json:"finalized_at,omitempty"`
+}
+
+// CreateImageUpload records a presigned upload in the pending state
+func CreateImageUpload(upload ImageUpload) (ImageUpload, error) {
+	fmt.Println("---CREATEIMAGEUPLOAD---", upload.ID, upload.CreatedBy, upload.Size)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return ImageUpload{}, fmt.Errorf("database connection error")
+	}
+
+	upload.Status = ImageUploadPending
+	upload.CreatedAt = time.Now()
+	_, err := db.Exec("INSERT INTO image_uploads (id, storage_key, content_type, size, status, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		upload.ID, upload.StorageKey, upload.ContentType, upload.Size, upload.Status, upload.CreatedBy, upload.CreatedAt, upload.ExpiresAt)
+	if err != nil {
+		return ImageUpload{}, fmt.Errorf("failed to create image upload: %v", err)
+	}
+	return upload, nil
+}
+
+// GetImageUpload retrieves an upload by id
+func GetImageUpload(id string) (ImageUpload, error) {
+	fmt.Println("---GETIMAGEUPLOAD---", id)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return ImageUpload{}, fmt.Errorf("database connection error")
+	}
+
+	var upload ImageUpload
+	var finalizedAt sql.NullTime
+	err := db.QueryRow(`SELECT id, storage_key, content_type, size, status, IFNULL(image_id, ''), IFNULL(error, ''), created_by, created_at, expires_at, finalized_at
+		FROM image_uploads WHERE id = ?`, id).Scan(
+		&upload.ID, &upload.StorageKey, &upload.ContentType, &upload.Size, &upload.Status, &upload.ImageID, &upload.Error,
+		&upload.CreatedBy, &upload.CreatedAt, &upload.ExpiresAt, &finalizedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ImageUpload{}, fmt.Errorf("image upload not found")
+		}
+		return ImageUpload{}, err
+	}
+	if finalizedAt.Valid {
+		upload.FinalizedAt = &finalizedAt.Time
+	}
+	return upload, nil
+}
+
+// ClaimImageUpload moves a pending upload to processing so only one finalise call runs it
+func ClaimImageUpload(id string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	result, err := db.Exec("UPDATE image_uploads SET status = ? WHERE id = ? AND status = ?", ImageUploadProcessing, id, ImageUploadPending)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("image upload %s is not pending", id)
+	}
+	return nil
+}
+
+// FinishImageUpload records the outcome of finalising an upload. Status pending hands
+// the upload back so the client can retry.
+func FinishImageUpload(id string, status string, imageID string, message string) error {
+	fmt.Println("---FINISHIMAGEUPLOAD---", id, status)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	var finalizedAt *time.Time
+	if status == ImageUploadFinalized {
+		now := time.Now()
+		finalizedAt = &now
+	}
+	_, err := db.Exec("UPDATE image_uploads SET status = ?, image_id = NULLIF(?, ''), error = NULLIF(?, ''), finalized_at = ? WHERE id = ?",
+		status, imageID, message, finalizedAt, id)
+	return err
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Image variant formats
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatWebP = "webp"
+)
+
+// ImageVariant is one resized encoding of an uploaded image. All variants of an
+// upload share its image ID; StorageKey is relative to the blob store.
+type ImageVariant struct {
+	ImageID    string    `json:"image_id"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Format     string    `json:"format"`
+	StorageKey string    `json:"storage_key"`
+	FileSize   int64     `json:"file_size"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SaveImageVariants records the variants generated for an upload
+func SaveImageVariants(variants []ImageVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	fmt.Println("---SAVEIMAGEVARIANTS---", variants[0].ImageID, len(variants))
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, v := range variants {
+		_, err := tx.Exec(`INSERT INTO image_variants (image_id, width, height, format, storage_key, file_size, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE height = VALUES(height), storage_key = VALUES(storage_key), file_size = VALUES(file_size), created_at = VALUES(created_at)`,
+			v.ImageID, v.Width, v.Height, v.Format, v.StorageKey, v.FileSize, v.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to save image variant: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx = nil
+	return nil
+}
+
+// GetImageVariants lists the variants of an image, narrowest first
+func GetImageVariants(imageID string) ([]ImageVariant, error) {
+	fmt.Println("---GETIMAGEVARIANTS---", imageID)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT image_id, width, height, format, storage_key, file_size, created_at FROM image_variants WHERE image_id = ? ORDER BY width, format", imageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []ImageVariant{}
+	for rows.Next() {
+		var v ImageVariant
+		if err := rows.Scan(&v.ImageID, &v.Width, &v.Height, &v.Format, &v.StorageKey, &v.FileSize, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// DeleteImageVariants drops the variant records of a deleted image
+func DeleteImageVariants(imageID string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	_, err := db.Exec("DELETE FROM image_variants WHERE image_id = ?", imageID)
+	return err
+}
@@ -9,31 +9,38 @@ import (
 )
 
 type Item struct {
-	ID                string    `json:"id"`
-	Code              string    `json:"code"`
-	BarCode           string    `json:"barcode"`
-	BoxBarcode        string    `json:"box_barcode"`
-	Price             float64   `json:"price"`
-	BoxPrice          float64   `json:"box_price"`
-	Name              string    `json:"name"`
-	Type              string    `json:"type"`
-	AvailableForOrder int       `json:"availableForOrder"`
-	ImagePath         string    `json:"image_path"`
-	CreatedAt         time.Time `json:"createdAt,omitempty"`
-	NameJpn           string    `json:"name_jpn"`
-	NameChn           string    `json:"name_chn"`
-	NameKor           string    `json:"name_kor"`
-	NameEng           string    `json:"name_eng"`
-	Stock             []Stock   `json:"stock"`
-	Tag               []Tag     `json:"tag"`
-	Ingredients       string    `json:"ingredients"`
-	IsBeefContained   bool      `json:"is_beef_contained"`
-	IsPorkContained   bool      `json:"is_pork_contained"`
-	IsHalal           bool      `json:"is_halal"`
-	IsPlantBased      bool      `json:"is_plant_based"`
-	Reasoning         string    `json:"reasoning"`
+	ID                string      `json:"id"`
+	Code              string      `json:"code"`
+	BarCode           string      `json:"barcode"`
+	BoxBarcode        string      `json:"box_barcode"`
+	Price             float64     `json:"price"`
+	BoxPrice          float64     `json:"box_price"`
+	Name              string      `json:"name"`
+	Type              string      `json:"type"`
+	AvailableForOrder int         `json:"availableForOrder"`
+	ImagePath         string      `json:"image_path"`
+	CreatedAt         time.Time   `json:"createdAt,omitempty"`
+	NameJpn           string      `json:"name_jpn"`
+	NameChn           string      `json:"name_chn"`
+	NameKor           string      `json:"name_kor"`
+	NameEng           string      `json:"name_eng"`
+	Stock             []Stock     `json:"stock"`
+	Tag               []Tag       `json:"tag"`
+	Images            []ItemImage `json:"images,omitempty"`
+	Ingredients       string      `json:"ingredients"`
+	IsBeefContained   bool        `json:"is_beef_contained"`
+	IsPorkContained   bool        `json:"is_pork_contained"`
+	IsHalal           bool        `json:"is_halal"`
+	IsPlantBased      bool        `json:"is_plant_based"`
+	Reasoning         string      `json:"reasoning"`
+	StoreID           string      `json:"store_id,omitempty"` // empty for the shared catalogue
+	RowVersion        int         `json:"row_version"`        // bumped on every write, see ErrVersionConflict
 }
 
+// ErrVersionConflict is returned when a row was changed since the caller read the row_version
+// it expects
+var ErrVersionConflict = errors.New("modified by someone else since it was read")
+
 type StockType string
 
 const (
@@ -45,6 +52,7 @@ const (
 type Stock struct {
 	StockId           string    `json:"stock_id"`
 	ItemId            string    `json:"item_id"`
+	StoreID           string    `json:"store_id"`
 	StockType         StockType `json:"stock_type"`
 	BoxNumber         int       `json:"box_number"`
 	PCSNumber         int       `json:"pcs_number"`
@@ -55,28 +63,36 @@ type Stock struct {
 	Notes             string    `json:"notes"`
 	CreatedAt         time.Time `json:"created_at,omitempty"`
 	DiscountRate      int       `json:"discount_rate"`
+	OriginStockID     string    `json:"origin_stock_id,omitempty"` // lot this one was transferred from
+	RowVersion        int       `json:"row_version"`
 }
 
 type StockTransaction struct {
 	ID              string    `json:"id"`
 	ItemID          string    `json:"itemId"`
+	StoreID         string    `json:"storeId"`
 	Quantity        int       `json:"quantity"`
-	TransactionType string    `json:"transactionType"` // "in" or "out"
+	TransactionType string    `json:"transactionType"` // "in", "out" or one of the transfer_* types
+	TransferID      int64     `json:"transferId,omitempty"`
 	UserEmail       string    `json:"userEmail"`
 	Notes           string    `json:"notes"`
 	CreatedAt       time.Time `json:"createdAt,omitempty"`
 }
 
 // GetItemByBarcode retrieves an item by its barcode
-func GetItemByBarcode(barcode string) (Item, error) {
-	fmt.Println("---GETITEMBYBARCODE---", barcode)
+// GetItemByBarcode finds an item of storeID's catalogue by barcode, with the store's stock
+func GetItemByBarcode(barcode string, storeID string) (Item, error) {
+	fmt.Println("---GETITEMBYBARCODE---", barcode, storeID)
+	if storeID == "" {
+		return Item{}, ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 	var item Item
 
-	query := `SELECT item_id, code, barcode, box_barcode, price, box_price, name, type, available_for_order, image_path, created_at 
+	query := `SELECT item_id, code, barcode, box_barcode, price, box_price, name, type, available_for_order, image_path, created_at, IFNULL(store_id, '') 
 				FROM items 
-				WHERE barcode = ? OR box_barcode = ?;`
-	err := db.QueryRow(query, barcode, barcode).Scan(
+				WHERE (barcode = ? OR box_barcode = ?) AND ` + catalogueFilter("") + `;`
+	err := db.QueryRow(query, barcode, barcode, storeID).Scan(
 		&item.ID,
 		&item.Code,
 		&item.BarCode,
@@ -88,6 +104,7 @@ func GetItemByBarcode(barcode string) (Item, error) {
 		&item.AvailableForOrder,
 		&item.ImagePath,
 		&item.CreatedAt,
+		&item.StoreID,
 	)
 
 	if err != nil {
@@ -96,25 +113,8 @@ func GetItemByBarcode(barcode string) (Item, error) {
 		}
 		return item, err
 	}
-	stocks := []Stock{}
-	query = "SELECT stock_type, box_number, pcs_number, bundle_number, stock_id, fkproduct_id,expiry_date, location, registering_person, notes, discount_rate, created_at FROM stocks WHERE fkproduct_id = ?"
-	rows, err := db.Query(query, item.ID)
+	stocks, err := GetStocksByItemId(item.ID, storeID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return item, errors.New("stock not found")
-		}
-		return item, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var stock Stock
-		err = rows.Scan(&stock.StockType, &stock.BoxNumber, &stock.PCSNumber, &stock.BundleNumber, &stock.StockId, &stock.ItemId, &stock.ExpiryDate, &stock.Location, &stock.RegisteringPerson, &stock.Notes, &stock.DiscountRate, &stock.CreatedAt)
-		if err != nil {
-			return item, err
-		}
-		stocks = append(stocks, stock)
-	}
-	if err = rows.Err(); err != nil {
 		return item, err
 	}
 	item.Stock = stocks
@@ -154,7 +154,7 @@ func CreateItem(item Item) (Item, error) {
 	}()
 
 	// Insert the item
-	query := "INSERT INTO items ( code, barcode, box_barcode, price, box_price, name, name_jpn, name_chn, name_kor, name_eng, type, available_for_order, image_path, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	query := "INSERT INTO items ( code, barcode, box_barcode, price, box_price, name, name_jpn, name_chn, name_kor, name_eng, type, available_for_order, image_path, created_at, store_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))"
 	result, err := tx.Exec(query,
 		item.Code,
 		item.BarCode,
@@ -170,6 +170,7 @@ func CreateItem(item Item) (Item, error) {
 		item.AvailableForOrder,
 		item.ImagePath,
 		item.CreatedAt,
+		item.StoreID,
 	)
 
 	if err != nil {
@@ -214,7 +215,8 @@ func CreateItem(item Item) (Item, error) {
 	return item, nil
 }
 
-// UpdateItem updates an existing item in the database
+// UpdateItem updates an existing item in the database. When item.RowVersion is set the write
+// only happens if the row is still at that version, otherwise ErrVersionConflict is returned.
 func UpdateItem(item Item) (Item, error) {
 	fmt.Println("---UPDATEITEM---", item)
 
@@ -267,8 +269,9 @@ func UpdateItem(item Item) (Item, error) {
 	// Prepare update query
 	query := `
 	UPDATE items 
-	SET name = ?, type = ?, name_jpn = ?, name_chn = ?, name_kor = ?, name_eng = ?, barcode = ?, box_barcode = ?, price = ?, box_price = ?, available_for_order = ?, image_path = ?
-	WHERE item_id = ?`
+	SET name = ?, type = ?, name_jpn = ?, name_chn = ?, name_kor = ?, name_eng = ?, barcode = ?, box_barcode = ?, price = ?, box_price = ?, available_for_order = ?, image_path = ?, ingredients = COALESCE(NULLIF(?, ''), ingredients),
+		row_version = row_version + 1
+	WHERE item_id = ? AND (? = 0 OR row_version = ?)`
 
 	stmt, err := db.Prepare(query)
 	if err != nil {
@@ -276,7 +279,7 @@ func UpdateItem(item Item) (Item, error) {
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(
+	result, err := stmt.Exec(
 		item.Name,
 		item.Type,
 		item.NameJpn,
@@ -289,12 +292,26 @@ func UpdateItem(item Item) (Item, error) {
 		item.BoxPrice,
 		item.AvailableForOrder,
 		item.ImagePath,
+		item.Ingredients,
 		item.ID,
+		item.RowVersion,
+		item.RowVersion,
 	)
 
 	if err != nil {
 		return Item{}, err
 	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// row_version always changes, so no affected row means the expected version is stale
+		return Item{}, ErrVersionConflict
+	}
+
+	// Keep the item_images list pointing at the same primary image
+	if item.ImagePath != existingItem.ImagePath {
+		if err := SetPrimaryImageByPath(item.ID, item.ImagePath, ""); err != nil {
+			fmt.Println("---Failed to sync item images---", err)
+		}
+	}
 
 	// Get the updated item to return
 	updatedItem, err := GetItemById(item.ID)
@@ -306,8 +323,11 @@ func UpdateItem(item Item) (Item, error) {
 }
 
 // StockIn adds quantity to an item's stock
-func StockIn(itemID string, quantity int, userID string, notes string) error {
-	fmt.Println("---STOCKIN---", itemID, quantity, userID, notes)
+func StockIn(itemID string, storeID string, quantity int, userID string, notes string) error {
+	fmt.Println("---STOCKIN---", itemID, storeID, quantity, userID, notes)
+	if storeID == "" {
+		return ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 
 	// Start a transaction
@@ -326,8 +346,8 @@ func StockIn(itemID string, quantity int, userID string, notes string) error {
 
 	// 2. Create stock transaction record
 	transactionID := fmt.Sprintf("transaction_%d", time.Now().UnixNano())
-	transactionQuery := "INSERT INTO stock_transactions (id, item_id, quantity, type, user_id, notes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
-	_, err = tx.Exec(transactionQuery, transactionID, itemID, quantity, "in", userID, notes, time.Now())
+	transactionQuery := "INSERT INTO stock_transactions (id, item_id, store_id, quantity, type, user_id, notes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(transactionQuery, transactionID, itemID, storeID, quantity, "in", userID, notes, time.Now())
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -337,8 +357,11 @@ func StockIn(itemID string, quantity int, userID string, notes string) error {
 }
 
 // StockOut removes quantity from an item's stock
-func StockOut(itemID string, quantity int, userID string, notes string) error {
-	fmt.Println("---STOCKOUT---", itemID, quantity, userID, notes)
+func StockOut(itemID string, storeID string, quantity int, userID string, notes string) error {
+	fmt.Println("---STOCKOUT---", itemID, storeID, quantity, userID, notes)
+	if storeID == "" {
+		return ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 
 	// First check if there's enough stock
@@ -368,8 +391,8 @@ func StockOut(itemID string, quantity int, userID string, notes string) error {
 	}
 
 	// 2. Create stock transaction record
-	transactionQuery := "INSERT INTO stock_transactions (item_id, quantity, type, user_id, notes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
-	_, err = tx.Exec(transactionQuery, itemID, quantity, "out", userID, notes, time.Now())
+	transactionQuery := "INSERT INTO stock_transactions (item_id, store_id, quantity, type, user_id, notes, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(transactionQuery, itemID, storeID, quantity, "out", userID, notes, time.Now())
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -378,16 +401,19 @@ func StockOut(itemID string, quantity int, userID string, notes string) error {
 	return tx.Commit()
 }
 
-// GetAllItems retrieves all items from the database with their tags
-func GetAllItems() ([]Item, error) {
-	fmt.Println("---GETALLITEMS---")
+// GetAllItems retrieves the catalogue of storeID with tags and the store's stock
+func GetAllItems(storeID string) ([]Item, error) {
+	fmt.Println("---GETALLITEMS---", storeID)
+	if storeID == "" {
+		return nil, ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 	var items []Item
 	var itemMap = make(map[string]*Item) // Map to store items by ID for easy access
 
 	// First query to get all items
-	query := "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at FROM items"
-	rows, err := db.Query(query)
+	query := "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at, IFNULL(store_id, '') FROM items WHERE " + catalogueFilter("")
+	rows, err := db.Query(query, storeID)
 	if err != nil {
 		return nil, err
 	}
@@ -407,6 +433,7 @@ func GetAllItems() ([]Item, error) {
 			&item.AvailableForOrder,
 			&item.ImagePath,
 			&item.CreatedAt,
+			&item.StoreID,
 		)
 		if err != nil {
 			return nil, err
@@ -463,7 +490,7 @@ func GetAllItems() ([]Item, error) {
 
 	// Fetch stock information for each item
 	for i, item := range items {
-		stocks, err := GetStocksByItemId(item.ID)
+		stocks, err := GetStocksByItemId(item.ID, storeID)
 		if err != nil {
 			// Continue with empty stock if there's an error
 			items[i].Stock = []Stock{}
@@ -496,8 +523,11 @@ FIX LATER
 // GetItemsPaginated retrieves items from the database with pagination and tag filtering
 
 // STUDY THIS CODE
-func GetItemsPaginated(offset, limit int, tagParams []string) ([]Item, int, error) {
-	fmt.Println("---GETITEMSPAGINATED---", offset, limit, tagParams)
+func GetItemsPaginated(offset, limit int, tagParams []string, storeID string) ([]Item, int, error) {
+	fmt.Println("---GETITEMSPAGINATED---", offset, limit, tagParams, storeID)
+	if storeID == "" {
+		return nil, 0, ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 	if db == nil {
 		fmt.Println("---db---", db)
@@ -525,6 +555,7 @@ func GetItemsPaginated(offset, limit int, tagParams []string) ([]Item, int, erro
 	for _, tag := range tagParams {
 		args = append(args, tag)
 	}
+	args = append(args, storeID)
 
 	// First, get the correct total count (items with matching tags)
 	var totalCount int
@@ -533,7 +564,7 @@ func GetItemsPaginated(offset, limit int, tagParams []string) ([]Item, int, erro
 		FROM items i
 		JOIN item_tags it ON i.item_id = it.item_id
 		JOIN tags t ON it.tag_id = t.id
-		WHERE t.name IN (` + placeholderStr + `)
+		WHERE t.name IN (` + placeholderStr + `) AND ` + catalogueFilter("i") + `
 	`
 
 	fmt.Println("---countQuery---", countQuery, args)
@@ -566,7 +597,7 @@ func GetItemsPaginated(offset, limit int, tagParams []string) ([]Item, int, erro
 		FROM items i
 		JOIN item_tags it ON i.item_id = it.item_id
 		JOIN tags t ON it.tag_id = t.id
-		WHERE t.name IN (` + placeholderStr + `)
+		WHERE t.name IN (` + placeholderStr + `) AND ` + catalogueFilter("i") + `
 		GROUP BY i.item_id
 		ORDER BY i.created_at DESC
 		LIMIT ? OFFSET ?
@@ -604,7 +635,7 @@ func GetItemsPaginated(offset, limit int, tagParams []string) ([]Item, int, erro
 			return nil, 0, err
 		}
 
-		fmt.Println("---Found item: ID=%s, Name=%s---", item.ID, item.Name)
+		fmt.Printf("---Found item: ID=%s, Name=%s---\n", item.ID, item.Name)
 		itemMap[item.ID] = &item
 		items = append(items, item)
 	}
@@ -668,14 +699,14 @@ func GetItemsPaginated(offset, limit int, tagParams []string) ([]Item, int, erro
 
 		// Fetch stock for each item
 		for i, item := range items {
-			fmt.Println("---Fetching stocks for item: %s---", item.ID)
-			stocks, err := GetStocksByItemId(item.ID)
+			fmt.Printf("---Fetching stocks for item: %s---\n", item.ID)
+			stocks, err := GetStocksByItemId(item.ID, storeID)
 			if err != nil {
 				fmt.Println("---err---", err)
 				items[i].Stock = []Stock{} // Empty stock array if error
 			} else {
 				items[i].Stock = stocks
-				fmt.Println("---Found %d stocks for item %s---", len(stocks), item.ID)
+				fmt.Printf("---Found %d stocks for item %s---\n", len(stocks), item.ID)
 			}
 		}
 	}
@@ -705,23 +736,13 @@ func GetItemByCode(code string) (Item, error) {
 func AddStock(stock Stock) error {
 	fmt.Println("---ADDSTOCK---", stock)
 	db := GetDBInstance(GetDBConfig())
-	query := "INSERT INTO stocks ( fkproduct_id,  stock_type,box_number, pcs_number, bundle_number, expiry_date, location, registering_person, notes, discount_rate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ? )"
-	_, err := db.Exec(query, stock.ItemId, stock.StockType, stock.BoxNumber, stock.PCSNumber, stock.BundleNumber, stock.ExpiryDate, stock.Location, stock.RegisteringPerson, stock.Notes, stock.DiscountRate)
-	if err != nil {
-		return err
-	}
-	return nil
+	return insertStock(db, stock)
 }
 func SaveStockTransaction(transaction StockTransaction) error {
 	fmt.Println("---SAVESTOCKTRANSACTION---", transaction)
 	db := GetDBInstance(GetDBConfig())
 	fmt.Println("@@@transaction.UserEmail", transaction.UserEmail)
-	query := "INSERT INTO stock_transactions ( fkitem_id, quantity, transaction_type, fkuser_email) VALUES (?, ?, ?, ?)"
-	_, err := db.Exec(query, transaction.ItemID, transaction.Quantity, transaction.TransactionType, transaction.UserEmail)
-	if err != nil {
-		return err
-	}
-	return nil
+	return insertStockTransaction(db, transaction)
 }
 
 func GetItemById(id string) (Item, error) {
@@ -740,10 +761,10 @@ func GetItemById(id string) (Item, error) {
 	var item Item
 	query := "SELECT item_id, code, IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), " +
 		"IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at, " +
-		"IFNULL(name_jpn, ''), IFNULL(name_chn, ''), IFNULL(name_kor, ''), IFNULL(name_eng, '') " +
+		"IFNULL(name_jpn, ''), IFNULL(name_chn, ''), IFNULL(name_kor, ''), IFNULL(name_eng, ''), IFNULL(ingredients, ''), IFNULL(store_id, ''), row_version " +
 		"FROM items WHERE item_id = ?"
 	fmt.Println("---QUERY---", query)
-	fmt.Println("---Executing query: %s with item ID: %s---", query, id)
+	fmt.Printf("---Executing query: %s with item ID: %s---\n", query, id)
 
 	err := db.QueryRow(query, id).Scan(
 		&item.ID,
@@ -761,26 +782,39 @@ func GetItemById(id string) (Item, error) {
 		&item.NameChn,
 		&item.NameKor,
 		&item.NameEng,
+		&item.Ingredients,
+		&item.StoreID,
+		&item.RowVersion,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			fmt.Println("---No item found with ID: %s---", id)
+			fmt.Printf("---No item found with ID: %s---\n", id)
 			return Item{}, fmt.Errorf("item not found")
 		}
-		fmt.Println("---Error querying item with ID %s: %v---", id, err)
+		fmt.Printf("---Error querying item with ID %s: %v---\n", id, err)
 		return Item{}, err
 	}
 
 	return item, nil
 }
 
-func GetStocksByItemId(itemId string) ([]Stock, error) {
-	fmt.Println("---GETSTOCKSBYITEMID---", itemId)
+// VisibleInStore reports whether the item is in storeID's catalogue: shared items are
+// visible everywhere, store-specific ones only in their own store
+func (i Item) VisibleInStore(storeID string) bool {
+	return i.StoreID == "" || i.StoreID == storeID
+}
+
+// GetStocksByItemId lists the stock lots an item has in storeID
+func GetStocksByItemId(itemId string, storeID string) ([]Stock, error) {
+	fmt.Println("---GETSTOCKSBYITEMID---", itemId, storeID)
 	if itemId == "" {
 		fmt.Println("---Empty item ID provided to GetStocksByItemId---")
 		return nil, fmt.Errorf("empty item ID")
 	}
+	if storeID == "" {
+		return nil, ErrNoStore
+	}
 
 	db := GetDBInstance(GetDBConfig())
 	if db == nil {
@@ -789,67 +823,59 @@ func GetStocksByItemId(itemId string) ([]Stock, error) {
 	}
 
 	var stocks []Stock
-	query := "SELECT stock_id, fkproduct_id, stock_type, box_number, pcs_number, bundle_number, expiry_date, location, registering_person, IFNULL(notes, ''), IFNULL(discount_rate, 0), created_at FROM stocks WHERE fkproduct_id = ?"
-	fmt.Println("---Executing query: %s with item ID: %s---", query, itemId)
+	query := "SELECT " + stockColumns + " FROM stocks WHERE fkproduct_id = ? AND store_id = ?"
+	fmt.Printf("---Executing query: %s with item ID: %s---\n", query, itemId)
 
-	rows, err := db.Query(query, itemId)
+	rows, err := db.Query(query, itemId, storeID)
 	if err != nil {
-		fmt.Println("---Error querying stocks for item %s: %v---", itemId, err)
+		fmt.Printf("---Error querying stocks for item %s: %v---\n", itemId, err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	stockCount := 0
 	for rows.Next() {
-		var stock Stock
-		err := rows.Scan(
-			&stock.StockId,
-			&stock.ItemId,
-			&stock.StockType,
-			&stock.BoxNumber,
-			&stock.PCSNumber,
-			&stock.BundleNumber,
-			&stock.ExpiryDate,
-			&stock.Location,
-			&stock.RegisteringPerson,
-			&stock.Notes,
-			&stock.DiscountRate,
-			&stock.CreatedAt,
-		)
+		stock, err := scanStock(rows)
 		if err != nil {
-			fmt.Println("---Error scanning stock row: %v---", err)
+			fmt.Printf("---Error scanning stock row: %v---\n", err)
 			return nil, err
 		}
-		fmt.Println("---Found stock: ID=%s, BoxNumber=%d, Location=%s---",
+		fmt.Printf("---Found stock: ID=%s, BoxNumber=%d, Location=%s---\n",
 			stock.StockId, stock.BoxNumber, stock.Location)
 		stocks = append(stocks, stock)
 		stockCount++
 	}
 
 	if err = rows.Err(); err != nil {
-		fmt.Println("---Error iterating through rows: %v---", err)
+		fmt.Printf("---Error iterating through rows: %v---\n", err)
 		return nil, err
 	}
 
 	return stocks, nil
 }
-func UpdateStock(stockId string, stockType string, quantity int) error {
-	fmt.Println("---UPDATESTOCK---", stockId, stockType, quantity)
+func UpdateStock(stockId string, storeID string, stockType string, quantity int) error {
+	fmt.Println("---UPDATESTOCK---", stockId, storeID, stockType, quantity)
+	if storeID == "" {
+		return ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
-	query := "UPDATE stocks SET box_number = box_number - ? WHERE stock_id = ?"
-	_, err := db.Exec(query, quantity, stockId)
+	query := "UPDATE stocks SET box_number = box_number - ?, row_version = row_version + 1 WHERE stock_id = ? AND store_id = ?"
+	_, err := db.Exec(query, quantity, stockId, storeID)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func RemoveStock(stockId string) error {
-	fmt.Println("---REMOVESTOCK---", stockId)
+func RemoveStock(stockId string, storeID string) error {
+	fmt.Println("---REMOVESTOCK---", stockId, storeID)
+	if storeID == "" {
+		return ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 	// delete row from stocks table
-	query := "DELETE FROM stocks WHERE stock_id = ?"
-	_, err := db.Exec(query, stockId)
+	query := "DELETE FROM stocks WHERE stock_id = ? AND store_id = ?"
+	_, err := db.Exec(query, stockId, storeID)
 	if err != nil {
 		return err
 	}
@@ -857,8 +883,11 @@ func RemoveStock(stockId string) error {
 }
 
 // SearchItemsByField searches for items using LIKE query on the specified field
-func SearchItemsByField(searchType string, value string) ([]Item, error) {
-	fmt.Println("---SEARCHITEMSBYFIELD---", searchType, value)
+func SearchItemsByField(searchType string, value string, storeID string) ([]Item, error) {
+	fmt.Println("---SEARCHITEMSBYFIELD---", searchType, value, storeID)
+	if storeID == "" {
+		return nil, ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 	var items []Item
 	var itemMap = make(map[string]*Item) // Map to store items by ID for easy access
@@ -870,16 +899,16 @@ func SearchItemsByField(searchType string, value string) ([]Item, error) {
 	// Determine which field to search
 	switch searchType {
 	case "code":
-		query = "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at FROM items WHERE code LIKE ?"
+		query = "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at FROM items WHERE code LIKE ? AND " + catalogueFilter("")
 	case "barcode":
-		query = "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at FROM items WHERE barcode LIKE ?"
+		query = "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at FROM items WHERE barcode LIKE ? AND " + catalogueFilter("")
 	case "name":
-		query = "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at FROM items WHERE name LIKE ?"
+		query = "SELECT item_id, IFNULL(code, ''), IFNULL(barcode, ''), IFNULL(box_barcode, ''), IFNULL(price, 0), IFNULL(box_price, 0), IFNULL(name, ''), IFNULL(type, ''), IFNULL(available_for_order, 0), IFNULL(image_path, ''), created_at FROM items WHERE name LIKE ? AND " + catalogueFilter("")
 	default:
 		return nil, fmt.Errorf("invalid search type: %s", searchType)
 	}
 
-	rows, err := db.Query(query, searchValue)
+	rows, err := db.Query(query, searchValue, storeID)
 	if err != nil {
 		return nil, err
 	}
@@ -975,7 +1004,7 @@ func SearchItemsByField(searchType string, value string) ([]Item, error) {
 
 		// Fetch stock information for each item
 		for i, item := range items {
-			stocks, err := GetStocksByItemId(item.ID)
+			stocks, err := GetStocksByItemId(item.ID, storeID)
 			if err != nil {
 				// Continue with empty stock if there's an error
 				items[i].Stock = []Stock{}
@@ -1031,8 +1060,11 @@ type ItemWithDaysToExpiry struct {
 }
 
 // GetItemsExpiringWithinDays retrieves items that are expiring within the specified number of days
-func GetItemsExpiringWithinDays(withinDays int) ([]ItemWithDaysToExpiry, error) {
-	fmt.Println("---GETITEMSEXPIRINGWITHINDAYS---", withinDays)
+func GetItemsExpiringWithinDays(withinDays int, storeID string) ([]ItemWithDaysToExpiry, error) {
+	fmt.Println("---GETITEMSEXPIRINGWITHINDAYS---", withinDays, storeID)
+	if storeID == "" {
+		return nil, ErrNoStore
+	}
 	db := GetDBInstance(GetDBConfig())
 	if db == nil {
 		fmt.Println("---Failed to get database instance---")
@@ -1062,15 +1094,16 @@ func GetItemsExpiringWithinDays(withinDays int) ([]ItemWithDaysToExpiry, error)
 			DATEDIFF(s.expiry_date, CURDATE()) as days_to_expiry
 		FROM items i
 		JOIN stocks s ON i.item_id = s.fkproduct_id
-		WHERE DATEDIFF(s.expiry_date, CURDATE()) <= ? 
+		WHERE s.store_id = ?
+		AND DATEDIFF(s.expiry_date, CURDATE()) <= ? 
 		AND DATEDIFF(s.expiry_date, CURDATE()) >= 0
 		ORDER BY days_to_expiry ASC
 	`
 
-	fmt.Println("---Executing query: %s with withinDays: %d---", query, withinDays)
-	rows, err := db.Query(query, withinDays)
+	fmt.Printf("---Executing query: %s with withinDays: %d---\n", query, withinDays)
+	rows, err := db.Query(query, storeID, withinDays)
 	if err != nil {
-		fmt.Println("---Error executing expiry query: %v---", err)
+		fmt.Printf("---Error executing expiry query: %v---\n", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -1105,7 +1138,7 @@ func GetItemsExpiringWithinDays(withinDays int) ([]ItemWithDaysToExpiry, error)
 			&daysToExpiry,
 		)
 		if err != nil {
-			fmt.Println("---Error scanning expiry row: %v---", err)
+			fmt.Printf("---Error scanning expiry row: %v---\n", err)
 			return nil, err
 		}
 
@@ -1121,15 +1154,15 @@ func GetItemsExpiringWithinDays(withinDays int) ([]ItemWithDaysToExpiry, error)
 			// Get tags for this item
 			tags, err := GetTagsByItemId(item.ID)
 			if err != nil {
-				fmt.Println("---Error fetching tags for item %s: %v---", item.ID, err)
+				fmt.Printf("---Error fetching tags for item %s: %v---\n", item.ID, err)
 			} else {
 				result.Item.Tag = tags
 			}
 
 			// Get all stocks for this item
-			stocks, err := GetStocksByItemId(item.ID)
+			stocks, err := GetStocksByItemId(item.ID, storeID)
 			if err != nil {
-				fmt.Println("---Error fetching stocks for item %s: %v---", item.ID, err)
+				fmt.Printf("---Error fetching stocks for item %s: %v---\n", item.ID, err)
 			} else {
 				result.Item.Stock = stocks
 			}
@@ -0,0 +1,298 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Image roles describe what a photo of an item shows
+const (
+	ImageRoleFront       = "front"
+	ImageRoleBack        = "back"
+	ImageRoleIngredients = "ingredients"
+	ImageRoleShelf       = "shelf"
+	ImageRoleOther       = "other"
+)
+
+// ImageRoles lists the accepted roles
+var ImageRoles = []string{ImageRoleFront, ImageRoleBack, ImageRoleIngredients, ImageRoleShelf, ImageRoleOther}
+
+// IsImageRole reports whether role is an accepted image role
+func IsImageRole(role string) bool {
+	for _, r := range ImageRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ItemImage is one photo attached to an item. The primary image is mirrored into
+// items.image_path so clients that only read ImagePath keep working.
+type ItemImage struct {
+	ID        int64     `json:"id"`
+	ItemID    string    `json:"item_id"`
+	ImagePath string    `json:"image_path"`
+	Role      string    `json:"role"`
+	SortOrder int       `json:"sort_order"`
+	IsPrimary bool      `json:"is_primary"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const itemImageColumns = "id, item_id, image_path, role, sort_order, is_primary, IFNULL(created_by, ''), created_at"
+
+func scanItemImages(rows *sql.Rows) ([]ItemImage, error) {
+	images := []ItemImage{}
+	for rows.Next() {
+		var img ItemImage
+		if err := rows.Scan(&img.ID, &img.ItemID, &img.ImagePath, &img.Role, &img.SortOrder, &img.IsPrimary, &img.CreatedBy, &img.CreatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// GetItemImages lists an item's images in display order
+func GetItemImages(itemID string) ([]ItemImage, error) {
+	fmt.Println("---GETITEMIMAGES---", itemID)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT "+itemImageColumns+" FROM item_images WHERE item_id = ? ORDER BY sort_order, id", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanItemImages(rows)
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// adoptLegacyImagePath turns an items.image_path set before item_images existed into the
+// first, primary row, so the first attach does not silently demote it.
+func adoptLegacyImagePath(tx queryRower, itemID string, createdBy string) error {
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM item_images WHERE item_id = ?", itemID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	var imagePath string
+	err := tx.QueryRow("SELECT IFNULL(image_path, '') FROM items WHERE item_id = ?", itemID).Scan(&imagePath)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("item not found")
+	}
+	if err != nil || imagePath == "" || imagePath == "/" {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO item_images (item_id, image_path, image_id, role, sort_order, is_primary, created_by, created_at) VALUES (?, ?, ?, ?, 0, TRUE, ?, ?)",
+		itemID, imagePath, FingerprintImageID(imagePath), ImageRoleFront, createdBy, time.Now())
+	return err
+}
+
+// syncPrimaryImagePath copies the primary image (or "" when there is none) into items.image_path
+func syncPrimaryImagePath(tx queryRower, itemID string) error {
+	var imagePath string
+	err := tx.QueryRow("SELECT image_path FROM item_images WHERE item_id = ? AND is_primary = TRUE ORDER BY sort_order, id LIMIT 1", itemID).Scan(&imagePath)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	_, err = tx.Exec("UPDATE items SET image_path = ?, row_version = row_version + 1 WHERE item_id = ?", imagePath, itemID)
+	return err
+}
+
+// withItemImagesTx runs fn in a transaction after adopting any legacy image and
+// re-syncs items.image_path before committing
+func withItemImagesTx(itemID string, createdBy string, fn func(tx *sql.Tx) error) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := adoptLegacyImagePath(tx, itemID, createdBy); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := syncPrimaryImagePath(tx, itemID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx = nil
+	return nil
+}
+
+// AttachItemImage adds an image at the end of the item's list. It becomes primary when
+// requested or when the item has no primary image yet.
+func AttachItemImage(image ItemImage) (ItemImage, error) {
+	fmt.Println("---ATTACHITEMIMAGE---", image.ItemID, image.ImagePath, image.Role)
+	err := withItemImagesTx(image.ItemID, image.CreatedBy, func(tx *sql.Tx) error {
+		var nextOrder int
+		var primaries int
+		err := tx.QueryRow("SELECT IFNULL(MAX(sort_order) + 1, 0), IFNULL(SUM(is_primary), 0) FROM item_images WHERE item_id = ?", image.ItemID).Scan(&nextOrder, &primaries)
+		if err != nil {
+			return err
+		}
+		image.SortOrder = nextOrder
+		if primaries == 0 {
+			image.IsPrimary = true
+		}
+		if image.IsPrimary {
+			if _, err := tx.Exec("UPDATE item_images SET is_primary = FALSE WHERE item_id = ?", image.ItemID); err != nil {
+				return err
+			}
+		}
+
+		image.CreatedAt = time.Now()
+		result, err := tx.Exec("INSERT INTO item_images (item_id, image_path, image_id, role, sort_order, is_primary, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			image.ItemID, image.ImagePath, FingerprintImageID(image.ImagePath), image.Role, image.SortOrder, image.IsPrimary, image.CreatedBy, image.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to attach image: %v", err)
+		}
+		image.ID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return ItemImage{}, err
+	}
+	return image, nil
+}
+
+// ReorderItemImages sets the display order; imageIDs must list every image of the item exactly once
+func ReorderItemImages(itemID string, imageIDs []int64) error {
+	fmt.Println("---REORDERITEMIMAGES---", itemID, imageIDs)
+	return withItemImagesTx(itemID, "", func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT id FROM item_images WHERE item_id = ?", itemID)
+		if err != nil {
+			return err
+		}
+		existing := map[int64]bool{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			existing[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(imageIDs) != len(existing) {
+			return fmt.Errorf("image order must list all %d images of the item", len(existing))
+		}
+		seen := map[int64]bool{}
+		for _, id := range imageIDs {
+			if !existing[id] || seen[id] {
+				return fmt.Errorf("image %d is not an image of this item or is listed twice", id)
+			}
+			seen[id] = true
+		}
+
+		for order, id := range imageIDs {
+			if _, err := tx.Exec("UPDATE item_images SET sort_order = ? WHERE id = ?", order, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetPrimaryItemImage makes one image the item's primary image
+func SetPrimaryItemImage(itemID string, imageID int64) error {
+	fmt.Println("---SETPRIMARYITEMIMAGE---", itemID, imageID)
+	return withItemImagesTx(itemID, "", func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM item_images WHERE id = ? AND item_id = ?", imageID, itemID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("image not found")
+		}
+		_, err = tx.Exec("UPDATE item_images SET is_primary = (id = ?) WHERE item_id = ?", imageID, itemID)
+		return err
+	})
+}
+
+// DetachItemImage removes an image from the item (the file itself stays in storage).
+// When the primary image is detached the next image in order takes its place.
+func DetachItemImage(itemID string, imageID int64) (ItemImage, error) {
+	fmt.Println("---DETACHITEMIMAGE---", itemID, imageID)
+	var detached ItemImage
+	err := withItemImagesTx(itemID, "", func(tx *sql.Tx) error {
+		err := tx.QueryRow("SELECT "+itemImageColumns+" FROM item_images WHERE id = ? AND item_id = ?", imageID, itemID).Scan(
+			&detached.ID, &detached.ItemID, &detached.ImagePath, &detached.Role, &detached.SortOrder, &detached.IsPrimary, &detached.CreatedBy, &detached.CreatedAt)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("image not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM item_images WHERE id = ?", imageID); err != nil {
+			return err
+		}
+		if detached.IsPrimary {
+			_, err = tx.Exec("UPDATE item_images SET is_primary = TRUE WHERE item_id = ? ORDER BY sort_order, id LIMIT 1", itemID)
+		}
+		return err
+	})
+	if err != nil {
+		return ItemImage{}, err
+	}
+	return detached, nil
+}
+
+// SetPrimaryImageByPath keeps item_images in line when items.image_path is written directly
+// (create/update item). It marks a matching image primary, or attaches the path as the new primary.
+func SetPrimaryImageByPath(itemID string, imagePath string, createdBy string) error {
+	if imagePath == "" || imagePath == "/" {
+		return nil
+	}
+	return withItemImagesTx(itemID, createdBy, func(tx *sql.Tx) error {
+		var imageID int64
+		err := tx.QueryRow("SELECT id FROM item_images WHERE item_id = ? AND image_path = ? ORDER BY id LIMIT 1", itemID, imagePath).Scan(&imageID)
+		if err == sql.ErrNoRows {
+			result, err := tx.Exec(`INSERT INTO item_images (item_id, image_path, image_id, role, sort_order, is_primary, created_by, created_at)
+				SELECT ?, ?, ?, ?, IFNULL(MAX(sort_order) + 1, 0), FALSE, ?, ? FROM item_images WHERE item_id = ?`,
+				itemID, imagePath, FingerprintImageID(imagePath), ImageRoleFront, createdBy, time.Now(), itemID)
+			if err != nil {
+				return err
+			}
+			if imageID, err = result.LastInsertId(); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE item_images SET is_primary = (id = ?) WHERE item_id = ?", imageID, itemID)
+		return err
+	})
+}
@@ -0,0 +1,453 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidPatch is returned for a patch document that is not a JSON object
+var ErrInvalidPatch = errors.New("a merge patch must be a JSON object")
+
+// PatchValidationError lists the fields of a merge patch that cannot be applied, with the
+// reason for each
+type PatchValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *PatchValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	problems := make([]string, 0, len(names))
+	for _, name := range names {
+		problems = append(problems, name+": "+e.Fields[name])
+	}
+	return "invalid patch: " + strings.Join(problems, "; ")
+}
+
+// patchKind is how a patched field is validated and stored
+type patchKind int
+
+const (
+	patchText patchKind = iota
+	patchMoney
+	patchFlag    // 0 or 1
+	patchPercent // whole number 0-100
+	patchDate
+)
+
+// patchField describes one field a merge patch may change
+type patchField struct {
+	column   string
+	kind     patchKind
+	required bool // cannot be cleared with null
+	maxLen   int  // in characters; TEXT columns hold 65535 bytes, so 16383 four-byte characters
+}
+
+// itemPatchFields are the item fields a merge patch may change, keyed by their JSON name
+var itemPatchFields = map[string]patchField{
+	"name":              {column: "name", kind: patchText, required: true, maxLen: 255},
+	"name_jpn":          {column: "name_jpn", kind: patchText, maxLen: 255},
+	"name_chn":          {column: "name_chn", kind: patchText, maxLen: 255},
+	"name_kor":          {column: "name_kor", kind: patchText, maxLen: 255},
+	"name_eng":          {column: "name_eng", kind: patchText, maxLen: 255},
+	"type":              {column: "type", kind: patchText, maxLen: 64},
+	"barcode":           {column: "barcode", kind: patchText, maxLen: 50},
+	"box_barcode":       {column: "box_barcode", kind: patchText, maxLen: 50},
+	"price":             {column: "price", kind: patchMoney},
+	"box_price":         {column: "box_price", kind: patchMoney},
+	"availableForOrder": {column: "available_for_order", kind: patchFlag},
+	"image_path":        {column: "image_path", kind: patchText, maxLen: 1024},
+	"ingredients":       {column: "ingredients", kind: patchText, maxLen: 16383},
+}
+
+// stockPatchFields are the details of a lot a merge patch may change. Quantities only change
+// through stock in/out so every change has a transaction.
+var stockPatchFields = map[string]patchField{
+	"expiry_date":   {column: "expiry_date", kind: patchDate, required: true},
+	"location":      {column: "location", kind: patchText, maxLen: 255},
+	"discount_rate": {column: "discount_rate", kind: patchPercent},
+	"notes":         {column: "notes", kind: patchText, maxLen: 16383},
+}
+
+// ItemPatch is a parsed JSON merge patch (RFC 7396) of an item: fields absent from the patch
+// stay unchanged and fields set to null are cleared
+type ItemPatch struct {
+	columns    map[string]interface{} // column -> value to store
+	fields     map[string]interface{} // JSON field -> value
+	HasTags    bool
+	TagIDs     []string // the complete new tag list when HasTags
+	RowVersion int      // the version the client read, 0 when not sent
+}
+
+// StockPatch is a parsed JSON merge patch of a stock lot
+type StockPatch struct {
+	columns    map[string]interface{}
+	RowVersion int
+}
+
+// Empty reports whether the patch changes nothing
+func (p ItemPatch) Empty() bool {
+	return len(p.columns) == 0 && !p.HasTags
+}
+
+// Empty reports whether the patch changes nothing
+func (p StockPatch) Empty() bool {
+	return len(p.columns) == 0
+}
+
+// decodeMergePatch splits a merge patch document into its members. A patch must be a JSON
+// object; anything else would replace the whole resource.
+func decodeMergePatch(doc []byte) (map[string]json.RawMessage, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &members); err != nil || members == nil {
+		return nil, ErrInvalidPatch
+	}
+	return members, nil
+}
+
+// takeRowVersion removes the optional row_version member, which is a precondition rather than
+// a change
+func takeRowVersion(members map[string]json.RawMessage, problems map[string]string) int {
+	raw, ok := members["row_version"]
+	if !ok {
+		return 0
+	}
+	delete(members, "row_version")
+	var version int
+	if err := json.Unmarshal(raw, &version); err != nil || version < 0 {
+		problems["row_version"] = "must be a version number"
+	}
+	return version
+}
+
+// patchColumns validates the remaining members against fields and returns the column values to
+// store; null clears a field to its empty value
+func patchColumns(members map[string]json.RawMessage, fields map[string]patchField, problems map[string]string) (map[string]interface{}, map[string]interface{}) {
+	columns := map[string]interface{}{}
+	values := map[string]interface{}{}
+	for name, raw := range members {
+		field, ok := fields[name]
+		if !ok {
+			problems[name] = "cannot be changed with a patch"
+			continue
+		}
+		value, problem := patchValue(field, raw)
+		if problem != "" {
+			problems[name] = problem
+			continue
+		}
+		columns[field.column] = value
+		values[name] = value
+	}
+	return columns, values
+}
+
+// patchValue validates one member and converts it to the value stored in its column
+func patchValue(field patchField, raw json.RawMessage) (interface{}, string) {
+	if string(raw) == "null" {
+		if field.required {
+			return nil, "cannot be cleared"
+		}
+		switch field.kind {
+		case patchText:
+			return "", ""
+		default:
+			return 0, ""
+		}
+	}
+
+	switch field.kind {
+	case patchText:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, "must be a string"
+		}
+		value = strings.TrimSpace(value)
+		if field.required && value == "" {
+			return nil, "cannot be empty"
+		}
+		if field.maxLen > 0 && utf8.RuneCountInString(value) > field.maxLen {
+			return nil, fmt.Sprintf("must be at most %d characters", field.maxLen)
+		}
+		return value, ""
+	case patchMoney:
+		var value float64
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, "must be a number"
+		}
+		if value < 0 {
+			return nil, "must not be negative"
+		}
+		return value, ""
+	case patchFlag:
+		var value int
+		if err := json.Unmarshal(raw, &value); err != nil || (value != 0 && value != 1) {
+			return nil, "must be 0 or 1"
+		}
+		return value, ""
+	case patchPercent:
+		var value int
+		if err := json.Unmarshal(raw, &value); err != nil || value < 0 || value > 100 {
+			return nil, "must be a whole number from 0 to 100"
+		}
+		return value, ""
+	case patchDate:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, "must be a date"
+		}
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t, ""
+		}
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			return t, ""
+		}
+		return nil, "must be a date (YYYY-MM-DD or RFC 3339)"
+	}
+	return nil, "unsupported field"
+}
+
+// ParseItemPatch parses and validates a merge patch of an item. The tags member replaces the
+// whole tag list, as merge patch does for arrays; it takes tag IDs or tag objects.
+func ParseItemPatch(doc []byte) (ItemPatch, error) {
+	members, err := decodeMergePatch(doc)
+	if err != nil {
+		return ItemPatch{}, err
+	}
+	problems := map[string]string{}
+	patch := ItemPatch{RowVersion: takeRowVersion(members, problems)}
+
+	if raw, ok := members["tags"]; ok {
+		delete(members, "tags")
+		patch.HasTags = true
+		if patch.TagIDs, err = parsePatchTags(raw); err != nil {
+			problems["tags"] = err.Error()
+		}
+	}
+	patch.columns, patch.fields = patchColumns(members, itemPatchFields, problems)
+
+	if len(patch.TagIDs) > 0 && problems["tags"] == "" {
+		if unknown, err := unknownTagIDs(patch.TagIDs); err != nil {
+			return ItemPatch{}, err
+		} else if len(unknown) > 0 {
+			problems["tags"] = "unknown tag IDs: " + strings.Join(unknown, ", ")
+		}
+	}
+	if len(problems) > 0 {
+		return ItemPatch{}, &PatchValidationError{Fields: problems}
+	}
+	return patch, nil
+}
+
+// parsePatchTags reads the tags member: null or an array of tag IDs or {"id": ...} objects
+func parsePatchTags(raw json.RawMessage) ([]string, error) {
+	if string(raw) == "null" {
+		return []string{}, nil
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, errors.New("must be an array of tag IDs")
+	}
+	seen := map[string]bool{}
+	tagIDs := []string{}
+	for _, entry := range entries {
+		var id string
+		if err := json.Unmarshal(entry, &id); err != nil {
+			var tag Tag
+			if err := json.Unmarshal(entry, &tag); err != nil {
+				return nil, errors.New("must be an array of tag IDs")
+			}
+			id = tag.ID
+		}
+		if id == "" {
+			return nil, errors.New("tag IDs cannot be empty")
+		}
+		if !seen[id] {
+			seen[id] = true
+			tagIDs = append(tagIDs, id)
+		}
+	}
+	return tagIDs, nil
+}
+
+// unknownTagIDs returns the IDs that name no tag
+func unknownTagIDs(tagIDs []string) ([]string, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+	args := make([]interface{}, len(tagIDs))
+	for i, id := range tagIDs {
+		args[i] = id
+	}
+	rows, err := db.Query("SELECT id FROM tags WHERE id IN (?"+strings.Repeat(", ?", len(tagIDs)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		known[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	unknown := []string{}
+	for _, id := range tagIDs {
+		if !known[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	return unknown, nil
+}
+
+// ParseStockPatch parses and validates a merge patch of a stock lot
+func ParseStockPatch(doc []byte) (StockPatch, error) {
+	members, err := decodeMergePatch(doc)
+	if err != nil {
+		return StockPatch{}, err
+	}
+	problems := map[string]string{}
+	patch := StockPatch{RowVersion: takeRowVersion(members, problems)}
+	patch.columns, _ = patchColumns(members, stockPatchFields, problems)
+	if len(problems) > 0 {
+		return StockPatch{}, &PatchValidationError{Fields: problems}
+	}
+	return patch, nil
+}
+
+// patchAssignments builds the SET list of a patch, in a stable column order, with the
+// row_version bump every write carries
+func patchAssignments(columns map[string]interface{}) (string, []interface{}) {
+	names := make([]string, 0, len(columns))
+	for column := range columns {
+		names = append(names, column)
+	}
+	sort.Strings(names)
+	sets := make([]string, 0, len(names)+1)
+	args := make([]interface{}, 0, len(names))
+	for _, column := range names {
+		sets = append(sets, column+" = ?")
+		args = append(args, columns[column])
+	}
+	sets = append(sets, "row_version = row_version + 1")
+	return strings.Join(sets, ", "), args
+}
+
+// PatchItem applies a merge patch to an item at rowVersion and returns the item with its tags.
+// The write only happens if the row is still at rowVersion, otherwise ErrVersionConflict is
+// returned. The columns and tags are written in one transaction.
+func PatchItem(itemID string, rowVersion int, patch ItemPatch) (Item, error) {
+	fmt.Println("---PATCHITEM---", itemID, rowVersion)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Item{}, fmt.Errorf("database connection error")
+	}
+
+	existing, err := GetItemById(itemID)
+	if err != nil {
+		return Item{}, fmt.Errorf("item not found: %v", err)
+	}
+	if !patch.Empty() {
+		tx, err := db.Begin()
+		if err != nil {
+			return Item{}, fmt.Errorf("failed to start transaction: %v", err)
+		}
+		defer func() {
+			if tx != nil {
+				tx.Rollback()
+			}
+		}()
+
+		if err := updateItemTx(tx, itemID, rowVersion, patch); err != nil {
+			return Item{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return Item{}, fmt.Errorf("failed to commit transaction: %v", err)
+		}
+		tx = nil
+	}
+	return afterItemUpdate(itemID, existing.ImagePath, patch)
+}
+
+// updateItemTx writes a patch's columns and tags in tx, only while the item is still at
+// rowVersion; otherwise it returns ErrVersionConflict. Merge patches and reviewed AI
+// suggestions both update items through it, followed by afterItemUpdate once committed.
+func updateItemTx(tx *sql.Tx, itemID string, rowVersion int, patch ItemPatch) error {
+	// Tag-only patches still bump the version, so the item's ETag covers its tags
+	sets, args := patchAssignments(patch.columns)
+	args = append(args, itemID, rowVersion)
+	result, err := tx.Exec("UPDATE items SET "+sets+" WHERE item_id = ? AND row_version = ?", args...)
+	if err != nil {
+		return fmt.Errorf("failed to update item: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrVersionConflict
+	}
+	if patch.HasTags {
+		if err := updateTagsForItemTx(tx, itemID, patch.TagIDs); err != nil {
+			return fmt.Errorf("failed to update tags: %v", err)
+		}
+	}
+	return nil
+}
+
+// afterItemUpdate keeps the item_images list pointing at the same primary image, as UpdateItem
+// does, and returns the updated item with its tags
+func afterItemUpdate(itemID string, previousImagePath string, patch ItemPatch) (Item, error) {
+	if imagePath, ok := patch.fields["image_path"].(string); ok && imagePath != previousImagePath {
+		if err := SetPrimaryImageByPath(itemID, imagePath, ""); err != nil {
+			fmt.Println("---Failed to sync item images---", err)
+		}
+	}
+
+	item, err := GetItemById(itemID)
+	if err != nil {
+		return Item{}, err
+	}
+	if item.Tag, err = GetTagsForItem(itemID); err != nil {
+		item.Tag = []Tag{}
+	}
+	return item, nil
+}
+
+// PatchStock applies a merge patch to a lot of storeID at rowVersion and returns the lot
+func PatchStock(stockID string, storeID string, rowVersion int, patch StockPatch) (Stock, error) {
+	fmt.Println("---PATCHSTOCK---", stockID, storeID, rowVersion)
+	if storeID == "" {
+		return Stock{}, ErrNoStore
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Stock{}, fmt.Errorf("database connection error")
+	}
+	if _, err := getStock(db, stockID, storeID, false); err != nil {
+		return Stock{}, err
+	}
+	if !patch.Empty() {
+		sets, args := patchAssignments(patch.columns)
+		args = append(args, stockID, storeID, rowVersion)
+		result, err := db.Exec("UPDATE stocks SET "+sets+" WHERE stock_id = ? AND store_id = ? AND row_version = ?", args...)
+		if err != nil {
+			return Stock{}, fmt.Errorf("failed to patch stock: %v", err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return Stock{}, ErrVersionConflict
+		}
+	}
+	return getStock(db, stockID, storeID, false)
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func patchProblems(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var validation *PatchValidationError
+	if !errors.As(err, &validation) {
+		t.Fatalf("err = %v, want a *PatchValidationError", err)
+	}
+	return validation.Fields
+}
+
+func TestParseItemPatchRejectsNonObjects(t *testing.T) {
+	for _, doc := range []string{``, `not json`, `[]`, `[{"name": "x"}]`, `null`, `"name"`, `42`} {
+		if _, err := ParseItemPatch([]byte(doc)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("ParseItemPatch(%q) err = %v, want ErrInvalidPatch", doc, err)
+		}
+		if _, err := ParseStockPatch([]byte(doc)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("ParseStockPatch(%q) err = %v, want ErrInvalidPatch", doc, err)
+		}
+	}
+}
+
+func TestParseItemPatchFields(t *testing.T) {
+	patch, err := ParseItemPatch([]byte(`{"name": "  Milk  ", "name_eng": null, "price": 1200, "availableForOrder": 0, "row_version": 3}`))
+	if err != nil {
+		t.Fatalf("ParseItemPatch: %v", err)
+	}
+	if patch.RowVersion != 3 {
+		t.Errorf("RowVersion = %d, want 3", patch.RowVersion)
+	}
+	want := map[string]interface{}{"name": "Milk", "name_eng": "", "price": float64(1200), "available_for_order": 0}
+	if len(patch.columns) != len(want) {
+		t.Errorf("columns = %v, want %v", patch.columns, want)
+	}
+	for column, value := range want {
+		if patch.columns[column] != value {
+			t.Errorf("column %s = %#v, want %#v", column, patch.columns[column], value)
+		}
+	}
+	if _, ok := patch.columns["row_version"]; ok {
+		t.Error("row_version was treated as a change")
+	}
+	if patch.HasTags || patch.Empty() {
+		t.Errorf("HasTags = %v, Empty = %v", patch.HasTags, patch.Empty())
+	}
+}
+
+func TestParseItemPatchEmpty(t *testing.T) {
+	patch, err := ParseItemPatch([]byte(`{"row_version": 2}`))
+	if err != nil {
+		t.Fatalf("ParseItemPatch: %v", err)
+	}
+	if !patch.Empty() {
+		t.Error("a patch with only row_version should be empty")
+	}
+}
+
+func TestParseItemPatchClearsTags(t *testing.T) {
+	patch, err := ParseItemPatch([]byte(`{"tags": null}`))
+	if err != nil {
+		t.Fatalf("ParseItemPatch: %v", err)
+	}
+	if !patch.HasTags || len(patch.TagIDs) != 0 || patch.Empty() {
+		t.Errorf("HasTags = %v, TagIDs = %v, Empty = %v; want the tag list cleared", patch.HasTags, patch.TagIDs, patch.Empty())
+	}
+
+	patch, err = ParseItemPatch([]byte(`{"tags": []}`))
+	if err != nil || !patch.HasTags || len(patch.TagIDs) != 0 {
+		t.Errorf("tags [] = %+v, %v; want the tag list cleared", patch, err)
+	}
+}
+
+func TestParseItemPatchValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		field string
+		want  string
+	}{
+		{"unknown field", `{"id": "other"}`, "id", "cannot be changed with a patch"},
+		{"read-only column", `{"created_at": "2024-01-01"}`, "created_at", "cannot be changed with a patch"},
+		{"clear required", `{"name": null}`, "name", "cannot be cleared"},
+		{"blank required", `{"name": "   "}`, "name", "cannot be empty"},
+		{"wrong type", `{"name": 5}`, "name", "must be a string"},
+		{"too long", `{"barcode": "` + strings.Repeat("1", 51) + `"}`, "barcode", "must be at most 50 characters"},
+		{"negative price", `{"price": -1}`, "price", "must not be negative"},
+		{"price as string", `{"price": "10"}`, "price", "must be a number"},
+		{"flag out of range", `{"availableForOrder": 2}`, "availableForOrder", "must be 0 or 1"},
+		{"bad row_version", `{"name": "Milk", "row_version": "3"}`, "row_version", "must be a version number"},
+		{"tags not an array", `{"tags": "a,b"}`, "tags", "must be an array of tag IDs"},
+		{"empty tag ID", `{"tags": [""]}`, "tags", "tag IDs cannot be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseItemPatch([]byte(tt.doc))
+			if got := patchProblems(t, err)[tt.field]; got != tt.want {
+				t.Errorf("%s: %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseItemPatchCountsCharacters(t *testing.T) {
+	// 255 three-byte characters fit a 255-character column even though they are 765 bytes
+	fits := strings.Repeat("가", 255)
+	if _, err := ParseItemPatch([]byte(`{"name_kor": "` + fits + `"}`)); err != nil {
+		t.Errorf("255 characters: %v", err)
+	}
+	_, err := ParseItemPatch([]byte(`{"name_kor": "` + fits + `가"}`))
+	if got := patchProblems(t, err)["name_kor"]; got != "must be at most 255 characters" {
+		t.Errorf("256 characters: %q", got)
+	}
+}
+
+func TestParseItemPatchReportsEveryField(t *testing.T) {
+	_, err := ParseItemPatch([]byte(`{"name": null, "price": -5, "owner": "x"}`))
+	problems := patchProblems(t, err)
+	if len(problems) != 3 {
+		t.Errorf("problems = %v, want one per bad field", problems)
+	}
+	if msg := err.Error(); msg != "invalid patch: name: cannot be cleared; owner: cannot be changed with a patch; price: must not be negative" {
+		t.Errorf("Error() = %q", msg)
+	}
+}
+
+func TestParseStockPatch(t *testing.T) {
+	patch, err := ParseStockPatch([]byte(`{"expiry_date": "2025-03-01", "discount_rate": 30, "location": null, "row_version": 7}`))
+	if err != nil {
+		t.Fatalf("ParseStockPatch: %v", err)
+	}
+	if patch.RowVersion != 7 {
+		t.Errorf("RowVersion = %d, want 7", patch.RowVersion)
+	}
+	if got := patch.columns["expiry_date"]; got != time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("expiry_date = %v", got)
+	}
+	if patch.columns["discount_rate"] != 30 || patch.columns["location"] != "" {
+		t.Errorf("columns = %v", patch.columns)
+	}
+
+	patch, err = ParseStockPatch([]byte(`{"expiry_date": "2025-03-01T09:00:00+09:00"}`))
+	if err != nil {
+		t.Fatalf("RFC 3339 expiry_date: %v", err)
+	}
+	if got, ok := patch.columns["expiry_date"].(time.Time); !ok || !got.Equal(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expiry_date = %v", patch.columns["expiry_date"])
+	}
+}
+
+func TestParseStockPatchValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		field string
+		want  string
+	}{
+		{"discount above 100", `{"discount_rate": 101}`, "discount_rate", "must be a whole number from 0 to 100"},
+		{"negative discount", `{"discount_rate": -1}`, "discount_rate", "must be a whole number from 0 to 100"},
+		{"fractional discount", `{"discount_rate": 12.5}`, "discount_rate", "must be a whole number from 0 to 100"},
+		{"clear expiry", `{"expiry_date": null}`, "expiry_date", "cannot be cleared"},
+		{"bad date", `{"expiry_date": "01/03/2025"}`, "expiry_date", "must be a date (YYYY-MM-DD or RFC 3339)"},
+		{"quantity", `{"quantity": 5}`, "quantity", "cannot be changed with a patch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseStockPatch([]byte(tt.doc))
+			if got := patchProblems(t, err)[tt.field]; got != tt.want {
+				t.Errorf("%s: %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
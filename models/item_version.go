@@ -0,0 +1,317 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Item version change types
+const (
+	ItemVersionInitial = "initial" // state before the first tracked edit
+	ItemVersionCreate  = "create"
+	ItemVersionUpdate  = "update"
+	ItemVersionTags    = "tags"
+	ItemVersionRestore = "restore"
+	ItemVersionReview  = "review" // approved AI suggestion
+	ItemVersionImages  = "images" // image attached, detached, reordered or made primary
+)
+
+// ErrItemVersionNotFound is returned for an unknown item or version number
+var ErrItemVersionNotFound = errors.New("item version not found")
+
+// ItemSnapshot is the editable state of an item kept in each version
+type ItemSnapshot struct {
+	Name              string   `json:"name"`
+	NameJpn           string   `json:"name_jpn"`
+	NameChn           string   `json:"name_chn"`
+	NameKor           string   `json:"name_kor"`
+	NameEng           string   `json:"name_eng"`
+	Type              string   `json:"type"`
+	BarCode           string   `json:"barcode"`
+	BoxBarcode        string   `json:"box_barcode"`
+	Price             float64  `json:"price"`
+	BoxPrice          float64  `json:"box_price"`
+	AvailableForOrder int      `json:"availableForOrder"`
+	ImagePath         string   `json:"image_path"`
+	Ingredients       string   `json:"ingredients"`
+	TagIDs            []string `json:"tag_ids"`
+	TagNames          []string `json:"tag_names"`
+	ImagePaths        []string `json:"image_paths,omitempty"` // attached images in display order
+}
+
+// ItemVersion is one numbered snapshot of an item
+type ItemVersion struct {
+	ID           int64        `json:"id"`
+	ItemID       string       `json:"item_id"`
+	Version      int          `json:"version"`
+	ChangeType   string       `json:"change_type"`
+	RestoredFrom int          `json:"restored_from,omitempty"`
+	Snapshot     ItemSnapshot `json:"snapshot"`
+	ChangedBy    string       `json:"changed_by"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+// snapshotItem reads the current state of an item with its tags
+func snapshotItem(itemID string) (ItemSnapshot, error) {
+	item, err := GetItemById(itemID)
+	if err != nil {
+		return ItemSnapshot{}, err
+	}
+	tags, err := GetTagsForItem(itemID)
+	if err != nil {
+		return ItemSnapshot{}, err
+	}
+	snapshot := ItemSnapshot{
+		Name:              item.Name,
+		NameJpn:           item.NameJpn,
+		NameChn:           item.NameChn,
+		NameKor:           item.NameKor,
+		NameEng:           item.NameEng,
+		Type:              item.Type,
+		BarCode:           item.BarCode,
+		BoxBarcode:        item.BoxBarcode,
+		Price:             item.Price,
+		BoxPrice:          item.BoxPrice,
+		AvailableForOrder: item.AvailableForOrder,
+		ImagePath:         item.ImagePath,
+		Ingredients:       item.Ingredients,
+		TagIDs:            []string{},
+		TagNames:          []string{},
+	}
+	for _, tag := range tags {
+		snapshot.TagIDs = append(snapshot.TagIDs, tag.ID)
+		snapshot.TagNames = append(snapshot.TagNames, tag.TagName)
+	}
+	images, err := GetItemImages(itemID)
+	if err != nil {
+		return ItemSnapshot{}, err
+	}
+	for _, image := range images {
+		snapshot.ImagePaths = append(snapshot.ImagePaths, image.ImagePath)
+	}
+	return snapshot, nil
+}
+
+// RecordItemVersion stores the item's current state as its next version
+func RecordItemVersion(itemID string, changeType string, changedBy string, restoredFrom int) (ItemVersion, error) {
+	fmt.Println("---RECORDITEMVERSION---", itemID, changeType, changedBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return ItemVersion{}, fmt.Errorf("database connection error")
+	}
+	snapshot, err := snapshotItem(itemID)
+	if err != nil {
+		return ItemVersion{}, fmt.Errorf("failed to read item: %v", err)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return ItemVersion{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ItemVersion{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	version := ItemVersion{
+		ItemID:       itemID,
+		ChangeType:   changeType,
+		RestoredFrom: restoredFrom,
+		Snapshot:     snapshot,
+		ChangedBy:    changedBy,
+		CreatedAt:    time.Now(),
+	}
+	// Locks the item's latest version so concurrent edits get consecutive numbers
+	if err := tx.QueryRow("SELECT IFNULL(MAX(version), 0) + 1 FROM item_versions WHERE item_id = ? FOR UPDATE", itemID).Scan(&version.Version); err != nil {
+		return ItemVersion{}, err
+	}
+	result, err := tx.Exec("INSERT INTO item_versions (item_id, version, change_type, restored_from, snapshot, changed_by, created_at) VALUES (?, ?, ?, NULLIF(?, 0), ?, ?, ?)",
+		itemID, version.Version, changeType, restoredFrom, string(data), changedBy, version.CreatedAt)
+	if err != nil {
+		return ItemVersion{}, fmt.Errorf("failed to record item version: %v", err)
+	}
+	if version.ID, err = result.LastInsertId(); err != nil {
+		return ItemVersion{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ItemVersion{}, fmt.Errorf("failed to commit: %v", err)
+	}
+	tx = nil
+	return version, nil
+}
+
+// EnsureItemVersioned records the item's current state as version 1 when it has no history
+// yet. Call it before the first tracked edit so the original state can be restored.
+func EnsureItemVersioned(itemID string, changedBy string) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM item_versions WHERE item_id = ?", itemID).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := RecordItemVersion(itemID, ItemVersionInitial, changedBy, 0)
+	return err
+}
+
+const itemVersionColumns = "id, item_id, version, change_type, IFNULL(restored_from, 0), snapshot, changed_by, created_at"
+
+func scanItemVersion(row rowScanner) (ItemVersion, error) {
+	var version ItemVersion
+	var data string
+	err := row.Scan(&version.ID, &version.ItemID, &version.Version, &version.ChangeType, &version.RestoredFrom,
+		&data, &version.ChangedBy, &version.CreatedAt)
+	if err != nil {
+		return ItemVersion{}, err
+	}
+	if err := json.Unmarshal([]byte(data), &version.Snapshot); err != nil {
+		return ItemVersion{}, fmt.Errorf("invalid snapshot in version %d: %v", version.ID, err)
+	}
+	return version, nil
+}
+
+// GetItemVersions lists an item's versions, newest first
+func GetItemVersions(itemID string) ([]ItemVersion, error) {
+	fmt.Println("---GETITEMVERSIONS---", itemID)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT "+itemVersionColumns+" FROM item_versions WHERE item_id = ? ORDER BY version DESC", itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []ItemVersion{}
+	for rows.Next() {
+		version, err := scanItemVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// GetItemVersion returns one version of an item
+func GetItemVersion(itemID string, version int) (ItemVersion, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return ItemVersion{}, fmt.Errorf("database connection error")
+	}
+
+	v, err := scanItemVersion(db.QueryRow("SELECT "+itemVersionColumns+" FROM item_versions WHERE item_id = ? AND version = ?", itemID, version))
+	if err == sql.ErrNoRows {
+		return ItemVersion{}, ErrItemVersionNotFound
+	}
+	return v, err
+}
+
+// DiffItemVersions compares two versions of an item field by field
+func DiffItemVersions(itemID string, from int, to int) (json.RawMessage, error) {
+	fromVersion, err := GetItemVersion(itemID, from)
+	if err != nil {
+		return nil, err
+	}
+	toVersion, err := GetItemVersion(itemID, to)
+	if err != nil {
+		return nil, err
+	}
+	fromData, err := json.Marshal(fromVersion.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	toData, err := json.Marshal(toVersion.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return DiffJSON(fromData, toData)
+}
+
+// RestoreItemVersion writes an old version back to the item as a new edit and records the
+// result as the next version. Every column is set to the snapshot's value, and the columns and
+// tags are written in one transaction that only applies while the item is still at rowVersion;
+// otherwise ErrVersionConflict is returned. The image list is not rebuilt; only the primary
+// image path is restored.
+func RestoreItemVersion(itemID string, version int, rowVersion int, restoredBy string) (Item, ItemVersion, error) {
+	fmt.Println("---RESTOREITEMVERSION---", itemID, version, restoredBy)
+	old, err := GetItemVersion(itemID, version)
+	if err != nil {
+		return Item{}, ItemVersion{}, err
+	}
+	snapshot := old.Snapshot
+	existing, err := GetItemById(itemID)
+	if err != nil {
+		return Item{}, ItemVersion{}, fmt.Errorf("item not found: %v", err)
+	}
+
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Item{}, ItemVersion{}, fmt.Errorf("database connection error")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return Item{}, ItemVersion{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(`UPDATE items
+		SET name = ?, type = ?, name_jpn = ?, name_chn = ?, name_kor = ?, name_eng = ?, barcode = ?, box_barcode = ?,
+			price = ?, box_price = ?, available_for_order = ?, image_path = ?, ingredients = ?, row_version = row_version + 1
+		WHERE item_id = ? AND row_version = ?`,
+		snapshot.Name, snapshot.Type, snapshot.NameJpn, snapshot.NameChn, snapshot.NameKor, snapshot.NameEng,
+		snapshot.BarCode, snapshot.BoxBarcode, snapshot.Price, snapshot.BoxPrice, snapshot.AvailableForOrder,
+		snapshot.ImagePath, snapshot.Ingredients, itemID, rowVersion)
+	if err != nil {
+		return Item{}, ItemVersion{}, fmt.Errorf("failed to restore item: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return Item{}, ItemVersion{}, ErrVersionConflict
+	}
+	if err := updateTagsForItemTx(tx, itemID, snapshot.TagIDs); err != nil {
+		return Item{}, ItemVersion{}, fmt.Errorf("failed to restore tags: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Item{}, ItemVersion{}, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	tx = nil
+
+	// Keep the item_images list pointing at the same primary image, as UpdateItem does
+	if snapshot.ImagePath != existing.ImagePath {
+		if err := SetPrimaryImageByPath(itemID, snapshot.ImagePath, ""); err != nil {
+			fmt.Println("---Failed to sync item images---", err)
+		}
+	}
+
+	restored, err := RecordItemVersion(itemID, ItemVersionRestore, restoredBy, version)
+	if err != nil {
+		return Item{}, ItemVersion{}, err
+	}
+	item, err := GetItemById(itemID)
+	if err != nil {
+		return Item{}, ItemVersion{}, err
+	}
+	if item.Tag, err = GetTagsForItem(itemID); err != nil {
+		item.Tag = []Tag{}
+	}
+	return item, restored, nil
+}
@@ -0,0 +1,330 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	LLMOutcomeSuccess       = "success"
+	LLMOutcomeError         = "error"
+	LLMOutcomeQuotaExceeded = "quota_exceeded"
+
+	LLMQuotaScopeUser   = "user"
+	LLMQuotaScopeBranch = "branch"
+
+	LLMQuotaPeriodDaily   = "daily"
+	LLMQuotaPeriodMonthly = "monthly"
+
+	// LLMQuotaDefaultSubject makes a quota apply to every user or branch without its own
+	LLMQuotaDefaultSubject = "*"
+)
+
+// LLMUsage is one recorded AI call
+type LLMUsage struct {
+	ID               int64     `json:"id"`
+	UserUID          string    `json:"user_uid"`
+	UserEmail        string    `json:"user_email"`
+	Branch           string    `json:"branch"`
+	Feature          string    `json:"feature"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+	Outcome          string    `json:"outcome"`
+	Error            string    `json:"error,omitempty"`
+	DurationMs       int64     `json:"duration_ms"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// LLMQuota caps token and/or cost spend for a user or branch over a day or month.
+// A zero limit means that dimension is not capped.
+type LLMQuota struct {
+	ID         int64     `json:"id"`
+	Scope      string    `json:"scope"`
+	Subject    string    `json:"subject"`
+	Period     string    `json:"period"`
+	MaxTokens  int       `json:"max_tokens"`
+	MaxCostUSD float64   `json:"max_cost_usd"`
+	UpdatedBy  string    `json:"updated_by"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// LLMUsageReportRow is one group of the usage report
+type LLMUsageReportRow struct {
+	Group            map[string]string `json:"group"`
+	Calls            int               `json:"calls"`
+	Errors           int               `json:"errors"`
+	Rejected         int               `json:"rejected"`
+	PromptTokens     int               `json:"prompt_tokens"`
+	CompletionTokens int               `json:"completion_tokens"`
+	TotalTokens      int               `json:"total_tokens"`
+	CostUSD          float64           `json:"cost_usd"`
+}
+
+// llmUsageGroupColumns lists the columns the usage report can be grouped by
+var llmUsageGroupColumns = map[string]string{
+	"user":    "user_email",
+	"branch":  "branch",
+	"model":   "model",
+	"feature": "feature",
+	"outcome": "outcome",
+	"day":     "DATE_FORMAT(created_at, '%Y-%m-%d')",
+	"month":   "DATE_FORMAT(created_at, '%Y-%m')",
+}
+
+// IsLLMUsageGroup reports whether the usage report can be grouped by the given key
+func IsLLMUsageGroup(group string) bool {
+	_, ok := llmUsageGroupColumns[group]
+	return ok
+}
+
+// RecordLLMUsage stores one AI call in the usage ledger
+func RecordLLMUsage(usage LLMUsage) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	if usage.CreatedAt.IsZero() {
+		usage.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO llm_usage
+	(user_uid, user_email, branch, feature, provider, model, prompt_tokens, completion_tokens, total_tokens, cost_usd, outcome, error, duration_ms, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.Exec(query, usage.UserUID, usage.UserEmail, usage.Branch, usage.Feature, usage.Provider, usage.Model,
+		usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, usage.CostUSD, usage.Outcome, usage.Error,
+		usage.DurationMs, usage.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record llm usage: %v", err)
+	}
+	return nil
+}
+
+// GetLLMUsageTotals sums the tokens and cost spent by a user or branch since the given time
+func GetLLMUsageTotals(scope string, subject string, since time.Time) (int, float64, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return 0, 0, fmt.Errorf("database connection error")
+	}
+
+	column := "user_email"
+	if scope == LLMQuotaScopeBranch {
+		column = "branch"
+	}
+	var tokens int
+	var cost float64
+	query := "SELECT IFNULL(SUM(total_tokens), 0), IFNULL(SUM(cost_usd), 0) FROM llm_usage WHERE " + column + " = ? AND created_at >= ?"
+	if err := db.QueryRow(query, subject, since).Scan(&tokens, &cost); err != nil {
+		return 0, 0, err
+	}
+	return tokens, cost, nil
+}
+
+// GetLLMUsageReport aggregates the ledger between from and to, grouped by the given keys.
+// userEmail and branch narrow the report when set.
+func GetLLMUsageReport(from time.Time, to time.Time, groupBy []string, userEmail string, branch string) ([]LLMUsageReportRow, error) {
+	fmt.Println("---GETLLMUSAGEREPORT---", from, to, groupBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	selects := []string{}
+	for _, group := range groupBy {
+		column, ok := llmUsageGroupColumns[group]
+		if !ok {
+			return nil, fmt.Errorf("cannot group usage by %s", group)
+		}
+		selects = append(selects, "IFNULL("+column+", '')")
+	}
+
+	conditions := []string{"created_at >= ?", "created_at < ?"}
+	args := []interface{}{from, to}
+	if userEmail != "" {
+		conditions = append(conditions, "user_email = ?")
+		args = append(args, userEmail)
+	}
+	if branch != "" {
+		conditions = append(conditions, "branch = ?")
+		args = append(args, branch)
+	}
+
+	query := "SELECT "
+	if len(selects) > 0 {
+		query += strings.Join(selects, ", ") + ", "
+	}
+	query += `COUNT(*),
+	SUM(outcome = 'error'),
+	SUM(outcome = 'quota_exceeded'),
+	IFNULL(SUM(prompt_tokens), 0),
+	IFNULL(SUM(completion_tokens), 0),
+	IFNULL(SUM(total_tokens), 0),
+	IFNULL(SUM(cost_usd), 0)
+	FROM llm_usage WHERE ` + strings.Join(conditions, " AND ")
+	if len(selects) > 0 {
+		positions := []string{}
+		for i := range selects {
+			positions = append(positions, fmt.Sprint(i+1))
+		}
+		query += " GROUP BY " + strings.Join(positions, ", ") + " ORDER BY " + strings.Join(positions, ", ")
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []LLMUsageReportRow{}
+	for rows.Next() {
+		keys := make([]string, len(groupBy))
+		var row LLMUsageReportRow
+		var errorsCount, rejected sql.NullInt64
+		dest := []interface{}{}
+		for i := range keys {
+			dest = append(dest, &keys[i])
+		}
+		dest = append(dest, &row.Calls, &errorsCount, &rejected, &row.PromptTokens, &row.CompletionTokens, &row.TotalTokens, &row.CostUSD)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row.Errors = int(errorsCount.Int64)
+		row.Rejected = int(rejected.Int64)
+		row.Group = map[string]string{}
+		for i, group := range groupBy {
+			row.Group[group] = keys[i]
+		}
+		if row.Calls > 0 {
+			report = append(report, row)
+		}
+	}
+	return report, rows.Err()
+}
+
+const llmQuotaColumns = "id, scope, subject, period, max_tokens, max_cost_usd, IFNULL(updated_by, ''), updated_at"
+
+func scanLLMQuotas(rows *sql.Rows) ([]LLMQuota, error) {
+	quotas := []LLMQuota{}
+	for rows.Next() {
+		var quota LLMQuota
+		if err := rows.Scan(&quota.ID, &quota.Scope, &quota.Subject, &quota.Period, &quota.MaxTokens, &quota.MaxCostUSD, &quota.UpdatedBy, &quota.UpdatedAt); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas, rows.Err()
+}
+
+// GetLLMQuotas lists all configured quotas
+func GetLLMQuotas() ([]LLMQuota, error) {
+	fmt.Println("---GETLLMQUOTAS---")
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT " + llmQuotaColumns + " FROM llm_quotas ORDER BY scope, subject, period")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanLLMQuotas(rows)
+}
+
+// GetApplicableLLMQuotas returns the quotas that govern a user and their branch.
+// A quota naming the user or branch replaces the "*" default for the same scope and period.
+func GetApplicableLLMQuotas(userEmail string, branch string) ([]LLMQuota, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	query := "SELECT " + llmQuotaColumns + ` FROM llm_quotas
+	WHERE (scope = 'user' AND subject IN (?, '*'))
+	OR (scope = 'branch' AND subject IN (?, '*'))`
+	rows, err := db.Query(query, userEmail, branch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	quotas, err := scanLLMQuotas(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	chosen := map[string]LLMQuota{}
+	order := []string{}
+	for _, quota := range quotas {
+		// Users without a branch are only governed by user quotas
+		if quota.Scope == LLMQuotaScopeBranch && branch == "" {
+			continue
+		}
+		key := quota.Scope + "/" + quota.Period
+		current, ok := chosen[key]
+		if !ok {
+			order = append(order, key)
+		}
+		if !ok || current.Subject == LLMQuotaDefaultSubject {
+			chosen[key] = quota
+		}
+	}
+
+	applicable := []LLMQuota{}
+	for _, key := range order {
+		applicable = append(applicable, chosen[key])
+	}
+	return applicable, nil
+}
+
+// SaveLLMQuota creates or replaces the quota for a scope, subject and period
+func SaveLLMQuota(quota LLMQuota) (LLMQuota, error) {
+	fmt.Println("---SAVELLMQUOTA---", quota.Scope, quota.Subject, quota.Period)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return LLMQuota{}, fmt.Errorf("database connection error")
+	}
+
+	quota.UpdatedAt = time.Now()
+	query := `INSERT INTO llm_quotas (scope, subject, period, max_tokens, max_cost_usd, updated_by, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE max_tokens = VALUES(max_tokens), max_cost_usd = VALUES(max_cost_usd),
+	updated_by = VALUES(updated_by), updated_at = VALUES(updated_at)`
+	_, err := db.Exec(query, quota.Scope, quota.Subject, quota.Period, quota.MaxTokens, quota.MaxCostUSD, quota.UpdatedBy, quota.UpdatedAt)
+	if err != nil {
+		return LLMQuota{}, fmt.Errorf("failed to save llm quota: %v", err)
+	}
+
+	err = db.QueryRow("SELECT id FROM llm_quotas WHERE scope = ? AND subject = ? AND period = ?",
+		quota.Scope, quota.Subject, quota.Period).Scan(&quota.ID)
+	if err != nil {
+		return LLMQuota{}, err
+	}
+	return quota, nil
+}
+
+// DeleteLLMQuota removes a quota by id
+func DeleteLLMQuota(id int64) error {
+	fmt.Println("---DELETELLMQUOTA---", id)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	result, err := db.Exec("DELETE FROM llm_quotas WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("quota not found")
+	}
+	return nil
+}
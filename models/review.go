@@ -0,0 +1,390 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SuggestionStatusApplied  = "applied"
+	SuggestionStatusRejected = "rejected"
+
+	FieldDecisionPending  = "pending"
+	FieldDecisionAccepted = "accepted"
+	FieldDecisionEdited   = "edited"
+	FieldDecisionRejected = "rejected"
+)
+
+// ReviewableItemFields are the item fields an AI suggestion may change, in display order
+var ReviewableItemFields = []string{
+	"name_eng", "name_kor", "name_jpn", "name_chn",
+	"ingredients",
+	"is_halal", "is_pork_contained", "is_beef_contained", "is_plant_based",
+}
+
+// dietaryFlagColumns maps the boolean item fields onto their columns
+var dietaryFlagColumns = map[string]string{
+	"is_halal":          "is_halal",
+	"is_pork_contained": "is_pork_contained",
+	"is_beef_contained": "is_beef_contained",
+	"is_plant_based":    "is_plant_based",
+}
+
+// IsDietaryFlagField reports whether the field is one of the boolean dietary flags
+func IsDietaryFlagField(field string) bool {
+	_, ok := dietaryFlagColumns[field]
+	return ok
+}
+
+// SuggestionFieldDecision is a reviewer's verdict on one field of a suggestion
+type SuggestionFieldDecision struct {
+	Field          string    `json:"field"`
+	Decision       string    `json:"decision"`
+	SuggestedValue string    `json:"suggested_value"`
+	AppliedValue   string    `json:"applied_value"`
+	ReviewedBy     string    `json:"reviewed_by"`
+	ReviewedAt     time.Time `json:"reviewed_at"`
+}
+
+// SuggestionFieldDiff is one row of the field-level diff shown to reviewers
+type SuggestionFieldDiff struct {
+	Field        string     `json:"field"`
+	Current      string     `json:"current"`
+	Suggested    string     `json:"suggested"`
+	Status       string     `json:"status"`
+	AppliedValue string     `json:"applied_value,omitempty"`
+	ReviewedBy   string     `json:"reviewed_by,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+}
+
+const aiSuggestionColumns = "id, item_id, job_id, source, IFNULL(model, ''), changes, IFNULL(reasoning, ''), status, IFNULL(created_by, ''), created_at"
+
+func scanAISuggestion(scanner interface{ Scan(...interface{}) error }) (AISuggestion, error) {
+	var suggestion AISuggestion
+	var jobID sql.NullInt64
+	var changes string
+	err := scanner.Scan(
+		&suggestion.ID,
+		&suggestion.ItemID,
+		&jobID,
+		&suggestion.Source,
+		&suggestion.Model,
+		&changes,
+		&suggestion.Reasoning,
+		&suggestion.Status,
+		&suggestion.CreatedBy,
+		&suggestion.CreatedAt,
+	)
+	if err != nil {
+		return AISuggestion{}, err
+	}
+	suggestion.JobID = jobID.Int64
+	if err := json.Unmarshal([]byte(changes), &suggestion.Changes); err != nil {
+		return AISuggestion{}, fmt.Errorf("failed to decode suggestion %d changes: %v", suggestion.ID, err)
+	}
+	return suggestion, nil
+}
+
+// GetAISuggestion retrieves a suggestion by id
+func GetAISuggestion(id int64) (AISuggestion, error) {
+	fmt.Println("---GETAISUGGESTION---", id)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return AISuggestion{}, fmt.Errorf("database connection error")
+	}
+
+	suggestion, err := scanAISuggestion(db.QueryRow("SELECT "+aiSuggestionColumns+" FROM ai_suggestions WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AISuggestion{}, fmt.Errorf("suggestion not found")
+		}
+		return AISuggestion{}, err
+	}
+	return suggestion, nil
+}
+
+// GetAISuggestions lists suggestions filtered by status and item, newest first. Only
+// suggestions for items in storeID's catalogue are listed.
+func GetAISuggestions(status string, itemID string, storeID string, limit int, offset int) ([]AISuggestion, int, error) {
+	fmt.Println("---GETAISUGGESTIONS---", status, itemID, storeID, limit, offset)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, 0, fmt.Errorf("database connection error")
+	}
+
+	conditions := []string{"item_id IN (SELECT i.item_id FROM items i WHERE " + catalogueFilter("i") + ")"}
+	args := []interface{}{storeID}
+	if status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, status)
+	}
+	if itemID != "" {
+		conditions = append(conditions, "item_id = ?")
+		args = append(args, itemID)
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM ai_suggestions"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := db.Query("SELECT "+aiSuggestionColumns+" FROM ai_suggestions"+where+" ORDER BY id DESC LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	suggestions := []AISuggestion{}
+	for rows.Next() {
+		suggestion, err := scanAISuggestion(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, total, rows.Err()
+}
+
+// GetSuggestionDecisions returns the decisions already made on a suggestion, keyed by field
+func GetSuggestionDecisions(suggestionID int64) (map[string]SuggestionFieldDecision, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT field, decision, IFNULL(suggested_value, ''), IFNULL(applied_value, ''), reviewed_by, reviewed_at FROM ai_suggestion_reviews WHERE suggestion_id = ?", suggestionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decisions := map[string]SuggestionFieldDecision{}
+	for rows.Next() {
+		var decision SuggestionFieldDecision
+		if err := rows.Scan(&decision.Field, &decision.Decision, &decision.SuggestedValue, &decision.AppliedValue, &decision.ReviewedBy, &decision.ReviewedAt); err != nil {
+			return nil, err
+		}
+		decisions[decision.Field] = decision
+	}
+	return decisions, rows.Err()
+}
+
+// GetItemReviewValues returns the current value of every reviewable field as a string.
+// Unknown dietary flags (NULL) come back as "" so reviewers can tell them apart from "false".
+func GetItemReviewValues(itemID string) (map[string]string, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	var nameEng, nameKor, nameJpn, nameChn, ingredients string
+	var halal, pork, beef, plant sql.NullBool
+	query := `SELECT IFNULL(name_eng, ''), IFNULL(name_kor, ''), IFNULL(name_jpn, ''), IFNULL(name_chn, ''), IFNULL(ingredients, ''),
+	is_halal, is_pork_contained, is_beef_contained, is_plant_based
+	FROM items WHERE item_id = ?`
+	err := db.QueryRow(query, itemID).Scan(&nameEng, &nameKor, &nameJpn, &nameChn, &ingredients, &halal, &pork, &beef, &plant)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("item not found")
+		}
+		return nil, err
+	}
+
+	flag := func(v sql.NullBool) string {
+		if !v.Valid {
+			return ""
+		}
+		return strconv.FormatBool(v.Bool)
+	}
+	return map[string]string{
+		"name_eng":          nameEng,
+		"name_kor":          nameKor,
+		"name_jpn":          nameJpn,
+		"name_chn":          nameChn,
+		"ingredients":       ingredients,
+		"is_halal":          flag(halal),
+		"is_pork_contained": flag(pork),
+		"is_beef_contained": flag(beef),
+		"is_plant_based":    flag(plant),
+	}, nil
+}
+
+// BuildSuggestionDiff lines up current values, suggested values and decisions field by field
+func BuildSuggestionDiff(suggestion AISuggestion, current map[string]string, decisions map[string]SuggestionFieldDecision) []SuggestionFieldDiff {
+	diff := []SuggestionFieldDiff{}
+	for _, field := range ReviewableItemFields {
+		suggested, ok := suggestion.Changes[field]
+		if !ok {
+			continue
+		}
+		row := SuggestionFieldDiff{
+			Field:     field,
+			Current:   current[field],
+			Suggested: suggested,
+			Status:    FieldDecisionPending,
+		}
+		if decision, ok := decisions[field]; ok {
+			reviewedAt := decision.ReviewedAt
+			row.Status = decision.Decision
+			row.AppliedValue = decision.AppliedValue
+			row.ReviewedBy = decision.ReviewedBy
+			row.ReviewedAt = &reviewedAt
+		}
+		diff = append(diff, row)
+	}
+	return diff
+}
+
+// ErrSuggestionReviewed is returned when a suggestion, or one of the fields being decided, was
+// reviewed by someone else in the meantime
+var ErrSuggestionReviewed = errors.New("suggestion has already been reviewed")
+
+// reviewTextColumns maps the text item fields a suggestion may change onto their columns
+var reviewTextColumns = map[string]string{
+	"name_eng":    "name_eng",
+	"name_kor":    "name_kor",
+	"name_jpn":    "name_jpn",
+	"name_chn":    "name_chn",
+	"ingredients": "ingredients",
+}
+
+// suggestionPatch turns the accepted and edited decisions into an item patch
+func suggestionPatch(decisions []SuggestionFieldDecision) (ItemPatch, error) {
+	patch := ItemPatch{columns: map[string]interface{}{}, fields: map[string]interface{}{}}
+	for _, d := range decisions {
+		if d.Decision == FieldDecisionRejected {
+			continue
+		}
+		if column, ok := reviewTextColumns[d.Field]; ok {
+			patch.columns[column] = d.AppliedValue
+			patch.fields[d.Field] = d.AppliedValue
+		} else if column, ok := dietaryFlagColumns[d.Field]; ok {
+			value, err := strconv.ParseBool(d.AppliedValue)
+			if err != nil {
+				return ItemPatch{}, fmt.Errorf("%s must be true or false", d.Field)
+			}
+			patch.columns[column] = value
+			patch.fields[d.Field] = value
+		} else {
+			return ItemPatch{}, fmt.Errorf("field %s cannot be applied", d.Field)
+		}
+	}
+	return patch, nil
+}
+
+// SaveSuggestionDecisions records reviewer decisions, applies the accepted and edited values to
+// the item at rowVersion and moves the suggestion to its new status, all in one transaction. The
+// item is updated through updateItemTx like a merge patch, so ErrVersionConflict is returned if
+// it changed since the reviewer read it. The suggestion is locked first, so two reviewers cannot
+// both apply it; ErrSuggestionReviewed is returned if it is no longer pending or one of the
+// fields was decided meanwhile. It returns the item after the review.
+func SaveSuggestionDecisions(suggestion AISuggestion, rowVersion int, decisions []SuggestionFieldDecision) (Item, error) {
+	fmt.Println("---SAVESUGGESTIONDECISIONS---", suggestion.ID, rowVersion, len(decisions))
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Item{}, fmt.Errorf("database connection error")
+	}
+	patch, err := suggestionPatch(decisions)
+	if err != nil {
+		return Item{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Item{}, err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var current string
+	if err := tx.QueryRow("SELECT status FROM ai_suggestions WHERE id = ? FOR UPDATE", suggestion.ID).Scan(&current); err != nil {
+		return Item{}, err
+	}
+	if current != SuggestionStatusPending {
+		return Item{}, fmt.Errorf("%w: it is %s", ErrSuggestionReviewed, current)
+	}
+
+	existing := map[string]string{}
+	rows, err := tx.Query("SELECT field, decision FROM ai_suggestion_reviews WHERE suggestion_id = ?", suggestion.ID)
+	if err != nil {
+		return Item{}, err
+	}
+	for rows.Next() {
+		var field, decision string
+		if err := rows.Scan(&field, &decision); err != nil {
+			rows.Close()
+			return Item{}, err
+		}
+		existing[field] = decision
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Item{}, err
+	}
+	for _, d := range decisions {
+		if _, done := existing[d.Field]; done {
+			return Item{}, fmt.Errorf("%w: %s was decided meanwhile", ErrSuggestionReviewed, d.Field)
+		}
+		existing[d.Field] = d.Decision
+	}
+
+	if !patch.Empty() {
+		if err := updateItemTx(tx, suggestion.ItemID, rowVersion, patch); err != nil {
+			return Item{}, err
+		}
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO ai_suggestion_reviews (suggestion_id, field, decision, suggested_value, applied_value, reviewed_by, reviewed_at) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return Item{}, err
+	}
+	defer stmt.Close()
+	for _, d := range decisions {
+		if _, err := stmt.Exec(suggestion.ID, d.Field, d.Decision, d.SuggestedValue, d.AppliedValue, d.ReviewedBy, d.ReviewedAt); err != nil {
+			return Item{}, fmt.Errorf("failed to save decision for %s: %v", d.Field, err)
+		}
+	}
+
+	status := suggestionStatusAfter(suggestion, existing)
+	if status != current {
+		if _, err := tx.Exec("UPDATE ai_suggestions SET status = ? WHERE id = ?", status, suggestion.ID); err != nil {
+			return Item{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Item{}, err
+	}
+	tx = nil
+	// Review fields never include image_path, so this only reloads the item
+	return afterItemUpdate(suggestion.ItemID, "", patch)
+}
+
+// suggestionStatusAfter decides whether the suggestion stays pending or is closed, given the
+// decision made on each field so far
+func suggestionStatusAfter(suggestion AISuggestion, decisions map[string]string) string {
+	anyApplied := false
+	for field := range suggestion.Changes {
+		decision, ok := decisions[field]
+		if !ok {
+			return SuggestionStatusPending
+		}
+		if decision != FieldDecisionRejected {
+			anyApplied = true
+		}
+	}
+	if anyApplied {
+		return SuggestionStatusApplied
+	}
+	return SuggestionStatusRejected
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Roles in increasing order of authority; each role can do everything the ones before it can
+const (
+	RoleStaff      = "staff"
+	RoleSupervisor = "supervisor"
+	RoleManager    = "manager"
+	RoleAdmin      = "admin"
+)
+
+// Roles lists the roles from least to most privileged
+var Roles = []string{RoleStaff, RoleSupervisor, RoleManager, RoleAdmin}
+
+// RoleLevel ranks a role; unknown roles rank below staff
+func RoleLevel(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsRole reports whether role is a known role
+func IsRole(role string) bool {
+	return RoleLevel(role) >= 0
+}
+
+// UserRoleAssignment is a user together with the role they act with
+type UserRoleAssignment struct {
+	Uid         string     `json:"uid"`
+	Email       string     `json:"email"`
+	DisplayName string     `json:"display_name"`
+	Designation string     `json:"designation"`
+	Branch      string     `json:"branch"`
+	Role        string     `json:"role"`
+	Assigned    bool       `json:"assigned"` // false when the role comes from a fallback
+	AssignedBy  string     `json:"assigned_by,omitempty"`
+	AssignedAt  *time.Time `json:"assigned_at,omitempty"`
+}
+
+// ResolveUserRole returns the role a user acts with. An explicit user_roles row wins; otherwise
+// bootstrap admins are listed by UID in RBAC_ADMIN_UIDS, or by email in RBAC_ADMIN_EMAILS when
+// the email is verified. Everyone else is staff.
+func ResolveUserRole(uid string, email string, emailVerified bool) (string, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return "", fmt.Errorf("database connection error")
+	}
+
+	var role sql.NullString
+	err := db.QueryRow("SELECT role FROM user_roles WHERE firebase_uid = ?", uid).Scan(&role)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return fallbackRole(role.String, uid, email, emailVerified), nil
+}
+
+// fallbackRole applies the bootstrap admin lists to users without an assigned role. The free-text
+// users.designation is never a role: clients could once set it themselves at sign-in.
+func fallbackRole(assigned string, uid string, email string, emailVerified bool) string {
+	if IsRole(assigned) {
+		return assigned
+	}
+	if uid != "" && listedInEnv("RBAC_ADMIN_UIDS", uid, false) {
+		return RoleAdmin
+	}
+	// Anyone can register an unverified account under an admin's address
+	if email != "" && emailVerified && listedInEnv("RBAC_ADMIN_EMAILS", email, true) {
+		return RoleAdmin
+	}
+	return RoleStaff
+}
+
+// listedInEnv reports whether value is in the comma-separated list of env var name
+func listedInEnv(name string, value string, ignoreCase bool) bool {
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == value || (ignoreCase && strings.EqualFold(entry, value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetUserRole assigns a role to an existing user
+func SetUserRole(uid string, role string, assignedBy string) error {
+	fmt.Println("---SETUSERROLE---", uid, role, assignedBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+	if !IsRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE firebase_uid = ?", uid).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	_, err := db.Exec(`INSERT INTO user_roles (firebase_uid, role, assigned_by, assigned_at) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE role = VALUES(role), assigned_by = VALUES(assigned_by), assigned_at = VALUES(assigned_at)`,
+		uid, role, assignedBy, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to assign role: %v", err)
+	}
+	return nil
+}
+
+// GetUserRoleAssignments lists every user with their effective role
+func GetUserRoleAssignments() ([]UserRoleAssignment, error) {
+	fmt.Println("---GETUSERROLEASSIGNMENTS---")
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query(`SELECT u.firebase_uid, IFNULL(u.email, ''), IFNULL(u.email_verified, FALSE), IFNULL(u.display_name, ''), IFNULL(u.designation, ''), IFNULL(u.branch, ''),
+		IFNULL(ur.role, ''), IFNULL(ur.assigned_by, ''), ur.assigned_at
+		FROM users u LEFT JOIN user_roles ur ON ur.firebase_uid = u.firebase_uid
+		ORDER BY u.email`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []UserRoleAssignment{}
+	for rows.Next() {
+		var a UserRoleAssignment
+		var assignedAt sql.NullTime
+		var emailVerified bool
+		if err := rows.Scan(&a.Uid, &a.Email, &emailVerified, &a.DisplayName, &a.Designation, &a.Branch, &a.Role, &a.AssignedBy, &assignedAt); err != nil {
+			return nil, err
+		}
+		a.Assigned = IsRole(a.Role)
+		a.Role = fallbackRole(a.Role, a.Uid, a.Email, emailVerified)
+		if assignedAt.Valid {
+			a.AssignedAt = &assignedAt.Time
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrStockNotFound is returned when a stock lot does not exist in the active store
+	ErrStockNotFound = errors.New("stock not found")
+	// ErrInsufficientStock is returned when more is deducted than a lot holds
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// Stock ledger (stock_transactions) entry types
+const (
+	StockTransactionIn                = "in"
+	StockTransactionOut               = "out"
+	StockTransactionTransferRequested = "transfer_requested"
+	StockTransactionTransferOut       = "transfer_out"
+	StockTransactionTransferIn        = "transfer_in"
+	StockTransactionTransferMissing   = "transfer_missing"
+	StockTransactionTransferCancelled = "transfer_cancelled"
+)
+
+const stockColumns = "stock_id, fkproduct_id, store_id, stock_type, box_number, pcs_number, bundle_number, expiry_date, IFNULL(location, ''), IFNULL(registering_person, ''), IFNULL(notes, ''), IFNULL(discount_rate, 0), IFNULL(origin_stock_id, ''), created_at, row_version"
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanStock(row rowScanner) (Stock, error) {
+	var stock Stock
+	err := row.Scan(&stock.StockId, &stock.ItemId, &stock.StoreID, &stock.StockType, &stock.BoxNumber, &stock.PCSNumber, &stock.BundleNumber,
+		&stock.ExpiryDate, &stock.Location, &stock.RegisteringPerson, &stock.Notes, &stock.DiscountRate, &stock.OriginStockID, &stock.CreatedAt, &stock.RowVersion)
+	return stock, err
+}
+
+// stockQuantityColumn is the column holding the quantity of a stock type
+func stockQuantityColumn(stockType StockType) (string, error) {
+	switch stockType {
+	case StockTypeBox:
+		return "box_number", nil
+	case StockTypeBundle:
+		return "bundle_number", nil
+	case StockTypePCS:
+		return "pcs_number", nil
+	}
+	return "", fmt.Errorf("invalid stock type %q", stockType)
+}
+
+// Quantity returns the lot's quantity of the given stock type
+func (s Stock) Quantity(stockType StockType) int {
+	switch stockType {
+	case StockTypeBox:
+		return s.BoxNumber
+	case StockTypeBundle:
+		return s.BundleNumber
+	case StockTypePCS:
+		return s.PCSNumber
+	}
+	return 0
+}
+
+// GetStock retrieves a stock lot of storeID; lots of other stores are reported as not found
+func GetStock(stockID string, storeID string) (Stock, error) {
+	if storeID == "" {
+		return Stock{}, ErrNoStore
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Stock{}, fmt.Errorf("database connection error")
+	}
+	return getStock(db, stockID, storeID, false)
+}
+
+func getStock(q queryRower, stockID string, storeID string, forUpdate bool) (Stock, error) {
+	query := "SELECT " + stockColumns + " FROM stocks WHERE stock_id = ? AND store_id = ?"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	stock, err := scanStock(q.QueryRow(query, stockID, storeID))
+	if err == sql.ErrNoRows {
+		return Stock{}, ErrStockNotFound
+	}
+	return stock, err
+}
+
+func insertStock(q queryRower, stock Stock) error {
+	if stock.StoreID == "" {
+		return ErrNoStore
+	}
+	_, err := q.Exec("INSERT INTO stocks (fkproduct_id, store_id, stock_type, box_number, pcs_number, bundle_number, expiry_date, location, registering_person, notes, discount_rate, origin_stock_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))",
+		stock.ItemId, stock.StoreID, stock.StockType, stock.BoxNumber, stock.PCSNumber, stock.BundleNumber, stock.ExpiryDate, stock.Location, stock.RegisteringPerson, stock.Notes, stock.DiscountRate, stock.OriginStockID)
+	return err
+}
+
+func insertStockTransaction(q queryRower, transaction StockTransaction) error {
+	if transaction.StoreID == "" {
+		return ErrNoStore
+	}
+	_, err := q.Exec("INSERT INTO stock_transactions (fkitem_id, store_id, quantity, transaction_type, fkuser_email, transfer_id) VALUES (?, ?, ?, ?, ?, NULLIF(?, 0))",
+		transaction.ItemID, transaction.StoreID, transaction.Quantity, transaction.TransactionType, transaction.UserEmail, transaction.TransferID)
+	return err
+}
+
+// ReceiveStock adds a stock lot to stock.StoreID and records the "in" transaction atomically
+func ReceiveStock(stock Stock, quantity int, userEmail string) error {
+	fmt.Println("---RECEIVESTOCK---", stock.ItemId, stock.StoreID, stock.StockType, quantity)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := insertStock(tx, stock); err != nil {
+		return fmt.Errorf("failed to add stock: %v", err)
+	}
+	err = insertStockTransaction(tx, StockTransaction{
+		ItemID:          stock.ItemId,
+		StoreID:         stock.StoreID,
+		Quantity:        quantity,
+		TransactionType: StockTransactionIn,
+		UserEmail:       userEmail,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record transaction: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stock in: %v", err)
+	}
+	tx = nil
+	return nil
+}
+
+// IssueStock deducts quantity of stockType from a lot of storeID and records the "out"
+// transaction atomically. The lot is removed once the deducted type reaches zero. The
+// lot is returned as it was before the deduction.
+func IssueStock(stockID string, storeID string, stockType StockType, quantity int, userEmail string) (Stock, error) {
+	fmt.Println("---ISSUESTOCK---", stockID, storeID, stockType, quantity)
+	if storeID == "" {
+		return Stock{}, ErrNoStore
+	}
+	if _, err := stockQuantityColumn(stockType); err != nil {
+		return Stock{}, err
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Stock{}, fmt.Errorf("database connection error")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Stock{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	stock, err := deductStock(tx, stockID, storeID, stockType, quantity)
+	if err != nil {
+		return stock, err
+	}
+
+	err = insertStockTransaction(tx, StockTransaction{
+		ItemID:          stock.ItemId,
+		StoreID:         storeID,
+		Quantity:        quantity,
+		TransactionType: StockTransactionOut,
+		UserEmail:       userEmail,
+	})
+	if err != nil {
+		return stock, fmt.Errorf("failed to record transaction: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return stock, fmt.Errorf("failed to commit stock out: %v", err)
+	}
+	tx = nil
+	return stock, nil
+}
+
+// deductStock takes quantity of stockType off a locked lot, removing the lot once that type
+// reaches zero. It returns the lot as it was before.
+func deductStock(tx *sql.Tx, stockID string, storeID string, stockType StockType, quantity int) (Stock, error) {
+	column, err := stockQuantityColumn(stockType)
+	if err != nil {
+		return Stock{}, err
+	}
+	stock, err := getStock(tx, stockID, storeID, true)
+	if err != nil {
+		return Stock{}, err
+	}
+	current := stock.Quantity(stockType)
+	if current < quantity {
+		return stock, fmt.Errorf("%w: current quantity %d, requested quantity %d", ErrInsufficientStock, current, quantity)
+	}
+
+	if current > quantity {
+		query := fmt.Sprintf("UPDATE stocks SET %s = %s - ?, row_version = row_version + 1 WHERE stock_id = ? AND store_id = ?", column, column)
+		_, err = tx.Exec(query, quantity, stockID, storeID)
+	} else {
+		_, err = tx.Exec("DELETE FROM stocks WHERE stock_id = ? AND store_id = ?", stockID, storeID)
+	}
+	if err != nil {
+		return stock, fmt.Errorf("failed to update stock: %v", err)
+	}
+	return stock, nil
+}
+
+// UpdateStockDetails saves the expiry date, location and markdown (discount rate) of a lot
+// of stock.StoreID and returns the updated lot. A non-zero stock.RowVersion makes the write
+// conditional, as in UpdateItem.
+func UpdateStockDetails(stock Stock) (Stock, error) {
+	fmt.Println("---UPDATESTOCKDETAILS---", stock.StockId, stock.StoreID)
+	if stock.StoreID == "" {
+		return Stock{}, ErrNoStore
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Stock{}, fmt.Errorf("database connection error")
+	}
+
+	if _, err := getStock(db, stock.StockId, stock.StoreID, false); err != nil {
+		return Stock{}, err
+	}
+	result, err := db.Exec(`UPDATE stocks SET expiry_date = ?, location = ?, discount_rate = ?, row_version = row_version + 1
+		WHERE stock_id = ? AND store_id = ? AND (? = 0 OR row_version = ?)`,
+		stock.ExpiryDate, stock.Location, stock.DiscountRate, stock.StockId, stock.StoreID, stock.RowVersion, stock.RowVersion)
+	if err != nil {
+		return Stock{}, fmt.Errorf("failed to update stock: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return Stock{}, ErrVersionConflict
+	}
+	return getStock(db, stock.StockId, stock.StoreID, false)
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultStoreID is the store existing single-store data was migrated into
+const DefaultStoreID = "default"
+
+// ErrNoStore is returned by store-scoped functions called without an active store
+var ErrNoStore = errors.New("no active store")
+
+// Store is one branch with its own stock, locations and markdowns. Items with an empty
+// StoreID are shared by every store; others belong to the catalogue of one store only.
+type Store struct {
+	ID        string    `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Branch    string    `json:"branch"` // users.branch value that maps to this store
+	Address   string    `json:"address"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateStore adds a store; the id defaults to the lower-cased code
+func CreateStore(store Store) (Store, error) {
+	fmt.Println("---CREATESTORE---", store.Code, store.Name)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Store{}, fmt.Errorf("database connection error")
+	}
+
+	if store.ID == "" {
+		store.ID = strings.ToLower(store.Code)
+	}
+	store.Active = true
+	store.CreatedAt = time.Now()
+	_, err := db.Exec("INSERT INTO stores (id, code, name, branch, address, active, created_at) VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?)",
+		store.ID, store.Code, store.Name, store.Branch, store.Address, store.Active, store.CreatedAt)
+	if err != nil {
+		return Store{}, fmt.Errorf("failed to create store: %v", err)
+	}
+	return store, nil
+}
+
+// UpdateStore saves the editable fields of a store
+func UpdateStore(store Store) (Store, error) {
+	fmt.Println("---UPDATESTORE---", store.ID)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Store{}, fmt.Errorf("database connection error")
+	}
+
+	_, err := db.Exec("UPDATE stores SET code = ?, name = ?, branch = NULLIF(?, ''), address = ?, active = ? WHERE id = ?",
+		store.Code, store.Name, store.Branch, store.Address, store.Active, store.ID)
+	if err != nil {
+		return Store{}, fmt.Errorf("failed to update store: %v", err)
+	}
+	return GetStore(store.ID)
+}
+
+// GetStore retrieves a store by id
+func GetStore(id string) (Store, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return Store{}, fmt.Errorf("database connection error")
+	}
+
+	var store Store
+	err := db.QueryRow("SELECT id, code, name, IFNULL(branch, ''), IFNULL(address, ''), active, created_at FROM stores WHERE id = ?", id).Scan(
+		&store.ID, &store.Code, &store.Name, &store.Branch, &store.Address, &store.Active, &store.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Store{}, fmt.Errorf("store not found")
+		}
+		return Store{}, err
+	}
+	return store, nil
+}
+
+// GetStores lists every store, active ones first
+func GetStores() ([]Store, error) {
+	fmt.Println("---GETSTORES---")
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT id, code, name, IFNULL(branch, ''), IFNULL(address, ''), active, created_at FROM stores ORDER BY active DESC, name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stores := []Store{}
+	for rows.Next() {
+		var store Store
+		if err := rows.Scan(&store.ID, &store.Code, &store.Name, &store.Branch, &store.Address, &store.Active, &store.CreatedAt); err != nil {
+			return nil, err
+		}
+		stores = append(stores, store)
+	}
+	return stores, rows.Err()
+}
+
+// ResolveUserStore returns the home store of a user: the default store the user picked if it is
+// active, then the active store whose branch, code or id matches users.branch. Users with no
+// branch fall back to DEFAULT_STORE_ID (or the migrated default store) if it exists, but a branch
+// that matches no active store is not redirected there. An empty id means the user has no store.
+func ResolveUserStore(uid string) (string, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return "", fmt.Errorf("database connection error")
+	}
+
+	var storeID string
+	err := db.QueryRow(`SELECT s.id FROM users u JOIN stores s ON s.id = u.default_store_id AND s.active = TRUE
+		WHERE u.firebase_uid = ?`, uid).Scan(&storeID)
+	if err == nil {
+		return storeID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	branch, err := GetUserBranch(uid)
+	if err != nil {
+		return "", err
+	}
+	if branch != "" {
+		err = db.QueryRow("SELECT id FROM stores WHERE active = TRUE AND (branch = ? OR code = ? OR id = ?) LIMIT 1",
+			branch, branch, branch).Scan(&storeID)
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return storeID, err
+	}
+
+	fallback := os.Getenv("DEFAULT_STORE_ID")
+	if fallback == "" {
+		fallback = DefaultStoreID
+	}
+	err = db.QueryRow("SELECT id FROM stores WHERE id = ? AND active = TRUE", fallback).Scan(&storeID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return storeID, err
+}
+
+// catalogueFilter limits the items aliased as alias to the shared catalogue plus the
+// store's own items; it takes the store id as its only argument
+func catalogueFilter(alias string) string {
+	if alias != "" {
+		alias += "."
+	}
+	return "(" + alias + "store_id IS NULL OR " + alias + "store_id = ?)"
+}
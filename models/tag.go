@@ -1,6 +1,7 @@
 package models
 
 import (
+	"database/sql"
 	"fmt"
 	"time"
 )
@@ -189,7 +190,8 @@ func GetTagsForItem(itemID string) ([]Tag, error) {
 	return tags, nil
 }
 
-// AssociateItemWithTags links an item with multiple tags
+// AssociateItemWithTags links an item with multiple tags and bumps the item's row_version,
+// so its ETag covers its tags
 func AssociateItemWithTags(itemID string, tagIDs []string) error {
 	fmt.Println("---ASSOCIATEITEMWITHTAGS---", itemID, tagIDs)
 	if len(tagIDs) == 0 {
@@ -218,10 +220,15 @@ func AssociateItemWithTags(itemID string, tagIDs []string) error {
 			return err
 		}
 	}
+	if _, err := tx.Exec("UPDATE items SET row_version = row_version + 1 WHERE item_id = ?", itemID); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	return tx.Commit()
 }
 
+// UpdateTagsForItem replaces the tags of an item with tagIDs
 func UpdateTagsForItem(itemID string, tagIDs []string) error {
 	fmt.Println("---UPDATEITEMTAGS---", itemID, tagIDs)
 	if itemID == "" {
@@ -232,28 +239,36 @@ func UpdateTagsForItem(itemID string, tagIDs []string) error {
 	if err != nil {
 		return err
 	}
-
-	query := ""
-	curRow, err := db.Query("Select tag_id from item_tags where item_id = ?", itemID)
-	if err != nil {
+	if err := updateTagsForItemTx(tx, itemID, tagIDs); err != nil {
 		tx.Rollback()
 		return err
 	}
-	defer curRow.Close()
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Error committing transaction: %v\n", err)
+		return err
+	}
+	return nil
+}
 
+// updateTagsForItemTx adds and removes item_tags rows inside tx so the item ends up with
+// exactly tagIDs
+func updateTagsForItemTx(tx *sql.Tx, itemID string, tagIDs []string) error {
+	curRow, err := tx.Query("SELECT tag_id FROM item_tags WHERE item_id = ?", itemID)
+	if err != nil {
+		return err
+	}
 	currentTags := make(map[string]bool)
 	for curRow.Next() {
 		var tagID string
-
 		if err := curRow.Scan(&tagID); err != nil {
-			tx.Rollback()
+			curRow.Close()
 			return err
 		}
 		currentTags[tagID] = true
-		if err := curRow.Err(); err != nil {
-			tx.Rollback()
-			return err
-		}
+	}
+	curRow.Close()
+	if err := curRow.Err(); err != nil {
+		return err
 	}
 
 	desiredTags := make(map[string]bool)
@@ -263,35 +278,22 @@ func UpdateTagsForItem(itemID string, tagIDs []string) error {
 
 	toAdd := []string{}
 	toRemove := []string{}
-
-	for key, _ := range desiredTags {
+	for key := range desiredTags {
 		if !currentTags[key] {
 			toAdd = append(toAdd, key)
 		}
 	}
-
-	for key, _ := range currentTags {
+	for key := range currentTags {
 		if !desiredTags[key] {
 			toRemove = append(toRemove, key)
 		}
 	}
 	fmt.Println("toAdd", toAdd)
 	fmt.Println("toRemove", toRemove)
-	fmt.Println("currentTags", currentTags)
-	fmt.Println("desiredTags", desiredTags)
-	fmt.Println("tagIDs", tagIDs)
-
-	if len(toAdd) == 0 && len(toRemove) == 0 {
-		if err := tx.Commit(); err != nil {
-			return err
-		}
-		return nil
-	}
 
-	args := make([]interface{}, 0, len(toRemove)+1)
 	if len(toRemove) > 0 {
-
 		placeholders := ""
+		args := make([]interface{}, 0, len(toRemove)+1)
 		args = append(args, itemID)
 		for i := range toRemove {
 			if i > 0 {
@@ -301,18 +303,15 @@ func UpdateTagsForItem(itemID string, tagIDs []string) error {
 			args = append(args, toRemove[i])
 		}
 
-		query = "DELETE FROM item_tags WHERE item_id = ? AND tag_id IN (" + placeholders + ")"
-
+		query := "DELETE FROM item_tags WHERE item_id = ? AND tag_id IN (" + placeholders + ")"
 		if _, err := tx.Exec(query, args...); err != nil {
 			fmt.Printf("Error deleting tags: %v\n", err)
-			tx.Rollback()
 			return err
 		}
 	}
 	if len(toAdd) > 0 {
 		stmt, err := tx.Prepare("INSERT INTO item_tags (item_id, tag_id) VALUES (?, ?)")
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 		defer stmt.Close()
@@ -320,19 +319,9 @@ func UpdateTagsForItem(itemID string, tagIDs []string) error {
 		for _, tagId := range toAdd {
 			if _, err := stmt.Exec(itemID, tagId); err != nil {
 				fmt.Printf("Error adding tags: %v\n", err)
-				tx.Rollback()
 				return err
 			}
 		}
-		if err := stmt.Close(); err != nil {
-			fmt.Printf("Error closing statement: %v\n", err)
-			tx.Rollback()
-			return err
-		}
-	}
-	if err := tx.Commit(); err != nil {
-		fmt.Printf("Error committing transaction: %v\n", err)
-		return err
 	}
 	return nil
 }
@@ -445,11 +434,14 @@ func SearchTagsByName(name string) ([]Tag, error) {
 }
 
 // GetRecommendedItems retrieves items recommended based on the given tags with pagination
-func GetRecommendedItems(tagIDs []string, limit int, page int) ([]Item, int, error) {
-	fmt.Println("---GETRECOMMENDEDITEMS---", tagIDs, limit, page)
+func GetRecommendedItems(tagIDs []string, limit int, page int, storeID string) ([]Item, int, error) {
+	fmt.Println("---GETRECOMMENDEDITEMS---", tagIDs, limit, page, storeID)
 	if len(tagIDs) == 0 {
 		return nil, 0, fmt.Errorf("no tags provided")
 	}
+	if storeID == "" {
+		return nil, 0, ErrNoStore
+	}
 
 	if limit <= 0 {
 		limit = 10 // Default limit
@@ -467,8 +459,8 @@ func GetRecommendedItems(tagIDs []string, limit int, page int) ([]Item, int, err
 
 	// Create placeholders for SQL query
 	placeholders := ""
-	countArgs := make([]interface{}, len(tagIDs))
-	args := make([]interface{}, len(tagIDs)+2) // +2 for limit and offset
+	countArgs := make([]interface{}, len(tagIDs)+1) // +1 for the store
+	args := make([]interface{}, len(tagIDs)+3)      // +3 for the store, limit and offset
 
 	for i, tagID := range tagIDs {
 		if i > 0 {
@@ -478,15 +470,17 @@ func GetRecommendedItems(tagIDs []string, limit int, page int) ([]Item, int, err
 		countArgs[i] = tagID
 		args[i] = tagID
 	}
-	args[len(tagIDs)] = limit
-	args[len(tagIDs)+1] = offset
+	countArgs[len(tagIDs)] = storeID
+	args[len(tagIDs)] = storeID
+	args[len(tagIDs)+1] = limit
+	args[len(tagIDs)+2] = offset
 
 	// First, get the total count for pagination info
 	countQuery := `
 	SELECT COUNT(DISTINCT i.item_id)
 	FROM items i
 	JOIN item_tags it ON i.item_id = it.item_id
-	WHERE it.tag_id IN (` + placeholders + `)`
+	WHERE it.tag_id IN (` + placeholders + `) AND ` + catalogueFilter("i")
 
 	var totalCount int
 	err := db.QueryRow(countQuery, countArgs...).Scan(&totalCount)
@@ -503,7 +497,7 @@ func GetRecommendedItems(tagIDs []string, limit int, page int) ([]Item, int, err
 	COUNT(it.tag_id) as tag_match_count
 	FROM items i
 	JOIN item_tags it ON i.item_id = it.item_id
-	WHERE it.tag_id IN (` + placeholders + `)
+	WHERE it.tag_id IN (` + placeholders + `) AND ` + catalogueFilter("i") + `
 	GROUP BY i.item_id
 	ORDER BY tag_match_count DESC, i.created_at DESC
 	LIMIT ? OFFSET ?`
@@ -598,7 +592,7 @@ func GetRecommendedItems(tagIDs []string, limit int, page int) ([]Item, int, err
 
 	// Fetch stock information for each item
 	for i := range items {
-		stocks, err := GetStocksByItemId(items[i].ID)
+		stocks, err := GetStocksByItemId(items[i].ID, storeID)
 		if err != nil {
 			// Continue with empty stock if there's an error
 			items[i].Stock = []Stock{}
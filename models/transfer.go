@@ -0,0 +1,516 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Transfer orders move requested -> dispatched (in transit, already taken off the source
+// store) -> received. Receipts may come in several goes, leaving the order partially_received
+// until every line is either received or reported missing. Only requested orders can be cancelled.
+const (
+	TransferRequested         = "requested"
+	TransferDispatched        = "dispatched"
+	TransferPartiallyReceived = "partially_received"
+	TransferReceived          = "received"
+	TransferCancelled         = "cancelled"
+)
+
+// ErrTransferNotFound is returned for orders that do not exist or do not involve the store
+var ErrTransferNotFound = errors.New("transfer not found")
+
+// ErrTransferInvalid wraps errors caused by the request rather than the database
+var ErrTransferInvalid = errors.New("invalid transfer")
+
+// ErrTransferState is returned when a transition is not allowed from the order's status
+var ErrTransferState = errors.New("transfer is not in a state that allows this")
+
+// TransferOrder moves stock lots from one store to another
+type TransferOrder struct {
+	ID           int64          `json:"id"`
+	FromStoreID  string         `json:"from_store_id"`
+	ToStoreID    string         `json:"to_store_id"`
+	Status       string         `json:"status"`
+	Notes        string         `json:"notes"`
+	RequestedBy  string         `json:"requested_by"`
+	RequestedAt  time.Time      `json:"requested_at"`
+	DispatchedBy string         `json:"dispatched_by,omitempty"`
+	DispatchedAt *time.Time     `json:"dispatched_at,omitempty"`
+	ReceivedBy   string         `json:"received_by,omitempty"`
+	ReceivedAt   *time.Time     `json:"received_at,omitempty"`
+	CancelledBy  string         `json:"cancelled_by,omitempty"`
+	CancelledAt  *time.Time     `json:"cancelled_at,omitempty"`
+	Lines        []TransferLine `json:"lines"`
+}
+
+// TransferLine is a quantity of one source lot. The lot's expiry, location, notes and markdown
+// are copied on request and again on dispatch so the destination receives the same lot.
+type TransferLine struct {
+	ID               int64     `json:"id"`
+	TransferID       int64     `json:"transfer_id"`
+	StockID          string    `json:"stock_id"` // lot in the source store
+	ItemID           string    `json:"item_id"`
+	StockType        StockType `json:"stock_type"`
+	Quantity         int       `json:"quantity"`
+	ExpiryDate       time.Time `json:"expiry_date"`
+	Location         string    `json:"location"`
+	LotNotes         string    `json:"lot_notes"`
+	DiscountRate     int       `json:"discount_rate"`
+	ReceivedQuantity int       `json:"received_quantity"`
+	MissingQuantity  int       `json:"missing_quantity"`
+	Discrepancy      string    `json:"discrepancy,omitempty"`
+}
+
+// Outstanding is the quantity neither received nor reported missing yet
+func (l TransferLine) Outstanding() int {
+	return l.Quantity - l.ReceivedQuantity - l.MissingQuantity
+}
+
+// TransferReceipt records what arrived for one line; Missing is reported as a discrepancy
+type TransferReceipt struct {
+	LineID   int64  `json:"line_id"`
+	Received int    `json:"received_quantity"`
+	Missing  int    `json:"missing_quantity"`
+	Reason   string `json:"reason"`
+}
+
+// CreateTransfer requests moving lots of fromStoreID to another store. Lines only need
+// StockID, StockType and Quantity; the lots must hold enough stock now, but nothing is
+// taken off until the order is dispatched.
+func CreateTransfer(fromStoreID string, toStoreID string, notes string, lines []TransferLine, userEmail string) (TransferOrder, error) {
+	fmt.Println("---CREATETRANSFER---", fromStoreID, toStoreID, len(lines), userEmail)
+	if fromStoreID == "" {
+		return TransferOrder{}, ErrNoStore
+	}
+	if toStoreID == fromStoreID {
+		return TransferOrder{}, fmt.Errorf("%w: destination must be another store", ErrTransferInvalid)
+	}
+	if len(lines) == 0 {
+		return TransferOrder{}, fmt.Errorf("%w: at least one line is required", ErrTransferInvalid)
+	}
+	if store, err := GetStore(toStoreID); err != nil || !store.Active {
+		return TransferOrder{}, fmt.Errorf("%w: unknown or inactive destination store %s", ErrTransferInvalid, toStoreID)
+	}
+
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return TransferOrder{}, fmt.Errorf("database connection error")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return TransferOrder{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	order := TransferOrder{
+		FromStoreID: fromStoreID,
+		ToStoreID:   toStoreID,
+		Status:      TransferRequested,
+		Notes:       notes,
+		RequestedBy: userEmail,
+		RequestedAt: time.Now(),
+	}
+	result, err := tx.Exec("INSERT INTO transfer_orders (from_store_id, to_store_id, status, notes, requested_by, requested_at) VALUES (?, ?, ?, ?, ?, ?)",
+		order.FromStoreID, order.ToStoreID, order.Status, order.Notes, order.RequestedBy, order.RequestedAt)
+	if err != nil {
+		return TransferOrder{}, fmt.Errorf("failed to create transfer: %v", err)
+	}
+	if order.ID, err = result.LastInsertId(); err != nil {
+		return TransferOrder{}, err
+	}
+
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			return TransferOrder{}, fmt.Errorf("%w: quantity of stock %s must be greater than 0", ErrTransferInvalid, line.StockID)
+		}
+		if _, err := stockQuantityColumn(line.StockType); err != nil {
+			return TransferOrder{}, fmt.Errorf("%w: %v", ErrTransferInvalid, err)
+		}
+		lot, err := getStock(tx, line.StockID, fromStoreID, false)
+		if err != nil {
+			return TransferOrder{}, fmt.Errorf("stock %s: %w", line.StockID, err)
+		}
+		if available := lot.Quantity(line.StockType); available < line.Quantity {
+			return TransferOrder{}, fmt.Errorf("stock %s: %w: current quantity %d, requested quantity %d", line.StockID, ErrInsufficientStock, available, line.Quantity)
+		}
+
+		line.TransferID = order.ID
+		line.ItemID = lot.ItemId
+		copyLotDetails(&line, lot)
+		result, err := tx.Exec(`INSERT INTO transfer_order_lines (transfer_id, stock_id, item_id, stock_type, quantity, expiry_date, location, lot_notes, discount_rate)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			line.TransferID, line.StockID, line.ItemID, line.StockType, line.Quantity, line.ExpiryDate, line.Location, line.LotNotes, line.DiscountRate)
+		if err != nil {
+			return TransferOrder{}, fmt.Errorf("failed to add transfer line: %v", err)
+		}
+		if line.ID, err = result.LastInsertId(); err != nil {
+			return TransferOrder{}, err
+		}
+		if err := recordTransferLedger(tx, order.ID, line, fromStoreID, StockTransactionTransferRequested, line.Quantity, userEmail); err != nil {
+			return TransferOrder{}, err
+		}
+		order.Lines = append(order.Lines, line)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return TransferOrder{}, fmt.Errorf("failed to commit transfer: %v", err)
+	}
+	tx = nil
+	return order, nil
+}
+
+// DispatchTransfer takes every line off the source lots and puts the order in transit.
+// Only the source store can dispatch.
+func DispatchTransfer(transferID int64, storeID string, userEmail string) (TransferOrder, error) {
+	fmt.Println("---DISPATCHTRANSFER---", transferID, storeID, userEmail)
+	return transitionTransfer(transferID, storeID, func(tx *sql.Tx, order *TransferOrder) error {
+		if order.FromStoreID != storeID {
+			return ErrTransferNotFound
+		}
+		if order.Status != TransferRequested {
+			return ErrTransferState
+		}
+		for i := range order.Lines {
+			line := &order.Lines[i]
+			lot, err := deductStock(tx, line.StockID, storeID, line.StockType, line.Quantity)
+			if err != nil {
+				return fmt.Errorf("stock %s: %w", line.StockID, err)
+			}
+			// The lot may have been edited since the request; ship what it is now
+			copyLotDetails(line, lot)
+			_, err = tx.Exec("UPDATE transfer_order_lines SET expiry_date = ?, location = ?, lot_notes = ?, discount_rate = ? WHERE id = ?",
+				line.ExpiryDate, line.Location, line.LotNotes, line.DiscountRate, line.ID)
+			if err != nil {
+				return err
+			}
+			if err := recordTransferLedger(tx, order.ID, *line, storeID, StockTransactionTransferOut, line.Quantity, userEmail); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		order.Status = TransferDispatched
+		order.DispatchedBy = userEmail
+		order.DispatchedAt = &now
+		_, err := tx.Exec("UPDATE transfer_orders SET status = ?, dispatched_by = ?, dispatched_at = ? WHERE id = ?",
+			order.Status, order.DispatchedBy, order.DispatchedAt, order.ID)
+		return err
+	})
+}
+
+// ReceiveTransfer books arrived stock into the destination store as new lots with the
+// original expiry and lot details. Without receipts everything outstanding is received;
+// otherwise each receipt may receive part of a line and report the rest missing. Only the
+// destination store can receive.
+func ReceiveTransfer(transferID int64, storeID string, receipts []TransferReceipt, userEmail string) (TransferOrder, error) {
+	fmt.Println("---RECEIVETRANSFER---", transferID, storeID, len(receipts), userEmail)
+	return transitionTransfer(transferID, storeID, func(tx *sql.Tx, order *TransferOrder) error {
+		if order.ToStoreID != storeID {
+			return ErrTransferNotFound
+		}
+		if order.Status != TransferDispatched && order.Status != TransferPartiallyReceived {
+			return ErrTransferState
+		}
+
+		if len(receipts) == 0 {
+			for _, line := range order.Lines {
+				if line.Outstanding() > 0 {
+					receipts = append(receipts, TransferReceipt{LineID: line.ID, Received: line.Outstanding()})
+				}
+			}
+		}
+
+		for _, receipt := range receipts {
+			line := findTransferLine(order.Lines, receipt.LineID)
+			if line == nil {
+				return fmt.Errorf("%w: line %d is not part of transfer %d", ErrTransferInvalid, receipt.LineID, order.ID)
+			}
+			if receipt.Received < 0 || receipt.Missing < 0 || receipt.Received+receipt.Missing == 0 {
+				return fmt.Errorf("%w: line %d: received and missing quantities must be positive", ErrTransferInvalid, line.ID)
+			}
+			if receipt.Received+receipt.Missing > line.Outstanding() {
+				return fmt.Errorf("%w: line %d: only %d outstanding", ErrTransferInvalid, line.ID, line.Outstanding())
+			}
+			if receipt.Missing > 0 && strings.TrimSpace(receipt.Reason) == "" {
+				return fmt.Errorf("%w: line %d: a reason is required for missing quantities", ErrTransferInvalid, line.ID)
+			}
+
+			if receipt.Received > 0 {
+				lot := Stock{
+					ItemId:            line.ItemID,
+					StoreID:           storeID,
+					StockType:         line.StockType,
+					ExpiryDate:        line.ExpiryDate,
+					Location:          line.Location,
+					RegisteringPerson: userEmail,
+					Notes:             line.LotNotes,
+					DiscountRate:      line.DiscountRate,
+					OriginStockID:     line.StockID,
+				}
+				switch line.StockType {
+				case StockTypeBox:
+					lot.BoxNumber = receipt.Received
+				case StockTypeBundle:
+					lot.BundleNumber = receipt.Received
+				case StockTypePCS:
+					lot.PCSNumber = receipt.Received
+				}
+				if err := insertStock(tx, lot); err != nil {
+					return fmt.Errorf("failed to add received stock: %v", err)
+				}
+				if err := recordTransferLedger(tx, order.ID, *line, storeID, StockTransactionTransferIn, receipt.Received, userEmail); err != nil {
+					return err
+				}
+			}
+			if receipt.Missing > 0 {
+				if err := recordTransferLedger(tx, order.ID, *line, storeID, StockTransactionTransferMissing, receipt.Missing, userEmail); err != nil {
+					return err
+				}
+				line.Discrepancy = strings.TrimSpace(line.Discrepancy + "\n" + strings.TrimSpace(receipt.Reason))
+			}
+
+			line.ReceivedQuantity += receipt.Received
+			line.MissingQuantity += receipt.Missing
+			_, err := tx.Exec("UPDATE transfer_order_lines SET received_quantity = ?, missing_quantity = ?, discrepancy = NULLIF(?, '') WHERE id = ?",
+				line.ReceivedQuantity, line.MissingQuantity, line.Discrepancy, line.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		order.Status = TransferReceived
+		for _, line := range order.Lines {
+			if line.Outstanding() > 0 {
+				order.Status = TransferPartiallyReceived
+				break
+			}
+		}
+		now := time.Now()
+		order.ReceivedBy = userEmail
+		order.ReceivedAt = &now
+		_, err := tx.Exec("UPDATE transfer_orders SET status = ?, received_by = ?, received_at = ? WHERE id = ?",
+			order.Status, order.ReceivedBy, order.ReceivedAt, order.ID)
+		return err
+	})
+}
+
+// CancelTransfer withdraws a requested order; either store may cancel before dispatch
+func CancelTransfer(transferID int64, storeID string, userEmail string) (TransferOrder, error) {
+	fmt.Println("---CANCELTRANSFER---", transferID, storeID, userEmail)
+	return transitionTransfer(transferID, storeID, func(tx *sql.Tx, order *TransferOrder) error {
+		if order.FromStoreID != storeID && order.ToStoreID != storeID {
+			return ErrTransferNotFound
+		}
+		if order.Status != TransferRequested {
+			return ErrTransferState
+		}
+		for _, line := range order.Lines {
+			if err := recordTransferLedger(tx, order.ID, line, order.FromStoreID, StockTransactionTransferCancelled, line.Quantity, userEmail); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		order.Status = TransferCancelled
+		order.CancelledBy = userEmail
+		order.CancelledAt = &now
+		_, err := tx.Exec("UPDATE transfer_orders SET status = ?, cancelled_by = ?, cancelled_at = ? WHERE id = ?",
+			order.Status, order.CancelledBy, order.CancelledAt, order.ID)
+		return err
+	})
+}
+
+// transitionTransfer runs fn on the locked order in a transaction and returns the updated order
+func transitionTransfer(transferID int64, storeID string, fn func(tx *sql.Tx, order *TransferOrder) error) (TransferOrder, error) {
+	if storeID == "" {
+		return TransferOrder{}, ErrNoStore
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return TransferOrder{}, fmt.Errorf("database connection error")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return TransferOrder{}, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	order, err := getTransfer(tx, transferID, true)
+	if err != nil {
+		return TransferOrder{}, err
+	}
+	if err := fn(tx, &order); err != nil {
+		return TransferOrder{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return TransferOrder{}, fmt.Errorf("failed to commit transfer: %v", err)
+	}
+	tx = nil
+	return order, nil
+}
+
+// GetTransfer retrieves an order with its lines; orders not involving storeID are not found
+func GetTransfer(transferID int64, storeID string) (TransferOrder, error) {
+	if storeID == "" {
+		return TransferOrder{}, ErrNoStore
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return TransferOrder{}, fmt.Errorf("database connection error")
+	}
+	order, err := getTransfer(db, transferID, false)
+	if err != nil {
+		return TransferOrder{}, err
+	}
+	if order.FromStoreID != storeID && order.ToStoreID != storeID {
+		return TransferOrder{}, ErrTransferNotFound
+	}
+	return order, nil
+}
+
+// GetTransfers lists orders involving storeID, newest first. direction is "outgoing",
+// "incoming" or "" for both; status filters when set.
+func GetTransfers(storeID string, direction string, status string, limit int) ([]TransferOrder, error) {
+	fmt.Println("---GETTRANSFERS---", storeID, direction, status, limit)
+	if storeID == "" {
+		return nil, ErrNoStore
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	query := "SELECT " + transferColumns + " FROM transfer_orders WHERE "
+	args := []interface{}{}
+	switch direction {
+	case "outgoing":
+		query += "from_store_id = ?"
+		args = append(args, storeID)
+	case "incoming":
+		query += "to_store_id = ?"
+		args = append(args, storeID)
+	default:
+		query += "(from_store_id = ? OR to_store_id = ?)"
+		args = append(args, storeID, storeID)
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY requested_at DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []TransferOrder{}
+	for rows.Next() {
+		order, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+const transferColumns = "id, from_store_id, to_store_id, status, IFNULL(notes, ''), requested_by, requested_at, IFNULL(dispatched_by, ''), dispatched_at, IFNULL(received_by, ''), received_at, IFNULL(cancelled_by, ''), cancelled_at"
+
+func scanTransfer(row rowScanner) (TransferOrder, error) {
+	var order TransferOrder
+	var dispatchedAt, receivedAt, cancelledAt sql.NullTime
+	err := row.Scan(&order.ID, &order.FromStoreID, &order.ToStoreID, &order.Status, &order.Notes, &order.RequestedBy, &order.RequestedAt,
+		&order.DispatchedBy, &dispatchedAt, &order.ReceivedBy, &receivedAt, &order.CancelledBy, &cancelledAt)
+	if err != nil {
+		return TransferOrder{}, err
+	}
+	if dispatchedAt.Valid {
+		order.DispatchedAt = &dispatchedAt.Time
+	}
+	if receivedAt.Valid {
+		order.ReceivedAt = &receivedAt.Time
+	}
+	if cancelledAt.Valid {
+		order.CancelledAt = &cancelledAt.Time
+	}
+	return order, nil
+}
+
+func getTransfer(q queryRower, transferID int64, forUpdate bool) (TransferOrder, error) {
+	query := "SELECT " + transferColumns + " FROM transfer_orders WHERE id = ?"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	order, err := scanTransfer(q.QueryRow(query, transferID))
+	if err == sql.ErrNoRows {
+		return TransferOrder{}, ErrTransferNotFound
+	}
+	if err != nil {
+		return TransferOrder{}, err
+	}
+
+	rows, err := q.Query(`SELECT id, transfer_id, stock_id, item_id, stock_type, quantity, expiry_date, IFNULL(location, ''), IFNULL(lot_notes, ''),
+		discount_rate, received_quantity, missing_quantity, IFNULL(discrepancy, '')
+		FROM transfer_order_lines WHERE transfer_id = ? ORDER BY id`, transferID)
+	if err != nil {
+		return TransferOrder{}, err
+	}
+	defer rows.Close()
+
+	order.Lines = []TransferLine{}
+	for rows.Next() {
+		var line TransferLine
+		if err := rows.Scan(&line.ID, &line.TransferID, &line.StockID, &line.ItemID, &line.StockType, &line.Quantity, &line.ExpiryDate, &line.Location,
+			&line.LotNotes, &line.DiscountRate, &line.ReceivedQuantity, &line.MissingQuantity, &line.Discrepancy); err != nil {
+			return TransferOrder{}, err
+		}
+		order.Lines = append(order.Lines, line)
+	}
+	return order, rows.Err()
+}
+
+func findTransferLine(lines []TransferLine, lineID int64) *TransferLine {
+	for i := range lines {
+		if lines[i].ID == lineID {
+			return &lines[i]
+		}
+	}
+	return nil
+}
+
+func copyLotDetails(line *TransferLine, lot Stock) {
+	line.ExpiryDate = lot.ExpiryDate
+	line.Location = lot.Location
+	line.LotNotes = lot.Notes
+	line.DiscountRate = lot.DiscountRate
+}
+
+// recordTransferLedger writes one stock_transactions entry for a transfer line
+func recordTransferLedger(tx *sql.Tx, transferID int64, line TransferLine, storeID string, transactionType string, quantity int, userEmail string) error {
+	err := insertStockTransaction(tx, StockTransaction{
+		ItemID:          line.ItemID,
+		StoreID:         storeID,
+		Quantity:        quantity,
+		TransactionType: transactionType,
+		UserEmail:       userEmail,
+		TransferID:      transferID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record %s: %v", transactionType, err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GlossaryTerm is a store-maintained brand or product term with its fixed rendering per language
+type GlossaryTerm struct {
+	ID        int64     `json:"id"`
+	Term      string    `json:"term"`
+	NameEng   string    `json:"name_eng"`
+	NameKor   string    `json:"name_kor"`
+	NameJpn   string    `json:"name_jpn"`
+	NameChn   string    `json:"name_chn"`
+	Notes     string    `json:"notes"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const glossaryColumns = "id, term, IFNULL(name_eng, ''), IFNULL(name_kor, ''), IFNULL(name_jpn, ''), IFNULL(name_chn, ''), IFNULL(notes, ''), IFNULL(updated_by, ''), updated_at"
+
+func scanGlossaryTerm(scanner interface{ Scan(...interface{}) error }) (GlossaryTerm, error) {
+	var term GlossaryTerm
+	err := scanner.Scan(&term.ID, &term.Term, &term.NameEng, &term.NameKor, &term.NameJpn, &term.NameChn, &term.Notes, &term.UpdatedBy, &term.UpdatedAt)
+	return term, err
+}
+
+// GetGlossaryTerms lists the whole glossary, alphabetically
+func GetGlossaryTerms() ([]GlossaryTerm, error) {
+	fmt.Println("---GETGLOSSARYTERMS---")
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	rows, err := db.Query("SELECT " + glossaryColumns + " FROM translation_glossary ORDER BY term")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []GlossaryTerm{}
+	for rows.Next() {
+		term, err := scanGlossaryTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	return terms, rows.Err()
+}
+
+// GetGlossaryTerm retrieves a glossary term by id
+func GetGlossaryTerm(id int64) (GlossaryTerm, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return GlossaryTerm{}, fmt.Errorf("database connection error")
+	}
+
+	term, err := scanGlossaryTerm(db.QueryRow("SELECT "+glossaryColumns+" FROM translation_glossary WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return GlossaryTerm{}, fmt.Errorf("glossary term not found")
+	}
+	return term, err
+}
+
+// CreateGlossaryTerm adds a term to the glossary
+func CreateGlossaryTerm(term GlossaryTerm) (GlossaryTerm, error) {
+	fmt.Println("---CREATEGLOSSARYTERM---", term.Term)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return GlossaryTerm{}, fmt.Errorf("database connection error")
+	}
+
+	term.UpdatedAt = time.Now()
+	query := "INSERT INTO translation_glossary (term, name_eng, name_kor, name_jpn, name_chn, notes, updated_by, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, term.Term, term.NameEng, term.NameKor, term.NameJpn, term.NameChn, term.Notes, term.UpdatedBy, term.UpdatedAt)
+	if err != nil {
+		return GlossaryTerm{}, fmt.Errorf("failed to create glossary term: %v", err)
+	}
+	term.ID, err = result.LastInsertId()
+	if err != nil {
+		return GlossaryTerm{}, err
+	}
+	return term, nil
+}
+
+// UpdateGlossaryTerm replaces a glossary term
+func UpdateGlossaryTerm(term GlossaryTerm) (GlossaryTerm, error) {
+	fmt.Println("---UPDATEGLOSSARYTERM---", term.ID, term.Term)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return GlossaryTerm{}, fmt.Errorf("database connection error")
+	}
+
+	term.UpdatedAt = time.Now()
+	query := "UPDATE translation_glossary SET term = ?, name_eng = ?, name_kor = ?, name_jpn = ?, name_chn = ?, notes = ?, updated_by = ?, updated_at = ? WHERE id = ?"
+	result, err := db.Exec(query, term.Term, term.NameEng, term.NameKor, term.NameJpn, term.NameChn, term.Notes, term.UpdatedBy, term.UpdatedAt, term.ID)
+	if err != nil {
+		return GlossaryTerm{}, fmt.Errorf("failed to update glossary term: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := GetGlossaryTerm(term.ID); err != nil {
+			return GlossaryTerm{}, err
+		}
+	}
+	return term, nil
+}
+
+// DeleteGlossaryTerm removes a glossary term
+func DeleteGlossaryTerm(id int64) error {
+	fmt.Println("---DELETEGLOSSARYTERM---", id)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	result, err := db.Exec("DELETE FROM translation_glossary WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("glossary term not found")
+	}
+	return nil
+}
+
+// GetItemsMissingNamesByTags returns tagged items visible in the store that have a name but lack at least one
+// translated name. Items with a pending translation suggestion are skipped.
+func GetItemsMissingNamesByTags(tagIDs []string, storeID string, limit int) ([]Item, error) {
+	fmt.Println("---GETITEMSMISSINGNAMESBYTAGS---", tagIDs, storeID, limit)
+	if len(tagIDs) == 0 {
+		return nil, fmt.Errorf("no tags provided")
+	}
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, fmt.Errorf("database connection error")
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tagIDs)), ", ")
+	args := []interface{}{}
+	for _, tagID := range tagIDs {
+		args = append(args, tagID)
+	}
+	args = append(args, storeID, limit)
+
+	query := `
+	SELECT DISTINCT i.item_id, IFNULL(i.code, ''), IFNULL(i.barcode, ''), IFNULL(i.name, ''),
+	IFNULL(i.name_jpn, ''), IFNULL(i.name_chn, ''), IFNULL(i.name_kor, ''), IFNULL(i.name_eng, ''), i.created_at
+	FROM items i
+	JOIN item_tags it ON i.item_id = it.item_id
+	WHERE it.tag_id IN (` + placeholders + `)
+	AND ` + catalogueFilter("i") + `
+	AND IFNULL(i.name, '') <> ''
+	AND (IFNULL(i.name_jpn, '') = '' OR IFNULL(i.name_chn, '') = '' OR IFNULL(i.name_kor, '') = '' OR IFNULL(i.name_eng, '') = '')
+	AND NOT EXISTS (
+		SELECT 1 FROM ai_suggestions s WHERE s.item_id = i.item_id AND s.status = 'pending' AND s.source = 'translation'
+	)
+	ORDER BY i.created_at DESC
+	LIMIT ?`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []Item{}
+	for rows.Next() {
+		var item Item
+		err := rows.Scan(&item.ID, &item.Code, &item.BarCode, &item.Name, &item.NameJpn, &item.NameChn, &item.NameKor, &item.NameEng, &item.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
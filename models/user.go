@@ -1,25 +1,55 @@
 package models
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
+// ErrUserNotFound is returned for unknown and deleted users
+var ErrUserNotFound = errors.New("user not found")
+
+// languagePattern accepts language tags such as "en", "ko" or "pt-BR"
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
 // User represents user data in the system
 type User struct {
-	ID            int       `json:"user_id"`
-	DisplayName   string    `json:"displayName"`
-	Email         string    `json:"email"`
-	EmailVerified bool      `json:"emailVerified"`
-	IsAnonymous   bool      `json:"isAnonymous"`
-	PhoneNumber   string    `json:"phoneNumber"`
-	PhotoURL      string    `json:"photoURL"`
-	ProviderId    string    `json:"providerId"`
-	Uid           string    `json:"uid"`
-	Designation   string    `json:"designation"`
-	Branch        string    `json:"branch"`
-	CreatedAt     time.Time `json:"createdAt"`
-	LoginAt       time.Time `json:"loginAt"`
+	ID            int        `json:"user_id"`
+	DisplayName   string     `json:"displayName"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"emailVerified"`
+	IsAnonymous   bool       `json:"isAnonymous"`
+	PhoneNumber   string     `json:"phoneNumber"`
+	PhotoURL      string     `json:"photoURL"`
+	ProviderId    string     `json:"providerId"`
+	Uid           string     `json:"uid"`
+	Designation   string     `json:"designation"`
+	Branch        string     `json:"branch"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	LoginAt       time.Time  `json:"loginAt"`
+	LastSeenAt    *time.Time `json:"lastSeenAt,omitempty"`
+
+	PreferredLanguage string     `json:"preferredLanguage"`
+	DefaultStoreID    string     `json:"defaultStoreId"`
+	DefaultLocation   string     `json:"defaultLocation"`
+	Active            bool       `json:"active"`
+	DeactivatedBy     string     `json:"deactivatedBy,omitempty"`
+	DeactivatedAt     *time.Time `json:"deactivatedAt,omitempty"`
+}
+
+// UserProfileUpdate holds the fields a user may change on their own profile; nil leaves a
+// field as it is and "" clears it
+type UserProfileUpdate struct {
+	DisplayName       *string `json:"displayName"`
+	PhoneNumber       *string `json:"phoneNumber"`
+	PreferredLanguage *string `json:"preferredLanguage"`
+	DefaultStoreID    *string `json:"defaultStoreId"`
+	DefaultLocation   *string `json:"defaultLocation"`
 }
 
 func (u *User) Save() (User, error) {
@@ -92,3 +122,323 @@ func (u *User) IsUserSaved(uid string) bool {
 	fmt.Println("IsUserSaved result:", user)
 	return true
 }
+
+// GetUserBranch returns the branch a user belongs to, or "" when none is set
+func GetUserBranch(uid string) (string, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return "", fmt.Errorf("database connection error")
+	}
+
+	var branch string
+	err := db.QueryRow("SELECT IFNULL(branch, '') FROM users WHERE firebase_uid = ?", uid).Scan(&branch)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return branch, err
+}
+
+const userColumns = `firebase_uid, IFNULL(email, ''), IFNULL(display_name, ''), IFNULL(photo_url, ''), IFNULL(phone_number, ''),
+	IFNULL(email_verified, FALSE), IFNULL(is_anonymous, FALSE), IFNULL(provider_id, ''), IFNULL(designation, ''), IFNULL(branch, ''),
+	created_at, login_at, last_seen_at, IFNULL(preferred_language, ''), IFNULL(default_store_id, ''), IFNULL(default_location, ''),
+	active, IFNULL(deactivated_by, ''), deactivated_at`
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	var createdAt, loginAt, lastSeenAt, deactivatedAt sql.NullTime
+	err := row.Scan(&user.Uid, &user.Email, &user.DisplayName, &user.PhotoURL, &user.PhoneNumber,
+		&user.EmailVerified, &user.IsAnonymous, &user.ProviderId, &user.Designation, &user.Branch,
+		&createdAt, &loginAt, &lastSeenAt, &user.PreferredLanguage, &user.DefaultStoreID, &user.DefaultLocation,
+		&user.Active, &user.DeactivatedBy, &deactivatedAt)
+	if err != nil {
+		return User{}, err
+	}
+	user.CreatedAt = createdAt.Time
+	user.LoginAt = loginAt.Time
+	if lastSeenAt.Valid {
+		user.LastSeenAt = &lastSeenAt.Time
+	}
+	if deactivatedAt.Valid {
+		user.DeactivatedAt = &deactivatedAt.Time
+	}
+	return user, nil
+}
+
+// GetUser returns a user by Firebase UID
+func GetUser(uid string) (User, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return User{}, fmt.Errorf("database connection error")
+	}
+
+	user, err := scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE firebase_uid = ? AND deleted_at IS NULL", uid))
+	if err == sql.ErrNoRows {
+		return User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+// UpdateUserProfile applies a user's own profile changes. A default store must be active.
+func UpdateUserProfile(uid string, update UserProfileUpdate) (User, error) {
+	fmt.Println("---UPDATEUSERPROFILE---", uid)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return User{}, fmt.Errorf("database connection error")
+	}
+
+	sets := []string{}
+	args := []interface{}{}
+	set := func(column string, value *string) {
+		if value != nil {
+			sets = append(sets, column+" = NULLIF(?, '')")
+			args = append(args, strings.TrimSpace(*value))
+		}
+	}
+	if update.PreferredLanguage != nil && *update.PreferredLanguage != "" && !languagePattern.MatchString(*update.PreferredLanguage) {
+		return User{}, fmt.Errorf("invalid language tag %q", *update.PreferredLanguage)
+	}
+	if update.DefaultStoreID != nil && *update.DefaultStoreID != "" {
+		if store, err := GetStore(*update.DefaultStoreID); err != nil || !store.Active {
+			return User{}, fmt.Errorf("unknown or inactive store %s", *update.DefaultStoreID)
+		}
+	}
+	set("display_name", update.DisplayName)
+	set("phone_number", update.PhoneNumber)
+	set("preferred_language", update.PreferredLanguage)
+	set("default_store_id", update.DefaultStoreID)
+	set("default_location", update.DefaultLocation)
+
+	if len(sets) > 0 {
+		args = append(args, uid)
+		result, err := db.Exec("UPDATE users SET "+strings.Join(sets, ", ")+" WHERE firebase_uid = ? AND deleted_at IS NULL", args...)
+		if err != nil {
+			return User{}, fmt.Errorf("failed to update profile: %v", err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			// MySQL reports 0 rows for an update that changes nothing, so check the user exists
+			if _, err := GetUser(uid); err != nil {
+				return User{}, err
+			}
+		}
+	}
+	return GetUser(uid)
+}
+
+// GetUsers lists users whose email, name, UID or branch contains query. status is "active",
+// "inactive" or "" for both. It also returns the number of matches for paging.
+func GetUsers(query string, status string, limit int, offset int) ([]User, int, error) {
+	fmt.Println("---GETUSERS---", query, status, limit, offset)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return nil, 0, fmt.Errorf("database connection error")
+	}
+
+	where := "deleted_at IS NULL"
+	args := []interface{}{}
+	if query != "" {
+		like := "%" + query + "%"
+		where += " AND (email LIKE ? OR display_name LIKE ? OR firebase_uid LIKE ? OR branch LIKE ?)"
+		args = append(args, like, like, like, like)
+	}
+	switch status {
+	case "active":
+		where += " AND active = TRUE"
+	case "inactive":
+		where += " AND active = FALSE"
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query("SELECT "+userColumns+" FROM users WHERE "+where+" ORDER BY email LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// SetUserActive deactivates or reactivates a user. Deactivated users are refused by the
+// auth middleware but keep their history.
+func SetUserActive(uid string, active bool, changedBy string) (User, error) {
+	fmt.Println("---SETUSERACTIVE---", uid, active, changedBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return User{}, fmt.Errorf("database connection error")
+	}
+
+	var err error
+	if active {
+		_, err = db.Exec("UPDATE users SET active = TRUE, deactivated_by = NULL, deactivated_at = NULL WHERE firebase_uid = ? AND deleted_at IS NULL", uid)
+	} else {
+		_, err = db.Exec("UPDATE users SET active = FALSE, deactivated_by = ?, deactivated_at = ? WHERE firebase_uid = ? AND deleted_at IS NULL AND active = TRUE",
+			changedBy, time.Now(), uid)
+	}
+	if err != nil {
+		return User{}, fmt.Errorf("failed to update user: %v", err)
+	}
+	return GetUser(uid)
+}
+
+// IsUserActive reports whether a user may sign in. Users without a row yet are active; they
+// are created on their first request.
+func IsUserActive(uid string) (bool, error) {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return false, fmt.Errorf("database connection error")
+	}
+
+	var active, deleted bool
+	err := db.QueryRow("SELECT active, deleted_at IS NOT NULL FROM users WHERE firebase_uid = ?", uid).Scan(&active, &deleted)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return active && !deleted, nil
+}
+
+// AnonymisedActor is the stand-in recorded in place of a deleted user's email. It is stable per
+// user, so the history of one deleted user still groups together.
+func AnonymisedActor(uid string) string {
+	sum := sha256.Sum256([]byte(uid))
+	return "deleted-" + hex.EncodeToString(sum[:8]) + "@users.invalid"
+}
+
+// DeleteUser removes a user's personal data. The users row is kept as an inactive tombstone so
+// the UID cannot sign in again, and the user's email on every history table (stock, transfers,
+// item versions, AI reviews and usage, image uploads and GC runs, API keys, role assignments)
+// is replaced by AnonymisedActor so those records stay intact. Per-user LLM quotas are dropped.
+// audit_log is kept as it is on purpose: its rows are hash-chained, so rewriting the actor would
+// break verification of every later entry.
+func DeleteUser(uid string, deletedBy string) (string, error) {
+	fmt.Println("---DELETEUSER---", uid, deletedBy)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return "", fmt.Errorf("database connection error")
+	}
+	user, err := GetUser(uid)
+	if err != nil {
+		return "", err
+	}
+	actor := AnonymisedActor(uid)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if user.Email != "" {
+		statements := []string{
+			"UPDATE stock_transactions SET fkuser_email = ? WHERE fkuser_email = ?",
+			"UPDATE transfer_orders SET requested_by = ? WHERE requested_by = ?",
+			"UPDATE transfer_orders SET dispatched_by = ? WHERE dispatched_by = ?",
+			"UPDATE transfer_orders SET received_by = ? WHERE received_by = ?",
+			"UPDATE transfer_orders SET cancelled_by = ? WHERE cancelled_by = ?",
+			"UPDATE item_versions SET changed_by = ? WHERE changed_by = ?",
+			"UPDATE item_images SET created_by = ? WHERE created_by = ?",
+			"UPDATE ai_suggestions SET created_by = ? WHERE created_by = ?",
+			"UPDATE ai_suggestion_reviews SET reviewed_by = ? WHERE reviewed_by = ?",
+			"UPDATE enrichment_jobs SET started_by = ? WHERE started_by = ?",
+			"UPDATE llm_usage SET user_email = ? WHERE user_email = ?",
+			"UPDATE llm_quotas SET updated_by = ? WHERE updated_by = ?",
+			"UPDATE translation_glossary SET updated_by = ? WHERE updated_by = ?",
+			"UPDATE image_gc_runs SET started_by = ? WHERE started_by = ?",
+			"UPDATE image_gc_runs SET deleted_by = ? WHERE deleted_by = ?",
+			"UPDATE image_uploads SET created_by = ? WHERE created_by = ?",
+			"UPDATE api_keys SET created_by = ? WHERE created_by = ?",
+			"UPDATE api_keys SET revoked_by = ? WHERE revoked_by = ?",
+			"UPDATE user_roles SET assigned_by = ? WHERE assigned_by = ?",
+			"UPDATE users SET deactivated_by = ? WHERE deactivated_by = ?",
+		}
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement, actor, user.Email); err != nil {
+				return "", fmt.Errorf("failed to anonymise history: %v", err)
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM llm_quotas WHERE scope = 'user' AND subject = ?", user.Email); err != nil {
+			return "", fmt.Errorf("failed to remove quotas: %v", err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE llm_usage SET user_uid = NULL WHERE user_uid = ?", uid); err != nil {
+		return "", fmt.Errorf("failed to anonymise history: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM user_roles WHERE firebase_uid = ?", uid); err != nil {
+		return "", fmt.Errorf("failed to remove role: %v", err)
+	}
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE users SET email = ?, display_name = NULL, photo_url = NULL, phone_number = NULL,
+		designation = NULL, branch = NULL, preferred_language = NULL, default_store_id = NULL, default_location = NULL,
+		active = FALSE, deactivated_by = ?, deactivated_at = ?, deleted_at = ?
+		WHERE firebase_uid = ?`, actor, deletedBy, now, now, uid)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete user: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit: %v", err)
+	}
+	tx = nil
+	return actor, nil
+}
+
+// SignInUser records a verified sign-in: it creates the user on first sign-in, otherwise it
+// refreshes the fields that come from the identity provider along with login_at
+func SignInUser(u User) (User, error) {
+	fmt.Println("---SIGNINUSER---", u.Uid)
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return User{}, fmt.Errorf("database connection error")
+	}
+
+	now := time.Now()
+	result, err := db.Exec(`UPDATE users SET email = ?, display_name = IFNULL(NULLIF(?, ''), display_name), photo_url = IFNULL(NULLIF(?, ''), photo_url),
+		email_verified = ?, provider_id = ?, login_at = ?, last_seen_at = ?
+		WHERE firebase_uid = ? AND deleted_at IS NULL`,
+		u.Email, u.DisplayName, u.PhotoURL, u.EmailVerified, u.ProviderId, now, now, u.Uid)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to update user: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 && !u.IsUserSaved(u.Uid) {
+		if _, err := u.Save(); err != nil {
+			return User{}, fmt.Errorf("failed to save user: %v", err)
+		}
+	}
+	return GetUser(u.Uid)
+}
+
+// TouchUserLastSeen records that a user made a request, creating the row for users who call
+// the API without having signed in first
+func TouchUserLastSeen(u User) error {
+	db := GetDBInstance(GetDBConfig())
+	if db == nil {
+		return fmt.Errorf("database connection error")
+	}
+
+	result, err := db.Exec("UPDATE users SET last_seen_at = ? WHERE firebase_uid = ?", time.Now(), u.Uid)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 && !u.IsUserSaved(u.Uid) {
+		_, err = u.Save()
+	}
+	return err
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalMountPath is where main.go mounts Local.Handler
+const LocalMountPath = "/public/storage/"
+
+// maxLocalPutSize caps uploads through presigned PUT URLs
+const maxLocalPutSize = 32 << 20
+
+// LocalConfig configures the filesystem driver
+type LocalConfig struct {
+	Root          string // directory holding the files
+	PublicBaseURL string // URL prefix the Handler is reachable under
+	SigningSecret string // HMAC key for presigned URLs; random per process when empty
+}
+
+// Local stores blobs as files under a root directory and serves them over HTTP
+type Local struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocal(cfg LocalConfig) (*Local, error) {
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory %s: %v", root, err)
+	}
+
+	secret := []byte(cfg.SigningSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		log.Printf("STORAGE_SIGNING_SECRET not set; presigned URLs will not survive a restart")
+	}
+	return &Local{root: root, baseURL: strings.TrimRight(cfg.PublicBaseURL, "/"), secret: secret}, nil
+}
+
+func (l *Local) Driver() string {
+	return "local"
+}
+
+func (l *Local) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// Write to a temp file first so readers never see a partial image
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (l *Local) Get(ctx context.Context, key string) ([]byte, Object, error) {
+	p, err := l.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, Object{}, ErrNotFound
+		}
+		return nil, Object{}, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return data, Object{Key: key, Size: info.Size(), ContentType: contentTypeFor(key, data), LastModified: info.ModTime()}, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	err := filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Presign returns a URL on the local Handler carrying an HMAC of method, key and expiry
+func (l *Local) Presign(ctx context.Context, method string, key string, ttl time.Duration) (string, error) {
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", ErrInvalidMethod
+	}
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", l.sign(method, key, expires, "", ""))
+	return l.URL(key) + "?" + query.Encode(), nil
+}
+
+// PresignUpload returns a PUT URL whose signature also covers the content type and size;
+// the Handler rejects bodies that do not match them
+func (l *Local) PresignUpload(ctx context.Context, key string, contentType string, size int64, ttl time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	length := strconv.FormatInt(size, 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("content_type", contentType)
+	query.Set("size", length)
+	query.Set("signature", l.sign(http.MethodPut, key, expires, contentType, length))
+	return l.URL(key) + "?" + query.Encode(), nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+func (l *Local) sign(method string, key string, expires string, contentType string, size string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	payload := method + "\n" + key + "\n" + expires
+	if contentType != "" || size != "" {
+		payload += "\n" + contentType + "\n" + size
+	}
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) verify(method string, key string, query url.Values) bool {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	expected := l.sign(method, key, expires, query.Get("content_type"), query.Get("size"))
+	return hmac.Equal([]byte(query.Get("signature")), []byte(expected))
+}
+
+// Handler serves GET for every stored file (like a public bucket) and
+// PUT for presigned upload URLs. Mount it under LocalMountPath.
+func (l *Local) Handler() http.Handler {
+	return http.StripPrefix(strings.TrimSuffix(LocalMountPath, "/"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			data, obj, err := l.Get(r.Context(), key)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", obj.ContentType)
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+			http.ServeContent(w, r, key, obj.LastModified, bytes.NewReader(data))
+		case http.MethodPut:
+			if !l.verify(http.MethodPut, key, r.URL.Query()) {
+				http.Error(w, "invalid or expired signature", http.StatusForbidden)
+				return
+			}
+			query := r.URL.Query()
+			if ct := query.Get("content_type"); ct != "" && r.Header.Get("Content-Type") != ct {
+				http.Error(w, "content type does not match the signed upload", http.StatusForbidden)
+				return
+			}
+			data, err := io.ReadAll(io.LimitReader(r.Body, maxLocalPutSize+1))
+			if err != nil {
+				http.Error(w, "failed to read body", http.StatusBadRequest)
+				return
+			}
+			if len(data) > maxLocalPutSize {
+				http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if size := query.Get("size"); size != "" && size != strconv.Itoa(len(data)) {
+				http.Error(w, "body size does not match the signed upload", http.StatusForbidden)
+				return
+			}
+			if err := l.Put(r.Context(), key, data, r.Header.Get("Content-Type")); err != nil {
+				http.Error(w, "failed to store file", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func contentTypeFor(key string, data []byte) string {
+	if ct := mime.TypeByExtension(filepath.Ext(key)); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(data)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps blobs in a map. Intended for tests and throwaway dev servers.
+type Memory struct {
+	mu      sync.RWMutex
+	baseURL string
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info Object
+}
+
+func NewMemory(baseURL string) *Memory {
+	return &Memory{baseURL: strings.TrimRight(baseURL, "/"), objects: map[string]memoryObject{}}
+}
+
+func (m *Memory) Driver() string {
+	return "memory"
+}
+
+func (m *Memory) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	copied := append([]byte(nil), data...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memoryObject{
+		data: copied,
+		info: Object{Key: key, Size: int64(len(copied)), ContentType: contentType, LastModified: time.Now()},
+	}
+	return nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	obj, ok := m.objects[key]
+	if !ok {
+		return nil, Object{}, ErrNotFound
+	}
+	return append([]byte(nil), obj.data...), obj.info, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context, prefix string) ([]Object, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	objects := []Object{}
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, obj.info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Presign returns a fake URL; the memory driver has nothing to serve it
+func (m *Memory) Presign(ctx context.Context, method string, key string, ttl time.Duration) (string, error) {
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", ErrInvalidMethod
+	}
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s?method=%s&expires=%d", m.URL(key), method, time.Now().Add(ttl).Unix()), nil
+}
+
+func (m *Memory) PresignUpload(ctx context.Context, key string, contentType string, size int64, ttl time.Duration) (string, error) {
+	return m.Presign(ctx, http.MethodPut, key, ttl)
+}
+
+func (m *Memory) URL(key string) string {
+	return m.baseURL + "/" + key
+}
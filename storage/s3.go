@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// S3Config configures an S3-compatible bucket (Cloudflare R2, AWS S3, MinIO)
+type S3Config struct {
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	PublicDomain string // serves objects publicly, e.g. the R2 custom domain
+	UsePathStyle bool   // required by R2 and MinIO
+}
+
+// S3 stores blobs in an S3-compatible bucket. The client is built once and reused.
+type S3 struct {
+	cfg     S3Config
+	client  *s3.Client
+	presign *s3.PresignClient
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.AccessKey == "" || cfg.SecretKey == "" || cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3 configuration missing. Please set R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY, R2_ENDPOINT, and R2_BUCKET_NAME (or the STORAGE_S3_* equivalents)")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "auto"
+	}
+
+	client := s3.NewFromConfig(aws.Config{
+		Credentials: credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, ""),
+		Region:      cfg.Region,
+	}, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(cfg.Endpoint)
+		o.UsePathStyle = cfg.UsePathStyle
+	})
+	return &S3{cfg: cfg, client: client, presign: s3.NewPresignClient(client)}, nil
+}
+
+func (s *S3) Driver() string {
+	return "s3"
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.cfg.Bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, Object, error) {
+	if err := validateKey(key); err != nil {
+		return nil, Object{}, err
+	}
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, Object{}, ErrNotFound
+		}
+		return nil, Object{}, fmt.Errorf("failed to get %s: %v", key, err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	obj := Object{Key: key, Size: int64(len(data)), ContentType: aws.ToString(out.ContentType)}
+	if out.LastModified != nil {
+		obj.LastModified = *out.LastModified
+	}
+	return data, obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %q: %v", prefix, err)
+		}
+		for _, item := range page.Contents {
+			obj := Object{Key: aws.ToString(item.Key), Size: aws.ToInt64(item.Size)}
+			if item.LastModified != nil {
+				obj.LastModified = *item.LastModified
+			}
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+func (s *S3) Presign(ctx context.Context, method string, key string, ttl time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	expires := s3.WithPresignExpires(ttl)
+	switch method {
+	case http.MethodGet:
+		req, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.cfg.Bucket),
+			Key:    aws.String(key),
+		}, expires)
+		if err != nil {
+			return "", err
+		}
+		return req.URL, nil
+	case http.MethodPut:
+		req, err := s.presign.PresignPutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(s.cfg.Bucket),
+			Key:    aws.String(key),
+		}, expires)
+		if err != nil {
+			return "", err
+		}
+		return req.URL, nil
+	default:
+		return "", ErrInvalidMethod
+	}
+}
+
+// PresignUpload signs Content-Type and Content-Length, so the bucket rejects any other body
+func (s *S3) PresignUpload(ctx context.Context, key string, contentType string, size int64, ttl time.Duration) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	req, err := s.presign.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.cfg.Bucket),
+		Key:           aws.String(key),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+func (s *S3) URL(key string) string {
+	if s.cfg.PublicDomain != "" {
+		return fmt.Sprintf("https://%s/%s", s.cfg.PublicDomain, key)
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.TrimRight(s.cfg.Endpoint, "/"), s.cfg.Bucket, key)
+}
+
+func isS3NotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound"
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Object describes a stored blob
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Blob is implemented by every storage driver
+type Blob interface {
+	// Driver names the implementation ("s3", "local", "memory")
+	Driver() string
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, Object, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Presign returns a time-limited URL for GET or PUT on key
+	Presign(ctx context.Context, method string, key string, ttl time.Duration) (string, error)
+	// PresignUpload returns a time-limited PUT URL that only accepts a body of exactly size
+	// bytes sent with the given Content-Type
+	PresignUpload(ctx context.Context, key string, contentType string, size int64, ttl time.Duration) (string, error)
+	// URL returns the public URL of key
+	URL(key string) string
+}
+
+var (
+	ErrNotFound      = errors.New("object not found")
+	ErrInvalidKey    = errors.New("invalid object key")
+	ErrInvalidMethod = errors.New("presign method must be GET or PUT")
+)
+
+// validateKey rejects keys that could escape a bucket or root directory
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+var (
+	defaultOnce sync.Once
+	defaultBlob Blob
+	defaultErr  error
+)
+
+// Default returns the process-wide blob store configured by the environment
+func Default() (Blob, error) {
+	defaultOnce.Do(func() {
+		defaultBlob, defaultErr = NewFromEnv()
+		if defaultErr == nil {
+			log.Printf("Storage driver: %s", defaultBlob.Driver())
+		}
+	})
+	return defaultBlob, defaultErr
+}
+
+// NewFromEnv builds the driver named by STORAGE_DRIVER:
+//   - "r2" / "s3" (default): S3-compatible bucket. STORAGE_S3_* variables, falling back to the R2_* ones
+//   - "local": files under STORAGE_LOCAL_DIR served by Local.Handler
+//   - "memory": in-process map, for tests
+func NewFromEnv() (Blob, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "r2", "s3":
+		return NewS3(S3Config{
+			Endpoint:     envOr("STORAGE_S3_ENDPOINT", os.Getenv("R2_ENDPOINT")),
+			Region:       envOr("STORAGE_S3_REGION", "auto"),
+			Bucket:       envOr("STORAGE_S3_BUCKET", os.Getenv("R2_BUCKET_NAME")),
+			AccessKey:    envOr("STORAGE_S3_ACCESS_KEY_ID", os.Getenv("R2_ACCESS_KEY_ID")),
+			SecretKey:    envOr("STORAGE_S3_SECRET_ACCESS_KEY", os.Getenv("R2_SECRET_ACCESS_KEY")),
+			PublicDomain: envOr("STORAGE_PUBLIC_DOMAIN", os.Getenv("R2_PUBLIC_DOMAIN")),
+			UsePathStyle: true,
+		})
+	case "local":
+		return NewLocal(LocalConfig{
+			Root:          envOr("STORAGE_LOCAL_DIR", "./data/storage"),
+			PublicBaseURL: envOr("STORAGE_PUBLIC_URL", "http://localhost:8080"+LocalMountPath),
+			SigningSecret: os.Getenv("STORAGE_SIGNING_SECRET"),
+		})
+	case "memory":
+		return NewMemory(envOr("STORAGE_PUBLIC_URL", "memory://storage")), nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+func envOr(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
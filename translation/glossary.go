@@ -0,0 +1,102 @@
+package translation
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// GlossaryTranslator works offline from the store glossary alone. It only answers
+// when the whole name is made of glossary terms, numbers, units and punctuation.
+type GlossaryTranslator struct{}
+
+func NewGlossaryTranslator() *GlossaryTranslator {
+	return &GlossaryTranslator{}
+}
+
+func (g *GlossaryTranslator) Name() string {
+	return ModeGlossary
+}
+
+func (g *GlossaryTranslator) Translate(ctx context.Context, req Request) (Result, error) {
+	result := Result{Names: map[string]string{}, Model: ModeGlossary}
+	skipped := []string{}
+	for _, lang := range req.Languages {
+		if name, ok := translateWithGlossary(req.Name, lang, req.Glossary); ok {
+			result.Names[lang] = name
+		} else {
+			skipped = append(skipped, lang)
+		}
+	}
+	if len(skipped) > 0 {
+		result.Notes = "no complete glossary match for: " + strings.Join(skipped, ", ")
+	}
+	return result, nil
+}
+
+// translateWithGlossary replaces glossary terms in name, longest first, and
+// succeeds only if nothing but numbers, units and punctuation is left over.
+func translateWithGlossary(name string, lang string, glossary []Term) (string, bool) {
+	terms := sortedTerms(glossary, lang)
+	out := strings.Builder{}
+	rest := strings.TrimSpace(name)
+	matched := false
+	for len(rest) > 0 {
+		found := false
+		for _, term := range terms {
+			if len(rest) >= len(term.Source) && strings.EqualFold(rest[:len(term.Source)], term.Source) {
+				out.WriteString(term.Translations[lang])
+				rest = rest[len(term.Source):]
+				found, matched = true, true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		r := []rune(rest)[0]
+		if !isPassThrough(r) {
+			return "", false
+		}
+		out.WriteRune(r)
+		rest = rest[len(string(r)):]
+	}
+	if !matched {
+		return "", false
+	}
+	return strings.Join(strings.Fields(out.String()), " "), true
+}
+
+// sortedTerms returns the terms that have a rendering for lang, longest source first
+func sortedTerms(glossary []Term, lang string) []Term {
+	terms := []Term{}
+	for _, term := range glossary {
+		if term.Source != "" && term.Translations[lang] != "" {
+			terms = append(terms, term)
+		}
+	}
+	sort.SliceStable(terms, func(i, j int) bool {
+		return len(terms[i].Source) > len(terms[j].Source)
+	})
+	return terms
+}
+
+// isPassThrough reports whether a rune can be copied untranslated (sizes like "120g", "x5")
+func isPassThrough(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) ||
+		strings.ContainsRune("gGmMlLkKxX", r)
+}
+
+// glossaryViolations lists glossary terms found in the source name whose fixed
+// rendering is missing from a proposed translation
+func glossaryViolations(source string, lang string, translated string, glossary []Term) []string {
+	violations := []string{}
+	lowerSource := strings.ToLower(source)
+	for _, term := range sortedTerms(glossary, lang) {
+		if strings.Contains(lowerSource, strings.ToLower(term.Source)) && !strings.Contains(translated, term.Translations[lang]) {
+			violations = append(violations, term.Source)
+		}
+	}
+	return violations
+}
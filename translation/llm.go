@@ -0,0 +1,116 @@
+package translation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jimyeongjung/owlverload_api/llm"
+)
+
+// LLMTranslator asks the configured LLM for the names, with the glossary in the prompt
+type LLMTranslator struct {
+	provider llm.Provider
+}
+
+func NewLLMTranslator(provider llm.Provider) *LLMTranslator {
+	return &LLMTranslator{provider: provider}
+}
+
+func (t *LLMTranslator) Name() string {
+	return ModeLLM
+}
+
+type llmTranslationOutput struct {
+	Names map[string]string `json:"names"`
+	Notes string            `json:"notes"`
+}
+
+func (t *LLMTranslator) Translate(ctx context.Context, req Request) (Result, error) {
+	resp, err := t.provider.Chat(ctx, llm.ChatRequest{
+		Model:    llm.DefaultModel(),
+		JSONMode: true,
+		Messages: []llm.Message{
+			{
+				Role:    "system",
+				Content: "You translate grocery product names for shelf labels in a Korean/Japanese grocery store. Keep brand names, sizes and counts intact. Always use the store glossary rendering for any glossary term. Answer in JSON.",
+			},
+			{
+				Role:    "user",
+				Content: buildTranslationPrompt(req),
+			},
+		},
+	})
+	result := Result{Names: map[string]string{}, Model: resp.Model, Usage: resp.Usage}
+	if err != nil {
+		return result, err
+	}
+
+	content := strings.TrimSpace(resp.Content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	var output llmTranslationOutput
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &output); err != nil {
+		return result, fmt.Errorf("failed to parse translation: %v", err)
+	}
+
+	notes := []string{}
+	if output.Notes != "" {
+		notes = append(notes, output.Notes)
+	}
+	for _, lang := range req.Languages {
+		name := strings.TrimSpace(output.Names[lang])
+		if name == "" {
+			continue
+		}
+		// A name that ignores the glossary is left out rather than queued for review as is
+		if violations := glossaryViolations(req.Name, lang, name, req.Glossary); len(violations) > 0 {
+			notes = append(notes, fmt.Sprintf("%s dropped, %q ignores glossary terms: %s", lang, name, strings.Join(violations, ", ")))
+			continue
+		}
+		result.Names[lang] = name
+	}
+	result.Notes = strings.Join(notes, "; ")
+	return result, nil
+}
+
+func buildTranslationPrompt(req Request) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Product name: %s\n", req.Name)
+	for _, lang := range Languages {
+		if known := req.Known[lang]; known != "" {
+			fmt.Fprintf(&b, "Existing %s name: %s\n", languageNames[lang], known)
+		}
+	}
+
+	b.WriteString("\nTranslate the product name into:\n")
+	for _, lang := range req.Languages {
+		fmt.Fprintf(&b, "- %q: %s\n", lang, languageNames[lang])
+	}
+
+	glossaryLines := []string{}
+	for _, term := range req.Glossary {
+		renderings := []string{}
+		for _, lang := range req.Languages {
+			if v := term.Translations[lang]; v != "" {
+				renderings = append(renderings, fmt.Sprintf("%s=%s", lang, v))
+			}
+		}
+		if len(renderings) > 0 && strings.Contains(strings.ToLower(req.Name), strings.ToLower(term.Source)) {
+			glossaryLines = append(glossaryLines, fmt.Sprintf("- %s: %s", term.Source, strings.Join(renderings, ", ")))
+		}
+	}
+	if len(glossaryLines) > 0 {
+		b.WriteString("\nStore glossary (use these renderings exactly):\n")
+		b.WriteString(strings.Join(glossaryLines, "\n"))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(`
+Return JSON in this exact format, with one key per requested language code:
+{"names": {"eng": "", "kor": "", "jpn": "", "chn": ""}, "notes": ""}
+Leave a name empty if you cannot translate it with reasonable confidence, and explain in "notes".`)
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package translation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jimyeongjung/owlverload_api/llm"
+)
+
+// fakeProvider answers every chat with a fixed content
+type fakeProvider struct {
+	content string
+}
+
+func (p fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p fakeProvider) Chat(ctx context.Context, req llm.ChatRequest) (llm.ChatResponse, error) {
+	return llm.ChatResponse{Model: "fake-model", Content: p.content}, nil
+}
+
+func TestLLMTranslatorDropsGlossaryViolations(t *testing.T) {
+	translator := NewLLMTranslator(fakeProvider{content: `{"names": {"eng": "Farmer Heart Ramen 120g", "jpn": "農心ラーメン 120g"}, "notes": ""}`})
+	result, err := translator.Translate(context.Background(), Request{
+		Name:      "농심 라면 120g",
+		Languages: []string{LangEnglish, LangJapanese},
+		Glossary: []Term{
+			{Source: "농심", Translations: map[string]string{LangEnglish: "Nongshim", LangJapanese: "農心"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Translate: %v", err)
+	}
+	if _, ok := result.Names[LangEnglish]; ok {
+		t.Errorf("eng = %q, want it dropped for ignoring the glossary", result.Names[LangEnglish])
+	}
+	if got := result.Names[LangJapanese]; got != "農心ラーメン 120g" {
+		t.Errorf("jpn = %q, want the glossary-consistent name kept", got)
+	}
+	if !strings.Contains(result.Notes, "eng dropped") || !strings.Contains(result.Notes, "농심") {
+		t.Errorf("Notes = %q, want the dropped language and term", result.Notes)
+	}
+	if result.Model != "fake-model" {
+		t.Errorf("Model = %q, want the provider's model", result.Model)
+	}
+}
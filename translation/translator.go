@@ -0,0 +1,91 @@
+package translation
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jimyeongjung/owlverload_api/llm"
+)
+
+// Target languages, named after the items.name_* column suffixes
+const (
+	LangEnglish  = "eng"
+	LangKorean   = "kor"
+	LangJapanese = "jpn"
+	LangChinese  = "chn"
+)
+
+// Languages lists every supported target language in a fixed order
+var Languages = []string{LangEnglish, LangKorean, LangJapanese, LangChinese}
+
+var languageNames = map[string]string{
+	LangEnglish:  "English",
+	LangKorean:   "Korean",
+	LangJapanese: "Japanese",
+	LangChinese:  "Simplified Chinese",
+}
+
+// IsLanguage reports whether lang is a supported target language
+func IsLanguage(lang string) bool {
+	_, ok := languageNames[lang]
+	return ok
+}
+
+// Term is a glossary entry: a source term and its fixed rendering per language
+type Term struct {
+	Source       string
+	Translations map[string]string
+}
+
+// Request asks for the given languages of one product name
+type Request struct {
+	Name      string
+	Known     map[string]string // names already on the item, by language, used as context
+	Languages []string
+	Glossary  []Term
+}
+
+// Result holds the proposed names by language. Languages the translator could
+// not handle are left out rather than guessed.
+type Result struct {
+	Names map[string]string
+	Notes string
+	Model string
+	Usage llm.Usage
+}
+
+// Translator proposes product names in other languages
+type Translator interface {
+	Name() string
+	Translate(ctx context.Context, req Request) (Result, error)
+}
+
+// Modes accepted by NewTranslator
+const (
+	ModeLLM      = "llm"
+	ModeGlossary = "glossary"
+)
+
+// DefaultMode returns TRANSLATION_MODE, or "llm" when unset
+func DefaultMode() string {
+	if v := os.Getenv("TRANSLATION_MODE"); v != "" {
+		return v
+	}
+	return ModeLLM
+}
+
+// NewTranslator builds the translator for a mode. The provider is only needed for "llm".
+func NewTranslator(mode string, provider llm.Provider) (Translator, error) {
+	switch mode {
+	case ModeLLM:
+		if provider == nil {
+			return nil, llm.ErrNotConfigured
+		}
+		return NewLLMTranslator(provider), nil
+	case ModeGlossary:
+		return NewGlossaryTranslator(), nil
+	default:
+		return nil, fmt.Errorf("unknown translation mode %q", mode)
+	}
+}